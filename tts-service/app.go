@@ -1,10 +1,16 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/collections"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/idempotency"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/templates"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/web"
 	"os"
@@ -12,18 +18,104 @@ import (
 )
 
 func main() {
+	scrub := flag.Bool("scrub", false, "Verify all stored media, quarantine corrupted ones and exit")
+	reencrypt := flag.Bool("reencrypt", false, "Re-encrypt all stored data with the active master key and exit")
+	migrateLayout := flag.Bool("migrate-layout", false, "Move stored data into the sharded directory layout and exit")
+	migrateIds := flag.Bool("migrate-ids", false, "Copy stored data under the IDs of TTS_ID_STRATEGY and exit")
+	flag.Parse()
+
 	portStr := strconv.Itoa(port)
 
 	engine := tts.NewEngine()
 	persistence := service.NewPersistence()
-	controller := service.New(persistence, engine)
+	batchPersistence := service.NewBatchPersistence()
+	collectionStore := collections.NewStore()
+	idempotencyStore := idempotency.NewStore()
+	templateStore := templates.NewStore()
+	lexicons := lexicon.NewStore()
+	assetStore := assets.NewStore()
+
+	if *scrub {
+		runScrub(service.NewScrubber(persistence, engine))
+		return
+	}
+
+	if *reencrypt {
+		runReencrypt(persistence, engine, batchPersistence, collectionStore, idempotencyStore, templateStore, lexicons, assetStore)
+		return
+	}
+
+	if *migrateLayout {
+		runMigrateLayout(persistence, engine, batchPersistence, collectionStore, idempotencyStore, templateStore, lexicons, assetStore)
+		return
+	}
 
-	web.New(http.DefaultServeMux, controller, engine, selfUrl(portStr))
+	ids := service.NewIdStrategy()
+
+	if *migrateIds {
+		runMigrateIds(persistence, ids)
+		return
+	}
+
+	idempotencyStore.ExpireInBackground()
+
+	controller := service.New(persistence, engine, lexicons, assetStore, ids)
+	batches := service.NewBatches(batchPersistence, controller)
+
+	web.New(http.DefaultServeMux, web.Config{
+		Service:     controller,
+		Batches:     batches,
+		Engine:      engine,
+		Lexicons:    lexicons,
+		Assets:      assetStore,
+		Templates:   templateStore,
+		Collections: collectionStore,
+		Idempotency: idempotencyStore,
+		SelfUrl:     selfUrl(portStr),
+		Signer:      web.NewUrlSigner(),
+	})
 
 	log.Printf("Listening on port: %v", portStr)
 	log.Fatal(http.ListenAndServe(":"+portStr, nil))
 }
 
+func runScrub(scrubber service.Scrubber) {
+	report, err := scrubber.Scrub()
+	if err != nil {
+		log.Fatalf("Scrub failed: %v", err)
+	}
+
+	log.Printf("Scrub finished. Checked media: %d, corrupted (quarantined): %v, switched to ERROR: %v",
+		report.Checked, report.Corrupted, report.Failed)
+}
+
+func runReencrypt(persistence service.TtsPersistence, engine service.RotateEngine, stores ...service.RotateStore) {
+	report, err := service.Reencrypt(persistence, engine, stores...)
+	if err != nil {
+		log.Fatalf("Re-encryption failed: %v", err)
+	}
+
+	log.Printf("Re-encryption finished. Records: %d, media: %d, other objects: %d", report.Records, report.Media, report.Objects)
+}
+
+func runMigrateLayout(persistence service.TtsPersistence, engine service.MigrateEngine, stores ...service.MigrateStore) {
+	report, err := service.MigrateLayout(persistence, engine, stores...)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Migration finished. Records: %d, media files: %d, other objects: %d", report.Records, report.Media, report.Objects)
+}
+
+func runMigrateIds(persistence service.TtsPersistence, ids service.IdStrategy) {
+	report, err := service.MigrateIds(persistence, ids)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	log.Printf("Migration to %s IDs finished. Records: %d, copied: %d, skipped: %d", ids.Name(), report.Records, report.Copied, report.Skipped)
+}
+
 func selfUrl(port string) string {
 	selfUrl := os.Getenv("SERVICE_SELF_URL")
 
@@ -0,0 +1,151 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+)
+
+// Asset is an audio file of a tenant, e.g. background music or a jingle mixed with the speech
+type Asset struct {
+	Tenant   string
+	Name     string
+	Size     int64
+	Checksum string // hex encoded SHA-256 of the content, changed whenever the asset is replaced
+}
+
+// Store keeps assets in files, one per tenant and name: <tenant>/<name>.wav, see filestore
+type Store struct {
+	files *filestore.Store
+}
+
+// NewStore creates a store in the ASSETS_BASE_DIR directory.
+func NewStore() *Store {
+
+	return &Store{files: filestore.NewStore("ASSETS_BASE_DIR", "assets")}
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidName tells if the asset name is safe to be used as a file name.
+func ValidName(name string) bool {
+
+	return namePattern.MatchString(name)
+}
+
+// List returns the assets of the tenant, sorted by name.
+func (s *Store) List(tenant string) ([]Asset, error) {
+
+	files, err := s.files.In(tenant).List(extension)
+
+	if err != nil {
+		return nil, err
+	}
+
+	assets := []Asset{}
+
+	for _, file := range files {
+
+		name := strings.TrimSuffix(file, extension)
+		if !ValidName(name) {
+			continue
+		}
+
+		asset, _, err := s.Get(tenant, name)
+		if err != nil {
+			return nil, err
+		}
+
+		assets = append(assets, asset)
+	}
+
+	sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+
+	return assets, nil
+}
+
+// Get returns the asset of the tenant along with its content.
+// It returns NotFoundError if there's no such asset, or another error, if any.
+func (s *Store) Get(tenant, name string) (Asset, []byte, error) {
+
+	content, err := s.files.In(tenant).Read(name + extension)
+
+	if os.IsNotExist(err) {
+		return Asset{}, nil, NotFound(name)
+	}
+
+	if err != nil {
+		return Asset{}, nil, err
+	}
+
+	return describe(tenant, name, content), content, nil
+}
+
+// Put adds the asset, or replaces the asset of the same name.
+// It returns the asset or an error, if any.
+func (s *Store) Put(tenant, name string, content []byte) (Asset, error) {
+
+	// Readers never see a partially written asset, even if it's uploaded twice at the same time
+	if err := s.files.In(tenant).Write(name+extension, content); err != nil {
+		return Asset{}, err
+	}
+
+	return describe(tenant, name, content), nil
+}
+
+// Delete removes the asset.
+// It returns NotFoundError if there's no such asset, or another error, if any.
+func (s *Store) Delete(tenant, name string) error {
+
+	err := s.files.In(tenant).Remove(name + extension)
+
+	if os.IsNotExist(err) {
+		return NotFound(name)
+	}
+
+	return err
+}
+
+// Rotate re-encrypts the assets with the active master key.
+// It returns the number of re-encrypted assets and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	return s.files.Rotate()
+}
+
+// Migrate moves the assets stored in flat directories into the sharded layout.
+// It returns the number of moved assets and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	return s.files.Migrate()
+}
+
+// Only WAV assets can be mixed
+const extension = ".wav"
+
+func describe(tenant, name string, content []byte) Asset {
+
+	checksum := sha256.Sum256(content)
+
+	return Asset{Tenant: tenant, Name: name, Size: int64(len(content)), Checksum: hex.EncodeToString(checksum[:])}
+}
+
+// NotFoundError is returned when the asset doesn't exist
+type NotFoundError struct {
+	Message string
+}
+
+func (err NotFoundError) Error() string {
+
+	return err.Message
+}
+
+func NotFound(name string) NotFoundError {
+
+	return NotFoundError{"Asset '" + name + "' doesn't exist"}
+}
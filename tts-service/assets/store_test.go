@@ -0,0 +1,84 @@
+package assets
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("Asset store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "assets")
+		defer os.RemoveAll(dir)
+
+		store := &Store{files: filestore.New(dir, &envelope.Keyring{})}
+
+		Convey("should return no assets of a new tenant", func() {
+
+			assets, err := store.List("acme")
+
+			So(err, ShouldBeNil)
+			So(assets, ShouldResemble, []Asset{})
+		})
+
+		Convey("should put and get assets", func() {
+
+			asset, err := store.Put("acme", "jingle", []byte("RIFF"))
+
+			So(err, ShouldBeNil)
+			So(asset.Name, ShouldEqual, "jingle")
+			So(asset.Size, ShouldEqual, 4)
+
+			stored, content, err := store.Get("acme", "jingle")
+
+			So(err, ShouldBeNil)
+			So(stored, ShouldResemble, asset)
+			So(string(content), ShouldEqual, "RIFF")
+		})
+
+		Convey("should change the checksum of replaced assets", func() {
+
+			first, _ := store.Put("acme", "jingle", []byte("RIFF1"))
+			second, _ := store.Put("acme", "jingle", []byte("RIFF2"))
+
+			So(second.Checksum, ShouldNotEqual, first.Checksum)
+
+			assets, _ := store.List("acme")
+			So(assets, ShouldResemble, []Asset{second})
+		})
+
+		Convey("should keep assets of tenants apart", func() {
+
+			store.Put("acme", "music", []byte("RIFF"))
+			store.Put("acme", "jingle", []byte("RIFF"))
+			store.Put("other", "music", []byte("RIFF"))
+
+			assets, _ := store.List("acme")
+			So(assets, ShouldHaveLength, 2)
+			So(assets[0].Name, ShouldEqual, "jingle")
+
+			_, _, err := store.Get("other", "jingle")
+			So(err, ShouldHaveSameTypeAs, NotFoundError{})
+		})
+
+		Convey("should delete assets", func() {
+
+			store.Put("acme", "jingle", []byte("RIFF"))
+
+			So(store.Delete("acme", "jingle"), ShouldBeNil)
+			So(store.Delete("acme", "jingle"), ShouldResemble, NotFound("jingle"))
+		})
+	})
+
+	Convey("Name validation", t, func() {
+
+		So(ValidName("intro_2"), ShouldBeTrue)
+		So(ValidName("../secret"), ShouldBeFalse)
+		So(ValidName(""), ShouldBeFalse)
+	})
+}
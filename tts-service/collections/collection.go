@@ -0,0 +1,84 @@
+package collections
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collection is a playlist of voice messages, e.g. daily bulletins, published as a podcast feed.
+// Collections are public, anyone knowing their IDs can read their feeds.
+// They're changed by their Tenant only, who publishes its own voice messages in them.
+type Collection struct {
+	Id          string
+	Tenant      string
+	Title       string
+	Description string
+	Language    string
+	Author      string
+	Items       []Item // In the order of publishing
+	Created     time.Time
+	Updated     time.Time
+}
+
+// Item is a voice message of a collection, published when it was added.
+// Title is the title of the episode, the beginning of the text of the voice message if empty.
+type Item struct {
+	Id    string
+	Title string
+	Added time.Time
+}
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidId tells if the collection ID is safe to be used as a file name.
+func ValidId(id string) bool {
+
+	return idPattern.MatchString(id)
+}
+
+// Validate returns problems of the collection, if any.
+func (c Collection) Validate() []string {
+
+	problems := []string{}
+
+	if strings.TrimSpace(c.Title) == "" {
+		problems = append(problems, "Title must not be empty")
+	}
+
+	if len(c.Title) > maxTitleSize || len(c.Author) > maxTitleSize {
+		problems = append(problems, "Title and Author must not be longer than "+strconv.Itoa(maxTitleSize)+" bytes")
+	}
+
+	if len(c.Description) > maxDescriptionSize {
+		problems = append(problems, "Description must not be longer than "+strconv.Itoa(maxDescriptionSize)+" bytes")
+	}
+
+	if len(c.Items) > MaxItems {
+		problems = append(problems, "Collection can't have more than "+strconv.Itoa(MaxItems)+" items")
+	}
+
+	added := map[string]bool{}
+
+	for _, item := range c.Items {
+
+		if added[item.Id] {
+			problems = append(problems, "Item "+item.Id+" is added more than once")
+		}
+
+		if len(item.Title) > maxTitleSize {
+			problems = append(problems, "Title of item "+item.Id+" must not be longer than "+strconv.Itoa(maxTitleSize)+" bytes")
+		}
+
+		added[item.Id] = true
+	}
+
+	return problems
+}
+
+// MaxItems is the number of items a collection can have
+const MaxItems = 1000
+
+const maxTitleSize = 200
+const maxDescriptionSize = 4000
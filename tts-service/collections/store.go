@@ -0,0 +1,215 @@
+package collections
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+)
+
+// Store keeps collections in files, one per ID: <id>.json, see filestore
+type Store struct {
+	files *filestore.Store
+	lock  sync.Mutex // Items are added to the collections read before
+}
+
+// NewStore creates a store in the COLLECTIONS_BASE_DIR directory.
+func NewStore() *Store {
+
+	return &Store{files: filestore.NewStore("COLLECTIONS_BASE_DIR", "collections")}
+}
+
+// Get returns the collection.
+// It returns NotFoundError if there's no such collection, or another error, if any.
+func (s *Store) Get(id string) (Collection, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.read(id)
+}
+
+// Put adds the collection, or replaces the collection of the same ID and tenant.
+// Items that were in the collection before keep the times they were added at, the others are added now.
+// It returns OwnerError if the collection is owned by another tenant, or the stored collection and an error, if any.
+func (s *Store) Put(c Collection) (Collection, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	c.Created, c.Updated = now, now
+
+	previous, err := s.read(c.Id)
+
+	switch err.(type) {
+	case nil:
+		if previous.Tenant != c.Tenant {
+			return c, OwnedBy(c.Id)
+		}
+		c.Created = previous.Created
+	case NotFoundError:
+	default:
+		return c, err
+	}
+
+	added := map[string]time.Time{}
+	for _, item := range previous.Items {
+		added[item.Id] = item.Added
+	}
+
+	items := []Item{}
+	for _, item := range c.Items {
+
+		item.Added = now
+		if at, ok := added[item.Id]; ok {
+			item.Added = at
+		}
+
+		items = append(items, item)
+	}
+
+	c.Items = items
+
+	return c, s.write(c)
+}
+
+// Add adds the item to the end of the collection of the tenant, or updates its title if it's there already.
+// It returns NotFoundError if there's no such collection, OwnerError if it's owned by another tenant, or another error, if any.
+func (s *Store) Add(id, tenant string, item Item) (Collection, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, err := s.read(id)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Tenant != tenant {
+		return c, OwnedBy(id)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	c.Updated = now
+
+	for i := range c.Items {
+
+		if c.Items[i].Id == item.Id {
+
+			c.Items[i].Title = item.Title
+			return c, s.write(c)
+		}
+	}
+
+	if len(c.Items) >= MaxItems {
+		return c, FullError{"Collection '" + id + "' can't have more than " + strconv.Itoa(MaxItems) + " items"}
+	}
+
+	item.Added = now
+	c.Items = append(c.Items, item)
+
+	return c, s.write(c)
+}
+
+// Delete removes the collection of the tenant.
+// It returns NotFoundError if there's no such collection, OwnerError if it's owned by another tenant, or another error, if any.
+func (s *Store) Delete(id, tenant string) error {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, err := s.read(id)
+	if err != nil {
+		return err
+	}
+
+	if c.Tenant != tenant {
+		return OwnedBy(id)
+	}
+
+	err = s.files.Remove(id + extension)
+
+	if os.IsNotExist(err) {
+		return NotFound(id)
+	}
+
+	return err
+}
+
+// Rotate re-encrypts the collections with the active master key.
+// It returns the number of re-encrypted collections and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	return s.files.Rotate()
+}
+
+// Migrate moves the collections stored in a flat directory into the sharded layout.
+// It returns the number of moved collections and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	return s.files.Migrate()
+}
+
+func (s *Store) read(id string) (Collection, error) {
+
+	c := Collection{}
+
+	err := s.files.ReadJSON(id+extension, &c)
+
+	if os.IsNotExist(err) {
+		return c, NotFound(id)
+	}
+
+	return c, err
+}
+
+// Feeds are never read from a partially written collection
+func (s *Store) write(c Collection) error {
+
+	return s.files.WriteJSON(c.Id+extension, c)
+}
+
+const extension = ".json"
+
+// NotFoundError is returned when the collection doesn't exist
+type NotFoundError struct {
+	Message string
+}
+
+func (err NotFoundError) Error() string {
+
+	return err.Message
+}
+
+func NotFound(id string) NotFoundError {
+
+	return NotFoundError{"Collection '" + id + "' doesn't exist"}
+}
+
+// FullError is returned when an item is added to a collection that has MaxItems already
+type FullError struct {
+	Message string
+}
+
+func (err FullError) Error() string {
+
+	return err.Message
+}
+
+// OwnerError is returned when a collection of another tenant is changed
+type OwnerError struct {
+	Message string
+}
+
+func (err OwnerError) Error() string {
+
+	return err.Message
+}
+
+func OwnedBy(id string) OwnerError {
+
+	return OwnerError{"Collection '" + id + "' is owned by another tenant"}
+}
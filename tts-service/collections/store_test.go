@@ -0,0 +1,109 @@
+package collections
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("Collection store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "collections")
+		defer os.RemoveAll(dir)
+
+		store := &Store{files: filestore.New(dir, &envelope.Keyring{})}
+		bulletins := Collection{Id: "bulletins", Tenant: "acme", Title: "Daily bulletins", Language: "EN", Items: []Item{{Id: "abc"}}}
+
+		Convey("should put and get collections", func() {
+
+			stored, err := store.Put(bulletins)
+
+			So(err, ShouldBeNil)
+			So(stored.Created, ShouldNotEqual, time.Time{})
+			So(stored.Items[0].Added, ShouldEqual, stored.Created)
+
+			got, err := store.Get("bulletins")
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, stored)
+		})
+
+		Convey("should keep the times items were added at", func() {
+
+			stored, _ := store.Put(bulletins)
+			added := stored.Items[0].Added.Add(-time.Hour)
+			stored.Items[0].Added = added
+			store.write(stored)
+
+			bulletins.Items = append(bulletins.Items, Item{Id: "def"})
+			stored, _ = store.Put(bulletins)
+
+			So(stored.Items[0].Added, ShouldEqual, added)
+			So(stored.Items[1].Added, ShouldHappenAfter, added)
+		})
+
+		Convey("should add items to the end of collections", func() {
+
+			store.Put(bulletins)
+
+			stored, err := store.Add("bulletins", "acme", Item{Id: "def", Title: "Tuesday"})
+			So(err, ShouldBeNil)
+			So(stored.Items, ShouldHaveLength, 2)
+			So(stored.Items[1].Title, ShouldEqual, "Tuesday")
+
+			stored, _ = store.Add("bulletins", "acme", Item{Id: "def", Title: "Wednesday"})
+			So(stored.Items, ShouldHaveLength, 2)
+			So(stored.Items[1].Title, ShouldEqual, "Wednesday")
+
+			_, err = store.Add("other", "acme", Item{Id: "def"})
+			So(err, ShouldResemble, NotFound("other"))
+		})
+
+		Convey("should delete collections", func() {
+
+			store.Put(bulletins)
+
+			So(store.Delete("bulletins", "acme"), ShouldBeNil)
+			So(store.Delete("bulletins", "acme"), ShouldResemble, NotFound("bulletins"))
+
+			_, err := store.Get("bulletins")
+			So(err, ShouldResemble, NotFound("bulletins"))
+		})
+
+		Convey("should change collections of their tenants only", func() {
+
+			store.Put(bulletins)
+
+			other := bulletins
+			other.Tenant = "globex"
+
+			_, err := store.Put(other)
+			So(err, ShouldResemble, OwnedBy("bulletins"))
+
+			_, err = store.Add("bulletins", "globex", Item{Id: "def"})
+			So(err, ShouldResemble, OwnedBy("bulletins"))
+
+			So(store.Delete("bulletins", "globex"), ShouldResemble, OwnedBy("bulletins"))
+
+			got, _ := store.Get("bulletins")
+			So(got.Items, ShouldHaveLength, 1)
+		})
+
+		Convey("should validate collections", func() {
+
+			So(bulletins.Validate(), ShouldBeEmpty)
+
+			bulletins.Title = " "
+			bulletins.Items = append(bulletins.Items, Item{Id: "abc"})
+			So(bulletins.Validate(), ShouldResemble, []string{"Title must not be empty", "Item abc is added more than once"})
+
+			So(ValidId("daily-bulletins_2"), ShouldBeTrue)
+			So(ValidId("../x"), ShouldBeFalse)
+		})
+	})
+}
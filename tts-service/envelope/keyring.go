@@ -0,0 +1,707 @@
+// Package envelope implements envelope encryption of data at rest.
+//
+// Every object is encrypted (AES-GCM) with its own, random data key.
+// The data key is encrypted with a master key and stored together with the object,
+// so that rotating the master key only requires re-encrypting the data keys.
+//
+// Objects are encrypted in segments, so that large ones (e.g. media) are streamed rather than held in memory.
+package envelope
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keyring holds master keys.
+// The first key is the active one, used for encryption. All the keys can be used for decryption.
+// An empty Keyring doesn't encrypt at all.
+type Keyring struct {
+	activeId string
+	keys     map[string][]byte
+}
+
+// NewKeyring loads master keys from ENCRYPTION_MASTER_KEY_FILE or ENCRYPTION_MASTER_KEY environment variables.
+// If neither is provided, the returned Keyring is empty and data is stored unencrypted.
+func NewKeyring() (*Keyring, error) {
+
+	value := os.Getenv("ENCRYPTION_MASTER_KEY")
+
+	if path := os.Getenv("ENCRYPTION_MASTER_KEY_FILE"); len(path) != 0 {
+
+		content, err := ioutil.ReadFile(path)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		value = string(content)
+	}
+
+	if len(strings.TrimSpace(value)) == 0 {
+
+		log.Printf("ENCRYPTION_MASTER_KEY(_FILE) not provided. Data is stored unencrypted")
+		return &Keyring{}, nil
+	}
+
+	return ParseKeyring(value)
+}
+
+// ParseKeyring reads master keys, one per line, in the "<key ID>:<base64 encoded 32 byte key>" format.
+// The key ID may be omitted if there is only one key. The first key is the active one.
+func ParseKeyring(value string) (*Keyring, error) {
+
+	k := &Keyring{keys: map[string][]byte{}}
+
+	for _, line := range strings.Split(value, "\n") {
+
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id := defaultKeyId
+		encoded := line
+
+		if i := strings.LastIndex(line, ":"); i >= 0 {
+			id, encoded = line[:i], line[i+1:]
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+
+		if err != nil || len(key) != keySize {
+
+			return nil, fmt.Errorf("Invalid master key '%s': expected base64 encoded %d bytes", id, keySize)
+		}
+
+		if len(id) == 0 || len(id) > 255 {
+
+			return nil, fmt.Errorf("Invalid master key ID '%s'", id)
+		}
+
+		if _, ok := k.keys[id]; ok {
+
+			return nil, fmt.Errorf("Duplicated master key ID '%s'", id)
+		}
+
+		if len(k.keys) == 0 {
+			k.activeId = id
+		}
+		k.keys[id] = key
+	}
+
+	return k, nil
+}
+
+// Enabled tells whether the Keyring encrypts data.
+func (k *Keyring) Enabled() bool {
+
+	return k != nil && len(k.keys) > 0
+}
+
+// Seal encrypts the data with a new data key, protected by the active master key.
+// It returns the data unchanged if the Keyring is empty.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+
+	if !k.Enabled() {
+
+		return plaintext, nil
+	}
+
+	sealed := &bytes.Buffer{}
+	writer, err := k.NewWriter(sealed)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if _, err = writer.Write(plaintext); err != nil {
+
+		return nil, err
+	}
+
+	if err = writer.Close(); err != nil {
+
+		return nil, err
+	}
+
+	return sealed.Bytes(), nil
+}
+
+// Open decrypts the data sealed with any of the master keys.
+// Data which isn't sealed (stored before the encryption was enabled) is returned unchanged.
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+
+	if !IsSealed(data) {
+
+		return data, nil
+	}
+
+	reader, err := k.NewReader(bytes.NewReader(data))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return ioutil.ReadAll(reader)
+}
+
+// NewWriter returns a writer encrypting the data written to it with a new data key, protected by the active master key.
+// The data is written to w in segments, the last one when the writer is closed. Closing the writer doesn't close w.
+// If the Keyring is empty, the data is written unchanged.
+func (k *Keyring) NewWriter(w io.Writer) (io.WriteCloser, error) {
+
+	if !k.Enabled() {
+
+		return nopCloser{w}, nil
+	}
+
+	dataKey := make([]byte, keySize)
+
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+
+		return nil, err
+	}
+
+	wrappedKey, err := seal(k.keys[k.activeId], dataKey, []byte(k.activeId))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+
+		return nil, err
+	}
+
+	aead, err := newAead(dataKey)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if _, err = w.Write(header(k.activeId, wrappedKey, prefix)); err != nil {
+
+		return nil, err
+	}
+
+	return &segmentWriter{w: w, aead: aead, prefix: prefix}, nil
+}
+
+// NewReader returns a reader decrypting the data read from r, sealed with any of the master keys.
+// Segments are authenticated as they're read, the reader fails with ErrCorrupted on the first damaged one.
+// Data which isn't sealed (stored before the encryption was enabled) is read unchanged.
+func (k *Keyring) NewReader(r io.Reader) (io.Reader, error) {
+
+	src := bufio.NewReaderSize(r, segmentSize+tagSize+1)
+	head, _ := src.Peek(maxHeaderSize)
+
+	if !IsSealed(head) {
+
+		return src, nil
+	}
+
+	id, headerSize, err := parseHeader(head)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	dataKey, err := k.unwrap(id, head)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	aead, err := newAead(dataKey)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	prefix := append([]byte{}, head[headerSize-noncePrefixSize:headerSize]...)
+	src.Discard(headerSize)
+
+	return &segmentReader{src: src, aead: aead, prefix: prefix}, nil
+}
+
+// NeedsRotation tells whether the data should be re-encrypted with the active master key.
+// It's enough to pass the beginning of the data, see RotateFile.
+func (k *Keyring) NeedsRotation(data []byte) bool {
+
+	if !IsSealed(data) {
+
+		return k.Enabled()
+	}
+
+	id, _, err := parseHeader(data)
+
+	return err == nil && id != k.activeId
+}
+
+// IsSealed tells whether the data has been encrypted by a Keyring.
+func IsSealed(data []byte) bool {
+
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// ReadFile reads the file and decrypts its content.
+func (k *Keyring) ReadFile(path string) ([]byte, error) {
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return k.Open(data)
+}
+
+// OpenFile opens the file for reading, its content is decrypted as it's read.
+func (k *Keyring) OpenFile(path string) (io.ReadCloser, error) {
+
+	file, err := os.Open(path)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	reader, err := k.NewReader(file)
+
+	if err != nil {
+
+		file.Close()
+		return nil, err
+	}
+
+	return readCloser{reader, file}, nil
+}
+
+// RotateFile re-encrypts the file with the active master key, if needed.
+// Only the data key of sealed data is re-encrypted, data stored before the encryption was enabled is sealed.
+// The file is replaced atomically, so it can be done while the service is running,
+// as long as the writers of the file are kept away, e.g. with layout.Locks.
+// It returns true if the file has been rewritten, and an error, if any.
+func (k *Keyring) RotateFile(path string) (bool, error) {
+
+	if !k.Enabled() {
+
+		return false, errNoKeys
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+
+		return false, err
+	}
+
+	defer file.Close()
+
+	src := bufio.NewReaderSize(file, maxHeaderSize)
+	head, err := src.Peek(maxHeaderSize)
+
+	if err != nil && err != io.EOF {
+
+		return false, err
+	}
+
+	if !k.NeedsRotation(head) {
+
+		return false, nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+
+	if err != nil {
+
+		return false, err
+	}
+
+	if IsSealed(head) {
+		err = k.rewrap(src, head, tmp)
+	} else {
+		err = k.sealStream(src, tmp)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+
+	if err != nil {
+
+		os.Remove(tmp.Name())
+		return false, err
+	}
+
+	return true, nil
+}
+
+// rewrap copies the sealed data with its data key re-encrypted with the active master key
+func (k *Keyring) rewrap(src *bufio.Reader, head []byte, dst io.Writer) error {
+
+	id, headerSize, err := parseHeader(head)
+
+	if err != nil {
+
+		return err
+	}
+
+	dataKey, err := k.unwrap(id, head)
+
+	if err != nil {
+
+		return err
+	}
+
+	wrappedKey, err := seal(k.keys[k.activeId], dataKey, []byte(k.activeId))
+
+	if err != nil {
+
+		return err
+	}
+
+	if _, err = dst.Write(header(k.activeId, wrappedKey, head[headerSize-noncePrefixSize:headerSize])); err != nil {
+
+		return err
+	}
+
+	if _, err = src.Discard(headerSize); err != nil {
+
+		return err
+	}
+
+	// Segments don't depend on the master key
+	_, err = io.Copy(dst, src)
+
+	return err
+}
+
+// sealStream seals the unencrypted data with a new data key
+func (k *Keyring) sealStream(src io.Reader, dst io.Writer) error {
+
+	writer, err := k.NewWriter(dst)
+
+	if err != nil {
+
+		return err
+	}
+
+	if _, err = io.Copy(writer, src); err != nil {
+
+		return err
+	}
+
+	return writer.Close()
+}
+
+// parseHeader returns the master key ID and the size of the header of the sealed data
+func parseHeader(data []byte) (string, int, error) {
+
+	if len(data) < len(magic)+1 {
+
+		return "", 0, ErrCorrupted
+	}
+
+	idSize := int(data[len(magic)])
+	idEnd := len(magic) + 1 + idSize
+	headerSize := idEnd + wrappedKeySize + noncePrefixSize
+
+	if len(data) < headerSize {
+
+		return "", 0, ErrCorrupted
+	}
+
+	return string(data[len(magic)+1 : idEnd]), headerSize, nil
+}
+
+// header returns the header of sealed data: magic, key ID, wrapped data key and nonce prefix
+func header(id string, wrappedKey []byte, prefix []byte) []byte {
+
+	header := bytes.NewBufferString(magic)
+	header.WriteByte(byte(len(id)))
+	header.WriteString(id)
+	header.Write(wrappedKey)
+	header.Write(prefix)
+
+	return header.Bytes()
+}
+
+// unwrap decrypts the data key of the sealed data with the master key of the given ID
+func (k *Keyring) unwrap(id string, data []byte) ([]byte, error) {
+
+	if !k.Enabled() {
+
+		return nil, errNoKeys
+	}
+
+	masterKey, ok := k.keys[id]
+
+	if !ok {
+
+		return nil, fmt.Errorf("Unknown master key '%s'", id)
+	}
+
+	idEnd := len(magic) + 1 + len(id)
+
+	return open(masterKey, data[idEnd:idEnd+wrappedKeySize], []byte(id))
+}
+
+// segmentWriter seals the data written to it in segments of segmentSize bytes.
+// A segment is sealed once the next one is started, the last one is sealed on Close.
+type segmentWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buffer  []byte
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+
+	written := len(p)
+
+	for len(p) > 0 {
+
+		if len(sw.buffer) == segmentSize {
+
+			if err := sw.flush(false); err != nil {
+
+				return 0, err
+			}
+		}
+
+		n := segmentSize - len(sw.buffer)
+		if n > len(p) {
+			n = len(p)
+		}
+
+		sw.buffer = append(sw.buffer, p[:n]...)
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (sw *segmentWriter) Close() error {
+
+	return sw.flush(true)
+}
+
+func (sw *segmentWriter) flush(last bool) error {
+
+	sealed := sw.aead.Seal(nil, nonce(sw.prefix, sw.counter, last), sw.buffer, nil)
+	sw.counter++
+	sw.buffer = sw.buffer[:0]
+
+	_, err := sw.w.Write(sealed)
+
+	return err
+}
+
+// segmentReader opens the segments read from src.
+// The last segment is marked, so that data truncated at a segment boundary is detected as well.
+type segmentReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buffer  []byte
+	done    bool
+}
+
+func (sr *segmentReader) Read(p []byte) (int, error) {
+
+	for len(sr.buffer) == 0 {
+
+		if sr.done {
+
+			return 0, io.EOF
+		}
+
+		if err := sr.next(); err != nil {
+
+			return 0, err
+		}
+	}
+
+	n := copy(p, sr.buffer)
+	sr.buffer = sr.buffer[n:]
+
+	return n, nil
+}
+
+func (sr *segmentReader) next() error {
+
+	sealed := make([]byte, segmentSize+tagSize)
+	n, err := io.ReadFull(sr.src, sealed)
+
+	switch err {
+	case nil:
+		_, err = sr.src.Peek(1)
+		sr.done = err == io.EOF
+	case io.ErrUnexpectedEOF:
+		sr.done = true
+	case io.EOF:
+		// The last segment is missing
+		return ErrCorrupted
+	default:
+		return err
+	}
+
+	plaintext, err := sr.aead.Open(sealed[:0], nonce(sr.prefix, sr.counter, sr.done), sealed[:n], nil)
+
+	if err != nil {
+
+		return ErrCorrupted
+	}
+
+	sr.counter++
+	sr.buffer = plaintext
+
+	return nil
+}
+
+// nonce of a segment: the random prefix of the object, the segment number and the last segment flag
+func nonce(prefix []byte, counter uint32, last bool) []byte {
+
+	nonce := make([]byte, noncePrefixSize, nonceSize)
+	copy(nonce, prefix)
+	nonce = append(nonce, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+
+	return nonce
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// seal encrypts with AES-GCM, the random nonce is prepended to the result
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+
+	aead, err := newAead(key)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+
+	aead, err := newAead(key)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+
+		return nil, ErrCorrupted
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+
+	if err != nil {
+
+		return nil, ErrCorrupted
+	}
+
+	return plaintext, nil
+}
+
+func newAead(key []byte) (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ErrCorrupted is returned when the sealed data has been damaged or tampered with
+var ErrCorrupted = errors.New("Encrypted data is corrupted")
+
+var errNoKeys = errors.New("No master key provided")
+
+// Marks the sealed data
+const magic = "TTSENC1\x00"
+
+// AES-256
+const keySize = 32
+
+// Nonce, encrypted data key and GCM tag
+const wrappedKeySize = nonceSize + keySize + tagSize
+
+const nonceSize = 12
+const tagSize = 16
+
+// Nonces of segments start with a random prefix, followed by the segment number (4 bytes) and the last segment flag
+const noncePrefixSize = nonceSize - 5
+
+// Plaintext bytes in a segment, all the segments but the last one are full
+const segmentSize = 64 * 1024
+
+// Enough to read the header of any sealed data
+const maxHeaderSize = len(magic) + 1 + 255 + wrappedKeySize + noncePrefixSize
+
+// Used when the key ID is omitted
+const defaultKeyId = "default"
@@ -0,0 +1,208 @@
+package envelope
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyring(t *testing.T) {
+
+	Convey("Keyring", t, func(c C) {
+
+		plaintext := []byte("This is just a simple test")
+
+		Convey("should encrypt and decrypt data", func() {
+
+			keyring, err := ParseKeyring(testKey1)
+			So(err, ShouldBeNil)
+
+			sealed, err := keyring.Seal(plaintext)
+			So(err, ShouldBeNil)
+			So(IsSealed(sealed), ShouldBeTrue)
+			So(bytes.Contains(sealed, plaintext), ShouldBeFalse)
+
+			opened, err := keyring.Open(sealed)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+		})
+
+		Convey("should use a new data key for every object", func() {
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			sealed1, _ := keyring.Seal(plaintext)
+			sealed2, _ := keyring.Seal(plaintext)
+
+			So(sealed1, ShouldNotResemble, sealed2)
+		})
+
+		Convey("should pass data through if there are no keys", func() {
+
+			keyring, err := ParseKeyring("")
+			So(err, ShouldBeNil)
+			So(keyring.Enabled(), ShouldBeFalse)
+
+			sealed, _ := keyring.Seal(plaintext)
+			So(sealed, ShouldResemble, plaintext)
+		})
+
+		Convey("should read data stored before the encryption was enabled", func() {
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			opened, err := keyring.Open(plaintext)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+			So(keyring.NeedsRotation(plaintext), ShouldBeTrue)
+		})
+
+		Convey("should detect tampered data", func() {
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			sealed, _ := keyring.Seal(plaintext)
+			sealed[len(sealed)-1] ^= 0xff
+
+			_, err := keyring.Open(sealed)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should stream data in segments", func() {
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			for _, size := range []int{0, segmentSize, 2*segmentSize + 100} {
+
+				large := bytes.Repeat([]byte("x"), size)
+				sealed := &bytes.Buffer{}
+
+				writer, err := keyring.NewWriter(sealed)
+				So(err, ShouldBeNil)
+				writer.Write(large[:size/3])
+				writer.Write(large[size/3:])
+				So(writer.Close(), ShouldBeNil)
+
+				reader, err := keyring.NewReader(bytes.NewReader(sealed.Bytes()))
+				So(err, ShouldBeNil)
+
+				opened, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(opened, ShouldResemble, large)
+			}
+		})
+
+		Convey("should detect data truncated at a segment boundary", func() {
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			sealed, _ := keyring.Seal(bytes.Repeat([]byte("x"), 2*segmentSize))
+			_, headerSize, _ := parseHeader(sealed)
+
+			_, err := keyring.Open(sealed[:headerSize+segmentSize+tagSize])
+			So(err, ShouldEqual, ErrCorrupted)
+		})
+
+		Convey("should reject invalid keys", func() {
+
+			_, err := ParseKeyring("k1:dG9vIHNob3J0")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should decrypt data sealed with a rotated key", func() {
+
+			oldKeyring, _ := ParseKeyring(testKey1)
+			newKeyring, _ := ParseKeyring(testKey2 + "\n" + testKey1)
+
+			sealed, _ := oldKeyring.Seal(plaintext)
+			So(newKeyring.NeedsRotation(sealed), ShouldBeTrue)
+
+			opened, err := newKeyring.Open(sealed)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+		})
+
+		Convey("should re-encrypt files with the active key", func() {
+
+			dir, _ := ioutil.TempDir("", "envelope")
+			defer os.RemoveAll(dir)
+			path := dir + string(os.PathSeparator) + "test"
+
+			oldKeyring, _ := ParseKeyring(testKey1)
+			newKeyring, _ := ParseKeyring(testKey2 + "\n" + testKey1)
+
+			sealed, _ := oldKeyring.Seal(plaintext)
+			ioutil.WriteFile(path, sealed, 0600)
+
+			rotated, err := newKeyring.RotateFile(path)
+			So(err, ShouldBeNil)
+			So(rotated, ShouldBeTrue)
+
+			rotated, err = newKeyring.RotateFile(path)
+			So(err, ShouldBeNil)
+			So(rotated, ShouldBeFalse)
+
+			_, err = oldKeyring.ReadFile(path)
+			So(err, ShouldNotBeNil)
+
+			opened, err := newKeyring.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+		})
+
+		Convey("should re-encrypt only the data keys", func() {
+
+			dir, _ := ioutil.TempDir("", "envelope")
+			defer os.RemoveAll(dir)
+			path := dir + string(os.PathSeparator) + "test"
+
+			oldKeyring, _ := ParseKeyring(testKey1)
+			newKeyring, _ := ParseKeyring(testKey2 + "\n" + testKey1)
+
+			sealed, _ := oldKeyring.Seal(plaintext)
+			ioutil.WriteFile(path, sealed, 0600)
+
+			rotated, err := newKeyring.RotateFile(path)
+			So(err, ShouldBeNil)
+			So(rotated, ShouldBeTrue)
+
+			stored, _ := ioutil.ReadFile(path)
+			_, headerSize, _ := parseHeader(stored)
+			_, oldHeaderSize, _ := parseHeader(sealed)
+			So(stored[headerSize:], ShouldResemble, sealed[oldHeaderSize:])
+			So(newKeyring.NeedsRotation(stored), ShouldBeFalse)
+
+			opened, err := newKeyring.Open(stored)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+		})
+
+		Convey("should seal files stored before the encryption was enabled", func() {
+
+			dir, _ := ioutil.TempDir("", "envelope")
+			defer os.RemoveAll(dir)
+			path := dir + string(os.PathSeparator) + "test"
+
+			keyring, _ := ParseKeyring(testKey1)
+
+			ioutil.WriteFile(path, plaintext, 0600)
+
+			rotated, err := keyring.RotateFile(path)
+			So(err, ShouldBeNil)
+			So(rotated, ShouldBeTrue)
+
+			stored, _ := ioutil.ReadFile(path)
+			So(IsSealed(stored), ShouldBeTrue)
+
+			opened, err := keyring.Open(stored)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, plaintext)
+		})
+	})
+}
+
+const testKey1 = "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+const testKey2 = "k2:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
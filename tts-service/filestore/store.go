@@ -0,0 +1,375 @@
+// Package filestore keeps objects in files, e.g. the JSON of a batch or a template.
+//
+// Files are encrypted with the master keys (see envelope), placed in the sharded layout (see layout)
+// and replaced atomically, so that readers never see a partially written file.
+// Files written before they were encrypted and sharded are still read, and can be re-encrypted and migrated
+// while the service is running.
+package filestore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+)
+
+// Store keeps files in a directory, one per name: <baseDir>/ab/cd/<name>
+// Subdirectories (e.g. of tenants) are stores of their own, see In.
+type Store struct {
+	baseDir string
+	keys    *envelope.Keyring
+	locks   *layout.Locks // Writers of a file wait for each other, e.g. a write and a re-encryption
+}
+
+// NewStore creates a store in the directory given by the environment variable, e.g. "BATCHES_BASE_DIR", see BaseDir.
+// Files are encrypted if a master key is provided, see envelope.NewKeyring.
+func NewStore(variable, name string) *Store {
+
+	keys, err := envelope.NewKeyring()
+
+	if err != nil {
+
+		log.Fatalf("Can't load encryption keys: %v", err)
+	}
+
+	return New(BaseDir(variable, name), keys)
+}
+
+// BaseDir returns the directory given by the environment variable, e.g. "BATCHES_BASE_DIR".
+// If it's not provided, the named subdirectory (e.g. "batches") of the data directory is used, see DataDir.
+func BaseDir(variable, name string) string {
+
+	value := os.Getenv(variable)
+
+	if len(value) == 0 {
+
+		value = filepath.Join(DataDir(), name)
+		log.Printf("%s not provided. Using %s", variable, value)
+	}
+
+	return value
+}
+
+// New creates a store in the directory, encrypting files with the keys.
+func New(baseDir string, keys *envelope.Keyring) *Store {
+
+	return &Store{baseDir: baseDir, keys: keys, locks: &layout.Locks{}}
+}
+
+// DataDir returns the directory all the stores of the service are in by default: TTS_DATA_DIR,
+// or "tts-service" in $XDG_DATA_HOME, "~/.local/share" if not set.
+// Unlike the temporary directory, it's private to the user and isn't cleaned up.
+func DataDir() string {
+
+	if dir := os.Getenv("TTS_DATA_DIR"); len(dir) > 0 {
+
+		return dir
+	}
+
+	dir := os.Getenv("XDG_DATA_HOME")
+
+	if len(dir) == 0 {
+
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+
+			log.Fatalf("Can't find the data directory: %v", err)
+		}
+
+		dir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dir, "tts-service")
+}
+
+// In returns the store of the subdirectory, e.g. of a tenant.
+// It shares the keys and the locks with the store.
+func (s *Store) In(dir string) *Store {
+
+	return &Store{baseDir: filepath.Join(s.baseDir, dir), keys: s.keys, locks: s.locks}
+}
+
+// Read returns the decrypted content of the file.
+// It returns an error satisfying os.IsNotExist if there's no such file, or another error, if any.
+func (s *Store) Read(name string) ([]byte, error) {
+
+	var content []byte
+
+	err := layout.Read(s.baseDir, name, name, func(path string) (err error) {
+
+		content, err = s.keys.ReadFile(path)
+		return err
+	})
+
+	return content, err
+}
+
+// ReadJSON decodes the JSON content of the file into v.
+// It returns an error satisfying os.IsNotExist if there's no such file, or another error, if any.
+func (s *Store) ReadJSON(name string, v interface{}) error {
+
+	content, err := s.Read(name)
+
+	if err != nil {
+
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// Write encrypts the content and replaces the file with it.
+// It returns an error, if any.
+func (s *Store) Write(name string, content []byte) error {
+
+	sealed, err := s.keys.Seal(content)
+
+	if err != nil {
+
+		return err
+	}
+
+	defer s.locks.Lock(name)()
+
+	dir := layout.Dir(s.baseDir, name)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+
+		return err
+	}
+
+	// Concurrent writers don't share their temporary files
+	tmp, err := ioutil.TempFile(dir, tmpPrefix+name+"-")
+
+	if err != nil {
+
+		return err
+	}
+
+	_, err = tmp.Write(sealed)
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), layout.Path(s.baseDir, name, name))
+	}
+
+	if err != nil {
+
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// The file has moved into the sharded layout
+	err = os.Remove(layout.FlatPath(s.baseDir, name))
+
+	if err != nil && !os.IsNotExist(err) {
+
+		return err
+	}
+
+	return nil
+}
+
+// WriteJSON encodes v in JSON and replaces the file with it.
+// It returns an error, if any.
+func (s *Store) WriteJSON(name string, v interface{}) error {
+
+	content, err := json.Marshal(v)
+
+	if err != nil {
+
+		return err
+	}
+
+	return s.Write(name, content)
+}
+
+// Remove removes the file.
+// It returns an error satisfying os.IsNotExist if there's no such file, or another error, if any.
+func (s *Store) Remove(name string) error {
+
+	defer s.locks.Lock(name)()
+
+	return layout.Remove(s.baseDir, name, name)
+}
+
+// List returns the names of the files with the suffix, e.g. ".json".
+// There are no files in a store whose directory doesn't exist yet.
+func (s *Store) List(suffix string) ([]string, error) {
+
+	names, err := layout.List(s.baseDir, func(name string) bool {
+
+		return strings.HasSuffix(name, suffix) && !strings.HasPrefix(name, tmpPrefix)
+	})
+
+	if os.IsNotExist(err) {
+
+		return []string{}, nil
+	}
+
+	return names, err
+}
+
+// Rotate re-encrypts the files of the store and of its subdirectories with the active master key.
+// It returns the number of re-encrypted files and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	count := 0
+
+	err := s.walk(func(path string, info os.FileInfo) error {
+
+		unlock := s.locks.Lock(info.Name())
+		rotated, err := s.keys.RotateFile(path)
+		unlock()
+
+		if rotated {
+			count++
+		}
+
+		if os.IsNotExist(err) {
+
+			return nil
+		}
+
+		return err
+	})
+
+	return count, err
+}
+
+// Migrate moves the files of the store and of its subdirectories, stored in flat directories, into the sharded layout.
+// It returns the number of moved files and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	files, err := ioutil.ReadDir(s.baseDir)
+
+	if os.IsNotExist(err) {
+
+		return 0, nil
+	}
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	count, err := layout.Migrate(s.baseDir, s.locks, func(name string) (string, bool) {
+
+		return name, !strings.HasPrefix(name, tmpPrefix)
+	})
+
+	if err != nil {
+
+		return count, err
+	}
+
+	for _, file := range files {
+
+		if !file.IsDir() || layout.IsShard(file.Name()) {
+			continue
+		}
+
+		moved, err := s.In(file.Name()).Migrate()
+		count += moved
+
+		if err != nil {
+
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Expire removes the files of the store and of its subdirectories which haven't been written for longer than maxAge.
+// It returns the number of removed files and an error, if any.
+func (s *Store) Expire(maxAge time.Duration) (int, error) {
+
+	count := 0
+
+	err := s.walk(func(path string, info os.FileInfo) error {
+
+		if time.Since(info.ModTime()) <= maxAge {
+
+			return nil
+		}
+
+		defer s.locks.Lock(info.Name())()
+
+		// The file may have been written again since
+		current, err := os.Stat(path)
+
+		if err != nil || time.Since(current.ModTime()) <= maxAge {
+
+			return nil
+		}
+
+		err = os.Remove(path)
+
+		if err == nil {
+			count++
+		}
+
+		if os.IsNotExist(err) {
+
+			return nil
+		}
+
+		return err
+	})
+
+	return count, err
+}
+
+// ExpireEvery removes the expired files in the background, every interval, see Expire.
+func (s *Store) ExpireEvery(maxAge, interval time.Duration) {
+
+	go func() {
+
+		for range time.Tick(interval) {
+
+			if _, err := s.Expire(maxAge); err != nil {
+
+				log.Printf("Can't remove expired files of %s: %v", s.baseDir, err)
+			}
+		}
+	}()
+}
+
+// walk calls fn for every file of the store and of its subdirectories, but the temporary ones
+func (s *Store) walk(fn func(path string, info os.FileInfo) error) error {
+
+	return filepath.Walk(s.baseDir, func(path string, info os.FileInfo, err error) error {
+
+		// Files may be removed during the walk, the directory may not have been created yet
+		if os.IsNotExist(err) {
+
+			return nil
+		}
+
+		if err != nil {
+
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpPrefix) {
+
+			return nil
+		}
+
+		return fn(path, info)
+	})
+}
+
+// Temporary files are hidden
+const tmpPrefix = "."
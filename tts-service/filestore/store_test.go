@@ -0,0 +1,125 @@
+package filestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("File store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "filestore")
+		defer os.RemoveAll(dir)
+
+		keys, _ := envelope.ParseKeyring(testKey1)
+		store := New(dir, keys)
+
+		Convey("should write and read files", func() {
+
+			So(store.WriteJSON("abc.json", map[string]string{"text": "Hello"}), ShouldBeNil)
+
+			v := map[string]string{}
+			So(store.ReadJSON("abc.json", &v), ShouldBeNil)
+			So(v["text"], ShouldEqual, "Hello")
+
+			names, err := store.List(".json")
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []string{"abc.json"})
+
+			err = store.ReadJSON("def.json", &v)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("should encrypt and shard files", func() {
+
+			store.Write("abc.json", []byte("Hello"))
+
+			stored, err := ioutil.ReadFile(layout.Path(dir, "abc.json", "abc.json"))
+			So(err, ShouldBeNil)
+			So(envelope.IsSealed(stored), ShouldBeTrue)
+			So(string(stored), ShouldNotContainSubstring, "Hello")
+		})
+
+		Convey("should remove files", func() {
+
+			store.Write("abc.json", []byte("Hello"))
+
+			So(store.Remove("abc.json"), ShouldBeNil)
+			So(os.IsNotExist(store.Remove("abc.json")), ShouldBeTrue)
+		})
+
+		Convey("should keep files of subdirectories apart", func() {
+
+			store.In("acme").Write("abc.json", []byte("Hello"))
+
+			names, _ := store.In("acme").List(".json")
+			So(names, ShouldResemble, []string{"abc.json"})
+
+			names, _ = store.In("other").List(".json")
+			So(names, ShouldBeEmpty)
+		})
+
+		Convey("should read, re-encrypt and migrate files written before", func() {
+
+			os.MkdirAll(filepath.Join(dir, "acme"), 0755)
+			ioutil.WriteFile(filepath.Join(dir, "acme", "abc.json"), []byte("Hello"), 0644)
+
+			content, err := store.In("acme").Read("abc.json")
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "Hello")
+
+			count, err := store.Rotate()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			stored, _ := ioutil.ReadFile(filepath.Join(dir, "acme", "abc.json"))
+			So(envelope.IsSealed(stored), ShouldBeTrue)
+
+			count, err = store.Migrate()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			_, err = os.Stat(layout.Path(filepath.Join(dir, "acme"), "abc.json", "abc.json"))
+			So(err, ShouldBeNil)
+
+			content, _ = store.In("acme").Read("abc.json")
+			So(string(content), ShouldEqual, "Hello")
+		})
+
+		Convey("should remove expired files", func() {
+
+			store.Write("abc.json", []byte("Hello"))
+			store.Write("def.json", []byte("Hello"))
+
+			old := time.Now().Add(-2 * time.Hour)
+			os.Chtimes(layout.Path(dir, "abc.json", "abc.json"), old, old)
+
+			count, err := store.Expire(time.Hour)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			names, _ := store.List(".json")
+			So(names, ShouldResemble, []string{"def.json"})
+		})
+
+		Convey("should default to the data directory rather than the temporary one", func() {
+
+			os.Setenv("XDG_DATA_HOME", dir)
+			defer os.Unsetenv("XDG_DATA_HOME")
+
+			So(DataDir(), ShouldEqual, filepath.Join(dir, "tts-service"))
+			So(strings.HasPrefix(NewStore("FILESTORE_TEST_DIR", "tests").baseDir, DataDir()), ShouldBeTrue)
+		})
+	})
+}
+
+const testKey1 = "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
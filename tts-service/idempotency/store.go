@@ -0,0 +1,155 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+)
+
+// Record is the response to the first request made with an idempotency key,
+// replayed to the requests repeating it.
+// Fingerprint identifies the request, so that the key isn't reused for another one.
+type Record struct {
+	Fingerprint string
+	Status      int
+	Body        []byte
+	Created     time.Time
+}
+
+// Store keeps records in files, one per key: <SHA-256 of the key>.json, see filestore
+// Records hold the responses, with the texts of the voice messages, so they're encrypted like the voice messages.
+// Records are kept for the TTL, the expired ones are removed when they're read, or by Expire.
+type Store struct {
+	files *filestore.Store
+	ttl   time.Duration
+	locks layout.Locks // Requests of the same key wait for each other, see Lock
+}
+
+// NewStore creates a store in the IDEMPOTENCY_BASE_DIR directory,
+// keeping records for the IDEMPOTENCY_KEY_TTL duration, e.g. "24h".
+func NewStore() *Store {
+
+	ttl := defaultTtl
+
+	if ttlValue := os.Getenv("IDEMPOTENCY_KEY_TTL"); len(ttlValue) > 0 {
+
+		parsed, err := time.ParseDuration(ttlValue)
+
+		if err == nil && parsed > 0 {
+			ttl = parsed
+		} else {
+			log.Printf("Invalid IDEMPOTENCY_KEY_TTL value: '%s'. Using %v", ttlValue, defaultTtl)
+		}
+	}
+
+	return &Store{files: filestore.NewStore("IDEMPOTENCY_BASE_DIR", "idempotency"), ttl: ttl}
+}
+
+// ExpireInBackground removes the expired records in the background, see Expire.
+// Only the server needs it, commands such as the re-encryption just go through the records and exit.
+func (s *Store) ExpireInBackground() {
+
+	interval := expiryInterval
+	if s.ttl < interval {
+		interval = s.ttl
+	}
+
+	s.files.ExpireEvery(s.ttl, interval)
+}
+
+// Fingerprint returns the fingerprint of the request content.
+func Fingerprint(content []byte) string {
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Lock locks the key until the returned function is called,
+// so that a request repeated before the first one is responded to waits for its record.
+func (s *Store) Lock(key string) func() {
+
+	return s.locks.Lock(key)
+}
+
+// Get returns the record of the key.
+// It returns NotFoundError if there's no such record or it has expired, or another error, if any.
+func (s *Store) Get(key string) (Record, error) {
+
+	r := Record{}
+
+	err := s.files.ReadJSON(name(key), &r)
+
+	if os.IsNotExist(err) {
+		return r, NotFoundError{"Idempotency key not found"}
+	}
+
+	if err != nil {
+		return r, err
+	}
+
+	if time.Since(r.Created) > s.ttl {
+
+		s.files.Remove(name(key))
+		return Record{}, NotFoundError{"Idempotency key has expired"}
+	}
+
+	return r, nil
+}
+
+// Put stores the record of the key.
+// It returns an error, if any.
+func (s *Store) Put(key string, r Record) error {
+
+	r.Created = time.Now().UTC()
+
+	// Repeated requests never read a partially written record
+	return s.files.WriteJSON(name(key), r)
+}
+
+// Expire removes the expired records, even if they're never read again.
+// It returns the number of removed records and an error, if any.
+func (s *Store) Expire() (int, error) {
+
+	return s.files.Expire(s.ttl)
+}
+
+// Rotate re-encrypts the records with the active master key.
+// It returns the number of re-encrypted records and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	return s.files.Rotate()
+}
+
+// Migrate moves the records stored in a flat directory into the sharded layout.
+// It returns the number of moved records and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	return s.files.Migrate()
+}
+
+// Keys are given by clients, so they're hashed to be used as file names
+func name(key string) string {
+
+	return Fingerprint([]byte(key)) + ".json"
+}
+
+const defaultTtl = 24 * time.Hour
+
+// How often expired records are removed, at most
+const expiryInterval = time.Hour
+
+// NotFoundError is returned when there's no record of the key
+type NotFoundError struct {
+	Message string
+}
+
+func (err NotFoundError) Error() string {
+
+	return err.Message
+}
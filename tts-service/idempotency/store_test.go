@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("Idempotency store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "idempotency")
+		defer os.RemoveAll(dir)
+
+		store := &Store{files: filestore.New(dir, &envelope.Keyring{}), ttl: time.Hour}
+		record := Record{Fingerprint: Fingerprint([]byte(`{"text":"Hello"}`)), Status: 202, Body: []byte(`{"id":"abc"}`)}
+
+		Convey("should put and get records", func() {
+
+			So(store.Put("acme:key-1", record), ShouldBeNil)
+
+			got, err := store.Get("acme:key-1")
+			So(err, ShouldBeNil)
+			So(got.Fingerprint, ShouldEqual, record.Fingerprint)
+			So(got.Status, ShouldEqual, 202)
+			So(string(got.Body), ShouldEqual, `{"id":"abc"}`)
+
+			_, err = store.Get("other:key-1")
+			So(err, ShouldHaveSameTypeAs, NotFoundError{})
+		})
+
+		Convey("should forget expired records", func() {
+
+			store.Put("acme:key-1", record)
+			store.ttl = time.Nanosecond
+			time.Sleep(time.Millisecond)
+
+			_, err := store.Get("acme:key-1")
+			So(err, ShouldHaveSameTypeAs, NotFoundError{})
+
+			names, _ := store.files.List(".json")
+			So(names, ShouldBeEmpty)
+		})
+
+		Convey("should remove expired records never read again", func() {
+
+			store.Put("acme:key-1", record)
+			store.ttl = time.Nanosecond
+			time.Sleep(time.Millisecond)
+
+			count, err := store.Expire()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			names, _ := store.files.List(".json")
+			So(names, ShouldBeEmpty)
+		})
+
+		Convey("should make requests of the same key wait for each other", func() {
+
+			unlock := store.Lock("acme:key-1")
+			locked := make(chan bool)
+
+			go func() {
+				store.Lock("acme:key-1")()
+				locked <- true
+			}()
+
+			select {
+			case <-locked:
+				t.Error("Key locked twice")
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			unlock()
+			So(<-locked, ShouldBeTrue)
+		})
+
+		Convey("should fingerprint the content", func() {
+
+			So(Fingerprint([]byte("a")), ShouldEqual, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb")
+			So(Fingerprint([]byte("a")), ShouldNotEqual, Fingerprint([]byte("b")))
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package language
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Detect guesses which of the candidate languages the text is written in, with a character trigram model.
+// It returns the most probable language and its probability (0-1).
+// It returns false if the text has no letters, or none of the candidates can be detected.
+func Detect(text string, candidates []Language) (Language, float64, bool) {
+
+	loadProfiles.Do(buildProfiles)
+
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return Language{}, 0, false
+	}
+
+	detectable := []Language{}
+	scores := []float64{}
+
+	for _, l := range candidates {
+
+		p, ok := profiles[strings.ToLower(primary(l.Tag))]
+		if !ok {
+			continue
+		}
+
+		detectable = append(detectable, l)
+		scores = append(scores, p.logLikelihood(grams))
+	}
+
+	if len(detectable) == 0 {
+		return Language{}, 0, false
+	}
+
+	best := 0
+	for i := range scores {
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	// Probabilities of equally probable languages, relative to the best one, to avoid underflows
+	sum := 0.0
+	for i := range scores {
+		sum += math.Exp(scores[i] - scores[best])
+	}
+
+	return detectable[best], 1 / sum, true
+}
+
+// profile holds trigram frequencies of a language
+type profile struct {
+	counts map[string]int
+	total  int
+}
+
+// logLikelihood returns the log probability of the trigrams in the language.
+// Unseen trigrams get a small, non-zero probability (additive smoothing).
+func (p profile) logLikelihood(grams []string) float64 {
+
+	const alpha = 0.5
+	denominator := float64(p.total) + alpha*float64(vocabulary)
+
+	result := 0.0
+	for _, g := range grams {
+		result += math.Log((float64(p.counts[g]) + alpha) / denominator)
+	}
+
+	return result
+}
+
+var profiles map[string]profile
+var vocabulary int
+var loadProfiles sync.Once
+
+func buildProfiles() {
+
+	profiles = map[string]profile{}
+	all := map[string]bool{}
+
+	for lang, sample := range samples {
+
+		p := profile{counts: map[string]int{}}
+
+		for _, g := range trigrams(sample) {
+			p.counts[g]++
+			p.total++
+			all[g] = true
+		}
+
+		profiles[lang] = p
+	}
+
+	vocabulary = len(all)
+}
+
+// trigrams returns the letter trigrams of the words of the text, with word boundaries marked with spaces.
+// E.g. "Hi you" gives " hi", "hi ", " yo", "you", "ou ".
+func trigrams(text string) []string {
+
+	grams := []string{}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+
+	for _, word := range words {
+
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+
+	return grams
+}
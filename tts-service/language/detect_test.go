@@ -0,0 +1,69 @@
+package language
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+
+	Convey("Language detection", t, func() {
+
+		registry, _ := ParseRegistry(builtIn)
+		candidates := registry.All()
+
+		Convey("should detect the language of the text", func() {
+
+			l, confidence, ok := Detect("Twoja przesyłka czeka na odbiór w paczkomacie przy ulicy Długiej.", candidates)
+
+			So(ok, ShouldBeTrue)
+			So(l.Code, ShouldEqual, "PL")
+			So(confidence, ShouldBeGreaterThan, 0.99)
+
+			l, _, _ = Detect("Your parcel is waiting for you at the pickup point on Main Street.", candidates)
+			So(l.Code, ShouldEqual, "EN")
+		})
+
+		Convey("should detect Polish written without diacritics", func() {
+
+			l, _, _ := Detect("Dziekujemy za zamowienie, wkrotce sie z Panem skontaktujemy", candidates)
+
+			So(l.Code, ShouldEqual, "PL")
+		})
+
+		Convey("should detect only the candidate languages", func() {
+
+			german, _ := ParseRegistry(`[{"code": "DE", "tag": "de-DE"}, {"code": "EN", "tag": "en-US"}]`)
+
+			l, _, _ := Detect("Vielen Dank für Ihre Bestellung", german.All())
+			So(l.Code, ShouldEqual, "DE")
+
+			l, _, _ = Detect("Vielen Dank für Ihre Bestellung", candidates)
+			So(l.Code, ShouldNotEqual, "DE")
+		})
+
+		Convey("should be unsure of very short texts", func() {
+
+			_, confidence, ok := Detect("OK", candidates)
+
+			So(ok, ShouldBeTrue)
+			So(confidence, ShouldBeLessThan, 0.9)
+		})
+
+		Convey("should give up on texts without letters", func() {
+
+			_, _, ok := Detect("12:30 !!!", candidates)
+
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should give up on languages without profiles", func() {
+
+			ukrainian, _ := ParseRegistry(`[{"code": "UK", "tag": "uk-UA"}]`)
+
+			_, _, ok := Detect("Дякуємо за замовлення", ukrainian.All())
+
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
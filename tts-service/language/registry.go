@@ -0,0 +1,163 @@
+// Package language holds the registry of supported languages: their tags, names and provider specific settings.
+//
+// Languages are configured in a JSON file, so that a new one can be added without code changes:
+//
+//	[{"code": "DE", "tag": "de-DE", "name": "German", "providers": {"voicerss": {"code": "de-de", "voices": ["Hanna", "Lina", "Jonas"]}}}]
+package language
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Language is a language texts can be written in
+type Language struct {
+	Code      string              `json:"code"`      // Code used by the API, e.g. "EN"
+	Tag       string              `json:"tag"`       // BCP-47 tag, e.g. "en-US"
+	Name      string              `json:"name"`      // Display name, e.g. "English"
+	Providers map[string]Provider `json:"providers"` // Settings of speech providers supporting the language, by provider name
+}
+
+// Provider holds settings of a speech provider for a language
+type Provider struct {
+	Code   string   `json:"code"`   // Language code of the provider, e.g. "en-us"
+	Voices []string `json:"voices"` // The first one is the default
+}
+
+// Registry holds the supported languages
+type Registry struct {
+	languages []Language
+}
+
+// NewRegistry loads languages from the file set by LANGUAGES_FILE environment variable.
+// If it's not provided, the built-in English and Polish are used.
+func NewRegistry() (*Registry, error) {
+
+	path := os.Getenv("LANGUAGES_FILE")
+
+	if len(path) == 0 {
+
+		log.Printf("LANGUAGES_FILE not provided. Using built-in languages")
+		return ParseRegistry(builtIn)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return ParseRegistry(string(content))
+}
+
+// ParseRegistry reads a JSON array of languages.
+func ParseRegistry(value string) (*Registry, error) {
+
+	r := &Registry{}
+
+	if err := json.Unmarshal([]byte(value), &r.languages); err != nil {
+
+		return nil, fmt.Errorf("Invalid languages: %v", err)
+	}
+
+	codes := map[string]bool{}
+
+	for _, l := range r.languages {
+
+		switch {
+		case l.Code == "" || l.Tag == "":
+			return nil, errors.New("Invalid languages: code and tag are mandatory")
+		case codes[l.Code]:
+			return nil, fmt.Errorf("Invalid languages: %s defined twice", l.Code)
+		}
+
+		codes[l.Code] = true
+	}
+
+	return r, nil
+}
+
+var defaultRegistry *Registry
+var loadDefault sync.Once
+
+// Default returns the registry loaded with NewRegistry, shared by all the packages.
+func Default() *Registry {
+
+	loadDefault.Do(func() {
+
+		var err error
+		defaultRegistry, err = NewRegistry()
+
+		if err != nil {
+			log.Fatalf("Can't load languages: %v", err)
+		}
+	})
+
+	return defaultRegistry
+}
+
+// All returns all the languages, in the configured order
+func (r *Registry) All() []Language {
+
+	return r.languages
+}
+
+// Lookup returns the language of the given code, e.g. "EN".
+func (r *Registry) Lookup(code string) (Language, bool) {
+
+	for _, l := range r.languages {
+		if l.Code == code {
+			return l, true
+		}
+	}
+
+	return Language{}, false
+}
+
+// ByTag returns the language of the BCP-47 tag, e.g. "en-US".
+// Tags are compared ignoring case. If there is no exact match, the primary language subtag (e.g. "en") is matched.
+func (r *Registry) ByTag(tag string) (Language, bool) {
+
+	for _, l := range r.languages {
+		if strings.EqualFold(l.Tag, tag) {
+			return l, true
+		}
+	}
+
+	for _, l := range r.languages {
+		if strings.EqualFold(primary(l.Tag), primary(tag)) {
+			return l, true
+		}
+	}
+
+	return Language{}, false
+}
+
+// Codes returns codes of all the languages, e.g. "EN"
+func (r *Registry) Codes() []string {
+
+	codes := []string{}
+
+	for _, l := range r.languages {
+		codes = append(codes, l.Code)
+	}
+
+	return codes
+}
+
+func primary(tag string) string {
+
+	return strings.SplitN(tag, "-", 2)[0]
+}
+
+const builtIn = `[
+	{"code": "EN", "tag": "en-US", "name": "English", "providers": {"voicerss": {"code": "en-us", "voices": ["Linda", "Amy", "Mary", "John", "Mike"]}}},
+	{"code": "PL", "tag": "pl-PL", "name": "Polish", "providers": {"voicerss": {"code": "pl-pl", "voices": ["Zofia"]}}}
+]`
@@ -0,0 +1,72 @@
+package language
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+
+	Convey("Language registry", t, func() {
+
+		registry, err := ParseRegistry(`[
+			{"code": "EN", "tag": "en-US", "name": "English", "providers": {"voicerss": {"code": "en-us", "voices": ["Linda"]}}},
+			{"code": "GB", "tag": "en-GB", "name": "British English"},
+			{"code": "UK", "tag": "uk-UA", "name": "Ukrainian"}
+		]`)
+
+		So(err, ShouldBeNil)
+
+		Convey("should find languages by code", func() {
+
+			l, ok := registry.Lookup("EN")
+
+			So(ok, ShouldBeTrue)
+			So(l.Name, ShouldEqual, "English")
+			So(l.Providers["voicerss"].Voices, ShouldResemble, []string{"Linda"})
+
+			_, ok = registry.Lookup("DE")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should find languages by tag, exact ones first", func() {
+
+			l, _ := registry.ByTag("en-gb")
+			So(l.Code, ShouldEqual, "GB")
+
+			l, _ = registry.ByTag("en-AU")
+			So(l.Code, ShouldEqual, "EN")
+
+			l, _ = registry.ByTag("uk")
+			So(l.Code, ShouldEqual, "UK")
+
+			_, ok := registry.ByTag("de-DE")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should keep the configured order", func() {
+
+			So(registry.Codes(), ShouldResemble, []string{"EN", "GB", "UK"})
+		})
+
+		Convey("should reject invalid configuration", func() {
+
+			_, err := ParseRegistry(`{"code": "EN"}`)
+			So(err, ShouldNotBeNil)
+
+			_, err = ParseRegistry(`[{"code": "EN", "tag": "en-US"}, {"code": "EN", "tag": "en-GB"}]`)
+			So(err.Error(), ShouldContainSubstring, "EN defined twice")
+
+			_, err = ParseRegistry(`[{"code": "EN"}]`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should have English and Polish built in", func() {
+
+			registry, err := ParseRegistry(builtIn)
+
+			So(err, ShouldBeNil)
+			So(registry.Codes(), ShouldResemble, []string{"EN", "PL"})
+		})
+	})
+}
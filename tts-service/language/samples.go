@@ -0,0 +1,29 @@
+package language
+
+// Sample texts the language profiles are built of, by primary language subtag.
+// Detection works for these languages only, other languages of the registry are never detected.
+var samples = map[string]string{
+	"en": `The quick brown fox jumps over the lazy dog. This is a short message to let you know that your order has been shipped and should arrive within the next three working days. If you have any questions about your delivery, please contact our customer service team, who will be happy to help you.
+Good morning, everyone. Thank you for joining us today. We would like to remind you that the meeting will start at ten o'clock in the main conference room on the second floor. Please bring your laptop and the documents we sent you last week.
+Your appointment with the doctor has been confirmed for Monday afternoon. Please arrive fifteen minutes early and remember to bring your insurance card. If you are unable to attend, let us know as soon as possible so that we can offer the slot to another patient.
+The weather today will be mostly cloudy with occasional showers in the north of the country. Temperatures will reach about eighteen degrees in the afternoon, and the wind will be light. Tomorrow should be sunny and warmer, so it is a good time to spend the weekend outside.
+We are writing to inform you that your account balance is low. To avoid any interruption of the service, please top up your account before the end of the month. You can do it online, through our mobile application, or at any of our offices.
+Welcome to the city museum. The exhibition on the ground floor shows the history of the town from the middle ages until the present day. On the first floor you will find paintings by local artists, and the shop near the entrance sells books, maps and souvenirs.
+It was a long and difficult journey, but they finally reached the village before night. The children were tired and hungry, so their mother made them some hot soup, and they fell asleep as soon as they went to bed. The next morning everything looked different in the bright light of the sun.`,
+
+	"pl": `Zamówienie zostało wysłane i powinno dotrzeć do Państwa w ciągu trzech dni roboczych. Jeśli mają Państwo pytania dotyczące dostawy, prosimy o kontakt z naszym biurem obsługi klienta, którego pracownicy chętnie pomogą.
+Dzień dobry wszystkim. Dziękujemy, że jesteście dzisiaj z nami. Przypominamy, że spotkanie rozpocznie się o godzinie dziesiątej w głównej sali konferencyjnej na drugim piętrze. Prosimy zabrać ze sobą komputer oraz dokumenty, które wysłaliśmy w zeszłym tygodniu.
+Pańska wizyta u lekarza została potwierdzona na poniedziałek po południu. Prosimy przyjść piętnaście minut wcześniej i pamiętać o zabraniu dowodu ubezpieczenia. Jeżeli nie może Pan przyjść, prosimy dać nam znać jak najszybciej, abyśmy mogli zaproponować ten termin innemu pacjentowi.
+Dzisiaj będzie przeważnie pochmurno, a na północy kraju wystąpią przelotne opady deszczu. Temperatura po południu wyniesie około osiemnastu stopni, wiatr będzie słaby. Jutro powinno być słonecznie i cieplej, więc to dobry czas, żeby spędzić weekend na świeżym powietrzu.
+Uprzejmie informujemy, że saldo Państwa konta jest niskie. Aby uniknąć przerwy w świadczeniu usług, prosimy o doładowanie konta przed końcem miesiąca. Można to zrobić przez internet, w naszej aplikacji mobilnej albo w każdym z naszych biur.
+Witamy w muzeum miejskim. Wystawa na parterze przedstawia historię miasta od średniowiecza do czasów współczesnych. Na pierwszym piętrze znajdują się obrazy lokalnych artystów, a w sklepie przy wejściu można kupić książki, mapy i pamiątki.
+To była długa i trudna podróż, ale przed nocą w końcu dotarli do wsi. Dzieci były zmęczone i głodne, więc matka ugotowała im gorącą zupę, a one zasnęły, gdy tylko położyły się do łóżek. Następnego ranka wszystko wyglądało inaczej w jasnym świetle słońca.`,
+
+	"de": `Ihre Bestellung wurde versandt und sollte innerhalb der nächsten drei Werktage bei Ihnen eintreffen. Wenn Sie Fragen zu Ihrer Lieferung haben, wenden Sie sich bitte an unseren Kundenservice, der Ihnen gerne weiterhilft.
+Guten Morgen zusammen. Vielen Dank, dass Sie heute bei uns sind. Wir möchten Sie daran erinnern, dass die Besprechung um zehn Uhr im großen Konferenzraum im zweiten Stock beginnt. Bitte bringen Sie Ihren Laptop und die Unterlagen mit, die wir Ihnen letzte Woche geschickt haben.
+Ihr Termin beim Arzt wurde für Montagnachmittag bestätigt. Bitte kommen Sie fünfzehn Minuten früher und denken Sie an Ihre Versichertenkarte. Falls Sie den Termin nicht wahrnehmen können, teilen Sie uns das bitte so schnell wie möglich mit, damit wir ihn einem anderen Patienten anbieten können.
+Das Wetter wird heute überwiegend bewölkt sein, im Norden des Landes gibt es vereinzelte Schauer. Die Temperaturen steigen am Nachmittag auf etwa achtzehn Grad, der Wind weht schwach. Morgen soll es sonnig und wärmer werden, also eine gute Gelegenheit, das Wochenende draußen zu verbringen.
+Wir möchten Sie darüber informieren, dass Ihr Kontostand niedrig ist. Um eine Unterbrechung des Dienstes zu vermeiden, laden Sie bitte Ihr Konto vor Ende des Monats auf. Sie können dies online, über unsere mobile Anwendung oder in jeder unserer Filialen tun.
+Willkommen im Stadtmuseum. Die Ausstellung im Erdgeschoss zeigt die Geschichte der Stadt vom Mittelalter bis zur Gegenwart. Im ersten Stock finden Sie Gemälde von Künstlern aus der Region, und im Laden neben dem Eingang gibt es Bücher, Karten und Andenken.
+Es war eine lange und schwierige Reise, aber vor Einbruch der Nacht erreichten sie endlich das Dorf. Die Kinder waren müde und hungrig, deshalb kochte ihnen die Mutter eine heiße Suppe, und sie schliefen ein, sobald sie im Bett lagen. Am nächsten Morgen sah im hellen Sonnenlicht alles ganz anders aus.`,
+}
@@ -0,0 +1,149 @@
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Run is a part of a text written in a single language
+type Run struct {
+	Text     string
+	Language Language
+}
+
+// Segment splits the text into runs of words written in the same language,
+// e.g. "Zamówienie shipped to Warsaw" into Polish "Zamówienie " and English "shipped to Warsaw".
+// Switching the language has a cost, so that single ambiguous words (e.g. "to") don't make runs of their own.
+// Ties are resolved in favor of the earlier candidates, so the expected language should go first.
+// The text is returned as a single run of the first candidate, if it can't be segmented.
+func Segment(text string, candidates []Language) []Run {
+
+	loadProfiles.Do(buildProfiles)
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	detectable := []Language{}
+	models := []profile{}
+
+	for _, l := range candidates {
+		if p, ok := profiles[strings.ToLower(primary(l.Tag))]; ok {
+			detectable = append(detectable, l)
+			models = append(models, p)
+		}
+	}
+
+	starts := wordStarts(text)
+
+	if len(detectable) < 2 || len(starts) == 0 {
+		return []Run{{text, candidates[0]}}
+	}
+
+	languages := viterbi(text, starts, models)
+
+	runs := []Run{}
+	start := 0
+
+	for i := 1; i < len(starts); i++ {
+
+		if languages[i] != languages[i-1] {
+			runs = append(runs, Run{text[start:starts[i]], detectable[languages[i-1]]})
+			start = starts[i]
+		}
+	}
+
+	return append(runs, Run{text[start:], detectable[languages[len(starts)-1]]})
+}
+
+// Cost of switching the language, in log probability. Distinctive words score a few points per trigram.
+const switchPenalty = 12.0
+
+// viterbi returns the most probable language (model index) of each word, starting at the given positions
+func viterbi(text string, starts []int, models []profile) []int {
+
+	scores := make([][]float64, len(starts))
+	previous := make([][]int, len(starts))
+
+	for i, start := range starts {
+
+		grams := trigrams(word(text[start:]))
+		scores[i] = make([]float64, len(models))
+		previous[i] = make([]int, len(models))
+
+		for k, model := range models {
+
+			emission := model.logLikelihood(grams)
+
+			if i == 0 {
+				scores[i][k] = emission
+				continue
+			}
+
+			best := 0
+			for j := range models {
+				if transition(scores[i-1], j, k) > transition(scores[i-1], best, k) {
+					best = j
+				}
+			}
+
+			scores[i][k] = transition(scores[i-1], best, k) + emission
+			previous[i][k] = best
+		}
+	}
+
+	last := len(starts) - 1
+	languages := make([]int, len(starts))
+
+	for k := range models {
+		if scores[last][k] > scores[last][languages[last]] {
+			languages[last] = k
+		}
+	}
+
+	for i := last; i > 0; i-- {
+		languages[i-1] = previous[i][languages[i]]
+	}
+
+	return languages
+}
+
+func transition(scores []float64, from, to int) float64 {
+
+	if from == to {
+		return scores[from]
+	}
+
+	return scores[from] - switchPenalty
+}
+
+// wordStarts returns byte positions of the words of the text
+func wordStarts(text string) []int {
+
+	starts := []int{}
+	inWord := false
+
+	for i, r := range text {
+
+		letter := unicode.IsLetter(r)
+		if letter && !inWord {
+			starts = append(starts, i)
+		}
+		inWord = letter
+	}
+
+	return starts
+}
+
+// word returns the word the text starts with
+func word(text string) string {
+
+	for i, r := range text {
+		if !unicode.IsLetter(r) {
+			return text[:i]
+		}
+	}
+
+	return text
+}
+
@@ -0,0 +1,60 @@
+package language
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+
+	Convey("Text segmentation", t, func() {
+
+		registry, _ := ParseRegistry(builtIn)
+		candidates := registry.All()
+
+		Convey("should split the text into runs of the same language", func() {
+
+			runs := Segment("Zamówienie shipped to Warsaw", candidates)
+
+			So(runs, ShouldHaveLength, 2)
+			So(runs[0].Language.Code, ShouldEqual, "PL")
+			So(runs[0].Text, ShouldEqual, "Zamówienie ")
+			So(runs[1].Language.Code, ShouldEqual, "EN")
+			So(runs[1].Text, ShouldEqual, "shipped to Warsaw")
+		})
+
+		Convey("should keep a text of a single language in one run", func() {
+
+			runs := Segment("Twoje zamówienie zostało wysłane do Warszawy.", candidates)
+			So(runs, ShouldHaveLength, 1)
+			So(runs[0].Language.Code, ShouldEqual, "PL")
+
+			// A single foreign word isn't worth switching the voice
+			runs = Segment("Please call Paweł tomorrow.", candidates)
+			So(runs, ShouldHaveLength, 1)
+			So(runs[0].Language.Code, ShouldEqual, "EN")
+		})
+
+		Convey("should keep punctuation and spaces with the preceding run", func() {
+
+			runs := Segment("Your order has been shipped! Dziękujemy za zakupy, zapraszamy ponownie.", candidates)
+
+			So(runs, ShouldHaveLength, 2)
+			So(runs[0].Text, ShouldEqual, "Your order has been shipped! ")
+			So(runs[1].Text, ShouldEqual, "Dziękujemy za zakupy, zapraszamy ponownie.")
+		})
+
+		Convey("should return a single run of the first candidate if the text can't be segmented", func() {
+
+			runs := Segment("12:30", candidates)
+			So(runs, ShouldResemble, []Run{{"12:30", candidates[0]}})
+
+			undetectable, _ := ParseRegistry(`[{"code": "FR", "tag": "fr-FR"}, {"code": "EN", "tag": "en-US"}]`)
+			runs = Segment("Zamówienie shipped to Warsaw", undetectable.All())
+			So(runs, ShouldHaveLength, 1)
+			So(runs[0].Language.Code, ShouldEqual, "FR")
+
+			So(Segment("text", nil), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,309 @@
+// Package layout places files in a hashed directory fan-out, e.g. "<base dir>/ab/cd/<file>",
+// so that no single directory holds too many files.
+//
+// Files written before the fan-out was introduced live directly in the base directory (the flat layout).
+// They are still found, and can be moved into the fan-out while the service is running.
+package layout
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Dir returns the directory holding files of the object with the given ID.
+func Dir(baseDir, id string) string {
+
+	sum := sha1.Sum([]byte(id))
+	hash := hex.EncodeToString(sum[:])
+
+	return base(baseDir) + separator + hash[0:2] + separator + hash[2:4]
+}
+
+// Path returns the path of the object's file in the fan-out.
+func Path(baseDir, id, name string) string {
+
+	return Dir(baseDir, id) + separator + name
+}
+
+// FlatPath returns the path of the file in the flat layout.
+func FlatPath(baseDir, name string) string {
+
+	return base(baseDir) + separator + name
+}
+
+// Locate returns the path of an existing object's file, looking into the fan-out first, then into the flat layout.
+// If the file doesn't exist at all, its fan-out path is returned.
+func Locate(baseDir, id, name string) string {
+
+	path := Path(baseDir, id, name)
+
+	if exists(path) {
+		return path
+	}
+
+	if flatPath := FlatPath(baseDir, name); exists(flatPath) {
+		return flatPath
+	}
+
+	// The file may have been just migrated
+	return path
+}
+
+// Read calls read with the path of an existing object's file, see Locate.
+// A file moved into the fan-out after it was located, e.g. by Migrate, is read again from there.
+func Read(baseDir, id, name string, read func(path string) error) error {
+
+	path := Locate(baseDir, id, name)
+	err := read(path)
+
+	if os.IsNotExist(err) && path != Path(baseDir, id, name) {
+
+		return read(Path(baseDir, id, name))
+	}
+
+	return err
+}
+
+// Create creates the directory for object's files, if needed.
+// It returns the path of the object's file in the fan-out, or an error, if any.
+func Create(baseDir, id, name string) (string, error) {
+
+	err := os.MkdirAll(Dir(baseDir, id), 0755)
+
+	if err != nil {
+
+		return "", err
+	}
+
+	return Path(baseDir, id, name), nil
+}
+
+// Remove removes the object's file from both layouts.
+// It returns an error if the file doesn't exist in any of them.
+func Remove(baseDir, id, name string) error {
+
+	err := os.Remove(Path(baseDir, id, name))
+	flatErr := os.Remove(FlatPath(baseDir, name))
+
+	if err == nil || flatErr == nil {
+
+		return nil
+	}
+
+	if !os.IsNotExist(flatErr) {
+
+		return flatErr
+	}
+
+	return err
+}
+
+// List returns names of files accepted by the filter, found in both layouts.
+func List(baseDir string, accept func(name string) bool) ([]string, error) {
+
+	names := []string{}
+	found := map[string]bool{}
+
+	add := func(dir string) error {
+
+		files, err := ioutil.ReadDir(dir)
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, file := range files {
+
+			name := file.Name()
+
+			if !file.IsDir() && !found[name] && accept(name) {
+				found[name] = true
+				names = append(names, name)
+			}
+		}
+
+		return nil
+	}
+
+	err := add(base(baseDir))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	err = walkShards(baseDir, add)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Migrate moves files from the flat layout into the fan-out.
+// The idOf function selects files to move and tells which object they belong to.
+// Each file is moved holding the lock of its object, so that writers of the object don't race with the move.
+// A file already present in the fan-out is never overwritten, as it's newer than the flat one.
+// It returns the number of moved files, and an error, if any.
+func Migrate(baseDir string, locks *Locks, idOf func(name string) (string, bool)) (int, error) {
+
+	files, err := ioutil.ReadDir(base(baseDir))
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	count := 0
+
+	for _, file := range files {
+
+		id, ok := idOf(file.Name())
+
+		if file.IsDir() || !ok {
+			continue
+		}
+
+		unlock := locks.Lock(id)
+		err := move(baseDir, id, file.Name())
+		unlock()
+
+		if err != nil {
+
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// move moves the object's file from the flat layout into the fan-out
+func move(baseDir, id, name string) error {
+
+	path, err := Create(baseDir, id, name)
+
+	if err != nil {
+
+		return err
+	}
+
+	// Unlike rename, link fails if the target exists
+	flatPath := FlatPath(baseDir, name)
+	err = os.Link(flatPath, path)
+
+	if err != nil && !os.IsExist(err) {
+
+		return err
+	}
+
+	err = os.Remove(flatPath)
+
+	if err != nil && !os.IsNotExist(err) {
+
+		return err
+	}
+
+	return nil
+}
+
+// Locks are per-object locks, striped over a fixed number of mutexes.
+// Writers of an object's files hold its lock, so that they don't overwrite each other's changes,
+// e.g. an update of the object and its re-encryption.
+type Locks struct {
+	stripes [lockStripes]sync.Mutex
+}
+
+// Lock locks the object until the returned function is called.
+// Objects may share a stripe, so a writer must not lock another object while holding the lock.
+func (l *Locks) Lock(id string) func() {
+
+	sum := sha1.Sum([]byte(id))
+	stripe := &l.stripes[sum[0]%lockStripes]
+
+	stripe.Lock()
+
+	return stripe.Unlock
+}
+
+const lockStripes = 64
+
+// walkShards calls fn for every "ab/cd" directory of the fan-out
+func walkShards(baseDir string, fn func(dir string) error) error {
+
+	level1, err := ioutil.ReadDir(base(baseDir))
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, dir1 := range level1 {
+
+		if !isShard(dir1) {
+			continue
+		}
+
+		path1 := base(baseDir) + separator + dir1.Name()
+		level2, err := ioutil.ReadDir(path1)
+
+		if err != nil {
+
+			return err
+		}
+
+		for _, dir2 := range level2 {
+
+			if !isShard(dir2) {
+				continue
+			}
+
+			if err := fn(path1 + separator + dir2.Name()); err != nil {
+
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Shard directories are named with two lowercase hex digits
+func isShard(file os.FileInfo) bool {
+
+	return file.IsDir() && IsShard(file.Name())
+}
+
+// IsShard tells whether the directory name is the one of the fan-out, e.g. "ab".
+func IsShard(name string) bool {
+
+	if len(name) != 2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(name)
+
+	return err == nil && strings.ToLower(name) == name
+}
+
+func exists(path string) bool {
+
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func base(baseDir string) string {
+
+	return strings.TrimSuffix(baseDir, separator)
+}
+
+// We need to distinguish between different path separator (Windows, Linux)
+const separator = string(os.PathSeparator)
@@ -0,0 +1,164 @@
+package layout
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayout(t *testing.T) {
+
+	Convey("Sharded layout", t, func(c C) {
+
+		baseDir, _ := ioutil.TempDir("", "layout")
+		defer os.RemoveAll(baseDir)
+
+		Convey("should place files in two levels of hashed directories", func() {
+
+			So(Dir("/base/", "abc"), ShouldEqual, "/base/a9/99")
+			So(Path("/base", "abc", "abc.json"), ShouldEqual, "/base/a9/99/abc.json")
+		})
+
+		Convey("should prefer the sharded file over the flat one", func() {
+
+			path, _ := Create(baseDir, "abc", "abc")
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, path)
+
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("old"), 0666)
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, FlatPath(baseDir, "abc"))
+
+			ioutil.WriteFile(path, []byte("new"), 0666)
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, path)
+
+			os.Remove(path)
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, FlatPath(baseDir, "abc"))
+		})
+
+		Convey("should list files in both layouts", func() {
+
+			path, _ := Create(baseDir, "abc", "abc")
+			ioutil.WriteFile(path, []byte("new"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("old"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "def"), []byte("old"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "other"), []byte("other"), 0666)
+
+			names, err := List(baseDir, func(name string) bool { return name != "other" })
+
+			So(err, ShouldBeNil)
+			So(names, ShouldHaveLength, 2)
+			So(names, ShouldContain, "abc")
+			So(names, ShouldContain, "def")
+		})
+
+		Convey("should migrate flat files without overwriting sharded ones", func() {
+
+			path, _ := Create(baseDir, "abc", "abc")
+			ioutil.WriteFile(path, []byte("new"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("old"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "def"), []byte("def"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "other"), []byte("other"), 0666)
+
+			count, err := Migrate(baseDir, &Locks{}, func(name string) (string, bool) { return name, name != "other" })
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			content, _ := ioutil.ReadFile(Locate(baseDir, "abc", "abc"))
+			So(string(content), ShouldEqual, "new")
+
+			content, _ = ioutil.ReadFile(Locate(baseDir, "def", "def"))
+			So(string(content), ShouldEqual, "def")
+			So(Locate(baseDir, "def", "def"), ShouldEqual, Path(baseDir, "def", "def"))
+
+			_, err = os.Stat(FlatPath(baseDir, "other"))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("should move files holding the locks of their objects", func() {
+
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("abc"), 0666)
+
+			locks := &Locks{}
+			unlock := locks.Lock("abc")
+			migrated := make(chan bool)
+
+			go func() {
+				Migrate(baseDir, locks, func(name string) (string, bool) { return name, true })
+				migrated <- true
+			}()
+
+			select {
+			case <-migrated:
+				t.Error("File moved while its object was locked")
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, FlatPath(baseDir, "abc"))
+
+			unlock()
+			So(<-migrated, ShouldBeTrue)
+			So(Locate(baseDir, "abc", "abc"), ShouldEqual, Path(baseDir, "abc", "abc"))
+		})
+
+		Convey("should read files moved after they were located", func() {
+
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("abc"), 0666)
+
+			var content []byte
+			paths := []string{}
+
+			err := Read(baseDir, "abc", "abc", func(path string) (err error) {
+				if len(paths) == 0 {
+					Migrate(baseDir, &Locks{}, func(name string) (string, bool) { return name, true })
+				}
+				paths = append(paths, path)
+				content, err = ioutil.ReadFile(path)
+				return err
+			})
+
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "abc")
+			So(paths, ShouldResemble, []string{FlatPath(baseDir, "abc"), Path(baseDir, "abc", "abc")})
+
+			err = Read(baseDir, "def", "def", func(path string) error {
+				_, err := ioutil.ReadFile(path)
+				return err
+			})
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("should remove files from both layouts", func() {
+
+			path, _ := Create(baseDir, "abc", "abc")
+			ioutil.WriteFile(path, []byte("new"), 0666)
+			ioutil.WriteFile(FlatPath(baseDir, "abc"), []byte("old"), 0666)
+
+			So(Remove(baseDir, "abc", "abc"), ShouldBeNil)
+			So(Remove(baseDir, "abc", "abc"), ShouldNotBeNil)
+		})
+
+		Convey("should make writers of the same object wait for each other", func() {
+
+			locks := &Locks{}
+			unlock := locks.Lock("abc")
+			locked := make(chan bool)
+
+			go func() {
+				locks.Lock("abc")()
+				locked <- true
+			}()
+
+			select {
+			case <-locked:
+				t.Error("Object locked twice")
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			unlock()
+			So(<-locked, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,188 @@
+package lexicon
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+)
+
+// Entry tells how to pronounce a word or phrase, e.g. a brand name or a product code
+type Entry struct {
+	Grapheme string // The word as written, matched regardless of the case
+	Alias    string `json:",omitempty"` // Read instead of the grapheme, e.g. "ex jay nine" for "XJ9"
+	Phoneme  string `json:",omitempty"` // IPA transcription, for speech synthesizers supporting SSML
+}
+
+// Lexicon holds the pronunciations of a tenant, in a language.
+// Its version is increased on every change, and never decreases.
+type Lexicon struct {
+	Tenant   string
+	Language string
+	Version  int
+	Entries  []Entry // Sorted by grapheme
+}
+
+// Validate returns problems of the entry, if any.
+func (e Entry) Validate() []string {
+
+	problems := []string{}
+
+	if strings.TrimSpace(e.Grapheme) == "" {
+		problems = append(problems, "Grapheme must not be empty")
+	}
+
+	if len(e.Grapheme) > maxGraphemeSize {
+		problems = append(problems, "Grapheme must not be longer than "+strconv.Itoa(maxGraphemeSize)+" bytes")
+	}
+
+	if strings.TrimSpace(e.Alias) == "" && strings.TrimSpace(e.Phoneme) == "" {
+		problems = append(problems, "Alias or Phoneme must be set")
+	}
+
+	return problems
+}
+
+const maxGraphemeSize = 100
+
+// Lookup returns the entry of the grapheme, regardless of its case.
+func (l Lexicon) Lookup(grapheme string) (Entry, bool) {
+
+	for _, e := range l.Entries {
+
+		if strings.EqualFold(e.Grapheme, grapheme) {
+			return e, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// Apply replaces the graphemes of the text with their aliases.
+// Entries with phonemes only are left as they are, as plain texts have no way to carry them.
+func (l Lexicon) Apply(text string) string {
+
+	var b bytes.Buffer
+
+	l.each(text, func(plain string, e *Entry) {
+
+		if e != nil && e.Alias != "" {
+			b.WriteString(e.Alias)
+		} else {
+			b.WriteString(plain)
+		}
+	})
+
+	return b.String()
+}
+
+// ApplySsml marks the graphemes of the document with <phoneme> elements, if phonemes are supported and set,
+// or with <sub> elements otherwise. Texts read in a specific way (<say-as>, <sub>, <phoneme>) are left as they are.
+func (l Lexicon) ApplySsml(root *ssml.Node, phonemes bool) *ssml.Node {
+
+	if len(l.Entries) == 0 {
+		return root
+	}
+
+	return root.Expand(func(text string) []*ssml.Node {
+
+		nodes := []*ssml.Node{}
+
+		l.each(text, func(plain string, e *Entry) {
+
+			switch {
+			case e == nil:
+				nodes = append(nodes, &ssml.Node{Text: plain})
+			case phonemes && e.Phoneme != "":
+				nodes = append(nodes, &ssml.Node{Name: "phoneme", Attrs: map[string]string{"alphabet": "ipa", "ph": e.Phoneme},
+					Children: []*ssml.Node{{Text: plain}}})
+			case e.Alias != "":
+				nodes = append(nodes, &ssml.Node{Name: "sub", Attrs: map[string]string{"alias": e.Alias},
+					Children: []*ssml.Node{{Text: plain}}})
+			default:
+				nodes = append(nodes, &ssml.Node{Text: plain})
+			}
+		})
+
+		return nodes
+	})
+}
+
+// each calls fn with the consecutive parts of the text: the graphemes with their entries, and the texts between them.
+// Graphemes match whole words only, longer ones first.
+func (l Lexicon) each(text string, fn func(plain string, e *Entry)) {
+
+	if len(l.Entries) == 0 {
+		fn(text, nil)
+		return
+	}
+
+	pattern := l.pattern()
+	start := 0
+
+	for pos := 0; pos < len(text); {
+
+		loc := pattern.FindStringIndex(text[pos:])
+		if loc == nil {
+			break
+		}
+
+		from, to := pos+loc[0], pos+loc[1]
+
+		if !wordBoundary(text, from) || !wordBoundary(text, to) {
+			_, size := utf8.DecodeRuneInString(text[from:])
+			pos = from + size
+			continue
+		}
+
+		if from > start {
+			fn(text[start:from], nil)
+		}
+
+		e, _ := l.Lookup(text[from:to])
+		fn(text[from:to], &e)
+
+		start, pos = to, to
+	}
+
+	if start < len(text) {
+		fn(text[start:], nil)
+	}
+}
+
+// pattern matches any of the graphemes, regardless of the case
+func (l Lexicon) pattern() *regexp.Regexp {
+
+	graphemes := []string{}
+	for _, e := range l.Entries {
+		graphemes = append(graphemes, regexp.QuoteMeta(e.Grapheme))
+	}
+
+	// Alternatives are matched in order
+	sort.SliceStable(graphemes, func(i, j int) bool { return len(graphemes[i]) > len(graphemes[j]) })
+
+	return regexp.MustCompile("(?i)" + strings.Join(graphemes, "|"))
+}
+
+// wordBoundary tells if the position of the text isn't inside a word
+func wordBoundary(text string, pos int) bool {
+
+	if pos == 0 || pos == len(text) {
+		return true
+	}
+
+	before, _ := utf8.DecodeLastRuneInString(text[:pos])
+	after, _ := utf8.DecodeRuneInString(text[pos:])
+
+	return !isWordRune(before) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,61 @@
+package lexicon
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+)
+
+func TestLexicon(t *testing.T) {
+
+	Convey("Lexicon", t, func() {
+
+		l := Lexicon{Entries: []Entry{
+			{Grapheme: "XJ9", Alias: "ex jay nine"},
+			{Grapheme: "Nike", Alias: "nai key", Phoneme: "ˈnaɪki"},
+			{Grapheme: "Nike Air", Alias: "nai key air"},
+			{Grapheme: "Hermès", Phoneme: "ɛʁˈmɛs"},
+		}}
+
+		Convey("should replace whole words with their aliases, regardless of the case", func() {
+
+			So(l.Apply("The xj9 by NIKE, not XJ90 or Nikes."), ShouldEqual, "The ex jay nine by nai key, not XJ90 or Nikes.")
+		})
+
+		Convey("should prefer longer graphemes", func() {
+
+			So(l.Apply("Nike Air Max"), ShouldEqual, "nai key air Max")
+		})
+
+		Convey("should leave graphemes without aliases in plain texts", func() {
+
+			So(l.Apply("Hermès bag"), ShouldEqual, "Hermès bag")
+		})
+
+		Convey("should mark graphemes of SSML documents with phonemes, if supported", func() {
+
+			root, _ := ssml.Parse(`<speak>Nike &amp; Hermès <sub alias="x">XJ9</sub> XJ9</speak>`)
+
+			So(l.ApplySsml(root, true).String(), ShouldEqual, `<speak><phoneme alphabet="ipa" ph="ˈnaɪki">Nike</phoneme> &amp; `+
+				`<phoneme alphabet="ipa" ph="ɛʁˈmɛs">Hermès</phoneme> <sub alias="x">XJ9</sub> <sub alias="ex jay nine">XJ9</sub></speak>`)
+
+			So(l.ApplySsml(root, false).String(), ShouldEqual, `<speak><sub alias="nai key">Nike</sub> &amp; `+
+				`Hermès <sub alias="x">XJ9</sub> <sub alias="ex jay nine">XJ9</sub></speak>`)
+		})
+
+		Convey("should leave texts unchanged if empty", func() {
+
+			So(Lexicon{}.Apply("Nike"), ShouldEqual, "Nike")
+		})
+	})
+
+	Convey("Lexicon entry", t, func() {
+
+		Convey("should require a grapheme and its pronunciation", func() {
+
+			So(Entry{Grapheme: "XJ9", Alias: "ex jay nine"}.Validate(), ShouldBeEmpty)
+			So(Entry{Grapheme: " "}.Validate(), ShouldResemble, []string{"Grapheme must not be empty", "Alias or Phoneme must be set"})
+		})
+	})
+}
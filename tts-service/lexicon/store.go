@@ -0,0 +1,158 @@
+package lexicon
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+)
+
+// Store keeps lexicons in files, one per tenant and language: <tenant>/<language>.json, see filestore
+type Store struct {
+	files *filestore.Store
+	lock  sync.Mutex // Changes read and write the whole lexicon
+}
+
+// NewStore creates a store in the LEXICON_BASE_DIR directory.
+func NewStore() *Store {
+
+	return &Store{files: filestore.NewStore("LEXICON_BASE_DIR", "lexicons")}
+}
+
+// DefaultTenant owns the lexicons of requests without a tenant
+const DefaultTenant = "default"
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidTenant tells if the tenant ID is safe to be used as a directory name.
+// Names of shards, e.g. "ab", would be mistaken for them by filestore.
+func ValidTenant(tenant string) bool {
+
+	return tenantPattern.MatchString(tenant) && tenant != "." && tenant != ".." && !layout.IsShard(tenant)
+}
+
+// Get returns the lexicon of the tenant in the language.
+// Missing lexicons are empty, of version 0.
+func (s *Store) Get(tenant, language string) (Lexicon, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.read(tenant, language)
+}
+
+// Put adds the entry to the lexicon, or replaces the entry of the same grapheme.
+// It returns the changed lexicon or an error, if any.
+func (s *Store) Put(tenant, language string, entry Entry) (Lexicon, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l, err := s.read(tenant, language)
+	if err != nil {
+		return l, err
+	}
+
+	entry.Grapheme = strings.TrimSpace(entry.Grapheme)
+	entries := []Entry{entry}
+
+	for _, e := range l.Entries {
+		if !strings.EqualFold(e.Grapheme, entry.Grapheme) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Grapheme < entries[j].Grapheme })
+	l.Entries = entries
+	err = s.write(&l)
+
+	return l, err
+}
+
+// Delete removes the entry of the grapheme from the lexicon.
+// It returns the changed lexicon, NotFoundError if there's no such entry, or another error, if any.
+func (s *Store) Delete(tenant, language, grapheme string) (Lexicon, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l, err := s.read(tenant, language)
+	if err != nil {
+		return l, err
+	}
+
+	entries := []Entry{}
+
+	for _, e := range l.Entries {
+		if !strings.EqualFold(e.Grapheme, grapheme) {
+			entries = append(entries, e)
+		}
+	}
+
+	if len(entries) == len(l.Entries) {
+		return l, NotFound(grapheme)
+	}
+
+	// The emptied lexicon is kept, so that its version doesn't start over
+	l.Entries = entries
+	err = s.write(&l)
+
+	return l, err
+}
+
+// Rotate re-encrypts the lexicons with the active master key.
+// It returns the number of re-encrypted lexicons and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	return s.files.Rotate()
+}
+
+// Migrate moves the lexicons stored in flat directories into the sharded layout.
+// It returns the number of moved lexicons and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	return s.files.Migrate()
+}
+
+func (s *Store) read(tenant, language string) (Lexicon, error) {
+
+	l := Lexicon{Tenant: tenant, Language: language, Entries: []Entry{}}
+
+	err := s.files.In(tenant).ReadJSON(language+extension, &l)
+
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+
+	return l, err
+}
+
+// write stores the next version of the lexicon
+func (s *Store) write(l *Lexicon) error {
+
+	l.Version++
+
+	// Readers never see a partially written lexicon
+	return s.files.In(l.Tenant).WriteJSON(l.Language+extension, l)
+}
+
+const extension = ".json"
+
+// NotFoundError is returned when deleting a missing entry
+type NotFoundError struct {
+	Message string
+}
+
+func (err NotFoundError) Error() string {
+
+	return err.Message
+}
+
+func NotFound(grapheme string) NotFoundError {
+
+	return NotFoundError{"Lexicon entry '" + grapheme + "' doesn't exist"}
+}
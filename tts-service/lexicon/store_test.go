@@ -0,0 +1,83 @@
+package lexicon
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("Lexicon store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "lexicon")
+		defer os.RemoveAll(dir)
+
+		store := &Store{files: filestore.New(dir, &envelope.Keyring{})}
+
+		Convey("should return empty lexicons of version 0 if missing", func() {
+
+			l, err := store.Get("acme", "EN")
+
+			So(err, ShouldBeNil)
+			So(l, ShouldResemble, Lexicon{Tenant: "acme", Language: "EN", Entries: []Entry{}})
+		})
+
+		Convey("should increase the version on every change", func() {
+
+			store.Put("acme", "EN", Entry{Grapheme: "XJ9", Alias: "ex jay nine"})
+			l, err := store.Put("acme", "EN", Entry{Grapheme: " Acme ", Alias: "ak me"})
+
+			So(err, ShouldBeNil)
+			So(l.Version, ShouldEqual, 2)
+			So(l.Entries, ShouldResemble, []Entry{{Grapheme: "Acme", Alias: "ak me"}, {Grapheme: "XJ9", Alias: "ex jay nine"}})
+
+			stored, _ := store.Get("acme", "EN")
+			So(stored, ShouldResemble, l)
+		})
+
+		Convey("should replace the entry of the same grapheme", func() {
+
+			store.Put("acme", "EN", Entry{Grapheme: "XJ9", Alias: "ex jay nine"})
+			l, _ := store.Put("acme", "EN", Entry{Grapheme: "xj9", Phoneme: "ɛks dʒeɪ naɪn"})
+
+			So(l.Entries, ShouldResemble, []Entry{{Grapheme: "xj9", Phoneme: "ɛks dʒeɪ naɪn"}})
+		})
+
+		Convey("should keep lexicons of tenants and languages apart", func() {
+
+			store.Put("acme", "EN", Entry{Grapheme: "XJ9", Alias: "ex jay nine"})
+
+			l, _ := store.Get("acme", "PL")
+			So(l.Entries, ShouldBeEmpty)
+
+			l, _ = store.Get("other", "EN")
+			So(l.Entries, ShouldBeEmpty)
+		})
+
+		Convey("should delete entries, without resetting the version", func() {
+
+			store.Put("acme", "EN", Entry{Grapheme: "XJ9", Alias: "ex jay nine"})
+
+			l, err := store.Delete("acme", "EN", "xj9")
+			So(err, ShouldBeNil)
+			So(l.Entries, ShouldBeEmpty)
+			So(l.Version, ShouldEqual, 2)
+
+			_, err = store.Delete("acme", "EN", "XJ9")
+			So(err, ShouldHaveSameTypeAs, NotFoundError{})
+		})
+	})
+
+	Convey("Tenant validation", t, func() {
+
+		So(ValidTenant("acme-01"), ShouldBeTrue)
+		So(ValidTenant(""), ShouldBeFalse)
+		So(ValidTenant("../etc"), ShouldBeFalse)
+		So(ValidTenant("ab"), ShouldBeFalse)
+		So(ValidTenant("AB"), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,325 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Numbers like "1,500.25" or "-3"
+const enNumber = `-?(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?`
+
+var english = []rule{
+
+	// 2017-05-12
+	{regexp.MustCompile(`(\d{4})-(\d{2})-(\d{2})`), func(m []string) (string, bool) {
+		return enDate(digits(m[1]), digits(m[2]), digits(m[3]))
+	}},
+
+	// 05/12/2017 (month first) or 12.05.2017 (day first)
+	{regexp.MustCompile(`(\d{1,2})([./])(\d{1,2})[./](\d{4})`), func(m []string) (string, bool) {
+		if m[2] == "/" {
+			return enDate(digits(m[4]), digits(m[1]), digits(m[3]))
+		}
+		return enDate(digits(m[4]), digits(m[3]), digits(m[1]))
+	}},
+
+	// May 12th, 2017
+	{regexp.MustCompile(`(` + enMonthPattern + `)\.? (\d{1,2})(?:st|nd|rd|th)?(?:,? (\d{4}))?`), func(m []string) (string, bool) {
+		words := enMonth(m[1]) + " " + enOrdinal(digits(m[2]))
+		if m[3] != "" {
+			words += ", " + enYear(digits(m[3]))
+		}
+		return words, digits(m[2]) >= 1 && digits(m[2]) <= 31
+	}},
+
+	// 12th May 2017
+	{regexp.MustCompile(`(\d{1,2})(?:st|nd|rd|th)? (` + enMonthPattern + `)\.?(?: (\d{4}))?`), func(m []string) (string, bool) {
+		words := "the " + enOrdinal(digits(m[1])) + " of " + enMonth(m[2])
+		if m[3] != "" {
+			words += " " + enYear(digits(m[3]))
+		}
+		return words, digits(m[1]) >= 1 && digits(m[1]) <= 31
+	}},
+
+	// 9:30, 9:30 pm
+	{regexp.MustCompile(`(\d{1,2}):(\d{2})(?:\s?([AaPp])(?:\.[Mm]\.|[Mm]\b))?`), func(m []string) (string, bool) {
+		return enTime(digits(m[1]), digits(m[2]), strings.ToUpper(m[3]))
+	}},
+
+	// $5, €3.50
+	{regexp.MustCompile(`([$€£])\s?(` + enNumber + `)`), func(m []string) (string, bool) {
+		return enMoney(m[2], enCurrencySymbols[m[1]])
+	}},
+
+	// 5 USD, 3.50 €
+	{regexp.MustCompile(`(` + enNumber + `)\s?(USD|EUR|GBP|PLN|zł|[$€£])`), func(m []string) (string, bool) {
+		currency := m[2]
+		if symbol, ok := enCurrencySymbols[currency]; ok {
+			currency = symbol
+		}
+		return enMoney(m[1], currency)
+	}},
+
+	// 5 km, 20%. Seconds need a space, as "90s" are rather years.
+	{regexp.MustCompile(`(` + enNumber + `)(?:\s?(km/h|mph|km|cm|mm|kg|ml|min|°C|°F|%|m|g|l|h)|\s(s))`), func(m []string) (string, bool) {
+		n, ok := parseNumber(m[1], ".", ",")
+		unit := enUnits[m[2]+m[3]]
+		if n.fraction == "" && (n.integer == 1 || n.integer == -1) {
+			return enNumberWords(n) + " " + unit[0], ok
+		}
+		return enNumberWords(n) + " " + unit[1], ok
+	}},
+
+	// 1st, 22nd
+	{regexp.MustCompile(`(\d+)(?:st|nd|rd|th)`), func(m []string) (string, bool) {
+		n, ok := parseNumber(m[1], ".", ",")
+		return enOrdinal(n.integer), ok
+	}},
+
+	// No. 5
+	{regexp.MustCompile(`No\.\s?(\d+)`), func(m []string) (string, bool) {
+		return "number " + m[1], true
+	}},
+
+	// in 1999
+	{regexp.MustCompile(`(?i)(in|since|until|till|by|from|before|after|year)\s+(\d{4})`), func(m []string) (string, bool) {
+		year := digits(m[2])
+		return m[1] + " " + enYear(year), year >= 1100 && year < 2100
+	}},
+
+	wordsRule(map[string]string{
+		"Mr.":     "mister",
+		"Mrs.":    "missus",
+		"Ms.":     "miz",
+		"Dr.":     "doctor",
+		"Prof.":   "professor",
+		"St.":     "saint",
+		"Jr.":     "junior",
+		"Sr.":     "senior",
+		"Inc.":    "incorporated",
+		"Ltd.":    "limited",
+		"Corp.":   "corporation",
+		"vs.":     "versus",
+		"etc.":    "et cetera.",
+		"e.g.":    "for example",
+		"i.e.":    "that is",
+		"approx.": "approximately",
+		"dept.":   "department",
+	}),
+
+	{regexp.MustCompile(enNumber), func(m []string) (string, bool) {
+		n, ok := parseNumber(m[0], ".", ",")
+		return enNumberWords(n), ok
+	}},
+}
+
+var enOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+	"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+var enTens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+var enScales = []string{"", "thousand", "million", "billion", "trillion"}
+
+// enCardinal returns words of the number, e.g. "twenty-one"
+func enCardinal(n int64) string {
+
+	switch {
+	case n < 0:
+		return "minus " + enCardinal(-n)
+	case n < 20:
+		return enOnes[n]
+	case n < 100:
+		words := enTens[n/10]
+		if n%10 > 0 {
+			words += "-" + enOnes[n%10]
+		}
+		return words
+	case n < 1000:
+		words := enOnes[n/100] + " hundred"
+		if n%100 > 0 {
+			words += " " + enCardinal(n%100)
+		}
+		return words
+	}
+
+	scale, i := int64(1000), 1
+	for n/scale >= 1000 {
+		scale *= 1000
+		i++
+	}
+
+	words := enCardinal(n/scale) + " " + enScales[i]
+	if n%scale > 0 {
+		words += " " + enCardinal(n%scale)
+	}
+
+	return words
+}
+
+// enOrdinal returns words of the ordinal number, e.g. "twenty-first"
+func enOrdinal(n int64) string {
+
+	words := enCardinal(n)
+	i := strings.LastIndexAny(words, " -") + 1
+	last := words[i:]
+
+	switch {
+	case enIrregularOrdinals[last] != "":
+		last = enIrregularOrdinals[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+
+	return words[:i] + last
+}
+
+var enIrregularOrdinals = map[string]string{
+	"one": "first", "two": "second", "three": "third", "five": "fifth", "eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+}
+
+// enNumberWords returns words of the number, e.g. "three point one four"
+func enNumberWords(n number) string {
+
+	words := enCardinal(n.integer)
+
+	if n.fraction != "" {
+		words += " point"
+		for _, digit := range n.fraction {
+			words += " " + enOnes[digit-'0']
+		}
+	}
+
+	return words
+}
+
+// enYear returns the year as it's read, e.g. "nineteen ninety-nine", "two thousand five"
+func enYear(year int64) string {
+
+	switch {
+	case year < 1000 || year > 9999 || year%1000 == 0 || year >= 2000 && year < 2010:
+		return enCardinal(year)
+	case year%100 == 0:
+		return enCardinal(year/100) + " hundred"
+	case year%100 < 10:
+		return enCardinal(year/100) + " oh " + enOnes[year%100]
+	default:
+		return enCardinal(year/100) + " " + enCardinal(year%100)
+	}
+}
+
+func enDate(year, month, day int64) (string, bool) {
+
+	if !validDate(year, month, day) {
+		return "", false
+	}
+
+	return enMonths[month-1] + " " + enOrdinal(day) + ", " + enYear(year), true
+}
+
+var enMonths = []string{"January", "February", "March", "April", "May", "June",
+	"July", "August", "September", "October", "November", "December"}
+
+const enMonthPattern = `January|February|March|April|May|June|July|August|September|October|November|December|` +
+	`Jan|Feb|Mar|Apr|Jun|Jul|Aug|Sept|Sep|Oct|Nov|Dec`
+
+// enMonth returns the full name of the month, e.g. "September" for "Sept"
+func enMonth(name string) string {
+
+	for _, month := range enMonths {
+		if strings.HasPrefix(month, name) {
+			return month
+		}
+	}
+
+	return name
+}
+
+// enTime returns the time as it's read, e.g. "nine oh five PM"
+func enTime(hour, minute int64, period string) (string, bool) {
+
+	if period != "" {
+		period = " " + period + "M"
+	}
+
+	if hour > 23 || minute > 59 || period != "" && (hour == 0 || hour > 12) {
+		return "", false
+	}
+
+	words := enCardinal(hour)
+
+	switch {
+	case minute == 0 && period == "":
+		words += " o'clock"
+	case minute == 0:
+	case minute < 10:
+		words += " oh " + enOnes[minute]
+	default:
+		words += " " + enCardinal(minute)
+	}
+
+	return words + period, true
+}
+
+// enMoney returns the amount of money as it's read, e.g. "three dollars and fifty cents"
+func enMoney(amount string, currency string) (string, bool) {
+
+	n, ok := parseNumber(amount, ".", ",")
+	names := enCurrencies[currency]
+
+	// Fractions of cents are rather prices per unit, e.g. "$0.125"
+	if len(n.fraction) > 2 {
+		return enNumberWords(n) + " " + names[1], ok
+	}
+
+	minor := digits((n.fraction + "00")[:2])
+	words := []string{}
+
+	if n.integer != 0 || minor == 0 {
+		words = append(words, enCardinal(n.integer)+" "+enPlural(n.integer, names[0], names[1]))
+	}
+
+	if minor != 0 {
+		words = append(words, enCardinal(minor)+" "+enPlural(minor, names[2], names[3]))
+	}
+
+	return strings.Join(words, " and "), ok
+}
+
+func enPlural(n int64, one, many string) string {
+
+	if n == 1 || n == -1 {
+		return one
+	}
+
+	return many
+}
+
+var enCurrencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "zł": "PLN"}
+
+// Names of currencies and their subunits: singular and plural
+var enCurrencies = map[string][4]string{
+	"USD": {"dollar", "dollars", "cent", "cents"},
+	"EUR": {"euro", "euros", "cent", "cents"},
+	"GBP": {"pound", "pounds", "penny", "pence"},
+	"PLN": {"zloty", "zlotys", "grosz", "groszy"},
+}
+
+// Names of units: singular and plural
+var enUnits = map[string][2]string{
+	"km/h": {"kilometer per hour", "kilometers per hour"},
+	"mph":  {"mile per hour", "miles per hour"},
+	"km":   {"kilometer", "kilometers"},
+	"m":    {"meter", "meters"},
+	"cm":   {"centimeter", "centimeters"},
+	"mm":   {"millimeter", "millimeters"},
+	"kg":   {"kilogram", "kilograms"},
+	"g":    {"gram", "grams"},
+	"l":    {"liter", "liters"},
+	"ml":   {"milliliter", "milliliters"},
+	"h":    {"hour", "hours"},
+	"min":  {"minute", "minutes"},
+	"s":    {"second", "seconds"},
+	"%":    {"percent", "percent"},
+	"°C":   {"degree Celsius", "degrees Celsius"},
+	"°F":   {"degree Fahrenheit", "degrees Fahrenheit"},
+}
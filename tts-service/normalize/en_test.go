@@ -0,0 +1,67 @@
+package normalize
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEnglish(t *testing.T) {
+
+	Convey("English normalization", t, func() {
+
+		Convey("should read numbers", func() {
+
+			So(Text("0 7 13 21 100 105 1,500 1000000", "EN"), ShouldEqual,
+				"zero seven thirteen twenty-one one hundred one hundred five one thousand five hundred one million")
+			So(Text("-7 and 3.14", "EN"), ShouldEqual, "minus seven and three point one four")
+		})
+
+		Convey("should read ordinals", func() {
+
+			So(Text("1st 2nd 3rd 12th 22nd 100th", "EN"), ShouldEqual,
+				"first second third twelfth twenty-second one hundredth")
+		})
+
+		Convey("should read dates", func() {
+
+			So(Text("2017-05-12", "EN"), ShouldEqual, "May twelfth, twenty seventeen")
+			So(Text("05/12/2017", "EN"), ShouldEqual, "May twelfth, twenty seventeen")
+			So(Text("12.05.2017", "EN"), ShouldEqual, "May twelfth, twenty seventeen")
+			So(Text("Sept 1st, 1939", "EN"), ShouldEqual, "September first, nineteen thirty-nine")
+			So(Text("4 July 2005", "EN"), ShouldEqual, "the fourth of July two thousand five")
+		})
+
+		Convey("should read years after prepositions", func() {
+
+			So(Text("in 1999, since 1900 and until 2010", "EN"), ShouldEqual,
+				"in nineteen ninety-nine, since nineteen hundred and until twenty ten")
+		})
+
+		Convey("should read times", func() {
+
+			So(Text("9:00, 9:05, 9:30 pm and 12:15 a.m.", "EN"), ShouldEqual,
+				"nine o'clock, nine oh five, nine thirty PM and twelve fifteen AM")
+		})
+
+		Convey("should read money", func() {
+
+			So(Text("$1", "EN"), ShouldEqual, "one dollar")
+			So(Text("$3.50", "EN"), ShouldEqual, "three dollars and fifty cents")
+			So(Text("€0.01", "EN"), ShouldEqual, "one cent")
+			So(Text("£2.5", "EN"), ShouldEqual, "two pounds and fifty pence")
+			So(Text("1,500 PLN", "EN"), ShouldEqual, "one thousand five hundred zlotys")
+		})
+
+		Convey("should read units", func() {
+
+			So(Text("1 km, 5km, 2.5 kg, 30 min, 10 s, 20% and 21°C", "EN"), ShouldEqual,
+				"one kilometer, five kilometers, two point five kilograms, thirty minutes, ten seconds, twenty percent and twenty-one degrees Celsius")
+		})
+
+		Convey("should expand abbreviations", func() {
+
+			So(Text("Dr. Smith met Mr. Jones, e.g. at St. Mary's No. 5 etc.", "EN"), ShouldEqual,
+				"Doctor Smith met Mister Jones, for example at Saint Mary's number five et cetera.")
+		})
+	})
+}
@@ -0,0 +1,230 @@
+// Package normalize rewrites numbers, dates, times, currencies, units and abbreviations as words,
+// the way they are read aloud, so that speech synthesizers don't have to guess how to read them.
+package normalize
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Text returns the text normalized according to the rules of the given language, e.g. "EN" or "PL".
+// Text in other languages is returned unchanged.
+func Text(text, lang string) string {
+
+	for _, r := range rules[lang] {
+		text = r.apply(text)
+	}
+
+	return text
+}
+
+// Rules of each language, applied in order.
+// Dates and times go first, as they are made of numbers, and plain numbers go last.
+var rules = map[string][]rule{
+	"EN": english,
+	"PL": polish,
+}
+
+// rule rewrites fragments of the text matching its pattern.
+// The replace function gets the submatches, and may refuse to rewrite the fragment (e.g. "31.02.2017").
+type rule struct {
+	pattern *regexp.Regexp
+	replace func(m []string) (string, bool)
+}
+
+// apply rewrites all the separate fragments matching the rule.
+// Fragments glued to other words or numbers (e.g. "MP3", "192.168.0.1") are left as they are.
+func (r rule) apply(text string) string {
+
+	var b bytes.Buffer
+	pos, written := 0, 0
+
+	for pos < len(text) {
+
+		loc := r.pattern.FindStringSubmatchIndex(text[pos:])
+
+		if loc == nil {
+			break
+		}
+
+		start, end := pos+loc[0], pos+loc[1]
+		replacement, ok := "", false
+
+		if isSeparate(text, start, end) {
+			replacement, ok = r.replace(submatches(text[pos:], loc))
+		}
+
+		if !ok {
+			// A shorter fragment starting further may still match
+			_, size := utf8.DecodeRuneInString(text[start:])
+			pos = start + size
+			continue
+		}
+
+		b.WriteString(text[written:start])
+		b.WriteString(replacement)
+		pos, written = end, end
+	}
+
+	b.WriteString(text[written:])
+
+	return b.String()
+}
+
+func submatches(text string, loc []int) []string {
+
+	m := make([]string, len(loc)/2)
+
+	for i := range m {
+		if loc[2*i] >= 0 {
+			m[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+
+	return m
+}
+
+// isSeparate tells if text[start:end] isn't a part of a longer word or number
+func isSeparate(text string, start, end int) bool {
+
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+
+	if isWordRune(before) || isWordRune(after) {
+		return false
+	}
+
+	// Decimal or thousands separators, parts of dates, times, versions...
+	if strings.ContainsRune(separators, before) {
+
+		previous, _ := utf8.DecodeLastRuneInString(text[:start-1])
+		if unicode.IsDigit(previous) {
+			return false
+		}
+	}
+
+	if strings.ContainsRune(separators, after) {
+
+		next, _ := utf8.DecodeRuneInString(text[end+1:])
+		if unicode.IsDigit(next) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isWordRune(r rune) bool {
+
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+const separators = ".,:/"
+
+// number is a decimal number, as written in the text
+type number struct {
+	integer  int64
+	fraction string // Digits after the decimal separator, if any
+}
+
+// parseNumber parses the number, ignoring the thousands separators.
+// Numbers too big to be read aloud are refused.
+func parseNumber(s string, decimalSeparator string, thousandsSeparators string) (number, bool) {
+
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	integer, fraction := s, ""
+	if i := strings.Index(s, decimalSeparator); i >= 0 {
+		integer, fraction = s[:i], s[i+len(decimalSeparator):]
+	}
+
+	integer = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(thousandsSeparators, r) {
+			return -1
+		}
+		return r
+	}, integer)
+
+	value, err := strconv.ParseInt(integer, 10, 64)
+
+	if err != nil || value > maxNumber {
+		return number{}, false
+	}
+
+	if negative {
+		value = -value
+	}
+
+	return number{value, fraction}, true
+}
+
+// Numbers up to trillions have names in all the languages
+const maxNumber = 999999999999999
+
+// digits returns the value of a string of digits
+func digits(s string) int64 {
+
+	value, _ := strconv.ParseInt(s, 10, 64)
+	return value
+}
+
+// validDate tells if the day exists in the month of the year
+func validDate(year, month, day int64) bool {
+
+	if month < 1 || month > 12 || day < 1 {
+		return false
+	}
+
+	daysInMonth := []int64{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}[month-1]
+	if month == 2 && year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+		daysInMonth = 29
+	}
+
+	return day <= daysInMonth
+}
+
+// wordsRule rewrites the words (e.g. abbreviations) of the dictionary.
+// Words are matched as written, or capitalized, and the replacement is capitalized accordingly.
+func wordsRule(dictionary map[string]string) rule {
+
+	alternatives := []string{}
+	replacements := map[string]string{}
+
+	for word, replacement := range dictionary {
+
+		for _, variant := range []string{word, capitalize(word)} {
+			alternatives = append(alternatives, regexp.QuoteMeta(variant))
+			replacements[variant] = replacement
+		}
+	}
+
+	// Longer words first, so that "itd." wins over "it"
+	sort.Slice(alternatives, func(i, j int) bool {
+		return len(alternatives[i]) > len(alternatives[j])
+	})
+
+	return rule{
+		regexp.MustCompile(strings.Join(alternatives, "|")),
+		func(m []string) (string, bool) {
+
+			replacement := replacements[m[0]]
+			if capitalize(m[0]) == m[0] {
+				replacement = capitalize(replacement)
+			}
+
+			return replacement, true
+		},
+	}
+}
+
+func capitalize(s string) string {
+
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
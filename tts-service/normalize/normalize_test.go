@@ -0,0 +1,40 @@
+package normalize
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+
+	Convey("Text normalization", t, func() {
+
+		Convey("should leave text in unknown languages unchanged", func() {
+
+			So(Text("Dr. Who, 12.05.2017 12:30", "DE"), ShouldEqual, "Dr. Who, 12.05.2017 12:30")
+		})
+
+		Convey("should leave text without numbers and abbreviations unchanged", func() {
+
+			So(Text("Hello, World!", "EN"), ShouldEqual, "Hello, World!")
+			So(Text("Zażółć gęślą jaźń.", "PL"), ShouldEqual, "Zażółć gęślą jaźń.")
+		})
+
+		Convey("should not rewrite numbers glued to words or other numbers", func() {
+
+			So(Text("MP3 file at 192.168.0.1, version 1.2.3", "EN"), ShouldEqual, "MP3 file at 192.168.0.1, version 1.2.3")
+			So(Text("plik MP3 na 10.0.0.1", "PL"), ShouldEqual, "plik MP3 na 10.0.0.1")
+		})
+
+		Convey("should not rewrite invalid dates and times as such", func() {
+
+			So(Text("31.02.2017", "EN"), ShouldNotContainSubstring, "February")
+			So(Text("25:61", "EN"), ShouldNotContainSubstring, "o'clock")
+		})
+
+		Convey("should leave too big numbers unchanged", func() {
+
+			So(Text("12345678901234567890", "EN"), ShouldEqual, "12345678901234567890")
+		})
+	})
+}
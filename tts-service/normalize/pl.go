@@ -0,0 +1,536 @@
+package normalize
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Numbers like "1 500,25" or "-3". Thousands may be separated with spaces, including the non-breaking ones.
+const plNumber = `-?(?:\d{1,3}(?:[ \x{a0}\x{202f}]\d{3})+|\d+)(?:,\d+)?`
+const plThousandsSeparators = " \u00a0\u202f"
+
+const plMonthPattern = `stycznia|lutego|marca|kwietnia|maja|czerwca|lipca|sierpnia|września|października|listopada|grudnia`
+
+var polish = []rule{
+
+	// 12.05.2017, 12/05/2017 r.
+	{regexp.MustCompile(plPrepositionPattern("dnia", "od", "do", "z") + `(\d{1,2})[./](\d{1,2})[./](\d{4})(?:\s?r\.)?`), func(m []string) (string, bool) {
+		return plDate(m[1], digits(m[4]), digits(m[3]), digits(m[2]))
+	}},
+
+	// 2017-05-12
+	{regexp.MustCompile(plPrepositionPattern("dnia", "od", "do", "z") + `(\d{4})-(\d{2})-(\d{2})(?:\s?r\.)?`), func(m []string) (string, bool) {
+		return plDate(m[1], digits(m[2]), digits(m[3]), digits(m[4]))
+	}},
+
+	// 12 maja 2017 r.
+	{regexp.MustCompile(plPrepositionPattern("dnia", "od", "do", "z") + `(\d{1,2})\s+(` + plMonthPattern + `)(?:\s+(\d{4})(?:\s?r\.|\s+roku)?)?`), func(m []string) (string, bool) {
+		preposition, c := plPreposition(m[1], nominative)
+		words := preposition + plOrdinal(digits(m[2]), masculine, c) + " " + m[3]
+		if m[4] != "" {
+			words += " " + plOrdinal(digits(m[4]), masculine, genitive) + " roku"
+		}
+		return words, digits(m[2]) >= 1 && digits(m[2]) <= 31
+	}},
+
+	// w 2017 r., przed 2017 rokiem
+	{regexp.MustCompile(plPrepositionPattern("w", "po", "od", "do", "z", "około", "ok.", "przed") + `(\d{1,4})\s?(r\.|roku|rokiem)`), func(m []string) (string, bool) {
+		preposition, c := plPreposition(m[1], genitive)
+		noun := "roku"
+		if c == instrumental {
+			noun = "rokiem"
+		}
+		return preposition + plOrdinal(digits(m[2]), masculine, c) + " " + noun, digits(m[2]) > 0
+	}},
+
+	// o godz. 12:30
+	{regexp.MustCompile(plPrepositionPattern("o", "po", "od", "do", "około", "ok.", "koło", "przed", "za", "między", "pomiędzy") +
+		`(?:(godz\.|godzin[aąęiy]|godzinie)\s*)?(\d{1,2}):(\d{2})`), func(m []string) (string, bool) {
+		return plTime(m[1], m[2], digits(m[3]), digits(m[4]))
+	}},
+
+	// $5, €3,50
+	{regexp.MustCompile(plPrepositionPattern(plGenitivePrepositions...) + `([$€£])\s?(` + plNumber + `)`), func(m []string) (string, bool) {
+		return plMoney(m[1], m[3], plCurrencySymbols[m[2]])
+	}},
+
+	// 1 500 zł, 3,50 EUR
+	{regexp.MustCompile(plPrepositionPattern(plGenitivePrepositions...) + `(` + plNumber + `)\s?(zł|PLN|USD|EUR|GBP|[$€£])`), func(m []string) (string, bool) {
+		currency := m[3]
+		if symbol, ok := plCurrencySymbols[currency]; ok {
+			currency = symbol
+		}
+		return plMoney(m[1], m[2], currency)
+	}},
+
+	// około 5 km, 20%. Seconds and abbreviated words need a space.
+	{regexp.MustCompile(plPrepositionPattern(plGenitivePrepositions...) + `(` + plNumber + `)` +
+		`(?:\s(s|gr|godz\.|tys\.|mln|mld)|\s?(km/h|km|cm|mm|kg|ml|min|°C|%|m|g|l|h))`), func(m []string) (string, bool) {
+		preposition, c := plPreposition(m[1], nominative)
+		n, ok := parseNumber(m[2], ",", plThousandsSeparators)
+		unit := plUnits[m[3]+m[4]]
+		if n.fraction != "" {
+			return preposition + plNumberWords(n, unit.gender, c) + " " + unit.part, ok
+		}
+		return preposition + plCardinal(n.integer, unit.gender, c) + " " + unit.form(n.integer, c), ok
+	}},
+
+	wordsRule(map[string]string{
+		"dr":    "doktor",
+		"dr.":   "doktor",
+		"mgr":   "magister",
+		"inż.":  "inżynier",
+		"prof.": "profesor",
+		"hab.":  "habilitowany",
+		"doc.":  "docent",
+		"ks.":   "ksiądz",
+		"płk":   "pułkownik",
+		"gen.":  "generał",
+		"św.":   "święty",
+		"ul.":   "ulica",
+		"al.":   "aleja",
+		"pl.":   "plac",
+		"os.":   "osiedle",
+		"np.":   "na przykład",
+		"tzn.":  "to znaczy",
+		"tj.":   "to jest",
+		"tzw.":  "tak zwany",
+		"m.in.": "między innymi",
+		"ok.":   "około",
+		"godz.": "godzina",
+		"nr":    "numer",
+		"tel.":  "telefon",
+		"itd.":  "i tak dalej.",
+		"itp.":  "i tym podobne.",
+		"wg":    "według",
+		"ww.":   "wyżej wymieniony",
+		"jw.":   "jak wyżej",
+		"im.":   "imienia",
+		"ds.":   "do spraw",
+		"zł":    "złotych",
+	}),
+
+	// około 5
+	{regexp.MustCompile(plPrepositionPattern(plGenitivePrepositions...) + `(` + plNumber + `)`), func(m []string) (string, bool) {
+		preposition, c := plPreposition(m[1], nominative)
+		n, ok := parseNumber(m[2], ",", plThousandsSeparators)
+		return preposition + plNumberWords(n, masculine, c), ok
+	}},
+}
+
+// Grammatical cases numbers are inflected by
+type plCase int
+
+const (
+	nominative plCase = iota
+	genitive
+	locative
+	instrumental
+)
+
+type gender int
+
+const (
+	masculine gender = iota
+	feminine
+	neuter
+)
+
+// Cases governed by prepositions preceding numbers
+var plPrepositions = map[string]plCase{
+	"około": genitive, "ok.": genitive, "koło": genitive, "do": genitive, "od": genitive, "z": genitive, "dnia": genitive,
+	"ponad": genitive, "powyżej": genitive, "poniżej": genitive, "bez": genitive, "dla": genitive, "blisko": genitive,
+	"wokół": genitive, "wśród": genitive, "spośród": genitive,
+	"o": locative, "po": locative, "w": locative,
+	"przed": instrumental, "za": instrumental, "między": instrumental, "pomiędzy": instrumental,
+}
+
+// Prepositions taking the genitive of amounts, e.g. "do 5 zł".
+// The others (e.g. "z 5 zł", "o 5 zł") take different cases depending on the meaning.
+var plGenitivePrepositions = []string{"około", "ok.", "koło", "do", "od", "ponad", "powyżej", "poniżej", "bez", "dla",
+	"blisko", "wokół", "wśród", "spośród"}
+
+// plPrepositionPattern matches an optional preposition followed by spaces, as the first submatch
+func plPrepositionPattern(prepositions ...string) string {
+
+	alternatives := []string{}
+	for _, preposition := range prepositions {
+		alternatives = append(alternatives, regexp.QuoteMeta(preposition))
+	}
+
+	return `((?i:` + strings.Join(alternatives, "|") + `)\s+)?`
+}
+
+// plPreposition returns the preposition matched by plPrepositionPattern, as it's read, and the case it governs.
+// Without a preposition, the given default case is returned.
+func plPreposition(prefix string, defaultCase plCase) (string, plCase) {
+
+	word := strings.TrimSpace(prefix)
+
+	if word == "" {
+		return "", defaultCase
+	}
+
+	c := plPrepositions[strings.ToLower(word)]
+
+	if strings.ToLower(word) == "ok." {
+		if capitalize(word) == word {
+			word = "Około"
+		} else {
+			word = "około"
+		}
+	}
+
+	return word + prefix[len(strings.TrimRightFunc(prefix, unicode.IsSpace)):], c
+}
+
+// plNoun holds the forms of a noun counted with numbers
+type plNoun struct {
+	gender gender
+
+	// Nominative, e.g. "złoty" (1), "złote" (2-4, 22-24...), "złotych" (5-21, 25-31...)
+	one, few, many string
+
+	// Genitive singular, e.g. "złotego", used with fractions
+	part string
+}
+
+// form returns the form of the noun counted with the number, in the given case.
+// Only the nominative and genitive are supported.
+func (n plNoun) form(value int64, c plCase) string {
+
+	if value < 0 {
+		value = -value
+	}
+
+	switch {
+	case c == genitive && value == 1:
+		return n.part
+	case c == genitive:
+		return n.many
+	case value == 1:
+		return n.one
+	case value%10 >= 2 && value%10 <= 4 && (value%100 < 12 || value%100 > 14):
+		return n.few
+	default:
+		return n.many
+	}
+}
+
+var plUnitWords = [2][]string{
+	{"zero", "jeden", "dwa", "trzy", "cztery", "pięć", "sześć", "siedem", "osiem", "dziewięć", "dziesięć",
+		"jedenaście", "dwanaście", "trzynaście", "czternaście", "piętnaście", "szesnaście", "siedemnaście", "osiemnaście", "dziewiętnaście"},
+	{"zera", "jeden", "dwóch", "trzech", "czterech", "pięciu", "sześciu", "siedmiu", "ośmiu", "dziewięciu", "dziesięciu",
+		"jedenastu", "dwunastu", "trzynastu", "czternastu", "piętnastu", "szesnastu", "siedemnastu", "osiemnastu", "dziewiętnastu"},
+}
+var plTensWords = [2][]string{
+	{"", "", "dwadzieścia", "trzydzieści", "czterdzieści", "pięćdziesiąt", "sześćdziesiąt", "siedemdziesiąt", "osiemdziesiąt", "dziewięćdziesiąt"},
+	{"", "", "dwudziestu", "trzydziestu", "czterdziestu", "pięćdziesięciu", "sześćdziesięciu", "siedemdziesięciu", "osiemdziesięciu", "dziewięćdziesięciu"},
+}
+var plHundredsWords = [2][]string{
+	{"", "sto", "dwieście", "trzysta", "czterysta", "pięćset", "sześćset", "siedemset", "osiemset", "dziewięćset"},
+	{"", "stu", "dwustu", "trzystu", "czterystu", "pięciuset", "sześciuset", "siedmiuset", "ośmiuset", "dziewięciuset"},
+}
+
+// "One" on its own agrees with the noun, unlike in compound numbers ("dwadzieścia jeden")
+var plOne = [2][3]string{
+	{"jeden", "jedna", "jedno"},
+	{"jednego", "jednej", "jednego"},
+}
+
+var plScales = []plNoun{
+	{},
+	{masculine, "tysiąc", "tysiące", "tysięcy", "tysiąca"},
+	{masculine, "milion", "miliony", "milionów", "miliona"},
+	{masculine, "miliard", "miliardy", "miliardów", "miliarda"},
+	{masculine, "bilion", "biliony", "bilionów", "biliona"},
+}
+
+// plCardinal returns words of the number agreeing with a noun of the given gender, e.g. "dwie" (godziny).
+// Only the nominative and genitive are supported, other cases fall back to the nominative.
+func plCardinal(n int64, g gender, c plCase) string {
+
+	if c != genitive {
+		c = nominative
+	}
+
+	switch {
+	case n < 0:
+		return "minus " + plCardinal(-n, g, c)
+	case n == 0:
+		return plUnitWords[c][0]
+	case n == 1:
+		return plOne[c][g]
+	}
+
+	words := []string{}
+
+	scale, i := int64(1), 0
+	for n/scale >= 1000 {
+		scale *= 1000
+		i++
+	}
+
+	for ; i >= 0; i, scale = i-1, scale/1000 {
+
+		group := n / scale % 1000
+
+		switch {
+		case group == 0:
+		case i == 0:
+			words = append(words, plHundreds(group, g, c))
+		case group == 1:
+			words = append(words, plScales[i].form(1, c))
+		default:
+			words = append(words, plHundreds(group, masculine, c), plScales[i].form(group, c))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+func plHundreds(n int64, g gender, c plCase) string {
+
+	words := []string{}
+
+	if n >= 100 {
+		words = append(words, plHundredsWords[c][n/100])
+	}
+
+	rest := n % 100
+
+	if rest >= 20 {
+		words = append(words, plTensWords[c][rest/10])
+		rest %= 10
+	}
+
+	switch {
+	case rest == 0:
+	case rest == 2 && g == feminine && c == nominative:
+		words = append(words, "dwie")
+	default:
+		words = append(words, plUnitWords[c][rest])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// plNumberWords returns words of the number, e.g. "trzy przecinek czternaście"
+func plNumberWords(n number, g gender, c plCase) string {
+
+	words := plCardinal(n.integer, g, c)
+
+	if n.fraction == "" {
+		return words
+	}
+
+	words += " przecinek"
+	fraction := strings.TrimLeft(n.fraction, "0")
+
+	for i := len(fraction); i < len(n.fraction); i++ {
+		words += " zero"
+	}
+
+	if len(fraction) > 3 {
+		for _, digit := range fraction {
+			words += " " + plUnitWords[nominative][digit-'0']
+		}
+	} else if fraction != "" {
+		words += " " + plCardinal(digits(fraction), masculine, nominative)
+	}
+
+	return words
+}
+
+var plOrdinalUnits = []string{"", "pierwszy", "drugi", "trzeci", "czwarty", "piąty", "szósty", "siódmy", "ósmy", "dziewiąty", "dziesiąty",
+	"jedenasty", "dwunasty", "trzynasty", "czternasty", "piętnasty", "szesnasty", "siedemnasty", "osiemnasty", "dziewiętnasty"}
+var plOrdinalTens = []string{"", "", "dwudziesty", "trzydziesty", "czterdziesty", "pięćdziesiąty", "sześćdziesiąty",
+	"siedemdziesiąty", "osiemdziesiąty", "dziewięćdziesiąty"}
+var plOrdinalHundreds = []string{"", "setny", "dwusetny", "trzechsetny", "czterechsetny", "pięćsetny", "sześćsetny",
+	"siedemsetny", "osiemsetny", "dziewięćsetny"}
+var plOrdinalThousands = []string{"", "", "dwu", "trzy", "cztero", "pięcio", "sześcio", "siedmio", "ośmio", "dziewięcio"}
+
+// plOrdinal returns words of the ordinal number of the given gender and case, e.g. "dwa tysiące siedemnastego".
+// Only the last two words of compound ordinals are inflected, the rest is a cardinal number.
+func plOrdinal(n int64, g gender, c plCase) string {
+
+	prefix, words := "", []string{}
+
+	switch {
+	case n <= 0 || n > 9999:
+		return plCardinal(n, g, c)
+	case n%100 != 0:
+		if n > 100 {
+			prefix = plCardinal(n-n%100, masculine, nominative) + " "
+		}
+		if rest := n % 100; rest < 20 {
+			words = append(words, plOrdinalUnits[rest])
+		} else {
+			words = append(words, plOrdinalTens[rest/10])
+			if rest%10 > 0 {
+				words = append(words, plOrdinalUnits[rest%10])
+			}
+		}
+	case n%1000 != 0:
+		if n > 1000 {
+			prefix = plCardinal(n-n%1000, masculine, nominative) + " "
+		}
+		words = append(words, plOrdinalHundreds[n%1000/100])
+	default:
+		words = append(words, plOrdinalThousands[n/1000]+"tysięczny")
+	}
+
+	for i := range words {
+		words[i] = plInflect(words[i], g, c)
+	}
+
+	return prefix + strings.Join(words, " ")
+}
+
+// plInflect inflects the ordinal given in masculine nominative, e.g. "drugi" -> "drugiej"
+func plInflect(word string, g gender, c plCase) string {
+
+	// Both "y" and "i" endings are single bytes
+	stem := word[:len(word)-1]
+	soft := strings.HasSuffix(word, "i")
+	hard := !soft || strings.HasSuffix(stem, "g") || strings.HasSuffix(stem, "k")
+
+	i := ""
+	if soft {
+		i = "i"
+	}
+
+	switch {
+	case g == feminine && c == nominative && hard:
+		return stem + "a"
+	case g == feminine && c == nominative:
+		return stem + "ia"
+	case g == feminine && c == instrumental && hard:
+		return stem + "ą"
+	case g == feminine && c == instrumental:
+		return stem + "ią"
+	case g == feminine:
+		return stem + i + "ej"
+	case c == genitive:
+		return stem + i + "ego"
+	case c == locative || c == instrumental:
+		if soft {
+			return stem + "im"
+		}
+		return stem + "ym"
+	default:
+		return word
+	}
+}
+
+var plMonths = strings.Split(plMonthPattern, "|")
+
+func plDate(prefix string, year, month, day int64) (string, bool) {
+
+	if !validDate(year, month, day) {
+		return "", false
+	}
+
+	preposition, c := plPreposition(prefix, nominative)
+
+	return preposition + plOrdinal(day, masculine, c) + " " + plMonths[month-1] + " " +
+		plOrdinal(year, masculine, genitive) + " roku", true
+}
+
+// Forms of the "godzina" noun in the cases governed by prepositions
+var plHourNoun = map[plCase]string{nominative: "godzina", genitive: "godziny", locative: "godzinie", instrumental: "godziną"}
+
+// plTime returns the time as it's read, e.g. "o dwunastej trzydzieści"
+func plTime(prefix string, noun string, hour, minute int64) (string, bool) {
+
+	if hour > 23 || minute > 59 {
+		return "", false
+	}
+
+	preposition, c := plPreposition(prefix, nominative)
+
+	words := preposition
+
+	switch noun {
+	case "":
+	case "godz.":
+		words += plHourNoun[c] + " "
+	default:
+		words += noun + " "
+	}
+
+	if hour == 0 {
+		words += plCardinal(0, feminine, nominative)
+	} else {
+		words += plOrdinal(hour, feminine, c)
+	}
+
+	switch {
+	case minute == 0:
+	case minute < 10:
+		words += " zero " + plCardinal(minute, feminine, nominative)
+	default:
+		words += " " + plCardinal(minute, feminine, nominative)
+	}
+
+	return words, true
+}
+
+// plMoney returns the amount of money as it's read, e.g. "dwanaście złotych pięćdziesiąt groszy"
+func plMoney(prefix string, amount string, currency string) (string, bool) {
+
+	n, ok := parseNumber(amount, ",", plThousandsSeparators)
+	preposition, c := plPreposition(prefix, nominative)
+	major, minor := plCurrencies[currency][0], plCurrencies[currency][1]
+
+	// Fractions of grosze are rather prices per unit, e.g. "0,125 zł"
+	if len(n.fraction) > 2 {
+		return preposition + plNumberWords(n, major.gender, c) + " " + major.part, ok
+	}
+
+	minorValue := digits((n.fraction + "00")[:2])
+	words := []string{}
+
+	if n.integer != 0 || minorValue == 0 {
+		words = append(words, plCardinal(n.integer, major.gender, c)+" "+major.form(n.integer, c))
+	}
+
+	if minorValue != 0 {
+		words = append(words, plCardinal(minorValue, minor.gender, c)+" "+minor.form(minorValue, c))
+	}
+
+	return preposition + strings.Join(words, " "), ok
+}
+
+var plCurrencySymbols = map[string]string{"$": "USD", "€": "EUR", "£": "GBP", "zł": "PLN"}
+
+// Names of currencies and their subunits
+var plCurrencies = map[string][2]plNoun{
+	"PLN": {{masculine, "złoty", "złote", "złotych", "złotego"}, {masculine, "grosz", "grosze", "groszy", "grosza"}},
+	"USD": {{masculine, "dolar", "dolary", "dolarów", "dolara"}, {masculine, "cent", "centy", "centów", "centa"}},
+	"EUR": {{neuter, "euro", "euro", "euro", "euro"}, {masculine, "cent", "centy", "centów", "centa"}},
+	"GBP": {{masculine, "funt", "funty", "funtów", "funta"}, {masculine, "pens", "pensy", "pensów", "pensa"}},
+}
+
+var plUnits = map[string]plNoun{
+	"km/h":  {masculine, "kilometr na godzinę", "kilometry na godzinę", "kilometrów na godzinę", "kilometra na godzinę"},
+	"km":    {masculine, "kilometr", "kilometry", "kilometrów", "kilometra"},
+	"m":     {masculine, "metr", "metry", "metrów", "metra"},
+	"cm":    {masculine, "centymetr", "centymetry", "centymetrów", "centymetra"},
+	"mm":    {masculine, "milimetr", "milimetry", "milimetrów", "milimetra"},
+	"kg":    {masculine, "kilogram", "kilogramy", "kilogramów", "kilograma"},
+	"g":     {masculine, "gram", "gramy", "gramów", "grama"},
+	"l":     {masculine, "litr", "litry", "litrów", "litra"},
+	"ml":    {masculine, "mililitr", "mililitry", "mililitrów", "mililitra"},
+	"h":     {feminine, "godzina", "godziny", "godzin", "godziny"},
+	"min":   {feminine, "minuta", "minuty", "minut", "minuty"},
+	"s":     {feminine, "sekunda", "sekundy", "sekund", "sekundy"},
+	"%":     {masculine, "procent", "procent", "procent", "procent"},
+	"°C":    {masculine, "stopień Celsjusza", "stopnie Celsjusza", "stopni Celsjusza", "stopnia Celsjusza"},
+	"godz.": {feminine, "godzina", "godziny", "godzin", "godziny"},
+	"gr":    {masculine, "grosz", "grosze", "groszy", "grosza"},
+	"tys.":  plScales[1],
+	"mln":   plScales[2],
+	"mld":   plScales[3],
+}
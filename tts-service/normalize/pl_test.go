@@ -0,0 +1,74 @@
+package normalize
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestPolish(t *testing.T) {
+
+	Convey("Polish normalization", t, func() {
+
+		Convey("should read numbers", func() {
+
+			So(Text("0, 7, 13, 21, 100, 215, 1 500, 2000, 5000, 1 000 000", "PL"), ShouldEqual,
+				"zero, siedem, trzynaście, dwadzieścia jeden, sto, dwieście piętnaście, tysiąc pięćset, dwa tysiące, pięć tysięcy, milion")
+			So(Text("-7 i 3,14 oraz 2,05", "PL"), ShouldEqual, "minus siedem i trzy przecinek czternaście oraz dwa przecinek zero pięć")
+		})
+
+		Convey("should inflect numbers after prepositions", func() {
+
+			So(Text("około 5, do 21 i od 1", "PL"), ShouldEqual, "około pięciu, do dwudziestu jeden i od jednego")
+		})
+
+		Convey("should read dates", func() {
+
+			So(Text("12.05.2026", "PL"), ShouldEqual, "dwunasty maja dwa tysiące dwudziestego szóstego roku")
+			So(Text("dnia 1.01.2000 r.", "PL"), ShouldEqual, "dnia pierwszego stycznia dwutysięcznego roku")
+			So(Text("2017-11-03", "PL"), ShouldEqual, "trzeci listopada dwa tysiące siedemnastego roku")
+			So(Text("Od 3 maja 1791 r.", "PL"), ShouldEqual, "Od trzeciego maja tysiąc siedemset dziewięćdziesiątego pierwszego roku")
+		})
+
+		Convey("should read years", func() {
+
+			So(Text("w 2026 r.", "PL"), ShouldEqual, "w dwa tysiące dwudziestym szóstym roku")
+			So(Text("przed 1900 rokiem", "PL"), ShouldEqual, "przed tysiąc dziewięćsetnym rokiem")
+			So(Text("2017 r.", "PL"), ShouldEqual, "dwa tysiące siedemnastego roku")
+		})
+
+		Convey("should read times in the case governed by the preposition", func() {
+
+			So(Text("12:30", "PL"), ShouldEqual, "dwunasta trzydzieści")
+			So(Text("o godz. 12:05", "PL"), ShouldEqual, "o godzinie dwunastej zero pięć")
+			So(Text("od 8:00 do 22:22", "PL"), ShouldEqual, "od ósmej do dwudziestej drugiej dwadzieścia dwie")
+			So(Text("przed 3:15", "PL"), ShouldEqual, "przed trzecią piętnaście")
+		})
+
+		Convey("should read money in the right grammatical number", func() {
+
+			So(Text("1 zł", "PL"), ShouldEqual, "jeden złoty")
+			So(Text("2 zł", "PL"), ShouldEqual, "dwa złote")
+			So(Text("12 zł", "PL"), ShouldEqual, "dwanaście złotych")
+			So(Text("22 zł", "PL"), ShouldEqual, "dwadzieścia dwa złote")
+			So(Text("1 500 zł", "PL"), ShouldEqual, "tysiąc pięćset złotych")
+			So(Text("12,50 PLN", "PL"), ShouldEqual, "dwanaście złotych pięćdziesiąt groszy")
+			So(Text("do 2 €", "PL"), ShouldEqual, "do dwóch euro")
+			So(Text("$1,01", "PL"), ShouldEqual, "jeden dolar jeden cent")
+		})
+
+		Convey("should read units in the gender of the unit", func() {
+
+			So(Text("1 h, 2 h, 5 h", "PL"), ShouldEqual, "jedna godzina, dwie godziny, pięć godzin")
+			So(Text("1 km, 2 km, 5 km", "PL"), ShouldEqual, "jeden kilometr, dwa kilometry, pięć kilometrów")
+			So(Text("ok. 1 km i 2,5 kg", "PL"), ShouldEqual, "około jednego kilometra i dwa przecinek pięć kilograma")
+			So(Text("3 tys. zł, 20% i -5°C", "PL"), ShouldEqual, "trzy tysiące złotych, dwadzieścia procent i minus pięć stopni Celsjusza")
+		})
+
+		Convey("should expand abbreviations", func() {
+
+			So(Text("Dr Nowak, prof. Kowalski i mgr inż. Wiśniewski mieszkają m.in. przy ul. Długiej nr 5 itd.", "PL"), ShouldEqual,
+				"Doktor Nowak, profesor Kowalski i magister inżynier Wiśniewski mieszkają między innymi przy ulica Długiej numer pięć i tak dalej.")
+			So(Text("Np. tel. 112", "PL"), ShouldEqual, "Na przykład telefon sto dwanaście")
+		})
+	})
+}
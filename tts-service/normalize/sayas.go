@@ -0,0 +1,134 @@
+package normalize
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// SayAs returns the text read the given way, as SSML <say-as> does, e.g. spelling out "ABC" as characters.
+// The format tells the order of date parts, e.g. "dmy". The result is normalized according to the language.
+func SayAs(interpretAs, format, text, lang string) string {
+
+	text = strings.TrimSpace(text)
+
+	switch interpretAs {
+
+	case "characters", "spell-out":
+		return Text(spaced(text, func(r rune) bool { return !unicode.IsSpace(r) }), lang)
+
+	case "digits":
+		return Text(spaced(text, unicode.IsDigit), lang)
+
+	case "telephone":
+		return Text(telephone(text), lang)
+
+	case "cardinal", "number", "ordinal":
+		return sayNumber(interpretAs, text, lang)
+
+	case "date":
+		return Text(isoDate(text, format), lang)
+
+	default:
+		return Text(text, lang)
+	}
+}
+
+// spaced separates the runes accepted by the filter with spaces, e.g. "ABC" -> "A B C"
+func spaced(text string, separate func(r rune) bool) string {
+
+	var b bytes.Buffer
+
+	for _, r := range text {
+
+		if separate(r) {
+			if b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			b.WriteRune(r)
+		} else if !unicode.IsSpace(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// telephone reads the digits one by one, with pauses between groups, e.g. "+48 123" -> "plus 4 8, 1 2 3"
+func telephone(text string) string {
+
+	groups := []string{}
+
+	for _, group := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsDigit(r) && r != '+' }) {
+
+		if strings.HasPrefix(group, "+") {
+			group = "plus " + group[1:]
+		}
+		groups = append(groups, spaced(group, unicode.IsDigit))
+	}
+
+	return strings.Join(groups, ", ")
+}
+
+// sayNumber reads the number as a cardinal or an ordinal one, e.g. "12" -> "twelfth"
+func sayNumber(interpretAs, text, lang string) string {
+
+	n, ok := parseNumber(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text), ".", ",")
+
+	if !ok || n.fraction != "" {
+		return Text(text, lang)
+	}
+
+	switch {
+	case interpretAs == "ordinal" && lang == "EN":
+		return enOrdinal(n.integer)
+	case interpretAs == "ordinal" && lang == "PL":
+		return plOrdinal(n.integer, masculine, nominative)
+	case lang == "EN":
+		return enCardinal(n.integer)
+	case lang == "PL":
+		return plCardinal(n.integer, masculine, nominative)
+	default:
+		return text
+	}
+}
+
+var datePattern = regexp.MustCompile(`^(\d{1,4})[./-](\d{1,2})[./-](\d{1,4})$`)
+
+// isoDate rewrites the date of the given part order (e.g. "mdy") as "2017-05-12", understood by all the languages
+func isoDate(text, format string) string {
+
+	m := datePattern.FindStringSubmatch(text)
+
+	if m == nil || len(format) != 3 {
+		return text
+	}
+
+	parts := map[byte]string{}
+	for i := 0; i < 3; i++ {
+		parts[format[i]] = m[i+1]
+	}
+
+	year, month, day := parts['y'], parts['m'], parts['d']
+
+	if len(year) != 4 || month == "" || day == "" {
+		return text
+	}
+
+	return year + "-" + pad(month) + "-" + pad(day)
+}
+
+func pad(s string) string {
+
+	if len(s) == 1 {
+		return "0" + s
+	}
+
+	return s
+}
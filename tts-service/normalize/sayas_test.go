@@ -0,0 +1,47 @@
+package normalize
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSayAs(t *testing.T) {
+
+	Convey("Say-as interpretation", t, func() {
+
+		Convey("should spell out characters", func() {
+
+			So(SayAs("characters", "", "ABC", "EN"), ShouldEqual, "A B C")
+			So(SayAs("spell-out", "", "SQL", "PL"), ShouldEqual, "S Q L")
+		})
+
+		Convey("should read digits one by one", func() {
+
+			So(SayAs("digits", "", "123", "EN"), ShouldEqual, "one two three")
+		})
+
+		Convey("should read phone numbers in groups", func() {
+
+			So(SayAs("telephone", "", "+48 12 34", "EN"), ShouldEqual, "plus four eight, one two, three four")
+		})
+
+		Convey("should read cardinal and ordinal numbers", func() {
+
+			So(SayAs("cardinal", "", "21", "EN"), ShouldEqual, "twenty-one")
+			So(SayAs("ordinal", "", "21", "EN"), ShouldEqual, "twenty-first")
+			So(SayAs("cardinal", "", "21", "PL"), ShouldEqual, "dwadzieścia jeden")
+		})
+
+		Convey("should read dates in the given format", func() {
+
+			So(SayAs("date", "mdy", "05/12/2017", "EN"), ShouldEqual, "May twelfth, twenty seventeen")
+			So(SayAs("date", "dmy", "05/12/2017", "EN"), ShouldEqual, "December fifth, twenty seventeen")
+		})
+
+		Convey("should normalize text it can't interpret", func() {
+
+			So(SayAs("cardinal", "", "many", "EN"), ShouldEqual, "many")
+			So(SayAs("date", "dmy", "2 cats", "EN"), ShouldEqual, "two cats")
+		})
+	})
+}
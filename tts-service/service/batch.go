@@ -0,0 +1,258 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+)
+
+//Public API
+
+type BatchService interface {
+	//Assigns the IDs of the voice messages of the items and creates them in the background, each on its own, so that the failure of one doesn't affect the others
+	//Returns the batch with the items that aren't created yet pending
+	Create(items []BatchCreate) (*BatchResult, error)
+	//Returns the batch with the current statuses of its voice messages
+	//May return BatchNotFoundError
+	Get(id string) (*BatchResult, error)
+}
+
+func NewBatches(persistence BatchPersistence, messages TtsService) BatchService {
+	return batches{persistence, messages, &runningBatches{ids: map[string]bool{}}}
+}
+
+//Implementation
+
+type batches struct {
+	persistence BatchPersistence
+	messages    TtsService
+	running     *runningBatches
+}
+
+//Batches whose items are being created by this process
+type runningBatches struct {
+	sync.Mutex
+	ids map[string]bool
+}
+
+func (r *runningBatches) set(id string, running bool) {
+	r.Lock()
+	defer r.Unlock()
+	if running {
+		r.ids[id] = true
+	} else {
+		delete(r.ids, id)
+	}
+}
+
+func (r *runningBatches) has(id string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.ids[id]
+}
+
+func (b batches) Create(items []BatchCreate) (*BatchResult, error) {
+	id, err := newBatchId()
+	if err != nil {
+		return nil, err
+	}
+
+	//The batch is stored first, with the IDs of its items, which are queued until they're created
+	data := batchData{Created: time.Now().UTC(), Items: []batchItemData{}}
+	creates := make([]*TtsCreate, len(items))
+
+	for i, item := range items {
+		if item.Create == nil {
+			data.Items = append(data.Items, batchItemData{Problem: item.Problem, Details: item.Details})
+			continue
+		}
+
+		messageId, err := b.messages.Id(item.Create)
+		if err != nil {
+			data.Items = append(data.Items, batchItemData{Problem: err.Error()})
+			continue
+		}
+
+		create := *item.Create
+		create.assigned = messageId
+		creates[i] = &create
+		data.Items = append(data.Items, batchItemData{Id: messageId, Queued: true})
+	}
+
+	if err := b.persistence.saveBatch(id, data); err != nil {
+		return nil, err
+	}
+
+	b.running.set(id, true)
+	go b.createItems(id, data, creates)
+
+	return b.Get(id)
+}
+
+//Creates the queued items one by one, the batch is stored again once all of them are
+//Items still queued when the service stops aren't created, see Get
+func (b batches) createItems(id string, data batchData, creates []*TtsCreate) {
+	defer b.running.set(id, false)
+
+	for i, create := range creates {
+		if create == nil {
+			continue
+		}
+
+		data.Items[i].Queued = false
+		if _, err := b.messages.Create(create); err != nil {
+			data.Items[i].Problem = err.Error()
+		}
+	}
+
+	if err := b.persistence.saveBatch(id, data); err != nil {
+		log.Printf("Problem with batch(id: %v) - can't store its created items: %v", id, err)
+	}
+}
+
+func (b batches) Get(id string) (*BatchResult, error) {
+	data, err := b.persistence.getBatch(id)
+	if err != nil {
+		return nil, err
+	}
+
+	running := b.running.has(id)
+	res := &BatchResult{Id: id, Created: data.Created, Status: BatchDone, Items: []BatchItem{}}
+
+	for _, d := range data.Items {
+		item := BatchItem{Id: d.Id, Problem: d.Problem, Details: d.Details}
+
+		if item.Id == "" {
+			res.Rejected++
+			res.Items = append(res.Items, item)
+			continue
+		}
+
+		if item.Problem != "" {
+			//Failed to be created
+			item.Status = StatusError
+		} else if message, err := b.messages.Get(item.Id); err == nil {
+			item.Status = message.Status
+		} else if _, notFound := err.(ObjectNotFoundError); notFound && d.Queued && running {
+			item.Status = StatusPending
+		} else if notFound && d.Queued {
+			//Its batch was stored, but the service stopped before it was created
+			item.Status = StatusError
+			item.Problem = errNotCreated
+		} else {
+			//E.g. deleted since
+			log.Printf("Problem with batch(id: %v) - can't read TTS(id: %v): %v", id, item.Id, err)
+			item.Status = StatusError
+			item.Problem = err.Error()
+		}
+
+		switch item.Status {
+		case StatusPending:
+			res.Pending++
+			res.Status = BatchPending
+		case StatusReady:
+			res.Ready++
+		default:
+			res.Failed++
+		}
+
+		res.Items = append(res.Items, item)
+	}
+
+	return res, nil
+}
+
+const errNotCreated = "Voice message wasn't created: the service stopped before"
+
+func newBatchId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// The interface of batch persistence
+type BatchPersistence interface {
+
+	//Request to store the batch with given id, replacing its previous version
+	saveBatch(id string, data batchData) error
+
+	//Returns the batch given it's id
+	//May return BatchNotFoundError
+	getBatch(id string) (*batchData, error)
+
+	//Re-encrypts all batches with the active master key
+	//Returns the number of re-encrypted batches
+	Rotate() (int, error)
+
+	//Moves batches stored in a single, flat directory into the sharded layout
+	//Returns the number of moved batches
+	Migrate() (int, error)
+}
+
+//Only the IDs of the voice messages are kept, their statuses are read when the batch is
+type batchData struct {
+	Created time.Time
+	Items   []batchItemData
+}
+
+type batchItemData struct {
+	Id      string   `json:",omitempty"`
+	Problem string   `json:",omitempty"`
+	Details []string `json:",omitempty"`
+	Queued  bool     `json:",omitempty"` //Not created yet, maybe never if the service stopped
+}
+
+// Initializes the batch persistence module
+func NewBatchPersistence() BatchPersistence {
+	return batchFiles{filestore.NewStore("BATCHES_BASE_DIR", "batches")}
+}
+
+// Returned on getBatch
+type BatchNotFoundError struct {
+	Message string
+}
+
+// BatchNotFoundError implements built-in  "error" interface
+func (err BatchNotFoundError) Error() string {
+	return err.Message
+}
+
+func BatchNotFound(id string) BatchNotFoundError {
+	return BatchNotFoundError{"Batch with ID: '" + id + "' doesn't exist"}
+}
+
+// Batches are stored a file each, encrypted like tts data, as problems of their items may quote the texts
+type batchFiles struct {
+	*filestore.Store
+}
+
+func (bf batchFiles) saveBatch(id string, data batchData) error {
+	return bf.WriteJSON(id+fileSuffix, data)
+}
+
+func (bf batchFiles) getBatch(id string) (*batchData, error) {
+	//IDs come from URLs
+	if !batchIdPattern.MatchString(id) {
+		return nil, BatchNotFound(id)
+	}
+
+	data := &batchData{}
+	err := bf.ReadJSON(id+fileSuffix, data)
+	if os.IsNotExist(err) {
+		return nil, BatchNotFound(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+var batchIdPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
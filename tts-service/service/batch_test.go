@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatches(t *testing.T) {
+	Convey("Batches", t, func(c C) {
+
+		dir, _ := ioutil.TempDir("", "batches")
+		defer os.RemoveAll(dir)
+
+		messages := &batchMessagesMock{statuses: map[string]StatusEnum{}}
+		batches := NewBatches(batchFiles{filestore.New(dir, &envelope.Keyring{})}, messages)
+
+		Convey("should assign the IDs and store the batch before its items are created", func() {
+			//given
+			messages.blocked = make(chan bool)
+
+			//when
+			res, err := batches.Create([]BatchCreate{
+				{Create: &TtsCreate{Text: "first"}},
+				{Problem: "Invalid payload", Details: []string{"Text is empty"}},
+			})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, BatchPending)
+			So(res.Items, ShouldResemble, []BatchItem{
+				{Id: "first", Status: StatusPending},
+				{Problem: "Invalid payload", Details: []string{"Text is empty"}},
+			})
+			So(res.Pending, ShouldEqual, 1)
+			So(res.Rejected, ShouldEqual, 1)
+
+			close(messages.blocked)
+			waitForItems(batches, res.Id)
+		})
+
+		Convey("should create each item on its own and report the rejected and failed ones", func() {
+			//when
+			res, err := batches.Create([]BatchCreate{
+				{Create: &TtsCreate{Text: "first"}},
+				{Problem: "Invalid payload", Details: []string{"Text is empty"}},
+				{Create: &TtsCreate{Text: "failing"}},
+				{Create: &TtsCreate{Text: "undetectable"}},
+				{Create: &TtsCreate{Text: "second"}},
+			})
+			So(err, ShouldBeNil)
+
+			res = waitForItems(batches, res.Id)
+
+			//then
+			So(res.Status, ShouldEqual, BatchPending)
+			So(res.Items, ShouldResemble, []BatchItem{
+				{Id: "first", Status: StatusPending},
+				{Problem: "Invalid payload", Details: []string{"Text is empty"}},
+				{Id: "failing", Status: StatusError, Problem: "Persistence Failure"},
+				{Problem: "Cannot create: no language to detect"},
+				{Id: "second", Status: StatusPending},
+			})
+			So(res.Pending, ShouldEqual, 2)
+			So(res.Failed, ShouldEqual, 1)
+			So(res.Rejected, ShouldEqual, 2)
+		})
+
+		Convey("should store the batch before and after its items are created only", func() {
+			//given
+			counting := &countingBatchFiles{BatchPersistence: batchFiles{filestore.New(dir, &envelope.Keyring{})}}
+			batches := NewBatches(counting, messages)
+
+			//when
+			res, _ := batches.Create([]BatchCreate{{Create: &TtsCreate{Text: "first"}}, {Create: &TtsCreate{Text: "second"}}, {Create: &TtsCreate{Text: "third"}}})
+			waitForItems(batches, res.Id)
+
+			//then
+			So(atomic.LoadInt32(&counting.saves), ShouldEqual, 2)
+		})
+
+		Convey("should fail the items the service stopped before creating", func() {
+			//given
+			persistence := batchFiles{filestore.New(dir, &envelope.Keyring{})}
+			persistence.saveBatch("0123456789abcdef0123456789abcdef", batchData{Items: []batchItemData{
+				{Id: "first", Queued: true},
+				{Id: "lost", Queued: true},
+			}})
+			messages.setStatus("first", StatusReady)
+
+			//when
+			res, err := NewBatches(persistence, messages).Get("0123456789abcdef0123456789abcdef")
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, BatchDone)
+			So(res.Items, ShouldResemble, []BatchItem{
+				{Id: "first", Status: StatusReady},
+				{Id: "lost", Status: StatusError, Problem: errNotCreated},
+			})
+			So(res.Failed, ShouldEqual, 1)
+		})
+
+		Convey("should be done when none of its voice messages is pending", func() {
+			//given
+			res, _ := batches.Create([]BatchCreate{{Create: &TtsCreate{Text: "first"}}, {Create: &TtsCreate{Text: "second"}}})
+			waitForItems(batches, res.Id)
+
+			//when
+			messages.setStatus("first", StatusReady)
+			messages.setStatus("second", StatusError)
+			res, err := batches.Get(res.Id)
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Status, ShouldEqual, BatchDone)
+			So(res.Ready, ShouldEqual, 1)
+			So(res.Failed, ShouldEqual, 1)
+		})
+
+		Convey("should return an error if the batch doesn't exist", func() {
+			_, err := batches.Get("0123456789abcdef0123456789abcdef")
+			So(err, ShouldResemble, BatchNotFound("0123456789abcdef0123456789abcdef"))
+
+			_, err = batches.Get("../secret")
+			So(err, ShouldHaveSameTypeAs, BatchNotFoundError{})
+		})
+	})
+}
+
+//Returns the batch once all its items are created
+func waitForItems(b BatchService, id string) *BatchResult {
+	for b.(batches).running.has(id) {
+		time.Sleep(time.Millisecond)
+	}
+	res, _ := b.Get(id)
+	return res
+}
+
+//Counts how many times batches are stored
+type countingBatchFiles struct {
+	BatchPersistence
+	saves int32
+}
+
+func (c *countingBatchFiles) saveBatch(id string, data batchData) error {
+	atomic.AddInt32(&c.saves, 1)
+	return c.BatchPersistence.saveBatch(id, data)
+}
+
+//Implements TtsService interface, with voice messages identified by their texts
+//Creation waits for blocked to be closed, if set
+type batchMessagesMock struct {
+	sync.Mutex
+	statuses map[string]StatusEnum
+	blocked  chan bool
+}
+
+func (m *batchMessagesMock) Create(create *TtsCreate) (*TtsResult, error) {
+	if m.blocked != nil {
+		<-m.blocked
+	}
+	if create.Text == "failing" {
+		return nil, errors.New("Persistence Failure")
+	}
+	m.setStatus(create.Text, StatusPending)
+	return &TtsResult{Id: create.Text, Status: StatusPending}, nil
+}
+
+func (m *batchMessagesMock) Id(create *TtsCreate) (string, error) {
+	if create.Text == "undetectable" {
+		return "", errors.New("Cannot create: no language to detect")
+	}
+	return create.Text, nil
+}
+
+func (m *batchMessagesMock) Get(id string) (*TtsResult, error) {
+	m.Lock()
+	defer m.Unlock()
+	status, ok := m.statuses[id]
+	if !ok {
+		return nil, NotFound(id)
+	}
+	return &TtsResult{Id: id, Status: status}, nil
+}
+
+func (m *batchMessagesMock) setStatus(id string, status StatusEnum) {
+	m.Lock()
+	defer m.Unlock()
+	m.statuses[id] = status
+}
+
+func (m *batchMessagesMock) Capabilities() tts.Capabilities {
+	return tts.Capabilities{}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+)
+
+//Chooses the IDs of new voice messages
+//A voice message is created once per ID: creating one of an existing ID returns the existing one
+type IdStrategy interface {
+	//Name of the strategy, as configured
+	Name() string
+	//Tells if IDs are derived from the requests, so that the same requests share their voice message
+	Derived() bool
+	//You can't implement this interface outside the package - parameter type is not exported
+	//Returns the ID of the voice message of the request, or the one requested by the client, if allowed
+	//May return IdError
+	id(request idRequest, requested string) (string, error)
+}
+
+//What the media of a voice message depends on
+type idRequest struct {
+	Text     string
+	Language string
+	Ssml     bool
+	Options  tts.Options
+	Lexicon  lexicon.Lexicon
+	MixKey   string
+	PartsKey string
+}
+
+//Exported
+const (
+	//SHA-1 of the text lowercased and without spaces, and of the options. The default, as all stored voice messages have such IDs
+	IdLegacy = "legacy"
+	//SHA-256 of the whole canonical request: the text as it is, its language, options, lexicon, mix...
+	IdContent = "content"
+	//Random, time-ordered UUIDs (version 7): voice messages are never shared
+	IdUuid7 = "uuid7"
+	//Chosen by clients, the content ones if not chosen
+	IdClient = "client"
+)
+
+var idStrategies = map[string]IdStrategy{
+	IdLegacy:  legacyIds{},
+	IdContent: contentIds{},
+	IdUuid7:   uuid7Ids{},
+	IdClient:  clientIds{},
+}
+
+//Returns the strategy chosen by the TTS_ID_STRATEGY variable, the legacy one by default
+func NewIdStrategy() IdStrategy {
+	name := os.Getenv("TTS_ID_STRATEGY")
+
+	if len(name) == 0 {
+		log.Printf("TTS_ID_STRATEGY not provided. Using %s", IdLegacy)
+		return legacyIds{}
+	}
+
+	strategy, ok := IdStrategyOf(name)
+	if !ok {
+		log.Fatalf("Unsupported TTS_ID_STRATEGY: '%s'. Strategies: %s", name, strings.Join(IdStrategies(), ", "))
+	}
+
+	return strategy
+}
+
+//Returns the strategy of the given name, e.g. "content"
+func IdStrategyOf(name string) (IdStrategy, bool) {
+	strategy, ok := idStrategies[name]
+	return strategy, ok
+}
+
+//Returns the names of the strategies, sorted
+func IdStrategies() []string {
+	names := []string{}
+	for name := range idStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type legacyIds struct{}
+
+func (legacyIds) Name() string  { return IdLegacy }
+func (legacyIds) Derived() bool { return true }
+
+func (legacyIds) id(r idRequest, requested string) (string, error) {
+	if requested != "" {
+		return "", clientIdsNotAllowed()
+	}
+	return generateId(r.Text, r.Language, r.Ssml, r.Options, r.Lexicon, r.MixKey, r.PartsKey), nil
+}
+
+type contentIds struct{}
+
+func (contentIds) Name() string  { return IdContent }
+func (contentIds) Derived() bool { return true }
+
+func (contentIds) id(r idRequest, requested string) (string, error) {
+	if requested != "" {
+		return "", clientIdsNotAllowed()
+	}
+	return contentId(r), nil
+}
+
+//Unlike generateId, tells apart texts differing in case and spacing, as they may be read differently
+func contentId(r idRequest) string {
+	lex := ""
+	if r.Lexicon.Version > 0 {
+		lex = r.Lexicon.Tenant + ":" + strconv.Itoa(r.Lexicon.Version)
+	}
+
+	//Fields are marshalled in order, so the same requests have the same canonical form
+	canonical, _ := json.Marshal(struct {
+		Text     string
+		Language string
+		Ssml     bool
+		Options  string
+		Lexicon  string
+		Mix      string
+		Parts    string
+	}{r.Text, r.Language, r.Ssml, r.Options.String(), lex, r.MixKey, r.PartsKey})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+type uuid7Ids struct{}
+
+func (uuid7Ids) Name() string  { return IdUuid7 }
+func (uuid7Ids) Derived() bool { return false }
+
+func (uuid7Ids) id(r idRequest, requested string) (string, error) {
+	if requested != "" {
+		return "", clientIdsNotAllowed()
+	}
+	return newUuid7(time.Now())
+}
+
+//https://datatracker.ietf.org/doc/html/rfc9562#section-5.7
+func newUuid7(now time.Time) (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		return "", err
+	}
+
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		u[i] = byte(ms >> uint(40-8*i))
+	}
+
+	u[6] = 0x70 | u[6]&0x0f //Version
+	u[8] = 0x80 | u[8]&0x3f //Variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+type clientIds struct{}
+
+func (clientIds) Name() string  { return IdClient }
+func (clientIds) Derived() bool { return true }
+
+func (clientIds) id(r idRequest, requested string) (string, error) {
+	if requested == "" {
+		return contentId(r), nil
+	}
+	if !ValidId(requested) {
+		return "", IdError{"ID must be 1-64 letters, digits, '-' or '_': " + requested}
+	}
+	return requested, nil
+}
+
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+//Tells if the ID can be chosen by a client: IDs are file names
+func ValidId(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+func clientIdsNotAllowed() IdError {
+	return IdError{"ID can't be chosen. IDs are chosen by the service unless TTS_ID_STRATEGY is '" + IdClient + "'"}
+}
+
+// Returned on create, if the requested ID isn't valid or allowed
+type IdError struct {
+	Message string
+}
+
+// IdError implements built-in  "error" interface
+func (err IdError) Error() string {
+	return err.Message
+}
+
+// Returned on create, if the requested ID is of another voice message
+type IdConflictError struct {
+	Message string
+}
+
+// IdConflictError implements built-in  "error" interface
+func (err IdConflictError) Error() string {
+	return err.Message
+}
+
+func IdConflict(id string) IdConflictError {
+	return IdConflictError{"TTS with ID: '" + id + "' already exists with another request"}
+}
+
+//Tells if the stored voice message was created by the same request
+func sameRequest(stored *ttsData, data ttsData) bool {
+	return requestOf(*stored) == requestOf(data)
+}
+
+//Returns the request of the data, without what's set when it's created
+func requestOf(data ttsData) string {
+	data.NormalizedText, data.DetectedLanguage, data.DetectionConfidence = "", "", 0
+	data.LexiconVersion, data.Template = 0, ""
+	data.Status, data.MediaId = "", ""
+
+	//Empty fields are omitted, so the ones read back match the new ones
+	content, _ := json.Marshal(data)
+	return string(content)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestIds(t *testing.T) {
+	Convey("ID strategies", t, func() {
+
+		hello := idRequest{Text: "Hello World", Language: "EN", Options: tts.Options{Voice: "Amy"}}
+
+		Convey("content IDs should tell apart texts differing in case and spacing", func() {
+			id, err := contentIds{}.id(hello, "")
+			So(err, ShouldBeNil)
+			So(id, ShouldHaveLength, 64)
+
+			again, _ := contentIds{}.id(hello, "")
+			So(again, ShouldEqual, id)
+
+			other := hello
+			other.Text = "helloworld"
+			So(contentId(other), ShouldNotEqual, id)
+			So(generateId(other.Text, "EN", false, other.Options, lexicon.Lexicon{}, "", ""), ShouldEqual, generateId(hello.Text, "EN", false, hello.Options, lexicon.Lexicon{}, "", ""))
+
+			other = hello
+			other.Options = tts.Options{Voice: "Mike"}
+			So(contentId(other), ShouldNotEqual, id)
+
+			other = hello
+			other.Lexicon = lexicon.Lexicon{Tenant: "acme", Version: 2}
+			So(contentId(other), ShouldNotEqual, id)
+		})
+
+		Convey("legacy IDs should stay as they were", func() {
+			id, err := legacyIds{}.id(hello, "")
+
+			So(err, ShouldBeNil)
+			So(id, ShouldEqual, generateId("Hello World", "EN", false, hello.Options, lexicon.Lexicon{}, "", ""))
+		})
+
+		Convey("UUIDv7 IDs should be random and ordered by time", func() {
+			id, err := uuid7Ids{}.id(hello, "")
+			So(err, ShouldBeNil)
+			So(id, ShouldNotEqual, "")
+
+			So(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id), ShouldBeTrue)
+
+			earlier, _ := newUuid7(time.Unix(1500000000, 0))
+			later, _ := newUuid7(time.Unix(1500000001, 0))
+			So(earlier[:13], ShouldEqual, "015d3ef7-9800")
+			So(later, ShouldBeGreaterThan, earlier)
+
+			again, _ := uuid7Ids{}.id(hello, "")
+			So(again, ShouldNotEqual, id)
+		})
+
+		Convey("client IDs should be validated, the content ones used if not given", func() {
+			id, err := clientIds{}.id(hello, "ticket-42")
+			So(err, ShouldBeNil)
+			So(id, ShouldEqual, "ticket-42")
+
+			_, err = clientIds{}.id(hello, "../42")
+			So(err, ShouldHaveSameTypeAs, IdError{})
+
+			id, _ = clientIds{}.id(hello, "")
+			So(id, ShouldEqual, contentId(hello))
+		})
+
+		Convey("only client IDs should be chosen by clients", func() {
+			for _, name := range []string{IdLegacy, IdContent, IdUuid7} {
+				strategy, ok := IdStrategyOf(name)
+				So(ok, ShouldBeTrue)
+
+				_, err := strategy.id(hello, "ticket-42")
+				So(err, ShouldHaveSameTypeAs, IdError{})
+			}
+
+			_, ok := IdStrategyOf("sha1")
+			So(ok, ShouldBeFalse)
+			So(IdStrategies(), ShouldResemble, []string{IdClient, IdContent, IdLegacy, IdUuid7})
+		})
+
+		Convey("Create should reject client IDs of other requests", func() {
+			stored := ttsData{Text: "Hello", Language: "EN", Tenant: lexicon.DefaultTenant, Status: StatusReady.String(), MediaId: "m1"}
+			mock := mock("ticket-42", stored)
+			mock.ttsTextThatConflicts = "Hi"
+			s := New(mock, mock, mock, mockAssets{}, clientIds{})
+
+			_, err := s.Create(&TtsCreate{Id: "ticket-42", Text: "Hi", Language: EN})
+
+			So(err, ShouldResemble, IdConflict("ticket-42"))
+		})
+
+		Convey("Create should return the voice message of a client ID repeated with the same request", func() {
+			stored := ttsData{Text: "Hello", Language: "EN", Tenant: lexicon.DefaultTenant, Status: StatusReady.String(), MediaId: "m1"}
+			mock := mock("ticket-42", stored)
+			mock.ttsTextThatConflicts = "Hello"
+			s := New(mock, mock, mock, mockAssets{}, clientIds{})
+
+			res, err := s.Create(&TtsCreate{Id: "ticket-42", Text: "Hello", Language: EN})
+
+			So(err, ShouldBeNil)
+			So(res.Id, ShouldEqual, "ticket-42")
+			So(res.MediaId, ShouldEqual, "m1")
+		})
+
+		Convey("Create should use the ID assigned in advance", func() {
+			mock := mock("", ttsData{})
+			s := New(mock, mock, mock, mockAssets{}, uuid7Ids{})
+
+			create := &TtsCreate{Text: "Hello", Language: EN}
+			id, err := s.Id(create)
+			So(err, ShouldBeNil)
+
+			create.assigned = id
+			res, err := s.Create(create)
+
+			So(err, ShouldBeNil)
+			So(res.Id, ShouldEqual, id)
+
+			readBlocking([]string{}, mock.recordChan)
+			readBlocking([]string{}, mock.recordChan)
+			readBlocking([]string{}, mock.recordChan)
+		})
+
+		Convey("MigrateIds should copy ready data under the derived IDs", func() {
+			stored := ttsData{Text: "Hello World", Language: "EN", Tenant: "acme", LexiconVersion: 2, Status: StatusReady.String(), MediaId: "m1"}
+			mock := mock("legacy", stored)
+
+			report, err := MigrateIds(mock, contentIds{})
+
+			So(err, ShouldBeNil)
+			So(report, ShouldResemble, &IdMigrationReport{Records: 1, Copied: 1})
+			So(mock.id, ShouldEqual, contentId(idRequest{Text: "Hello World", Language: "EN", Lexicon: lexicon.Lexicon{Tenant: "acme", Version: 2}}))
+			So(mock.data.MediaId, ShouldEqual, "m1")
+		})
+
+		Convey("MigrateIds should skip data whose IDs can't be derived again", func() {
+			stored := ttsData{Text: "Hello", Language: "EN", Mix: &Mix{Background: "music"}, Status: StatusReady.String(), MediaId: "m1"}
+			mock := mock("legacy", stored)
+
+			report, err := MigrateIds(mock, contentIds{})
+
+			So(err, ShouldBeNil)
+			So(report, ShouldResemble, &IdMigrationReport{Records: 1, Skipped: 1})
+			So(mock.id, ShouldEqual, "legacy")
+
+			report, _ = MigrateIds(mock, uuid7Ids{})
+			So(report, ShouldResemble, &IdMigrationReport{})
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"log"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+)
+
+//Interface abstracting over tts.Engine
+type MigrateEngine interface {
+	Migrate() (int, error)
+}
+
+//Interface abstracting over the stores of other objects, e.g. batches, lexicons or templates
+type MigrateStore interface {
+	Migrate() (int, error)
+}
+
+//Defines MigrateLayout result
+//Records and Media are the numbers of moved tts data and media files, Objects of the other stored objects
+type MigrationReport struct {
+	Records int
+	Media   int
+	Objects int
+}
+
+//Moves tts data, media and objects of the stores stored in single, flat directories into the sharded layout.
+//Files are found in both layouts during the migration, so it can be done while the service is running.
+func MigrateLayout(persistence TtsPersistence, engine MigrateEngine, stores ...MigrateStore) (*MigrationReport, error) {
+	records, err := persistence.migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := engine.Migrate()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := 0
+	for _, store := range stores {
+		count, err := store.Migrate()
+		if err != nil {
+			return nil, err
+		}
+		objects += count
+	}
+
+	return &MigrationReport{records, media, objects}, nil
+}
+
+//Defines MigrateIds result
+//Records is the number of examined tts data, Copied the number of the ones copied under the IDs of the strategy
+//Skipped are the ones whose IDs can't be derived again, e.g. mixed with assets that may have been replaced since
+type IdMigrationReport struct {
+	Records int
+	Copied  int
+	Skipped int
+}
+
+//Copies ready tts data under the IDs the strategy derives from their requests, so that the same requests keep sharing them.
+//The copies share the media, and the tts data stays available under its former ID.
+//Strategies that don't derive IDs have nothing to migrate.
+func MigrateIds(persistence TtsPersistence, ids IdStrategy) (*IdMigrationReport, error) {
+	report := &IdMigrationReport{}
+	if !ids.Derived() {
+		return report, nil
+	}
+
+	list, err := persistence.list()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range list {
+		data, err := persistence.get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Records++
+		if data.Status != StatusReady.String() {
+			continue
+		}
+
+		//Keys of mixes and dialogues tell the versions of assets and lexicons they were read with, which aren't stored
+		if data.Mix != nil || len(data.Segments) > 0 {
+			report.Skipped++
+			continue
+		}
+
+		request := idRequest{data.Text, data.Language, data.Ssml, data.Options, lexicon.Lexicon{Tenant: data.Tenant, Version: data.LexiconVersion}, "", strings.Join(data.Fragments, "|")}
+		newId, err := ids.id(request, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if newId == id {
+			continue
+		}
+
+		err = persistence.create(newId, *data)
+		if _, ok := err.(ObjectAlreadyExistsError); ok {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("TTS(id: %v) copied to TTS(id: %v)", id, newId)
+		report.Copied++
+	}
+
+	return report, nil
+}
@@ -1,25 +1,125 @@
 package service
 
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	"time"
+)
+
 //////////////////////////////////////// STRUCTS ////////////////////////////////////////
 
 //Used to create new TTS data
+//Ssml tells that Text is an SSML document, already validated
+//Options tell how to read the text (voice, rate...), already validated against the engine capabilities
+//Tenant owns the pronunciation lexicon to read the text with, lexicon.DefaultTenant if empty
+//Mix tells which of the Tenant's assets are mixed with the speech, optional
+//Segments make a dialogue, read instead of the Text, optional. Language is then the language of the first segment
+//Fragments of the Text are converted on their own, optional, see tts.Metadata. Template names the template they're rendered from
+//Id is chosen by the client, optional, allowed by the IdStrategy of the service only
+//The voice message is created with the ID returned by TtsService.Id, if assigned
 type TtsCreate struct {
+	Id        string
+	Text      string
+	Language  LangEnum
+	Ssml      bool
+	Options   tts.Options
+	Tenant    string
+	Mix       *Mix
+	Segments  []Segment
+	Fragments []string
+	Template  string
+	assigned  string
+}
+
+//A part of a dialogue, read by its Speaker in its own Language
+//Voice is the voice of the dialogue if empty, see tts.Segment
+//Pause is the silence before the segment
+//Start and End tell when the segment is heard in the media, they're set only when the media is ready
+type Segment struct {
+	Speaker  string
 	Text     string
 	Language LangEnum
+	Voice    string
+	Pause    time.Duration
+	Start    time.Duration
+	End      time.Duration
+}
+
+//Names the assets mixed with the speech, see tts.Mix
+//Volume of the background and its Ducking under the speech are in dB
+type Mix struct {
+	Background string  `json:",omitempty"`
+	Intro      string  `json:",omitempty"`
+	Outro      string  `json:",omitempty"`
+	Volume     float64 `json:",omitempty"`
+	Ducking    float64 `json:",omitempty"`
 }
 
 //Defines Service result
 //ID is the object unique identifier, derived from Text
 //Text is the TTS source text
+//Ssml tells that Text is an SSML document
+//NormalizedText is the text actually read aloud, with numbers, dates, abbreviations... written as words
+//Options tell how the text is read (voice, rate...)
+//LexiconVersion is the version of the Tenant's lexicon the text is read with, 0 if there's none
 //MediaId is returned only if Status == Ready, and it's used to retrieve the data from Media Storage (outside of this Service)
+//Media describes the media (format, duration, size...), it's returned along with MediaId
+//Segments of dialogues are returned in order, Text is then their texts, a line each
 type TtsResult struct {
+	Id                  string
+	Text                string
+	NormalizedText      string
+	Ssml                bool
+	Options             tts.Options
+	Language            LangEnum
+	DetectedLanguage    LangEnum //Not necessarily the same as Language, e.g. if the detection wasn't confident
+	DetectionConfidence float64  //From 0 to 1
+	Tenant              string
+	LexiconVersion      int
+	Mix                 *Mix
+	Segments            []Segment
+	Fragments           []string
+	Template            string
+	Status              StatusEnum
+	MediaId             string
+	Media               *tts.MediaInfo
+}
+
+//An item of a batch: a voice message to create, or the Problem it was rejected for before, e.g. when validated
+type BatchCreate struct {
+	Create  *TtsCreate
+	Problem string
+	Details []string
+}
+
+//Defines a batch of voice messages, created together
+//Items are in the order of their creation requests
+//Status is BatchPending while any of its voice messages is pending, BatchDone when none is
+//Pending, Ready and Failed count the voice messages of each status, Rejected counts the items that got no ID
+type BatchResult struct {
 	Id       string
-	Text     string
-	Language LangEnum
-	Status   StatusEnum
-	MediaId  string
+	Created  time.Time
+	Status   string
+	Items    []BatchItem
+	Pending  int
+	Ready    int
+	Failed   int
+	Rejected int
 }
 
+//The voice message of a batch item, or the Problem it wasn't created for
+//Status is the status of the voice message, nil if rejected, StatusPending if it's not created yet and StatusError if it failed to be
+type BatchItem struct {
+	Id      string
+	Status  StatusEnum
+	Problem string
+	Details []string
+}
+
+const (
+	BatchPending = "PENDING"
+	BatchDone    = "DONE"
+)
+
 //////////////////////////////////////// ENUMS ////////////////////////////////////////
 
 ////// LANGUAGE ENUM //////
@@ -46,8 +146,16 @@ func (l lang) String() string {
 const (
 	EN lang = "EN"
 	PL lang = "PL"
+	//Requests detecting the language of the text, never stored
+	AUTO lang = "AUTO"
 )
 
+//Returns the language of the given code, e.g. "EN".
+//The code must be validated against the engine capabilities first.
+func NewLanguage(code string) LangEnum {
+	return lang(code)
+}
+
 ////// STATUS ENUM //////
 
 //Exported interface provides type-safety
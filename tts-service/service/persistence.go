@@ -2,12 +2,18 @@ package service
 
 import (
 	"encoding/json"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"time"
 )
 
-//The interface of TTS data persistence
+// The interface of TTS data persistence
 type TtsPersistence interface {
 
 	//Request to store tts data with given id
@@ -25,51 +31,86 @@ type TtsPersistence interface {
 	//Removes tts data given it's id
 	//May return ObjectNotFoundError
 	del(id string) error
+
+	//Returns ids of all stored tts data
+	list() ([]string, error)
+
+	//Re-encrypts all tts data with the active master key
+	//Returns the number of re-encrypted objects
+	rotate() (int, error)
+
+	//Moves tts data stored in a single, flat directory into the sharded layout
+	//Returns the number of moved objects
+	migrate() (int, error)
 }
 
 type ttsData struct {
+	Text                string
+	NormalizedText      string `json:",omitempty"`
+	Ssml                bool   `json:",omitempty"`
+	Language            string
+	DetectedLanguage    string        `json:",omitempty"` //Set if the language was detected (AUTO)
+	DetectionConfidence float64       `json:",omitempty"`
+	Tenant              string        `json:",omitempty"`
+	LexiconVersion      int           `json:",omitempty"`
+	Mix                 *Mix          `json:",omitempty"`
+	Segments            []segmentData `json:",omitempty"`
+	Fragments           []string      `json:",omitempty"`
+	Template            string        `json:",omitempty"`
+	Status              string
+	MediaId             string
+	tts.Options         //Flattened, so that records without options stay unchanged
+}
+
+//A segment of a dialogue, without its timing, which is a part of the media
+type segmentData struct {
+	Speaker  string `json:",omitempty"`
 	Text     string
 	Language string
-	Status   string
-	MediaId  string
+	Voice    string        `json:",omitempty"`
+	Pause    time.Duration `json:",omitempty"`
 }
 
-//Initializes the persistence module
+// Initializes the persistence module
 func NewPersistence() TtsPersistence {
-	directory := os.Getenv("PERSISTENCE_BASE_DIR")
+	directory := filestore.BaseDir("PERSISTENCE_BASE_DIR", "messages")
 
-	if len(directory) == 0 {
+	//Records are listed, e.g. by the scrub, before any is stored
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		log.Fatalf("Can't create %s: %v", directory, err)
+	}
 
-		directory = os.TempDir()
-		log.Printf("PERSISTENCE_BASE_DIR not provided. Using %s", directory)
+	keys, err := envelope.NewKeyring()
+	if err != nil {
+		log.Fatalf("Can't load encryption keys: %v", err)
 	}
 
-	return &fileBased{directory}
+	return &fileBased{directory, keys, &layout.Locks{}}
 }
 
 // Errors
 
-//Returned on get/del
+// Returned on get/del
 type ObjectNotFoundError struct {
 	Message string
 }
 
-//ObjectNotFoundError implements built-in  "error" interface
+// ObjectNotFoundError implements built-in  "error" interface
 func (err ObjectNotFoundError) Error() string {
 	return err.Message
 }
 
-//Returned on create
+// Returned on create
 type ObjectAlreadyExistsError struct {
 	Message string
 }
 
-//ObjectAlreadyExistsError implements built-in  "error" interface
+// ObjectAlreadyExistsError implements built-in  "error" interface
 func (err ObjectAlreadyExistsError) Error() string {
 	return err.Message
 }
 
-//Helper functions
+// Helper functions
 func NotFound(id string) ObjectNotFoundError {
 	return ObjectNotFoundError{"TTS with ID: '" + id + "' doesn't exist"}
 }
@@ -80,22 +121,38 @@ func AlreadyExists(id string) ObjectAlreadyExistsError {
 
 // Implementation
 
-const separator = string(os.PathSeparator)
-
+// Text of the voice messages is encrypted if a master key is provided
+// Writers of a record hold its lock, so that an update isn't lost to a concurrent re-encryption
 type fileBased struct {
 	directory string
+	keys      *envelope.Keyring
+	locks     *layout.Locks
 }
 
 func (fb fileBased) create(id string, data ttsData) error {
-	path := fb.pathWithId(id)
+	defer fb.locks.Lock(id)()
+
+	//Data stored before the sharding was introduced may not have been migrated yet
+	if _, err := os.Stat(layout.FlatPath(fb.directory, id+fileSuffix)); err == nil {
+		return AlreadyExists(id)
+	}
+
+	path, err := layout.Create(fb.directory, id, id+fileSuffix)
+	if err != nil {
+		return err
+	}
+
+	content, err := fb.encode(data)
+	if err != nil {
+		return err
+	}
 
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
 
 	if err == nil {
-		encoder := json.NewEncoder(file)
-		encoder.Encode(data)
+		_, err = file.Write(content)
 		file.Close()
-		return nil
+		return err
 	}
 
 	if os.IsExist(err) {
@@ -106,14 +163,18 @@ func (fb fileBased) create(id string, data ttsData) error {
 }
 
 func (fb fileBased) get(id string) (*ttsData, error) {
-	path := fb.pathWithId(id)
-	file, err := os.Open(path)
+	var content []byte
+	err := layout.Read(fb.directory, id, id+fileSuffix, func(path string) (err error) {
+		content, err = fb.keys.ReadFile(path)
+		return err
+	})
 
 	if err == nil {
 		data := &ttsData{}
-		decoder := json.NewDecoder(file)
-		err = decoder.Decode(&data)
-		file.Close()
+		err = json.Unmarshal(content, data)
+		if err != nil {
+			return nil, err
+		}
 		return data, nil
 	}
 
@@ -126,6 +187,8 @@ func (fb fileBased) get(id string) (*ttsData, error) {
 }
 
 func (fb fileBased) update(id string, status string, mediaId string) error {
+	defer fb.locks.Lock(id)()
+
 	//Read file
 	data, err := fb.get(id)
 
@@ -137,29 +200,108 @@ func (fb fileBased) update(id string, status string, mediaId string) error {
 	data.Status = status
 	data.MediaId = mediaId
 
-	path := fb.pathWithId(id)
+	content, err := fb.encode(*data)
+	if err != nil {
+		return err
+	}
 
-	//Write updated data
-	file, err := os.OpenFile(path, os.O_RDWR, 0666)
-	if err == nil {
-		encoder := json.NewEncoder(file)
-		encoder.Encode(data)
+	//Write updated data, moving it into the sharded layout
+	path, err := layout.Create(fb.directory, id, id+fileSuffix)
+	if err != nil {
+		return err
 	}
-	file.Close()
-	return err
+
+	err = ioutil.WriteFile(path, content, 0666)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(layout.FlatPath(fb.directory, id+fileSuffix))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func (fb fileBased) del(id string) error {
-	return os.Remove(fb.pathWithId(id))
+	defer fb.locks.Lock(id)()
+
+	return layout.Remove(fb.directory, id, id+fileSuffix)
 }
 
-func (fb fileBased) pathWithId(name string) string {
-	var res string
-	if strings.HasSuffix(fb.directory, separator) {
-		res = fb.directory + name
-	} else {
-		res = fb.directory + separator + name
+func (fb fileBased) list() ([]string, error) {
+	names, err := layout.List(fb.directory, isDataFile)
+	if err != nil {
+		return nil, err
 	}
 
-	return res + ".json"
+	ids := []string{}
+	for _, name := range names {
+		ids = append(ids, strings.TrimSuffix(name, fileSuffix))
+	}
+
+	return ids, nil
+}
+
+func (fb fileBased) migrate() (int, error) {
+	return layout.Migrate(fb.directory, fb.locks, func(name string) (string, bool) {
+		if !isDataFile(name) {
+			return "", false
+		}
+
+		//Skip foreign JSON files, the directory may be shared
+		id := strings.TrimSuffix(name, fileSuffix)
+		if data, err := fb.get(id); err != nil || data.Text == "" {
+			return "", false
+		}
+		return id, true
+	})
 }
+
+func (fb fileBased) rotate() (int, error) {
+	ids, err := fb.list()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		//Skip foreign JSON files, the directory may be shared
+		if data, err := fb.get(id); err != nil || data.Text == "" {
+			continue
+		}
+
+		unlock := fb.locks.Lock(id)
+		rotated, err := fb.keys.RotateFile(fb.pathWithId(id))
+		unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+		if rotated {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Serializes and encrypts tts data
+func (fb fileBased) encode(data ttsData) ([]byte, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return fb.keys.Seal(content)
+}
+
+func (fb fileBased) pathWithId(id string) string {
+	return layout.Locate(fb.directory, id, id+fileSuffix)
+}
+
+// The directory may be shared with other JSON files (e.g. media info "<id>.info.json")
+func isDataFile(name string) bool {
+	return strings.HasSuffix(name, fileSuffix) && strings.Count(name, ".") == 1
+}
+
+const fileSuffix = ".json"
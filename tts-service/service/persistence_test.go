@@ -1,13 +1,22 @@
 package service
 
 import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
 func TestPersistence(t *testing.T) {
 	Convey("TTS Persistence", t, func(c C) {
 
+		baseDir, _ := ioutil.TempDir("", "persistence")
+		defer os.RemoveAll(baseDir)
+
+		os.Setenv("PERSISTENCE_BASE_DIR", baseDir)
+		defer os.Unsetenv("PERSISTENCE_BASE_DIR")
+
 		Convey("should create, read and delete the file", func() {
 			persistence := NewPersistence()
 			id := "test1"
@@ -74,6 +83,140 @@ func TestPersistence(t *testing.T) {
 			So(err.Error(), ShouldEqual, "TTS with ID: '"+id+"' already exists")
 		})
 
+		Convey("should list stored ids", func() {
+			persistence := NewPersistence()
+			id := "test5"
+
+			err := persistence.create(id, ttsData{
+				Text:     "test text 5",
+				Language: EN.String(),
+				Status:   StatusPending.String(),
+				MediaId:  "",
+			})
+			defer persistence.del(id)
+
+			So(err, ShouldBeNil)
+
+			ids, err := persistence.list()
+			So(err, ShouldBeNil)
+			So(ids, ShouldContain, id)
+		})
+
+		Convey("should encrypt the file if a master key is provided", func() {
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			persistence := NewPersistence()
+			id := "test6"
+
+			err := persistence.create(id, ttsData{
+				Text:     "secret text 6",
+				Language: EN.String(),
+				Status:   StatusPending.String(),
+				MediaId:  "",
+			})
+			defer persistence.del(id)
+
+			So(err, ShouldBeNil)
+
+			stored, _ := ioutil.ReadFile(persistence.(*fileBased).pathWithId(id))
+			So(string(stored), ShouldNotContainSubstring, "secret text 6")
+
+			err = persistence.update(id, StatusReady.String(), "media6")
+			So(err, ShouldBeNil)
+
+			data, err := persistence.get(id)
+			So(err, ShouldBeNil)
+			So(data.Text, ShouldEqual, "secret text 6")
+			So(data.Status, ShouldEqual, StatusReady.String())
+			So(data.MediaId, ShouldEqual, "media6")
+		})
+
+		Convey("should re-encrypt files stored before the encryption was enabled", func() {
+			dir, _ := ioutil.TempDir("", "persistence")
+			defer os.RemoveAll(dir)
+
+			os.Setenv("PERSISTENCE_BASE_DIR", dir)
+			defer os.Unsetenv("PERSISTENCE_BASE_DIR")
+
+			id := "test7"
+			err := NewPersistence().create(id, ttsData{
+				Text:     "secret text 7",
+				Language: EN.String(),
+				Status:   StatusPending.String(),
+				MediaId:  "",
+			})
+			So(err, ShouldBeNil)
+
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			persistence := NewPersistence()
+			defer persistence.del(id)
+
+			count, err := persistence.rotate()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			stored, _ := ioutil.ReadFile(persistence.(*fileBased).pathWithId(id))
+			So(string(stored), ShouldNotContainSubstring, "secret text 7")
+
+			data, err := persistence.get(id)
+			So(err, ShouldBeNil)
+			So(data.Text, ShouldEqual, "secret text 7")
+		})
+
+		Convey("should find, update and migrate files stored in a flat directory", func() {
+			dir, _ := ioutil.TempDir("", "persistence")
+			defer os.RemoveAll(dir)
+
+			os.Setenv("PERSISTENCE_BASE_DIR", dir)
+			defer os.Unsetenv("PERSISTENCE_BASE_DIR")
+
+			persistence := NewPersistence()
+			for _, id := range []string{"test8", "test9"} {
+				err := persistence.create(id, ttsData{
+					Text:     "test text",
+					Language: EN.String(),
+					Status:   StatusPending.String(),
+					MediaId:  "",
+				})
+				So(err, ShouldBeNil)
+
+				//Simulate data stored before the sharding was introduced
+				os.Rename(layout.Path(dir, id, id+".json"), layout.FlatPath(dir, id+".json"))
+			}
+			ioutil.WriteFile(layout.FlatPath(dir, "foreign.json"), []byte("{}"), 0666)
+
+			ids, err := persistence.list()
+			So(err, ShouldBeNil)
+			So(ids, ShouldContain, "test8")
+
+			err = persistence.create("test8", ttsData{Text: "test text"})
+			So(err, ShouldHaveSameTypeAs, ObjectAlreadyExistsError{})
+
+			err = persistence.update("test8", StatusReady.String(), "media8")
+			So(err, ShouldBeNil)
+
+			count, err := persistence.migrate()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			for _, id := range []string{"test8", "test9"} {
+				_, err = os.Stat(layout.Path(dir, id, id+".json"))
+				So(err, ShouldBeNil)
+				_, err = os.Stat(layout.FlatPath(dir, id+".json"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			}
+			_, err = os.Stat(layout.FlatPath(dir, "foreign.json"))
+			So(err, ShouldBeNil)
+
+			data, err := persistence.get("test8")
+			So(err, ShouldBeNil)
+			So(data.Status, ShouldEqual, StatusReady.String())
+			So(data.MediaId, ShouldEqual, "media8")
+		})
+
 		Convey("should update existing file", func() {
 			persistence := NewPersistence()
 			id := "test4"
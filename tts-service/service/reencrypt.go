@@ -0,0 +1,45 @@
+package service
+
+//Interface abstracting over tts.Engine
+type RotateEngine interface {
+	Rotate() (int, error)
+}
+
+//Interface abstracting over the stores of other objects, e.g. batches, lexicons or templates
+type RotateStore interface {
+	Rotate() (int, error)
+}
+
+//Defines Reencrypt result
+//Records and Media are the numbers of re-encrypted tts data and media, Objects of the other stored objects
+type ReencryptReport struct {
+	Records int
+	Media   int
+	Objects int
+}
+
+//Re-encrypts all tts data, media and objects of the stores with the active master key.
+//Data encrypted with older keys, or stored before the encryption was enabled, is rewritten.
+//Once it's done, older master keys can be removed.
+func Reencrypt(persistence TtsPersistence, engine RotateEngine, stores ...RotateStore) (*ReencryptReport, error) {
+	records, err := persistence.rotate()
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := engine.Rotate()
+	if err != nil {
+		return nil, err
+	}
+
+	objects := 0
+	for _, store := range stores {
+		count, err := store.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		objects += count
+	}
+
+	return &ReencryptReport{records, media, objects}, nil
+}
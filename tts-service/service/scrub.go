@@ -0,0 +1,115 @@
+package service
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	"log"
+)
+
+//Checks the integrity of all stored media
+type Scrubber interface {
+	//Verifies all media and all READY tts data.
+	//Corrupted media is quarantined and tts data using it is switched to ERROR, so that it's regenerated on next Create.
+	Scrub() (*ScrubReport, error)
+}
+
+//Interface abstracting over tts.Engine
+type ScrubEngine interface {
+	Media() ([]string, error)
+	Verify(mediaId string) error
+	Quarantine(mediaId string) error
+}
+
+//Defines Scrub result
+//Checked is the number of verified media
+//Corrupted contains IDs of damaged or missing media
+//Failed contains IDs of tts data that has been switched to ERROR
+type ScrubReport struct {
+	Checked   int
+	Corrupted []string
+	Failed    []string
+}
+
+func NewScrubber(persistence TtsPersistence, engine ScrubEngine) Scrubber {
+	return scrubber{
+		persistence: persistence,
+		engine:      engine,
+	}
+}
+
+//Implementation
+
+type scrubber struct {
+	persistence TtsPersistence
+	engine      ScrubEngine
+}
+
+func (s scrubber) Scrub() (*ScrubReport, error) {
+	report := &ScrubReport{}
+
+	//Verification result by media ID, nil means the media is fine
+	verified := map[string]error{}
+
+	verify := func(mediaId string) error {
+		err, ok := verified[mediaId]
+		if !ok {
+			err = s.engine.Verify(mediaId)
+			verified[mediaId] = err
+			report.Checked++
+
+			if _, ok := err.(tts.MediaCorruptedError); ok {
+				log.Printf("Scrub: %v", err)
+				report.Corrupted = append(report.Corrupted, mediaId)
+			}
+		}
+		return err
+	}
+
+	mediaIds, err := s.engine.Media()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mediaId := range mediaIds {
+		if err := verify(mediaId); err != nil {
+			if _, ok := err.(tts.MediaCorruptedError); !ok {
+				//Don't quarantine on I/O problems, the media may be fine
+				log.Printf("Scrub: can't verify media(id: %v): %v", mediaId, err)
+			}
+		}
+	}
+
+	//Media referenced by tts data must exist and be intact
+	ids, err := s.persistence.list()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		data, err := s.persistence.get(id)
+		if err != nil {
+			log.Printf("Scrub: can't read TTS(id: %v): %v", id, err)
+			continue
+		}
+
+		if data.Status != StatusReady.String() || data.MediaId == "" {
+			continue
+		}
+
+		if _, ok := verify(data.MediaId).(tts.MediaCorruptedError); ok {
+			err = s.persistence.update(id, StatusError.String(), "")
+			if err != nil {
+				return nil, err
+			}
+			report.Failed = append(report.Failed, id)
+		}
+	}
+
+	for _, mediaId := range report.Corrupted {
+		err = s.engine.Quarantine(mediaId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
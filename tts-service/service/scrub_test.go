@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestScrub(t *testing.T) {
+	Convey("TTS Scrubber", t, func(c C) {
+
+		Convey("should quarantine corrupted media and switch tts data using it to ERROR", func() {
+			//given
+			persistence := mock("abc", ttsData{Text: "Hello,World", Language: "EN", Status: StatusReady.String(), MediaId: "media1"})
+			engine := &scrubEngineMock{media: map[string]error{
+				"media1": tts.MediaCorruptedError{Id: "media1", Message: "checksum mismatch"},
+				"media2": nil,
+			}}
+
+			//when
+			report, err := NewScrubber(persistence, engine).Scrub()
+
+			//then
+			So(err, ShouldBeNil)
+			So(report.Checked, ShouldEqual, 2)
+			So(report.Corrupted, ShouldResemble, []string{"media1"})
+			So(report.Failed, ShouldResemble, []string{"abc"})
+			So(engine.quarantined, ShouldResemble, []string{"media1"})
+			So(persistence.data.Status, ShouldEqual, StatusError.String())
+			So(persistence.data.MediaId, ShouldEqual, "")
+		})
+
+		Convey("should switch tts data to ERROR when its media is missing", func() {
+			//given
+			persistence := mock("abc", ttsData{Text: "Hello,World", Language: "EN", Status: StatusReady.String(), MediaId: "media3"})
+			engine := &scrubEngineMock{media: map[string]error{}}
+
+			//when
+			report, err := NewScrubber(persistence, engine).Scrub()
+
+			//then
+			So(err, ShouldBeNil)
+			So(report.Corrupted, ShouldResemble, []string{"media3"})
+			So(report.Failed, ShouldResemble, []string{"abc"})
+			So(persistence.data.Status, ShouldEqual, StatusError.String())
+		})
+
+		Convey("should not quarantine media that can't be verified", func() {
+			//given
+			persistence := mock("abc", ttsData{Text: "Hello,World", Language: "EN", Status: StatusReady.String(), MediaId: "media1"})
+			engine := &scrubEngineMock{media: map[string]error{
+				"media1": errors.New("Permission denied"),
+			}}
+
+			//when
+			report, err := NewScrubber(persistence, engine).Scrub()
+
+			//then
+			So(err, ShouldBeNil)
+			So(report.Checked, ShouldEqual, 1)
+			So(report.Corrupted, ShouldBeEmpty)
+			So(report.Failed, ShouldBeEmpty)
+			So(engine.quarantined, ShouldBeEmpty)
+			So(persistence.data.Status, ShouldEqual, StatusReady.String())
+		})
+	})
+}
+
+//Mock object used to verify interaction between scrubber and tts.Engine
+type scrubEngineMock struct {
+	media       map[string]error //Verification result by media ID
+	quarantined []string
+}
+
+func (m *scrubEngineMock) Media() ([]string, error) {
+	ids := []string{}
+	for id := range m.media {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (m *scrubEngineMock) Verify(mediaId string) error {
+	err, ok := m.media[mediaId]
+	if !ok {
+		return tts.MediaCorruptedError{Id: mediaId, Message: "media is missing"}
+	}
+	return err
+}
+
+func (m *scrubEngineMock) Quarantine(mediaId string) error {
+	m.quarantined = append(m.quarantined, mediaId)
+	return nil
+}
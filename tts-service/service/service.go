@@ -5,7 +5,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	"log"
+	"strconv"
 	"strings"
 )
 
@@ -13,18 +17,41 @@ import (
 
 type TtsService interface {
 	Create(create *TtsCreate) (*TtsResult, error)
+	//Returns the ID the voice message of the request gets, without creating it
+	//Fails the way Create would, if the request can't be created
+	Id(create *TtsCreate) (string, error)
 	Get(ID string) (*TtsResult, error)
+	//Voices, formats... supported by the engine
+	Capabilities() tts.Capabilities
 }
 
 //Interface abstracting over tts.Engine
 type MediaEngine interface {
 	Process(text string, meta tts.Metadata) (string, error)
+	Normalize(text string, meta tts.Metadata) string
+	Info(mediaId string) (*tts.MediaInfo, error)
+	Marks(mediaId string) ([]tts.Mark, error)
+	Capabilities() tts.Capabilities
+	DetectLanguage(text string, meta tts.Metadata) tts.Detection
 }
 
-func New(persistence TtsPersistence, engine MediaEngine) TtsService {
+//Interface abstracting over lexicon.Store
+type LexiconStore interface {
+	Get(tenant, language string) (lexicon.Lexicon, error)
+}
+
+//Interface abstracting over assets.Store
+type AssetStore interface {
+	Get(tenant, name string) (assets.Asset, []byte, error)
+}
+
+func New(persistence TtsPersistence, engine MediaEngine, lexicons LexiconStore, assets AssetStore, ids IdStrategy) TtsService {
 	return impl{
 		persistence: persistence,
 		ttsEngine:   engine,
+		lexicons:    lexicons,
+		assets:      assets,
+		ids:         ids,
 	}
 }
 
@@ -33,32 +60,59 @@ func New(persistence TtsPersistence, engine MediaEngine) TtsService {
 type impl struct {
 	persistence TtsPersistence
 	ttsEngine   MediaEngine
+	lexicons    LexiconStore
+	assets      AssetStore
+	ids         IdStrategy
 }
 
 func (srv impl) Create(create *TtsCreate) (*TtsResult, error) {
 
-	if create.Text == "" {
-		return nil, errors.New("Cannot create: Text is empty")
+	req, err := srv.read(create)
+	if err != nil {
+		return nil, err
 	}
 
-	id := generateId(create.Text, create.Language.String())
-
 	initialStatus := StatusPending
 	mediaId := ""
 
+	//Kept for debugging, as this is what's actually read aloud
+	meta := tts.Metadata{Lang: req.language.String(), Ssml: create.Ssml, Options: create.Options, Lexicon: req.lex, Segments: req.segments, Fragments: create.Fragments}
+	normalizedText := srv.normalize(req.text, meta)
+
+	data := ttsData{
+		Text:                req.text,
+		NormalizedText:      normalizedText,
+		Ssml:                create.Ssml,
+		Options:             create.Options,
+		Language:            req.language.String(),
+		DetectionConfidence: req.detectionConfidence,
+		Tenant:              req.tenant,
+		LexiconVersion:      req.lex.Version,
+		Mix:                 create.Mix,
+		Segments:            toSegmentData(create.Segments),
+		Fragments:           create.Fragments,
+		Template:            create.Template,
+		Status:              initialStatus.String(),
+		MediaId:             mediaId,
+	}
+	if req.detectedLanguage != nil {
+		data.DetectedLanguage = req.detectedLanguage.String()
+	}
+
 	//Save TTS definition data in the persistent store
-	err := srv.persistence.create(id, ttsData{
-		Text:     create.Text,
-		Language: create.Language.String(),
-		Status:   initialStatus.String(),
-		MediaId:  mediaId,
-	})
+	err = srv.persistence.create(req.id, data)
 
 	if err != nil {
 		//In case of conflict, just return already existing object
 		_, ok := err.(ObjectAlreadyExistsError)
 		if ok {
-			return srv.Get(id)
+			//IDs chosen by clients aren't derived from the requests, so they may be reused for other ones
+			if create.Id != "" {
+				if stored, err := srv.persistence.get(req.id); err == nil && !sameRequest(stored, data) {
+					return nil, IdConflict(req.id)
+				}
+			}
+			return srv.regenerateFailed(req.id)
 		}
 
 		//Propagate other errors
@@ -66,19 +120,123 @@ func (srv impl) Create(create *TtsCreate) (*TtsResult, error) {
 	}
 
 	res := TtsResult{
-		Id:       id,
-		Text:     create.Text,
-		Language: create.Language,
-		Status:   initialStatus,
-		MediaId:  mediaId,
+		Id:                  req.id,
+		Text:                req.text,
+		NormalizedText:      normalizedText,
+		Ssml:                create.Ssml,
+		Options:             create.Options,
+		Language:            req.language,
+		DetectedLanguage:    req.detectedLanguage,
+		DetectionConfidence: req.detectionConfidence,
+		Tenant:              req.tenant,
+		LexiconVersion:      req.lex.Version,
+		Mix:                 create.Mix,
+		Segments:            create.Segments,
+		Fragments:           create.Fragments,
+		Template:            create.Template,
+		Status:              initialStatus,
+		MediaId:             mediaId,
 	}
 
 	//Generate Media in the background
-	go srv.generateMedia(res.Id, res.Text, res.Language)
+	go srv.generateMedia(res, req.lex, req.mix, req.segments)
 
 	return &res, nil
 }
 
+func (srv impl) Id(create *TtsCreate) (string, error) {
+	req, err := srv.read(create)
+	if err != nil {
+		return "", err
+	}
+	return req.id, nil
+}
+
+//What the voice message is created of: the request with its language detected, its lexicon, assets... read
+type creation struct {
+	text                string
+	language            LangEnum
+	detectedLanguage    LangEnum
+	detectionConfidence float64
+	tenant              string
+	lex                 lexicon.Lexicon
+	mix                 *tts.Mix
+	segments            []tts.Segment
+	id                  string
+}
+
+//Validates the request and reads what the voice message is created of
+func (srv impl) read(create *TtsCreate) (*creation, error) {
+
+	if create.Text == "" && len(create.Segments) == 0 {
+		return nil, errors.New("Cannot create: Text is empty")
+	}
+
+	//Dialogues are read segment by segment, their text is for reference only
+	text := create.Text
+	if len(create.Segments) > 0 {
+		text = dialogueText(create.Segments)
+	}
+
+	language := create.Language
+	var detectedLanguage LangEnum
+	var detectionConfidence float64
+
+	if language == AUTO && len(create.Segments) > 0 {
+		return nil, errors.New("Cannot create: languages of dialogues must be given")
+	}
+
+	if language == AUTO {
+		detection := srv.ttsEngine.DetectLanguage(create.Text, tts.Metadata{Ssml: create.Ssml})
+		if detection.Lang == "" {
+			return nil, errors.New("Cannot create: no language to detect")
+		}
+
+		language = lang(detection.Lang)
+		if detection.Detected != "" {
+			detectedLanguage = lang(detection.Detected)
+			detectionConfidence = detection.Confidence
+		}
+	}
+
+	tenant := create.Tenant
+	if tenant == "" {
+		tenant = lexicon.DefaultTenant
+	}
+
+	lex, err := srv.lexicons.Get(tenant, language.String())
+	if err != nil {
+		return nil, err
+	}
+
+	mix, mixKey, err := srv.readMix(tenant, create.Mix)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, partsKey, err := srv.readDialogue(tenant, create.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	//Values of templates are read the way their types tell, not necessarily the way the text reads
+	if len(create.Fragments) > 0 {
+		partsKey = strings.Join(create.Fragments, "|")
+	}
+
+	//IDs are based on the actual language, so that detected ones match explicitly requested ones
+	id := create.assigned
+	if id == "" {
+		id, err = srv.ids.id(idRequest{text, language.String(), create.Ssml, create.Options, lex, mixKey, partsKey}, create.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &creation{text, language, detectedLanguage, detectionConfidence, tenant, lex, mix, segments, id}, nil
+}
+
+
 func (srv impl) Get(id string) (*TtsResult, error) {
 
 	data, err := srv.persistence.get(id)
@@ -86,22 +244,225 @@ func (srv impl) Get(id string) (*TtsResult, error) {
 		return nil, err
 	}
 
-	return &TtsResult{
-		Id:       id,
-		Text:     data.Text,
-		Language: lang(data.Language),
-		Status:   status(data.Status),
-		MediaId:  data.MediaId,
-	}, nil
+	res := &TtsResult{
+		Id:             id,
+		Text:           data.Text,
+		NormalizedText: data.NormalizedText,
+		Ssml:           data.Ssml,
+		Options:        data.Options,
+		Language:       lang(data.Language),
+		Tenant:         data.Tenant,
+		LexiconVersion: data.LexiconVersion,
+		Mix:            data.Mix,
+		Segments:       fromSegmentData(data.Segments),
+		Fragments:      data.Fragments,
+		Template:       data.Template,
+		Status:         status(data.Status),
+		MediaId:        data.MediaId,
+	}
+
+	if data.DetectedLanguage != "" {
+		res.DetectedLanguage = lang(data.DetectedLanguage)
+		res.DetectionConfidence = data.DetectionConfidence
+	}
+
+	if res.MediaId != "" {
+		//Missing media info is not fatal, the media itself can still be served
+		res.Media, err = srv.ttsEngine.Info(res.MediaId)
+		if err != nil {
+			log.Printf("Problem with TTS(id: %v) - can't read media info: %v", id, err)
+		}
+	}
+
+	if res.MediaId != "" && len(res.Segments) > 0 {
+		//The segments are still listed without their timing
+		if err := srv.readTimings(res); err != nil {
+			log.Printf("Problem with TTS(id: %v) - can't read timings of the segments: %v", id, err)
+		}
+	}
+
+	return res, nil
+}
+
+//Returns already existing object.
+//If its media generation failed (or the media got corrupted), the generation is started again.
+func (srv impl) regenerateFailed(id string) (*TtsResult, error) {
+
+	res, err := srv.Get(id)
+	if err != nil || res.Status != StatusError {
+		return res, err
+	}
+
+	//Only the latest version of the lexicon is kept
+	lex, err := srv.lexicons.Get(tenantOf(res), res.Language.String())
+	if err != nil {
+		return nil, err
+	}
+	if lex.Version != res.LexiconVersion {
+		log.Printf("TTS(id: %v) is regenerated with lexicon version %d instead of %d", id, lex.Version, res.LexiconVersion)
+	}
+
+	//So are the assets
+	mix, _, err := srv.readMix(tenantOf(res), res.Mix)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, _, err := srv.readDialogue(tenantOf(res), res.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	err = srv.persistence.update(id, StatusPending.String(), "")
+	if err != nil {
+		return nil, err
+	}
+	res.Status = StatusPending
+
+	//Generate Media in the background
+	go srv.generateMedia(*res, lex, mix, segments)
+
+	return res, nil
+}
+
+func (srv impl) Capabilities() tts.Capabilities {
+	return srv.ttsEngine.Capabilities()
+}
+
+//Records stored before lexicons were introduced have no tenant
+func tenantOf(res *TtsResult) string {
+	if res.Tenant == "" {
+		return lexicon.DefaultTenant
+	}
+	return res.Tenant
+}
+
+//Reads the assets of the mix, if any
+//Returns the mix for the engine and its key, which changes whenever one of the assets is replaced
+func (srv impl) readMix(tenant string, mix *Mix) (*tts.Mix, string, error) {
+	if mix == nil {
+		return nil, "", nil
+	}
+
+	result := &tts.Mix{Volume: mix.Volume, Ducking: mix.Ducking}
+	key := fmt.Sprintf("volume=%v,ducking=%v", mix.Volume, mix.Ducking)
+
+	tracks := []struct {
+		role    string
+		name    string
+		content *[]byte
+	}{
+		{"background", mix.Background, &result.Background},
+		{"intro", mix.Intro, &result.Intro},
+		{"outro", mix.Outro, &result.Outro},
+	}
+
+	for _, track := range tracks {
+		if track.name == "" {
+			continue
+		}
+
+		asset, content, err := srv.assets.Get(tenant, track.name)
+		if err != nil {
+			return nil, "", err
+		}
+
+		*track.content = content
+		key += "," + track.role + "=" + track.name + ":" + asset.Checksum
+	}
+
+	return result, key, nil
+}
+
+//Reads the lexicons of the languages of the dialogue, if any
+//Returns the segments for the engine and their key, which changes whenever one of the lexicons does
+func (srv impl) readDialogue(tenant string, segments []Segment) ([]tts.Segment, string, error) {
+	var result []tts.Segment
+	keys := []string{}
+
+	for _, s := range segments {
+		lex, err := srv.lexicons.Get(tenant, s.Language.String())
+		if err != nil {
+			return nil, "", err
+		}
+
+		result = append(result, tts.Segment{Speaker: s.Speaker, Text: s.Text, Lang: s.Language.String(), Voice: s.Voice, Pause: s.Pause, Lexicon: lex})
+		keys = append(keys, fmt.Sprintf("speaker=%s,lang=%s,voice=%s,pause=%v,lexicon=%d:%s", s.Speaker, s.Language, s.Voice, s.Pause, lex.Version, s.Text))
+	}
+
+	return result, strings.Join(keys, "|"), nil
+}
+
+//Reads the timing of the segments from the marks of the media
+func (srv impl) readTimings(res *TtsResult) error {
+	marks, err := srv.ttsEngine.Marks(res.MediaId)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	for _, mark := range marks {
+		if mark.Type == tts.MarkSegment && i < len(res.Segments) {
+			res.Segments[i].Start = mark.Start
+			res.Segments[i].End = mark.End
+			i++
+		}
+	}
+
+	return nil
 }
 
-func (srv impl) generateMedia(id, text string, language LangEnum) {
+//Normalizes dialogues segment by segment, a line each
+func (srv impl) normalize(text string, meta tts.Metadata) string {
+	if len(meta.Segments) == 0 {
+		return srv.ttsEngine.Normalize(text, meta)
+	}
+
+	lines := []string{}
+	for _, s := range meta.Segments {
+		lines = append(lines, srv.ttsEngine.Normalize(s.Text, tts.Metadata{Lang: s.Lang, Options: meta.Options, Lexicon: s.Lexicon}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func dialogueText(segments []Segment) string {
+	lines := []string{}
+	for _, s := range segments {
+		lines = append(lines, s.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func toSegmentData(segments []Segment) []segmentData {
+	var data []segmentData
+	for _, s := range segments {
+		data = append(data, segmentData{s.Speaker, s.Text, s.Language.String(), s.Voice, s.Pause})
+	}
+	return data
+}
+
+func fromSegmentData(data []segmentData) []Segment {
+	var segments []Segment
+	for _, d := range data {
+		segments = append(segments, Segment{Speaker: d.Speaker, Text: d.Text, Language: lang(d.Language), Voice: d.Voice, Pause: d.Pause})
+	}
+	return segments
+}
+
+func (srv impl) generateMedia(res TtsResult, lex lexicon.Lexicon, mix *tts.Mix, segments []tts.Segment) {
+	id := res.Id
 
 	metadata := tts.Metadata{
-		Lang: language.String(),
+		Lang:      res.Language.String(),
+		Ssml:      res.Ssml,
+		Options:   res.Options,
+		Lexicon:   lex,
+		Mix:       mix,
+		Segments:  segments,
+		Fragments: res.Fragments,
 	}
 
-	mediaId, mediaErr := srv.ttsEngine.Process(text, metadata)
+	mediaId, mediaErr := srv.ttsEngine.Process(res.Text, metadata)
 
 	if mediaErr == nil {
 		srv.persistence.update(id, StatusReady.String(), mediaId)
@@ -111,8 +472,27 @@ func (srv impl) generateMedia(id, text string, language LangEnum) {
 	}
 }
 
-func generateId(text string, language string) string {
+//SSML documents get different IDs than the same plain texts, as markup is read differently.
+//So do texts read with different options (voice, rate...), different versions of the tenant's lexicon, or mixed with other assets.
+//Texts read without any lexicon or mix keep their IDs.
+//Dialogues and rendered templates are identified by their parts as well, as told by partsKey.
+func generateId(text string, language string, ssml bool, options tts.Options, lex lexicon.Lexicon, mixKey string, partsKey string) string {
 	baseStr := strings.ToLower(strings.Replace(text, " ", "", -1) + language)
+	if ssml {
+		baseStr += "#ssml"
+	}
+	if options := options.String(); options != "" {
+		baseStr += "#" + options
+	}
+	if lex.Version > 0 {
+		baseStr += "#lexicon=" + lex.Tenant + ":" + strconv.Itoa(lex.Version)
+	}
+	if mixKey != "" {
+		baseStr += "#mix=" + mixKey
+	}
+	if partsKey != "" {
+		baseStr += "#parts=" + partsKey
+	}
 	sha1Sum := sha1.Sum([]byte(baseStr))
 	encoded := hex.EncodeToString(sha1Sum[:])
 	return encoded
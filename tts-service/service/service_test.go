@@ -2,9 +2,13 @@ package service
 
 import (
 	"errors"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 	. "github.com/smartystreets/goconvey/convey"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestService(t *testing.T) {
@@ -15,20 +19,54 @@ func TestService(t *testing.T) {
 			text2 := "  hELLO,wORLD  "
 			text3 := "Hello World"
 
-			res1en := generateId(text1, "EN")
-			res1pl := generateId(text1, "PL")
-			res2en := generateId(text2, "EN")
-			res3en := generateId(text3, "EN")
+			res1en := generateId(text1, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", "")
+			res1pl := generateId(text1, "PL", false, tts.Options{}, lexicon.Lexicon{}, "", "")
+			res2en := generateId(text2, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", "")
+			res3en := generateId(text3, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", "")
 
 			So(res1en, ShouldNotEqual, res1pl)
 			So(res2en, ShouldEqual, res1en)
 			So(res3en, ShouldNotEqual, res1en)
 		})
 
+		Convey("'generateId' function should generate different IDs for SSML documents", func() {
+			text := "<speak>Hello</speak>"
+
+			So(generateId(text, "EN", true, tts.Options{}, lexicon.Lexicon{}, "", ""), ShouldNotEqual, generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", ""))
+		})
+
+		Convey("'generateId' function should generate different IDs for different options", func() {
+			text := "Hello"
+			rate := 2
+
+			plain := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", "")
+			amy := generateId(text, "EN", false, tts.Options{Voice: "Amy"}, lexicon.Lexicon{}, "", "")
+			fast := generateId(text, "EN", false, tts.Options{Voice: "Amy", Rate: &rate}, lexicon.Lexicon{}, "", "")
+
+			So(amy, ShouldNotEqual, plain)
+			So(fast, ShouldNotEqual, amy)
+			So(generateId(text, "EN", false, tts.Options{Voice: "Amy"}, lexicon.Lexicon{}, "", ""), ShouldEqual, amy)
+		})
+
+		Convey("'generateId' function should generate different IDs for different lexicon versions", func() {
+			text := "Hello"
+
+			plain := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", "")
+			empty := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{Tenant: "acme"}, "", "")
+			v1 := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{Tenant: "acme", Version: 1}, "", "")
+			v2 := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{Tenant: "acme", Version: 2}, "", "")
+			other := generateId(text, "EN", false, tts.Options{}, lexicon.Lexicon{Tenant: "other", Version: 1}, "", "")
+
+			So(empty, ShouldEqual, plain)
+			So(v1, ShouldNotEqual, plain)
+			So(v2, ShouldNotEqual, v1)
+			So(other, ShouldNotEqual, v1)
+		})
+
 		Convey("Get by Id should return an error if not exists", func() {
 			//given
-			mock := mock("abc", ttsData{"Hello,World", "EN", StatusPending.String(), ""})
-			s := New(mock, mock)
+			mock := mock("abc", ttsData{Text: "Hello,World", Language: "EN", Status: StatusPending.String(), MediaId: ""})
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
 			data, err := s.Get("def")
@@ -45,8 +83,8 @@ func TestService(t *testing.T) {
 
 		Convey("Get by Id should return an object if exists", func() {
 			//given
-			mock := mock("abc", ttsData{"Hello,World", "EN", StatusPending.String(), ""})
-			s := New(mock, mock)
+			mock := mock("abc", ttsData{Text: "Hello,World", Language: "EN", Status: StatusPending.String(), MediaId: ""})
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
 			data, err := s.Get("abc")
@@ -70,10 +108,10 @@ func TestService(t *testing.T) {
 			//given
 			mock := mock("", ttsData{}) //Notice no initial data
 			mock.mediaIdToGenerate = mediaId
-			s := New(mock, mock)
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
-			res, err := s.Create(&TtsCreate{text, EN})
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN})
 
 			//then after Create
 			So(err, ShouldBeNil)
@@ -81,6 +119,7 @@ func TestService(t *testing.T) {
 			id := res.Id
 			So(id, ShouldNotBeEmpty)
 			assertCommonValues(res, text, EN, StatusPending, "")
+			So(res.NormalizedText, ShouldEqual, "HELLO, TTS")
 
 			//Ensure all operations in the backgrounds completed...
 			actions = readBlocking(actions, mock.recordChan)
@@ -93,6 +132,9 @@ func TestService(t *testing.T) {
 			So(res, ShouldNotBeNil)
 			So(res.Id, ShouldEqual, id)
 			assertCommonValues(res, text, EN, StatusReady, mediaId)
+			So(res.NormalizedText, ShouldEqual, "HELLO, TTS")
+			So(res.Media, ShouldNotBeNil)
+			So(res.Media.MimeType, ShouldEqual, "audio/mpeg")
 
 			//Verify interaction
 			So(actions[0], ShouldEqual, "persistence.create")
@@ -107,10 +149,10 @@ func TestService(t *testing.T) {
 			//given
 			mock := mock("", ttsData{}) //Notice no initial data
 			mock.mediaIdToGenerate = "" //Indicates that mock media engine should generate an error
-			s := New(mock, mock)
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
-			res, err := s.Create(&TtsCreate{text, EN})
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN})
 
 			//then after Create
 			So(err, ShouldBeNil)
@@ -130,6 +172,7 @@ func TestService(t *testing.T) {
 			So(res, ShouldNotBeNil)
 			So(res.Id, ShouldEqual, id)
 			assertCommonValues(res, text, EN, StatusError, "")
+			So(res.Media, ShouldBeNil)
 
 			//Verify interaction
 			So(actions[0], ShouldEqual, "persistence.create")
@@ -137,6 +180,276 @@ func TestService(t *testing.T) {
 			So(actions[2], ShouldEqual, "persistence.update")
 		})
 
+		Convey("Create should pass SSML documents to the engine as such", func() {
+			const text = "<speak>Hello</speak>"
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "ssmlAudio"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN, Ssml: true})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Ssml, ShouldBeTrue)
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Ssml, ShouldBeTrue)
+
+			res, err = s.Get(res.Id)
+			So(err, ShouldBeNil)
+			So(res.Ssml, ShouldBeTrue)
+		})
+
+		Convey("Create should pass options to the engine and keep them", func() {
+			const text = "Hello"
+			rate := 3
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "fastAudio"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN, Options: tts.Options{Voice: "Amy", Rate: &rate}})
+
+			//then
+			So(err, ShouldBeNil)
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Voice, ShouldEqual, "Amy")
+			So(*mock.processedMeta.Rate, ShouldEqual, 3)
+
+			res, err = s.Get(res.Id)
+			So(err, ShouldBeNil)
+			So(res.Options.String(), ShouldEqual, "voice=Amy;rate=3")
+		})
+
+		Convey("Create should read the text with the lexicon of the tenant", func() {
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "audio"
+			mock.lexicon = lexicon.Lexicon{Tenant: "acme", Language: "EN", Version: 3,
+				Entries: []lexicon.Entry{{Grapheme: "XJ9", Alias: "ex jay nine"}}}
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "XJ9", Language: EN, Tenant: "acme"})
+
+			//then
+			So(err, ShouldBeNil)
+			So(mock.lexiconTenant, ShouldEqual, "acme")
+			So(res.Tenant, ShouldEqual, "acme")
+			So(res.LexiconVersion, ShouldEqual, 3)
+			So(res.Id, ShouldEqual, generateId("XJ9", "EN", false, tts.Options{}, mock.lexicon, "", ""))
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Lexicon, ShouldResemble, mock.lexicon)
+
+			res, err = s.Get(res.Id)
+			So(err, ShouldBeNil)
+			So(res.LexiconVersion, ShouldEqual, 3)
+		})
+
+		Convey("Create should use the lexicon of the default tenant if none is given", func() {
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "XJ9", Language: EN})
+
+			//then
+			So(err, ShouldBeNil)
+			So(mock.lexiconTenant, ShouldEqual, lexicon.DefaultTenant)
+			So(res.LexiconVersion, ShouldEqual, 0)
+		})
+
+		Convey("Create should mix the tenant's assets with the speech", func() {
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "audio"
+			jingles := mockAssets{"acme/jingle": "RIFF1", "acme/music": "RIFF2"}
+			s := New(mock, mock, mock, jingles, legacyIds{})
+			mix := &Mix{Background: "music", Intro: "jingle", Ducking: 12}
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "Welcome", Language: EN, Tenant: "acme", Mix: mix})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Mix, ShouldEqual, mix)
+			So(res.Id, ShouldNotEqual, generateId("Welcome", "EN", false, tts.Options{}, lexicon.Lexicon{}, "", ""))
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Mix, ShouldResemble, &tts.Mix{Background: []byte("RIFF2"), Intro: []byte("RIFF1"), Ducking: 12})
+
+			//Replacing an asset changes the ID, so that the text is mixed again
+			jingles["acme/jingle"] = "RIFF3"
+			_, key, _ := s.(impl).readMix("acme", mix)
+			So(generateId("Welcome", "EN", false, tts.Options{}, lexicon.Lexicon{}, key, ""), ShouldNotEqual, res.Id)
+		})
+
+		Convey("Create should fail if an asset of the mix doesn't exist", func() {
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			_, err := s.Create(&TtsCreate{Text: "Welcome", Language: EN, Mix: &Mix{Intro: "jingle"}})
+
+			//then
+			So(err, ShouldResemble, assets.NotFound("jingle"))
+		})
+
+		Convey("Create should read dialogues segment by segment", func() {
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "dialogue"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+			segments := []Segment{
+				{Speaker: "agent", Text: "How can I help?", Language: EN, Voice: "Amy"},
+				{Speaker: "customer", Text: "Dzień dobry", Language: PL, Pause: 300 * time.Millisecond},
+			}
+
+			//when
+			res, err := s.Create(&TtsCreate{Language: EN, Segments: segments})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Text, ShouldEqual, "How can I help?\nDzień dobry")
+			So(res.NormalizedText, ShouldEqual, "HOW CAN I HELP?\nDZIEŃ DOBRY")
+			So(res.Segments, ShouldResemble, segments)
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Segments, ShouldResemble, []tts.Segment{
+				{Speaker: "agent", Text: "How can I help?", Lang: "EN", Voice: "Amy"},
+				{Speaker: "customer", Text: "Dzień dobry", Lang: "PL", Pause: 300 * time.Millisecond},
+			})
+
+			//Other speakers make other dialogues
+			segments[1].Speaker = "caller"
+			_, key, _ := s.(impl).readDialogue(lexicon.DefaultTenant, segments)
+			So(generateId(res.Text, "EN", false, tts.Options{}, lexicon.Lexicon{}, "", key), ShouldNotEqual, res.Id)
+		})
+
+		Convey("Create should read rendered templates fragment by fragment", func() {
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "rendered"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+			fragments := []string{"Order ", "one two", " ships"}
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "Order 12 ships", Language: EN, Fragments: fragments, Template: "shipped"})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Template, ShouldEqual, "shipped")
+			So(mock.data.Fragments, ShouldResemble, fragments)
+
+			//The same text read as a number is another voice message
+			So(res.Id, ShouldNotEqual, generateId("Order 12 ships", "EN", false, tts.Options{}, lexicon.Lexicon{}, "", ""))
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Fragments, ShouldResemble, fragments)
+		})
+
+		Convey("Get should return the timing of the segments of dialogues", func() {
+			//given
+			mock := mock("abc", ttsData{Text: "Hi\nCześć", Language: "EN", Status: StatusReady.String(), MediaId: "dialogue",
+				Segments: []segmentData{{Speaker: "agent", Text: "Hi", Language: "EN"}, {Speaker: "customer", Text: "Cześć", Language: "PL"}}})
+			mock.marks = []tts.Mark{
+				{Type: tts.MarkWord, Text: "Hi", End: time.Second},
+				{Type: tts.MarkSegment, Text: "agent", End: time.Second},
+				{Type: tts.MarkSegment, Text: "customer", Start: time.Second, End: 2 * time.Second},
+			}
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Get("abc")
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Segments, ShouldResemble, []Segment{
+				{Speaker: "agent", Text: "Hi", Language: EN, End: time.Second},
+				{Speaker: "customer", Text: "Cześć", Language: PL, Start: time.Second, End: 2 * time.Second},
+			})
+		})
+
+		Convey("Create should detect the language and record the detection", func() {
+			actions := []string{}
+
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "polishAudio"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "Cześć, co słychać?", Language: AUTO})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Language, ShouldEqual, PL)
+			So(res.DetectedLanguage, ShouldEqual, PL)
+			So(res.DetectionConfidence, ShouldEqual, 0.99)
+			So(res.Id, ShouldEqual, generateId("Cześć, co słychać?", "PL", false, tts.Options{}, lexicon.Lexicon{}, "", ""))
+
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			actions = readBlocking(actions, mock.recordChan)
+			So(mock.processedMeta.Lang, ShouldEqual, "PL")
+
+			res, err = s.Get(res.Id)
+			So(err, ShouldBeNil)
+			So(res.DetectedLanguage, ShouldEqual, PL)
+			So(res.DetectionConfidence, ShouldEqual, 0.99)
+		})
+
+		Convey("Create should fall back to the language chosen by the engine if the detection isn't confident", func() {
+			//given
+			mock := mock("", ttsData{}) //Notice no initial data
+			mock.mediaIdToGenerate = "englishAudio"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: "OK", Language: AUTO})
+
+			//then
+			So(err, ShouldBeNil)
+			So(res.Language, ShouldEqual, EN)
+			So(res.DetectedLanguage, ShouldEqual, PL)
+			So(res.DetectionConfidence, ShouldEqual, 0.4)
+
+			readBlocking([]string{}, mock.recordChan)
+			readBlocking([]string{}, mock.recordChan)
+			readBlocking([]string{}, mock.recordChan)
+		})
+
 		Convey("Create should not start media generation on create failure", func() {
 			const text = "Boom!"
 			actions := []string{}
@@ -144,10 +457,10 @@ func TestService(t *testing.T) {
 			//given
 			mock := mock("", ttsData{}) //Notice no initial data
 			mock.ttsTextThatFails = text
-			s := New(mock, mock)
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
-			res, err := s.Create(&TtsCreate{text, EN})
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN})
 
 			//then after Create
 			So(err, ShouldNotBeNil)
@@ -168,12 +481,12 @@ func TestService(t *testing.T) {
 			actions := []string{}
 
 			//given
-			mock := mock(id, ttsData{text, "EN", StatusReady.String(), "mediaId#123"})
+			mock := mock(id, ttsData{Text: text, Language: "EN", Status: StatusReady.String(), MediaId: "mediaId#123"})
 			mock.ttsTextThatConflicts = text
-			s := New(mock, mock)
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
 
 			//when
-			res, err := s.Create(&TtsCreate{text, EN})
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN})
 
 			//then after Create
 			So(err, ShouldBeNil)
@@ -189,6 +502,46 @@ func TestService(t *testing.T) {
 			So(actions[0], ShouldEqual, "persistence.create")
 			So(actions[1], ShouldEqual, "persistence.get")
 		})
+
+		Convey("Create should regenerate existing object in ERROR status on conflict", func() {
+			const text = "Hello, TTS"
+			const id = "15f3f83eec955266793622006b0f66a47398f3b1"
+			actions := []string{}
+
+			//given
+			mock := mock(id, ttsData{Text: text, Language: "EN", Status: StatusError.String(), MediaId: ""})
+			mock.ttsTextThatConflicts = text
+			mock.mediaIdToGenerate = "mediaId#456"
+			s := New(mock, mock, mock, mockAssets{}, legacyIds{})
+
+			//when
+			res, err := s.Create(&TtsCreate{Text: text, Language: EN})
+
+			//then after Create
+			So(err, ShouldBeNil)
+			So(res, ShouldNotBeNil)
+			So(res.Id, ShouldEqual, id)
+			assertCommonValues(res, text, EN, StatusPending, "")
+
+			//Ensure all operations in the backgrounds completed...
+			for i := 0; i < 5; i++ {
+				actions = readBlocking(actions, mock.recordChan)
+			}
+
+			//Verify interaction
+			So(actions, ShouldResemble, []string{
+				"persistence.create",
+				"persistence.get",
+				"persistence.update",
+				"tts.Engine.Process",
+				"persistence.update",
+			})
+
+			//then after Get
+			res, err = s.Get(id)
+			So(err, ShouldBeNil)
+			assertCommonValues(res, text, EN, StatusReady, "mediaId#456")
+		})
 	})
 }
 
@@ -202,7 +555,7 @@ func mock(id string, data ttsData) *interactionMock {
 }
 
 //Mock object used to verify correct interaction between service.persistence and tts.Engine inside service
-//This mock implement both service.TtsPersistence and MediaEngine interfaces.
+//This mock implement service.TtsPersistence, MediaEngine and LexiconStore interfaces.
 type interactionMock struct {
 	id   string  //tts id
 	data ttsData //tts persistence data
@@ -211,6 +564,12 @@ type interactionMock struct {
 	ttsTextThatFails     string //if invoked with this text, simulate persistence failure
 	ttsTextThatConflicts string //if invoked with this text, return ObjectAlreadyExistsError
 
+	processedMeta tts.Metadata //metadata passed to tts.Engine.Process
+	marks         []tts.Mark   //returned from tts.Engine.Marks
+
+	lexicon       lexicon.Lexicon //returned for any tenant and language
+	lexiconTenant string          //tenant of the last lexicon.Store.Get
+
 	recordChan chan string
 }
 
@@ -260,8 +619,24 @@ func (mp *interactionMock) del(id string) error {
 	}
 }
 
+func (mp *interactionMock) list() ([]string, error) {
+	if mp.id == "" {
+		return []string{}, nil
+	}
+	return []string{mp.id}, nil
+}
+
+func (mp *interactionMock) rotate() (int, error) {
+	return 0, nil
+}
+
+func (mp *interactionMock) migrate() (int, error) {
+	return 0, nil
+}
+
 //Implements MediaEngine interface
 func (mp *interactionMock) Process(text string, meta tts.Metadata) (string, error) {
+	mp.processedMeta = meta
 	mp.recordChan <- "tts.Engine.Process"
 
 	if mp.mediaIdToGenerate == "" {
@@ -271,6 +646,51 @@ func (mp *interactionMock) Process(text string, meta tts.Metadata) (string, erro
 	return mp.mediaIdToGenerate, nil
 }
 
+//Implements LexiconStore interface
+func (mp *interactionMock) Get(tenant, language string) (lexicon.Lexicon, error) {
+	mp.lexiconTenant = tenant
+	return mp.lexicon, nil
+}
+
+//Implements MediaEngine interface
+func (mp *interactionMock) Capabilities() tts.Capabilities {
+	return tts.Capabilities{Formats: []string{"mp3"}}
+}
+
+//Implements MediaEngine interface
+func (mp *interactionMock) DetectLanguage(text string, meta tts.Metadata) tts.Detection {
+	if strings.Contains(text, "ł") {
+		return tts.Detection{Lang: "PL", Detected: "PL", Confidence: 0.99}
+	}
+	return tts.Detection{Lang: "EN", Detected: "PL", Confidence: 0.4}
+}
+
+//Implements MediaEngine interface
+func (mp *interactionMock) Normalize(text string, meta tts.Metadata) string {
+	return strings.ToUpper(text)
+}
+
+//Implements MediaEngine interface
+func (mp *interactionMock) Info(mediaId string) (*tts.MediaInfo, error) {
+	return &tts.MediaInfo{MimeType: "audio/mpeg", Size: 123}, nil
+}
+
+//Implements MediaEngine interface
+func (mp *interactionMock) Marks(mediaId string) ([]tts.Mark, error) {
+	return mp.marks, nil
+}
+
+//Implements AssetStore interface, contents by "<tenant>/<name>"
+type mockAssets map[string]string
+
+func (ma mockAssets) Get(tenant, name string) (assets.Asset, []byte, error) {
+	content, ok := ma[tenant+"/"+name]
+	if !ok {
+		return assets.Asset{}, nil, assets.NotFound(name)
+	}
+	return assets.Asset{Tenant: tenant, Name: name, Checksum: content}, []byte(content), nil
+}
+
 func readBlocking(source []string, recordChan chan string) []string {
 	s := <-recordChan
 	return append(source, s)
@@ -0,0 +1,199 @@
+package ssml
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/language"
+)
+
+// element describes a supported SSML element
+type element struct {
+	attrs    map[string]func(value string) string // Validators of supported attributes, returning a problem, if any
+	required []string
+	empty    bool // Can't have any content
+	textOnly bool // Can't contain other elements
+}
+
+var elements = map[string]element{
+	"speak": {
+		attrs: map[string]func(string) string{"version": anything, "xml:lang": languageTag},
+	},
+	"break": {
+		attrs: map[string]func(string) string{"time": breakTime, "strength": oneOf(strengths...)},
+		empty: true,
+	},
+	"prosody": {
+		attrs: map[string]func(string) string{
+			"rate":   keywordOr(`^\d+(\.\d+)?%$`, "a percentage", "x-slow", "slow", "medium", "fast", "x-fast", "default"),
+			"pitch":  keywordOr(`^[+-]\d+(\.\d+)?(%|Hz|st)$`, "a relative change, e.g. +10%", "x-low", "low", "medium", "high", "x-high", "default"),
+			"volume": keywordOr(`^[+-]\d+(\.\d+)?dB$`, "a relative change, e.g. -6dB", "silent", "x-soft", "soft", "medium", "loud", "x-loud", "default"),
+		},
+	},
+	"say-as": {
+		attrs: map[string]func(string) string{
+			"interpret-as": oneOf(InterpretAs...),
+			"format":       anything,
+			"detail":       anything,
+		},
+		required: []string{"interpret-as"},
+		textOnly: true,
+	},
+	"emphasis": {
+		attrs: map[string]func(string) string{"level": oneOf("strong", "moderate", "reduced", "none")},
+	},
+	"sub": {
+		attrs:    map[string]func(string) string{"alias": notEmpty},
+		required: []string{"alias"},
+		textOnly: true,
+	},
+	"phoneme": {
+		attrs:    map[string]func(string) string{"alphabet": oneOf(Alphabets...), "ph": notEmpty},
+		required: []string{"ph"},
+		textOnly: true,
+	},
+	"lang": {
+		attrs:    map[string]func(string) string{"xml:lang": languageTag},
+		required: []string{"xml:lang"},
+	},
+}
+
+// Supported values of the <say-as> interpret-as attribute
+var InterpretAs = []string{"characters", "spell-out", "cardinal", "number", "ordinal", "digits", "date", "time", "telephone"}
+
+// Supported phonetic alphabets of the <phoneme> element
+var Alphabets = []string{"ipa", "x-sampa"}
+
+var strengths = []string{"none", "x-weak", "weak", "medium", "strong", "x-strong"}
+
+// Pauses of the <break> strengths
+var strengthDurations = map[string]time.Duration{
+	"none":     0,
+	"x-weak":   100 * time.Millisecond,
+	"weak":     250 * time.Millisecond,
+	"medium":   500 * time.Millisecond,
+	"strong":   750 * time.Millisecond,
+	"x-strong": time.Second,
+}
+
+// Longer pauses are rather mistakes
+const maxBreak = 10 * time.Second
+
+// BreakDuration returns the pause of a <break> element with the given attributes
+func BreakDuration(attrs map[string]string) time.Duration {
+
+	if value, ok := attrs["time"]; ok {
+
+		duration, _ := parseBreakTime(value)
+		return duration
+	}
+
+	if strength, ok := attrs["strength"]; ok {
+
+		return strengthDurations[strength]
+	}
+
+	return strengthDurations["medium"]
+}
+
+var breakTimePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ms|s)$`)
+
+func parseBreakTime(value string) (time.Duration, bool) {
+
+	m := breakTimePattern.FindStringSubmatch(value)
+
+	if m == nil {
+		return 0, false
+	}
+
+	amount, _ := strconv.ParseFloat(m[1], 64)
+	if m[2] == "s" {
+		amount *= 1000
+	}
+
+	return time.Duration(amount * float64(time.Millisecond)), true
+}
+
+// Language returns the service language (e.g. "EN") of the xml:lang attribute value (e.g. "en-US").
+// It returns false for languages missing in the language registry.
+func Language(tag string) (string, bool) {
+
+	l, ok := language.Default().ByTag(tag)
+	return l.Code, ok
+}
+
+// Validators
+
+func anything(string) string {
+
+	return ""
+}
+
+func notEmpty(value string) string {
+
+	if strings.TrimSpace(value) == "" {
+		return "must not be empty"
+	}
+
+	return ""
+}
+
+func breakTime(value string) string {
+
+	duration, ok := parseBreakTime(value)
+
+	switch {
+	case !ok:
+		return "must be a time like 500ms or 1.5s"
+	case duration > maxBreak:
+		return "must not exceed " + maxBreak.String()
+	default:
+		return ""
+	}
+}
+
+func languageTag(value string) string {
+
+	if _, ok := Language(value); !ok {
+		tags := []string{}
+		for _, l := range language.Default().All() {
+			tags = append(tags, l.Tag)
+		}
+
+		return "must be one of the supported languages: " + strings.Join(tags, ", ")
+	}
+
+	return ""
+}
+
+func oneOf(values ...string) func(string) string {
+
+	return func(value string) string {
+
+		for _, allowed := range values {
+			if value == allowed {
+				return ""
+			}
+		}
+
+		return "must be one of: " + strings.Join(values, ", ")
+	}
+}
+
+// keywordOr accepts one of the keywords, or a value matching the pattern
+func keywordOr(pattern string, description string, keywords ...string) func(string) string {
+
+	re := regexp.MustCompile(pattern)
+	isKeyword := oneOf(keywords...)
+
+	return func(value string) string {
+
+		if re.MatchString(value) || isKeyword(value) == "" {
+			return ""
+		}
+
+		return "must be " + description + " or one of: " + strings.Join(keywords, ", ")
+	}
+}
@@ -0,0 +1,409 @@
+// Package ssml parses and validates the subset of the Speech Synthesis Markup Language (https://www.w3.org/TR/speech-synthesis11/)
+// supported by the service, and renders it for speech synthesizers, with or without SSML support.
+package ssml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Node is an element or a text of the SSML document
+type Node struct {
+	Name     string            // Element name, empty for a text
+	Attrs    map[string]string // Element attributes, e.g. "xml:lang"
+	Text     string            // Text of a text node
+	Children []*Node
+}
+
+// Problem describes an invalid part of the document
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+// InvalidError lists all the problems found in the document
+type InvalidError struct {
+	Problems []Problem
+}
+
+func (err InvalidError) Error() string {
+
+	problems := []string{}
+	for _, problem := range err.Problems {
+		problems = append(problems, problem.String())
+	}
+
+	return "Invalid SSML: " + strings.Join(problems, "; ")
+}
+
+// Parse parses and validates the document.
+// It returns the root <speak> element, or InvalidError listing the problems found.
+func Parse(document string) (*Node, error) {
+
+	p := parser{document: document, decoder: xml.NewDecoder(strings.NewReader(document))}
+	root := p.parse()
+
+	if len(p.problems) > 0 {
+
+		return nil, InvalidError{p.problems}
+	}
+
+	return root, nil
+}
+
+type parser struct {
+	document string
+	decoder  *xml.Decoder
+	problems []Problem
+}
+
+func (p *parser) parse() *Node {
+
+	var root *Node
+	stack := []*Node{}
+
+	for {
+
+		// Before reading the token, the offset points at its beginning
+		offset := p.decoder.InputOffset()
+		token, err := p.decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+
+			// The rest of the document can't be read
+			message := err.Error()
+			if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+				message = syntaxErr.Msg
+			}
+			p.problem(p.decoder.InputOffset(), "%s", message)
+			return nil
+		}
+
+		switch t := token.(type) {
+
+		case xml.StartElement:
+
+			var parent *Node
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+
+			node := p.element(t, parent, offset)
+
+			switch {
+			case parent != nil:
+				parent.Children = append(parent.Children, node)
+			case root == nil:
+				root = node
+			default:
+				p.problem(offset, "the document must have a single <speak> element")
+			}
+
+			stack = append(stack, node)
+
+		case xml.EndElement:
+
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+
+			text := string(t)
+
+			if len(stack) == 0 {
+
+				if strings.TrimSpace(text) != "" {
+					p.problem(offset, "text must be placed inside the <speak> element")
+				}
+				continue
+			}
+
+			parent := stack[len(stack)-1]
+
+			if elements[parent.Name].empty && strings.TrimSpace(text) != "" {
+				p.problem(offset, "<%s> must be empty", parent.Name)
+			}
+
+			parent.Children = append(parent.Children, &Node{Text: text})
+		}
+	}
+
+	if root == nil && len(p.problems) == 0 {
+		p.problem(0, "the document must have a <speak> element")
+	}
+
+	return root
+}
+
+// element validates the element and its attributes
+func (p *parser) element(t xml.StartElement, parent *Node, offset int64) *Node {
+
+	name := t.Name.Local
+	node := &Node{Name: name, Attrs: map[string]string{}}
+	spec, supported := elements[name]
+
+	switch {
+	case !supported:
+		p.problem(offset, "unsupported element <%s>", name)
+		return node
+	case parent == nil && name != "speak":
+		p.problem(offset, "the root element must be <speak>, not <%s>", name)
+	case parent != nil && name == "speak":
+		p.problem(offset, "<speak> can't be nested")
+	case parent != nil && (elements[parent.Name].empty || elements[parent.Name].textOnly):
+		p.problem(offset, "<%s> can't contain <%s>", parent.Name, name)
+	}
+
+	for _, attr := range t.Attr {
+
+		key := attr.Name.Local
+
+		switch {
+		case attr.Name.Space == "xmlns" || attr.Name.Space == "" && key == "xmlns":
+			// Namespace declarations
+			continue
+		case attr.Name.Space == xmlNamespace:
+			key = "xml:" + key
+		case attr.Name.Space != "":
+			key = attr.Name.Space + ":" + key
+		}
+
+		validate, ok := spec.attrs[key]
+
+		if !ok {
+			p.problem(offset, "<%s> doesn't support the '%s' attribute", name, key)
+			continue
+		}
+
+		if message := validate(attr.Value); message != "" {
+			p.problem(offset, "<%s> attribute '%s' %s, got '%s'", name, key, message, attr.Value)
+		}
+
+		node.Attrs[key] = attr.Value
+	}
+
+	for _, key := range spec.required {
+
+		if _, ok := node.Attrs[key]; !ok {
+			p.problem(offset, "<%s> requires the '%s' attribute", name, key)
+		}
+	}
+
+	if name == "prosody" && len(node.Attrs) == 0 {
+		p.problem(offset, "<prosody> requires at least one of 'rate', 'pitch' or 'volume' attributes")
+	}
+
+	return node
+}
+
+// problem records the problem found at the byte offset of the document
+func (p *parser) problem(offset int64, format string, args ...interface{}) {
+
+	head := p.document[:offset]
+	line := strings.Count(head, "\n") + 1
+	column := len([]rune(head[strings.LastIndex(head, "\n")+1:])) + 1
+
+	p.problems = append(p.problems, Problem{line, column, fmt.Sprintf(format, args...)})
+}
+
+// The "xml" prefix is bound to this namespace
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// String renders the node as SSML
+func (n *Node) String() string {
+
+	var b bytes.Buffer
+	n.render(&b)
+
+	return b.String()
+}
+
+func (n *Node) render(b *bytes.Buffer) {
+
+	if n.Name == "" {
+		b.WriteString(escaper.Replace(n.Text))
+		return
+	}
+
+	b.WriteString("<" + n.Name)
+
+	keys := []string{}
+	for key := range n.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		b.WriteString(" " + key + `="` + escaper.Replace(n.Attrs[key]) + `"`)
+	}
+
+	if len(n.Children) == 0 {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteString(">")
+
+	for _, child := range n.Children {
+		child.render(b)
+	}
+
+	b.WriteString("</" + n.Name + ">")
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// Normalize returns a copy of the document with texts rewritten by the function, e.g. to write numbers as words.
+// The function gets the language of the text, as set by the xml:lang attributes, or the given default.
+// Texts read in a specific way (<say-as>, <sub>, <phoneme>) are left as they are.
+func (n *Node) Normalize(fn func(text, lang string) string, lang string) *Node {
+
+	if n.Name == "" {
+
+		return &Node{Text: fn(n.Text, lang)}
+	}
+
+	if tag, ok := n.Attrs["xml:lang"]; ok {
+		lang, _ = Language(tag)
+	}
+
+	result := &Node{Name: n.Name, Attrs: n.Attrs}
+
+	for _, child := range n.Children {
+
+		if n.readAsIs() {
+			result.Children = append(result.Children, child)
+		} else {
+			result.Children = append(result.Children, child.Normalize(fn, lang))
+		}
+	}
+
+	return result
+}
+
+// Expand returns a copy of the document with texts replaced by the nodes returned by the function,
+// e.g. to mark some words with <sub>. Texts read in a specific way (<say-as>, <sub>, <phoneme>) are left as they are.
+func (n *Node) Expand(fn func(text string) []*Node) *Node {
+
+	result := &Node{Name: n.Name, Attrs: n.Attrs}
+
+	for _, child := range n.Children {
+
+		switch {
+		case n.readAsIs():
+			result.Children = append(result.Children, child)
+		case child.Name == "":
+			result.Children = append(result.Children, fn(child.Text)...)
+		default:
+			result.Children = append(result.Children, child.Expand(fn))
+		}
+	}
+
+	return result
+}
+
+// readAsIs tells if the content of the element is read in a specific way
+func (n *Node) readAsIs() bool {
+
+	return n.Name == "say-as" || n.Name == "sub" || n.Name == "phoneme"
+}
+
+// Segment is a part of the document for speech synthesizers not supporting SSML: a plain text in a language, or a pause.
+type Segment struct {
+	Text  string
+	Lang  string
+	Pause time.Duration
+}
+
+// Segments flattens the document into plain texts and pauses.
+// Markup with no plain text equivalent (<prosody>, <emphasis>, <phoneme>) is dropped.
+// The sayAs function reads the content of <say-as> elements, e.g. spells out the characters.
+func (n *Node) Segments(lang string, sayAs func(interpretAs, format, text, lang string) string) []Segment {
+
+	segments := []Segment{}
+	n.flatten(lang, sayAs, &segments)
+
+	return segments
+}
+
+func (n *Node) flatten(lang string, sayAs func(interpretAs, format, text, lang string) string, segments *[]Segment) {
+
+	if tag, ok := n.Attrs["xml:lang"]; ok {
+		lang, _ = Language(tag)
+	}
+
+	switch n.Name {
+
+	case "":
+		appendText(segments, n.Text, lang)
+
+	case "break":
+		appendPause(segments, BreakDuration(n.Attrs))
+
+	case "sub":
+		appendText(segments, n.Attrs["alias"], lang)
+
+	case "say-as":
+		appendText(segments, sayAs(n.Attrs["interpret-as"], n.Attrs["format"], n.plainText(), lang), lang)
+
+	default:
+		for _, child := range n.Children {
+			child.flatten(lang, sayAs, segments)
+		}
+	}
+}
+
+// plainText returns the text of the node and its descendants
+func (n *Node) plainText() string {
+
+	text := n.Text
+	for _, child := range n.Children {
+		text += child.plainText()
+	}
+
+	return text
+}
+
+func appendText(segments *[]Segment, text, lang string) {
+
+	last := len(*segments) - 1
+
+	if last >= 0 && (*segments)[last].Pause == 0 && (*segments)[last].Lang == lang {
+		(*segments)[last].Text += text
+		return
+	}
+
+	if strings.TrimSpace(text) != "" {
+		*segments = append(*segments, Segment{Text: text, Lang: lang})
+	}
+}
+
+func appendPause(segments *[]Segment, pause time.Duration) {
+
+	last := len(*segments) - 1
+
+	if pause <= 0 {
+		return
+	}
+
+	if last >= 0 && (*segments)[last].Pause > 0 {
+		(*segments)[last].Pause += pause
+		return
+	}
+
+	*segments = append(*segments, Segment{Pause: pause})
+}
@@ -0,0 +1,141 @@
+package ssml
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+
+	Convey("SSML parsing", t, func() {
+
+		Convey("should parse all the supported elements", func() {
+
+			root, err := Parse(`<speak version="1.1" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US">` +
+				`<prosody rate="slow" pitch="+10%">Hello</prosody> <break time="300ms"/>` +
+				`<emphasis level="strong">dear</emphasis> <say-as interpret-as="characters">SSML</say-as> ` +
+				`<sub alias="World Wide Web">WWW</sub> <lang xml:lang="pl-PL">cześć</lang> <phoneme alphabet="ipa" ph="dʒɪf">GIF</phoneme></speak>`)
+
+			So(err, ShouldBeNil)
+			So(root.Name, ShouldEqual, "speak")
+			So(root.Attrs["xml:lang"], ShouldEqual, "en-US")
+			So(root.Children[0].Name, ShouldEqual, "prosody")
+			So(root.Children[0].Attrs["rate"], ShouldEqual, "slow")
+			So(root.Children[0].Children[0].Text, ShouldEqual, "Hello")
+		})
+
+		Convey("should report all the problems with their positions", func() {
+
+			_, err := Parse("<speak>\n  <break time=\"20s\"/>\n  <say-as>12</say-as><prosody>x</prosody>\n</speak>")
+
+			So(err, ShouldNotBeNil)
+			So(err.(InvalidError).Problems, ShouldResemble, []Problem{
+				{2, 3, "<break> attribute 'time' must not exceed 10s, got '20s'"},
+				{3, 3, "<say-as> requires the 'interpret-as' attribute"},
+				{3, 22, "<prosody> requires at least one of 'rate', 'pitch' or 'volume' attributes"},
+			})
+		})
+
+		Convey("should report malformed documents", func() {
+
+			_, err := Parse("<speak>\n<emphasis>Hi</speak>")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "Invalid SSML: line 2")
+		})
+
+		Convey("should require the <speak> root element", func() {
+
+			_, err := Parse("Hello")
+			So(err.Error(), ShouldContainSubstring, "text must be placed inside the <speak> element")
+
+			_, err = Parse("<prosody rate=\"slow\">Hello</prosody>")
+			So(err.Error(), ShouldContainSubstring, "the root element must be <speak>")
+		})
+
+		Convey("should reject misplaced content", func() {
+
+			_, err := Parse(`<speak><break>now</break><sub alias="x"><break/></sub></speak>`)
+
+			So(err.Error(), ShouldContainSubstring, "<break> must be empty")
+			So(err.Error(), ShouldContainSubstring, "<sub> can't contain <break>")
+		})
+
+		Convey("should reject unsupported attributes and languages", func() {
+
+			_, err := Parse(`<speak xml:lang="de-DE"><emphasis volume="loud">Hi</emphasis></speak>`)
+
+			So(err.Error(), ShouldContainSubstring, "attribute 'xml:lang' must be one of the supported languages")
+			So(err.Error(), ShouldContainSubstring, "<emphasis> doesn't support the 'volume' attribute")
+		})
+	})
+}
+
+func TestNode(t *testing.T) {
+
+	Convey("SSML node", t, func() {
+
+		root, _ := Parse(`<speak xml:lang="en-US">I have 2 cats &amp; <say-as interpret-as="digits">12</say-as>` +
+			`<break strength="strong"/><break time="1s"/><lang xml:lang="pl">mam 2 koty</lang>` +
+			`<sub alias="World Wide Web">WWW</sub></speak>`)
+
+		Convey("should render as SSML", func() {
+
+			So(root.String(), ShouldEqual, `<speak xml:lang="en-US">I have 2 cats &amp; <say-as interpret-as="digits">12</say-as>`+
+				`<break strength="strong"/><break time="1s"/><lang xml:lang="pl">mam 2 koty</lang>`+
+				`<sub alias="World Wide Web">WWW</sub></speak>`)
+		})
+
+		Convey("should normalize texts in their languages, except <say-as> and <sub>", func() {
+
+			normalized := root.Normalize(func(text, lang string) string { return lang + ":" + strings.ToUpper(text) }, "EN")
+
+			So(normalized.String(), ShouldEqual, `<speak xml:lang="en-US">EN:I HAVE 2 CATS &amp; <say-as interpret-as="digits">12</say-as>`+
+				`<break strength="strong"/><break time="1s"/><lang xml:lang="pl">PL:MAM 2 KOTY</lang>`+
+				`<sub alias="World Wide Web">WWW</sub></speak>`)
+		})
+
+		Convey("should expand texts into nodes, except <say-as> and <sub>", func() {
+
+			expanded := root.Expand(func(text string) []*Node {
+				return []*Node{{Name: "emphasis", Children: []*Node{{Text: text}}}}
+			})
+
+			So(expanded.String(), ShouldEqual, `<speak xml:lang="en-US"><emphasis>I have 2 cats &amp; </emphasis><say-as interpret-as="digits">12</say-as>`+
+				`<break strength="strong"/><break time="1s"/><lang xml:lang="pl"><emphasis>mam 2 koty</emphasis></lang>`+
+				`<sub alias="World Wide Web">WWW</sub></speak>`)
+		})
+
+		Convey("should read <phoneme> as its text when flattened", func() {
+
+			root, _ := Parse(`<speak>A <phoneme alphabet="ipa" ph="dʒɪf">GIF</phoneme></speak>`)
+
+			So(root.Segments("EN", nil), ShouldResemble, []Segment{{Text: "A GIF", Lang: "EN"}})
+		})
+
+		Convey("should flatten into texts and pauses", func() {
+
+			sayAs := func(interpretAs, format, text, lang string) string { return interpretAs + "(" + text + ")" }
+
+			So(root.Segments("EN", sayAs), ShouldResemble, []Segment{
+				{Text: "I have 2 cats & digits(12)", Lang: "EN"},
+				{Pause: 1750 * time.Millisecond},
+				{Text: "mam 2 koty", Lang: "PL"},
+				{Text: "World Wide Web", Lang: "EN"},
+			})
+		})
+	})
+}
+
+func TestBreakDuration(t *testing.T) {
+
+	Convey("Break duration", t, func() {
+
+		So(BreakDuration(map[string]string{"time": "1.5s"}), ShouldEqual, 1500*time.Millisecond)
+		So(BreakDuration(map[string]string{"time": "250ms"}), ShouldEqual, 250*time.Millisecond)
+		So(BreakDuration(map[string]string{"strength": "x-weak"}), ShouldEqual, 100*time.Millisecond)
+		So(BreakDuration(map[string]string{}), ShouldEqual, 500*time.Millisecond)
+	})
+}
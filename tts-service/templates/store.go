@@ -0,0 +1,149 @@
+package templates
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+)
+
+// Store keeps templates in files, one per tenant and name: <tenant>/<name>.json, see filestore
+type Store struct {
+	files *filestore.Store
+	lock  sync.Mutex // Versions are read and written along with the templates
+}
+
+// NewStore creates a store in the TEMPLATES_BASE_DIR directory.
+func NewStore() *Store {
+
+	return &Store{files: filestore.NewStore("TEMPLATES_BASE_DIR", "templates")}
+}
+
+// List returns the templates of the tenant, sorted by name.
+func (s *Store) List(tenant string) ([]Template, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, err := s.files.In(tenant).List(extension)
+
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []Template{}
+
+	for _, file := range files {
+
+		name := strings.TrimSuffix(file, extension)
+		if !ValidName(name) {
+			continue
+		}
+
+		t, err := s.read(tenant, name)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	return templates, nil
+}
+
+// Get returns the template of the tenant.
+// It returns NotFoundError if there's no such template, or another error, if any.
+func (s *Store) Get(tenant, name string) (Template, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.read(tenant, name)
+}
+
+// Put adds the template, or replaces the template of the same name with its next version.
+// It returns the stored template or an error, if any.
+func (s *Store) Put(t Template) (Template, error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t.Version = 1
+
+	previous, err := s.read(t.Tenant, t.Name)
+
+	switch err.(type) {
+	case nil:
+		t.Version = previous.Version + 1
+	case NotFoundError:
+	default:
+		return t, err
+	}
+
+	// Readers never see a partially written template
+	return t, s.files.In(t.Tenant).WriteJSON(t.Name+extension, t)
+}
+
+// Delete removes the template.
+// It returns NotFoundError if there's no such template, or another error, if any.
+func (s *Store) Delete(tenant, name string) error {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := s.files.In(tenant).Remove(name + extension)
+
+	if os.IsNotExist(err) {
+		return NotFound(name)
+	}
+
+	return err
+}
+
+// Rotate re-encrypts the templates with the active master key.
+// It returns the number of re-encrypted templates and an error, if any.
+func (s *Store) Rotate() (int, error) {
+
+	return s.files.Rotate()
+}
+
+// Migrate moves the templates stored in flat directories into the sharded layout.
+// It returns the number of moved templates and an error, if any.
+func (s *Store) Migrate() (int, error) {
+
+	return s.files.Migrate()
+}
+
+func (s *Store) read(tenant, name string) (Template, error) {
+
+	t := Template{}
+
+	err := s.files.In(tenant).ReadJSON(name+extension, &t)
+
+	if os.IsNotExist(err) {
+		return t, NotFound(name)
+	}
+
+	return t, err
+}
+
+const extension = ".json"
+
+// NotFoundError is returned when the template doesn't exist
+type NotFoundError struct {
+	Message string
+}
+
+func (err NotFoundError) Error() string {
+
+	return err.Message
+}
+
+func NotFound(name string) NotFoundError {
+
+	return NotFoundError{"Template '" + name + "' doesn't exist"}
+}
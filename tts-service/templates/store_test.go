@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+
+	Convey("Template store", t, func() {
+
+		dir, _ := ioutil.TempDir("", "templates")
+		defer os.RemoveAll(dir)
+
+		store := &Store{files: filestore.New(dir, &envelope.Keyring{})}
+		hello := Template{Tenant: "acme", Name: "hello", Language: "EN", Text: "Hello {name}", Placeholders: map[string]string{"name": TypeText}}
+
+		Convey("should return no templates of a new tenant", func() {
+
+			templates, err := store.List("acme")
+
+			So(err, ShouldBeNil)
+			So(templates, ShouldResemble, []Template{})
+		})
+
+		Convey("should put and get templates, increasing their versions", func() {
+
+			stored, err := store.Put(hello)
+
+			So(err, ShouldBeNil)
+			So(stored.Version, ShouldEqual, 1)
+
+			hello.Text = "Hi {name}"
+			stored, _ = store.Put(hello)
+			So(stored.Version, ShouldEqual, 2)
+
+			got, err := store.Get("acme", "hello")
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, stored)
+		})
+
+		Convey("should keep templates of tenants apart", func() {
+
+			store.Put(hello)
+			other := hello
+			other.Tenant = "other"
+			other.Name = "bye"
+			store.Put(other)
+
+			templates, _ := store.List("acme")
+			So(templates, ShouldHaveLength, 1)
+			So(templates[0].Name, ShouldEqual, "hello")
+
+			_, err := store.Get("other", "hello")
+			So(err, ShouldResemble, NotFound("hello"))
+		})
+
+		Convey("should delete templates", func() {
+
+			store.Put(hello)
+
+			So(store.Delete("acme", "hello"), ShouldBeNil)
+			So(store.Delete("acme", "hello"), ShouldResemble, NotFound("hello"))
+		})
+	})
+}
@@ -0,0 +1,224 @@
+package templates
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/normalize"
+)
+
+// Template is a text of a tenant with placeholders, e.g. "Your order {number} ships {date}",
+// rendered into voice messages with the values of its variables.
+// Its version is increased on every change.
+type Template struct {
+	Tenant       string
+	Name         string
+	Language     string
+	Text         string
+	Placeholders map[string]string // Types of the placeholders by name, e.g. "number": "digits"
+	Version      int
+}
+
+// Types of placeholders, telling what values they take and how they are read.
+// Values of the text type are read as they are, the others as SSML <say-as> of the same name reads them.
+const (
+	TypeText       = "text"
+	TypeNumber     = "number"
+	TypeOrdinal    = "ordinal"
+	TypeDigits     = "digits"
+	TypeCharacters = "characters"
+	TypeTelephone  = "telephone"
+	TypeDate       = "date" // 2006-01-02
+	TypeTime       = "time" // 15:04
+)
+
+// Valid values of each type
+var typePatterns = map[string]*regexp.Regexp{
+	TypeText:       regexp.MustCompile(`\S`),
+	TypeNumber:     regexp.MustCompile(`^-?\d{1,15}(\.\d{1,6})?$`),
+	TypeOrdinal:    regexp.MustCompile(`^\d{1,9}$`),
+	TypeDigits:     regexp.MustCompile(`^\d{1,32}$`),
+	TypeCharacters: regexp.MustCompile(`^[\p{L}\p{N}]{1,32}$`),
+	TypeTelephone:  regexp.MustCompile(`^\+?[\d ()-]{3,24}$`),
+	TypeDate:       regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`),
+	TypeTime:       regexp.MustCompile(`^\d{1,2}:\d{2}$`),
+}
+
+// Placeholders are names in braces, e.g. "{number}"
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]{0,63})\}`)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidName tells if the template name is safe to be used as a file name.
+func ValidName(name string) bool {
+
+	return namePattern.MatchString(name)
+}
+
+// Types returns the types of placeholders, sorted.
+func Types() []string {
+
+	types := []string{}
+	for t := range typePatterns {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+// Validate returns problems of the template, if any.
+// Each placeholder of the text must be declared, and each declared one must be used.
+func (t Template) Validate() []string {
+
+	problems := []string{}
+
+	if strings.TrimSpace(t.Text) == "" {
+		problems = append(problems, "Text must not be empty")
+	}
+
+	if len(t.Text) > maxTextSize {
+		problems = append(problems, "Text must not be longer than "+strconv.Itoa(maxTextSize)+" bytes")
+	}
+
+	// Braces that aren't a part of placeholders would be read aloud
+	if strings.ContainsAny(placeholderPattern.ReplaceAllString(t.Text, ""), "{}") {
+		problems = append(problems, "Text must have braces around placeholder names only, e.g. {number}")
+	}
+
+	used := map[string]bool{}
+
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Text, -1) {
+
+		if _, ok := t.Placeholders[m[1]]; !ok && !used[m[1]] {
+			problems = append(problems, "Placeholder {"+m[1]+"} must be declared")
+		}
+
+		used[m[1]] = true
+	}
+
+	for _, name := range t.names() {
+
+		if !used[name] {
+			problems = append(problems, "Placeholder "+name+" isn't used in the Text")
+		}
+
+		if _, ok := typePatterns[t.Placeholders[name]]; !ok {
+			problems = append(problems, "Placeholder "+name+" has unsupported type: "+t.Placeholders[name]+". Types: "+strings.Join(Types(), ", "))
+		}
+	}
+
+	return problems
+}
+
+const maxTextSize = 5000
+
+// Render replaces the placeholders of the text with the values of the variables.
+// It returns the rendered text and its fragments: the static parts of the text, the same in every rendering,
+// and the values in between, rewritten the way they are read in the language of the template.
+// Problems of the variables are returned instead, if any.
+func (t Template) Render(variables map[string]string) (string, []string, []string) {
+
+	problems := []string{}
+
+	for _, name := range t.names() {
+
+		value, ok := variables[name]
+
+		switch {
+		case !ok:
+			problems = append(problems, "Variable "+name+" is missing")
+		case !validValue(t.Placeholders[name], value):
+			problems = append(problems, "Variable "+name+" must be a valid "+t.Placeholders[name]+": "+value)
+		}
+	}
+
+	unknown := []string{}
+	for name := range variables {
+		if _, ok := t.Placeholders[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, "Variable "+name+" isn't a placeholder of the template")
+	}
+
+	if len(problems) > 0 {
+		return "", nil, problems
+	}
+
+	var text strings.Builder
+	fragments := []string{}
+	position := 0
+
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(t.Text, -1) {
+
+		static := t.Text[position:loc[0]]
+		name := t.Text[loc[2]:loc[3]]
+		value := strings.TrimSpace(variables[name])
+
+		text.WriteString(static + value)
+		fragments = append(fragments, static, t.read(t.Placeholders[name], value))
+		position = loc[1]
+	}
+
+	text.WriteString(t.Text[position:])
+	fragments = append(fragments, t.Text[position:])
+
+	return text.String(), fragments, nil
+}
+
+// read rewrites the value of the type the way it's read
+func (t Template) read(typ, value string) string {
+
+	switch typ {
+	case TypeText, TypeTime:
+		return value
+	case TypeDate:
+		return normalize.SayAs(typ, "ymd", value, t.Language)
+	default:
+		return normalize.SayAs(typ, "", value, t.Language)
+	}
+}
+
+// names returns the names of the placeholders, sorted
+func (t Template) names() []string {
+
+	names := []string{}
+	for name := range t.Placeholders {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func validValue(typ, value string) bool {
+
+	value = strings.TrimSpace(value)
+
+	if !typePatterns[typ].MatchString(value) || utf8.RuneCountInString(value) > maxValueSize || strings.ContainsAny(value, "{}") {
+		return false
+	}
+
+	switch typ {
+	case TypeDate:
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case TypeTime:
+		_, err := time.Parse("15:04", value)
+		return err == nil
+	}
+
+	return true
+}
+
+const maxValueSize = 200
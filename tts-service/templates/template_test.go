@@ -0,0 +1,75 @@
+package templates
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+
+	Convey("Template", t, func() {
+
+		order := Template{
+			Language:     "EN",
+			Text:         "Your order {number} ships {date}. Call {phone}.",
+			Placeholders: map[string]string{"number": TypeDigits, "date": TypeDate, "phone": TypeTelephone},
+		}
+
+		Convey("should accept declared placeholders", func() {
+
+			So(order.Validate(), ShouldBeEmpty)
+		})
+
+		Convey("should reject undeclared, unused and mistyped placeholders", func() {
+
+			t := Template{Text: "Hi {name}, {name} {x", Placeholders: map[string]string{"name": "person", "total": TypeNumber}}
+
+			So(t.Validate(), ShouldResemble, []string{
+				"Text must have braces around placeholder names only, e.g. {number}",
+				"Placeholder name has unsupported type: person. Types: characters, date, digits, number, ordinal, telephone, text, time",
+				"Placeholder total isn't used in the Text",
+			})
+
+			So(Template{Text: "Hi {name}"}.Validate(), ShouldResemble, []string{"Placeholder {name} must be declared"})
+		})
+
+		Convey("should render the variables, read the way their types tell", func() {
+
+			text, fragments, problems := order.Render(map[string]string{"number": "042", "date": "2017-05-12", "phone": "+48 123"})
+
+			So(problems, ShouldBeNil)
+			So(text, ShouldEqual, "Your order 042 ships 2017-05-12. Call +48 123.")
+			So(fragments, ShouldResemble, []string{
+				"Your order ", "zero four two", " ships ", "May twelfth, twenty seventeen", ". Call ", "plus four eight, one two three", ".",
+			})
+		})
+
+		Convey("should keep the static fragments of different renderings the same", func() {
+
+			_, first, _ := order.Render(map[string]string{"number": "1", "date": "2017-05-12", "phone": "123"})
+			_, second, _ := order.Render(map[string]string{"number": "2", "date": "2018-01-01", "phone": "456"})
+
+			So(first[0], ShouldEqual, second[0])
+			So(first[2], ShouldEqual, second[2])
+			So(first[1], ShouldNotEqual, second[1])
+		})
+
+		Convey("should reject missing, invalid and unknown variables", func() {
+
+			_, _, problems := order.Render(map[string]string{"number": "12a", "date": "2017-02-30", "other": "x"})
+
+			So(problems, ShouldResemble, []string{
+				"Variable date must be a valid date: 2017-02-30",
+				"Variable number must be a valid digits: 12a",
+				"Variable phone is missing",
+				"Variable other isn't a placeholder of the template",
+			})
+		})
+	})
+
+	Convey("Name validation", t, func() {
+
+		So(ValidName("order_shipped"), ShouldBeTrue)
+		So(ValidName("../secret"), ShouldBeFalse)
+	})
+}
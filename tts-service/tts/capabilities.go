@@ -0,0 +1,91 @@
+package tts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capabilities describe the voices, formats and prosody options supported by a converter.
+type Capabilities struct {
+	Voices  map[string][]string // Voices of each language, e.g. "EN". The first one is the default.
+	Formats []string            // Output formats. The first one is the default.
+	Rate    *Range              // Speaking rate, nil if it can't be changed
+	Pitch   *Range              // Pitch change in percent, nil if it can't be changed
+	Volume  *Range              // Volume change in dB, nil if it can't be changed
+}
+
+// Languages returns the supported languages, e.g. "EN", in alphabetical order.
+func (c Capabilities) Languages() []string {
+
+	languages := []string{}
+
+	for lang := range c.Voices {
+		languages = append(languages, lang)
+	}
+
+	sort.Strings(languages)
+
+	return languages
+}
+
+// Supports tells if texts in the language can be converted.
+func (c Capabilities) Supports(lang string) bool {
+
+	_, ok := c.Voices[lang]
+	return ok
+}
+
+// Range of supported values, inclusive
+type Range struct {
+	Min int
+	Max int
+}
+
+// Validate checks the options requested for a text in the given language.
+// It returns the problems found, if any.
+func (c Capabilities) Validate(lang string, options Options) []string {
+
+	problems := []string{}
+
+	if options.Voice != "" && !contains(c.Voices[lang], options.Voice) {
+		problems = append(problems, fmt.Sprintf("Unsupported Voice: %s. Voices of %s: %s",
+			options.Voice, lang, strings.Join(c.Voices[lang], ", ")))
+	}
+
+	problems = append(problems, validateRange("Rate", options.Rate, c.Rate)...)
+	problems = append(problems, validateRange("Pitch", options.Pitch, c.Pitch)...)
+	problems = append(problems, validateRange("Volume", options.Volume, c.Volume)...)
+
+	if options.Format != "" && !contains(c.Formats, options.Format) {
+		problems = append(problems, fmt.Sprintf("Unsupported Format: %s. Formats: %s",
+			options.Format, strings.Join(c.Formats, ", ")))
+	}
+
+	return problems
+}
+
+func validateRange(name string, value *int, supported *Range) []string {
+
+	switch {
+	case value == nil:
+		return nil
+	case supported == nil:
+		return []string{name + " can't be changed"}
+	case *value < supported.Min || *value > supported.Max:
+		return []string{fmt.Sprintf("%s must be between %d and %d", name, supported.Min, supported.Max)}
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+
+	Convey("Capabilities", t, func() {
+
+		capabilities := Capabilities{
+			Voices:  map[string][]string{"EN": {"Amy"}},
+			Formats: []string{"mp3"},
+			Volume:  &Range{-6, 6},
+		}
+
+		Convey("should list the supported languages", func() {
+
+			capabilities.Voices["DE"] = []string{}
+
+			So(capabilities.Languages(), ShouldResemble, []string{"DE", "EN"})
+			So(capabilities.Supports("DE"), ShouldBeTrue)
+			So(capabilities.Supports("PL"), ShouldBeFalse)
+		})
+
+		Convey("should accept default options", func() {
+
+			So(capabilities.Validate("EN", Options{}), ShouldBeEmpty)
+		})
+
+		Convey("should accept supported options", func() {
+
+			volume := 6
+			So(capabilities.Validate("EN", Options{Voice: "Amy", Volume: &volume, Format: "mp3"}), ShouldBeEmpty)
+		})
+
+		Convey("should report all the unsupported options", func() {
+
+			rate, volume := 1, -7
+
+			So(capabilities.Validate("PL", Options{Voice: "Amy", Rate: &rate, Volume: &volume, Format: "wav"}), ShouldResemble, []string{
+				"Unsupported Voice: Amy. Voices of PL: ",
+				"Rate can't be changed",
+				"Volume must be between -6 and 6",
+				"Unsupported Format: wav. Formats: mp3",
+			})
+		})
+	})
+
+	Convey("Options", t, func() {
+
+		Convey("should have a canonical form", func() {
+
+			rate, pitch := 0, -2
+
+			So(Options{}.String(), ShouldEqual, "")
+			So(Options{Format: "wav", Pitch: &pitch, Voice: "Amy", Rate: &rate}.String(), ShouldEqual, "voice=Amy;rate=0;pitch=-2;format=wav")
+		})
+	})
+}
@@ -0,0 +1,494 @@
+package tts
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// CELT frames of Opus renditions (RFC 6716, 4.3).
+// They are 20 ms long blocks, without the pitch pre-filter, coded at a constant bitrate.
+// Only what shapes the bitstream is ported from the reference encoder, its analysis (transients,
+// time-frequency resolution, dynamic allocation) is left out for these defaults.
+
+const (
+	celtBands     = 21
+	celtFrameSize = 960 // 20 ms at 48 kHz
+	celtOverlap   = 120 // of the MDCT windows
+	celtLM        = 3   // log2 of the frame size in short (2.5 ms) blocks
+
+	celtPreemphasis = 0.8500061035
+	celtMaxFineBits = 8
+	celtFineOffset  = 21
+)
+
+// Spreading of the pulses (RFC 6716, 4.3.4.3)
+const (
+	celtSpreadNone = iota
+	celtSpreadLight
+	celtSpreadNormal
+	celtSpreadAggressive
+)
+
+// celtEncoder encodes the frames of a mono stream, keeping what they are predicted from.
+type celtEncoder struct {
+	bands          int // coded bands, which depend on the bandwidth
+	frameBytes     int
+	inMem          [celtOverlap]float64 // pre-emphasized end of the previous frame
+	preemphMem     float64
+	overlapMax     float64
+	oldE           [celtBands]float64 // quantized band energies of the previous frame
+	intra          bool
+	spread         int
+	tonalAverage   int
+	lastCodedBands int
+}
+
+func newCeltEncoder(bands, frameBytes int) *celtEncoder {
+
+	return &celtEncoder{
+		bands:        bands,
+		frameBytes:   frameBytes,
+		intra:        true,
+		spread:       celtSpreadNormal,
+		tonalAverage: 256,
+	}
+}
+
+// encode encodes a frame of celtFrameSize samples in the 16 bit range.
+func (st *celtEncoder) encode(pcm []float64) []byte {
+
+	e := newRangeEncoder(st.frameBytes)
+	totalBits := st.frameBytes * 8
+	end := st.bands
+
+	// Silence is a flag, the rest of the frame is then skipped
+	sampleMax := math.Max(st.overlapMax, maxAbs(pcm[:celtFrameSize-celtOverlap]))
+	st.overlapMax = maxAbs(pcm[celtFrameSize-celtOverlap:])
+	silence := math.Max(sampleMax, st.overlapMax) == 0
+
+	e.bitLogp(silence, 15)
+	tell := 1
+	if silence {
+		tell = totalBits
+		e.nbits += tell - e.tell()
+	}
+
+	in := make([]float64, celtOverlap+celtFrameSize)
+	copy(in, st.inMem[:])
+	for i, x := range pcm {
+		in[celtOverlap+i] = x - st.preemphMem
+		st.preemphMem = celtPreemphasis * x
+	}
+	copy(st.inMem[:], in[celtFrameSize:])
+
+	// No pitch pre-filter and no transient
+	if tell+16 <= totalBits {
+		e.bitLogp(false, 1)
+	}
+	if e.tell()+3 <= totalBits {
+		e.bitLogp(false, 3)
+	}
+
+	freq := mdct(in)
+
+	var bandE, bandLogE [celtBands]float64
+	x := make([]float64, celtFrameSize)
+
+	for i := 0; i < end; i++ {
+
+		band := freq[celtBandEdges[i]<<celtLM : celtBandEdges[i+1]<<celtLM]
+
+		sum := 1e-27
+		for _, f := range band {
+			sum += f * f
+		}
+		bandE[i] = math.Sqrt(sum)
+		bandLogE[i] = math.Log2(bandE[i]) - celtEnergyMeans[i]
+
+		for j, f := range band {
+			x[celtBandEdges[i]<<celtLM+j] = f / (1e-27 + bandE[i])
+		}
+	}
+
+	energyError := st.encodeCoarseEnergy(e, bandLogE[:end], totalBits)
+
+	// Time-frequency resolution is kept in all the bands, a bit is reserved for the unused tf_select
+	tfBudget := totalBits
+	logp := uint(4)
+	if e.tell()+int(logp)+1 <= tfBudget {
+		tfBudget--
+	}
+	for i := 0; i < end; i++ {
+		if e.tell()+int(logp) <= tfBudget {
+			e.bitLogp(false, logp)
+		}
+		logp = 5
+	}
+
+	if e.tell()+4 <= totalBits {
+		st.spread = st.spreadingDecision(x, end)
+		e.icdf(st.spread, celtSpreadIcdf, 5)
+	}
+
+	caps := make([]int, end)
+	for i := range caps {
+		width := (celtBandEdges[i+1] - celtBandEdges[i]) << celtLM
+		caps[i] = (int(celtCacheCaps[celtBands*2*celtLM+i]) + 64) * width >> 2
+	}
+
+	// No band is boosted
+	totalFrac := totalBits << 3
+	tell = e.tellFrac()
+	for i := 0; i < end; i++ {
+		if tell+6<<3 < totalFrac && caps[i] > 0 {
+			e.bitLogp(false, 6)
+			tell = e.tellFrac()
+		}
+	}
+
+	trim := 5
+	if tell+6<<3 <= totalFrac {
+		trim = allocationTrim(bandLogE[:end])
+		e.icdf(trim, celtTrimIcdf, 7)
+	}
+
+	alloc := computeAllocation(e, end, caps, trim, totalFrac-e.tellFrac()-1, st.lastCodedBands)
+
+	if st.lastCodedBands > 0 {
+		st.lastCodedBands = minInt(st.lastCodedBands+1, maxInt(st.lastCodedBands-1, alloc.codedBands))
+	} else {
+		st.lastCodedBands = alloc.codedBands
+	}
+
+	for i := 0; i < end; i++ {
+
+		fine := alloc.fineBits[i]
+		if fine <= 0 {
+			continue
+		}
+
+		frac := 1 << uint(fine)
+		q := maxInt(0, minInt(frac-1, int(math.Floor((energyError[i]+.5)*float64(frac)))))
+		e.bits(uint32(q), fine)
+
+		offset := (float64(q)+.5)/float64(frac) - .5
+		st.oldE[i] += offset
+		energyError[i] -= offset
+	}
+
+	quantizeBands(e, x, end, alloc, st.spread, totalFrac)
+
+	// The bits left refine the energies further
+	bitsLeft := totalBits - e.tell()
+	for priority := 0; priority < 2; priority++ {
+		for i := 0; i < end && bitsLeft >= 1; i++ {
+
+			if alloc.fineBits[i] >= celtMaxFineBits || alloc.finePriority[i] != priority {
+				continue
+			}
+
+			q := 1
+			if energyError[i] < 0 {
+				q = 0
+			}
+			e.bits(uint32(q), 1)
+
+			st.oldE[i] += (float64(q) - .5) / float64(int(2)<<uint(alloc.fineBits[i]))
+			bitsLeft--
+		}
+	}
+
+	if silence {
+		for i := range st.oldE {
+			st.oldE[i] = -28
+		}
+	}
+
+	st.intra = false
+
+	return e.done()
+}
+
+// encodeCoarseEnergy encodes the band energies in steps of 6 dB, predicted from the previous frame
+// unless it's an intra frame, and from the previous band (RFC 6716, 4.3.2.1).
+// The errors left for the fine energies are returned.
+func (st *celtEncoder) encodeCoarseEnergy(e *rangeEncoder, bandLogE []float64, budget int) []float64 {
+
+	end := len(bandLogE)
+	energyError := make([]float64, end)
+
+	intra := st.intra
+	if e.tell()+3 > budget {
+		intra = false
+	} else {
+		e.bitLogp(intra, 3)
+	}
+
+	coef, beta, model := celtPredictionCoef, celtBetaCoef, celtEnergyModels[0]
+	if intra {
+		coef, beta, model = 0, celtBetaIntra, celtEnergyModels[1]
+	}
+
+	maxDecay := 16.0
+	if end > 10 {
+		maxDecay = math.Min(maxDecay, .125*float64(st.frameBytes))
+	}
+
+	prev := 0.0
+
+	for i, x := range bandLogE {
+
+		oldE := math.Max(-9, st.oldE[i])
+		f := x - coef*oldE - prev
+		qi := int(math.Floor(.5 + f))
+
+		// Energies can't go down too quickly
+		decayBound := math.Max(-28, st.oldE[i]) - maxDecay
+		if qi < 0 && x < decayBound {
+			qi = minInt(0, qi+int(decayBound-x))
+		}
+
+		tell := e.tell()
+		bitsLeft := budget - tell - 3*(end-i)
+		if i != 0 && bitsLeft < 30 {
+			if bitsLeft < 24 {
+				qi = minInt(1, qi)
+			}
+			if bitsLeft < 16 {
+				qi = maxInt(-1, qi)
+			}
+		}
+
+		switch {
+		case budget-tell >= 15:
+			p := 2 * minInt(i, 20)
+			qi = e.laplace(qi, uint32(model[p])<<7, int(model[p+1])<<6)
+		case budget-tell >= 2:
+			qi = maxInt(-1, minInt(qi, 1))
+			symbol := 2 * qi
+			if qi < 0 {
+				symbol = -symbol - 1
+			}
+			e.icdf(symbol, celtSmallEnergyIcdf, 2)
+		case budget-tell >= 1:
+			qi = minInt(0, qi)
+			e.bitLogp(qi != 0, 1)
+		default:
+			qi = -1
+		}
+
+		q := float64(qi)
+		energyError[i] = f - q
+		st.oldE[i] = coef*oldE + prev + q
+		prev += q - beta*q
+	}
+
+	return energyError
+}
+
+// spreadingDecision chooses how much the pulses are spread based on how peaky the bands are.
+func (st *celtEncoder) spreadingDecision(x []float64, end int) int {
+
+	if (celtBandEdges[end]-celtBandEdges[end-1])<<celtLM <= 8 {
+		return celtSpreadNone
+	}
+
+	sum, bands := 0, 0
+
+	for i := 0; i < end; i++ {
+
+		band := x[celtBandEdges[i]<<celtLM : celtBandEdges[i+1]<<celtLM]
+		n := len(band)
+		if n <= 8 {
+			continue
+		}
+
+		var counts [3]int
+		for _, v := range band {
+			v2n := v * v * float64(n)
+			for j, limit := range []float64{.25, .0625, .015625} {
+				if v2n < limit {
+					counts[j]++
+				}
+			}
+		}
+
+		for _, count := range counts {
+			if 2*count >= n {
+				sum += 256
+			}
+		}
+		bands++
+	}
+
+	sum = (sum/bands + st.tonalAverage) >> 1
+	st.tonalAverage = sum
+
+	// Hysteresis
+	sum = (3*sum + (3-st.spread)<<7 + 64 + 2) >> 2
+
+	switch {
+	case sum < 80:
+		return celtSpreadAggressive
+	case sum < 256:
+		return celtSpreadNormal
+	case sum < 384:
+		return celtSpreadLight
+	default:
+		return celtSpreadNone
+	}
+}
+
+// allocationTrim tilts the allocation towards the low or the high bands, following the spectral tilt.
+func allocationTrim(bandLogE []float64) int {
+
+	end := len(bandLogE)
+
+	diff := 0.0
+	for i := 0; i < end-1; i++ {
+		diff += bandLogE[i] * float64(2+2*i-end)
+	}
+	diff /= float64(end - 1)
+
+	trim := 5 - math.Max(-2, math.Min(2, (diff+1)/6))
+
+	return maxInt(0, minInt(10, int(math.Floor(.5+trim))))
+}
+
+// The MDCT window: the overlaps are power complementary
+var celtWindow = func() []float64 {
+
+	window := make([]float64, celtOverlap)
+	for i := range window {
+		s := math.Sin(.5 * math.Pi * (float64(i) + .5) / celtOverlap)
+		window[i] = math.Sin(.5 * math.Pi * s * s)
+	}
+
+	return window
+}()
+
+var mdctTwiddles = func() []float64 {
+
+	twiddles := make([]float64, celtFrameSize)
+	for i := range twiddles {
+		twiddles[i] = math.Cos(2 * math.Pi * (float64(i) + .125) / (2 * celtFrameSize))
+	}
+
+	return twiddles
+}()
+
+var fftTwiddles = func() []complex128 {
+
+	twiddles := make([]complex128, celtFrameSize/2)
+	for i := range twiddles {
+		twiddles[i] = cmplx.Exp(complex(0, -2*math.Pi*float64(i)/float64(len(twiddles))))
+	}
+
+	return twiddles
+}()
+
+// mdct transforms the frame and the overlap preceding it into celtFrameSize coefficients,
+// through a complex FFT of a quarter of the size, like the reference implementation.
+func mdct(in []float64) []float64 {
+
+	const n2, n4 = celtFrameSize, celtFrameSize / 2
+
+	window := celtWindow
+	trig := mdctTwiddles
+
+	// Window, shuffle, fold
+	f := make([]float64, n2)
+	xp1, xp2 := celtOverlap/2, n2-1+celtOverlap/2
+	wp1, wp2 := celtOverlap/2, celtOverlap/2-1
+	yp := 0
+
+	i := 0
+	for ; i < (celtOverlap+3)>>2; i++ {
+		f[yp] = window[wp2]*in[xp1+n2] + window[wp1]*in[xp2]
+		f[yp+1] = window[wp1]*in[xp1] - window[wp2]*in[xp2-n2]
+		yp, xp1, xp2, wp1, wp2 = yp+2, xp1+2, xp2-2, wp1+2, wp2-2
+	}
+
+	wp1, wp2 = 0, celtOverlap-1
+	for ; i < n4-(celtOverlap+3)>>2; i++ {
+		f[yp] = in[xp2]
+		f[yp+1] = in[xp1]
+		yp, xp1, xp2 = yp+2, xp1+2, xp2-2
+	}
+
+	for ; i < n4; i++ {
+		f[yp] = -window[wp1]*in[xp1-n2] + window[wp2]*in[xp2]
+		f[yp+1] = window[wp2]*in[xp1] + window[wp1]*in[xp2+n2]
+		yp, xp1, xp2, wp1, wp2 = yp+2, xp1+2, xp2-2, wp1+2, wp2-2
+	}
+
+	// Pre-rotation
+	z := make([]complex128, n4)
+	for i := range z {
+		re, im := f[2*i], f[2*i+1]
+		t0, t1 := trig[i], trig[n4+i]
+		z[i] = complex((re*t0-im*t1)/n4, (im*t0+re*t1)/n4)
+	}
+
+	spectrum := make([]complex128, n4)
+	fft(spectrum, z, n4, 1)
+
+	// Post-rotation
+	out := make([]float64, n2)
+	for i, c := range spectrum {
+		t0, t1 := trig[i], trig[n4+i]
+		out[2*i] = imag(c)*t1 - real(c)*t0
+		out[n2-1-2*i] = real(c)*t1 + imag(c)*t0
+	}
+
+	return out
+}
+
+// fft is a recursive mixed radix FFT of the n samples of in taken with the stride,
+// n is a product of 2, 3 and 5 which divides the length of fftTwiddles.
+func fft(out, in []complex128, n, stride int) {
+
+	if n == 1 {
+		out[0] = in[0]
+		return
+	}
+
+	p := 2
+	for n%p != 0 {
+		p++
+	}
+	m := n / p
+
+	for r := 0; r < p; r++ {
+		fft(out[r*m:], in[r*stride:], m, stride*p)
+	}
+
+	step := len(fftTwiddles) / n
+
+	var t [5]complex128
+
+	for k := 0; k < m; k++ {
+
+		for r := 0; r < p; r++ {
+			t[r] = out[r*m+k] * fftTwiddles[r*k*step]
+		}
+
+		for q := 0; q < p; q++ {
+			var sum complex128
+			for r := 0; r < p; r++ {
+				sum += t[r] * fftTwiddles[r*q*m%n*step]
+			}
+			out[q*m+k] = sum
+		}
+	}
+}
+
+func maxAbs(samples []float64) float64 {
+
+	max := 0.0
+	for _, s := range samples {
+		max = math.Max(max, math.Abs(s))
+	}
+
+	return max
+}
@@ -0,0 +1,661 @@
+package tts
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Bit allocation and quantization of the shapes of the bands of CELT frames (RFC 6716, 4.3.3 and 4.3.4),
+// in 1/8 bits. Mono streams only, the stereo parameters are left out.
+
+// celtAllocation is the split of the bits of a frame between the bands.
+type celtAllocation struct {
+	codedBands   int
+	balance      int   // bits over the caps, left for the bands
+	pulses       []int // bits of the shapes
+	fineBits     []int // bits of the fine energies
+	finePriority []int // which bands get the bits left at the end first
+}
+
+// computeAllocation computes the allocation of the total bits to the bands and encodes the skipped bands.
+// prev is the number of bands coded in the previous frame.
+func computeAllocation(e *rangeEncoder, end int, caps []int, trim, total, prev int) celtAllocation {
+
+	const allocSteps = 6
+	const allocFloor = 1 << 3
+	const allocVectors = 11
+
+	total = maxInt(total, 0)
+	skipRsv := 0
+	if total >= 1<<3 {
+		skipRsv = 1 << 3
+	}
+	total -= skipRsv
+
+	width := func(j int) int {
+		return celtBandEdges[j+1] - celtBandEdges[j]
+	}
+
+	thresh := make([]int, end)
+	trimOffset := make([]int, end)
+	for j := 0; j < end; j++ {
+		thresh[j] = maxInt(1<<3, 3*width(j)<<celtLM<<3>>4)
+		trimOffset[j] = width(j) * (trim - 5 - celtLM) * (end - j - 1) * (1 << (celtLM + 3)) >> 6
+	}
+
+	vector := func(level, j int) int {
+		return width(j) * int(celtBandAllocation[level*celtBands+j]) << celtLM >> 2
+	}
+
+	// The highest quality level which fits
+	lo, hi := 1, allocVectors-1
+	for lo <= hi {
+
+		mid := (lo + hi) >> 1
+		psum := 0
+		done := false
+
+		for j := end - 1; j >= 0; j-- {
+
+			b := vector(mid, j)
+			if b > 0 {
+				b = maxInt(0, b+trimOffset[j])
+			}
+
+			if b >= thresh[j] || done {
+				done = true
+				psum += minInt(b, caps[j])
+			} else if b >= allocFloor {
+				psum += allocFloor
+			}
+		}
+
+		if psum > total {
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+	hi = lo
+	lo--
+
+	bits1 := make([]int, end)
+	bits2 := make([]int, end)
+	for j := 0; j < end; j++ {
+
+		b1 := vector(lo, j)
+		b2 := caps[j]
+		if hi < allocVectors {
+			b2 = vector(hi, j)
+		}
+		if b1 > 0 {
+			b1 = maxInt(0, b1+trimOffset[j])
+		}
+		if b2 > 0 {
+			b2 = maxInt(0, b2+trimOffset[j])
+		}
+		bits1[j] = b1
+		bits2[j] = maxInt(0, b2-b1)
+	}
+
+	// Interpolation between the two levels
+	lo, hi = 0, 1<<allocSteps
+	for i := 0; i < allocSteps; i++ {
+
+		mid := (lo + hi) >> 1
+		psum := 0
+		done := false
+
+		for j := end - 1; j >= 0; j-- {
+
+			b := bits1[j] + mid*bits2[j]>>allocSteps
+			if b >= thresh[j] || done {
+				done = true
+				psum += minInt(b, caps[j])
+			} else if b >= allocFloor {
+				psum += allocFloor
+			}
+		}
+
+		if psum > total {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	alloc := celtAllocation{
+		pulses:       make([]int, end),
+		fineBits:     make([]int, end),
+		finePriority: make([]int, end),
+	}
+	bandBits := alloc.pulses
+
+	psum := 0
+	done := false
+	for j := end - 1; j >= 0; j-- {
+
+		b := bits1[j] + lo*bits2[j]>>allocSteps
+		if b < thresh[j] && !done {
+			if b >= allocFloor {
+				b = allocFloor
+			} else {
+				b = 0
+			}
+		} else {
+			done = true
+		}
+
+		bandBits[j] = minInt(b, caps[j])
+		psum += bandBits[j]
+	}
+
+	// Skipping the bands at the top, their bits go to the bands below
+	codedBands := end
+	for ; ; codedBands-- {
+
+		j := codedBands - 1
+		if j <= 0 {
+			total += skipRsv
+			break
+		}
+
+		left := total - psum
+		perCoeff := left / celtBandEdges[codedBands]
+		left -= celtBandEdges[codedBands] * perCoeff
+		rem := maxInt(left-celtBandEdges[j], 0)
+		bandWidth := celtBandEdges[codedBands] - celtBandEdges[j]
+		b := bandBits[j] + perCoeff*bandWidth + rem
+
+		if b >= maxInt(thresh[j], allocFloor+1<<3) {
+
+			// Hysteresis keeps the bands from fluctuating in and out
+			factor := 9
+			if j < prev {
+				factor = 7
+			}
+			if codedBands <= 2 || b > factor*bandWidth<<celtLM<<3>>4 {
+				e.bitLogp(true, 1)
+				break
+			}
+			e.bitLogp(false, 1)
+
+			psum += 1 << 3
+			b -= 1 << 3
+		}
+
+		psum -= bandBits[j]
+		if b >= allocFloor {
+			psum += allocFloor
+			bandBits[j] = allocFloor
+		} else {
+			bandBits[j] = 0
+		}
+	}
+
+	left := total - psum
+	perCoeff := left / celtBandEdges[codedBands]
+	left -= celtBandEdges[codedBands] * perCoeff
+	for j := 0; j < codedBands; j++ {
+		bandBits[j] += perCoeff * width(j)
+	}
+	for j := 0; j < codedBands; j++ {
+		tmp := minInt(left, width(j))
+		bandBits[j] += tmp
+		left -= tmp
+	}
+
+	// The fine energies take their share
+	balance := 0
+	for j := 0; j < codedBands; j++ {
+
+		n := width(j) << celtLM
+		b := bandBits[j] + balance
+
+		excess := maxInt(b-caps[j], 0)
+		bandBits[j] = b - excess
+
+		// Offset from the fair share of the bits by log2(n)/2 + celtFineOffset
+		logN := n * (celtLogN[j] + celtLM<<3)
+		offset := logN>>1 - n*celtFineOffset
+		if n == 2 {
+			offset += n << 3 >> 2
+		}
+		if bandBits[j]+offset < n*2<<3 {
+			offset += logN >> 2
+		} else if bandBits[j]+offset < n*3<<3 {
+			offset += logN >> 3
+		}
+
+		fine := maxInt(0, bandBits[j]+offset+n<<2) / n >> 3
+		if fine > bandBits[j]>>3 {
+			fine = bandBits[j] >> 3
+		}
+		fine = minInt(fine, celtMaxFineBits)
+
+		alloc.finePriority[j] = boolToInt(fine*n<<3 >= bandBits[j]+offset)
+		bandBits[j] -= fine << 3
+
+		if excess > 0 {
+			extra := minInt(excess>>3, celtMaxFineBits-fine)
+			fine += extra
+			alloc.finePriority[j] = boolToInt(extra<<3 >= excess-balance)
+			excess -= extra << 3
+		}
+
+		alloc.fineBits[j] = fine
+		balance = excess
+	}
+
+	for j := codedBands; j < end; j++ {
+		alloc.fineBits[j] = bandBits[j] >> 3
+		bandBits[j] = 0
+		alloc.finePriority[j] = boolToInt(alloc.fineBits[j] < 1)
+	}
+
+	alloc.codedBands = codedBands
+	alloc.balance = balance
+
+	return alloc
+}
+
+// quantizeBands encodes the normalized shapes of the bands, the bits a band doesn't use go to the next ones.
+func quantizeBands(e *rangeEncoder, x []float64, end int, alloc celtAllocation, spread, totalBits int) {
+
+	balance := alloc.balance
+
+	for i := 0; i < end; i++ {
+
+		tell := e.tellFrac()
+		if i != 0 {
+			balance -= tell
+		}
+
+		q := &bandQuantizer{e: e, band: i, spread: spread, remaining: totalBits - tell - 1}
+
+		b := 0
+		if i < alloc.codedBands {
+			current := balance / minInt(3, alloc.codedBands-i)
+			b = maxInt(0, minInt(16383, minInt(q.remaining+1, alloc.pulses[i]+current)))
+		}
+
+		q.partition(x[celtBandEdges[i]<<celtLM:celtBandEdges[i+1]<<celtLM], b, celtLM)
+
+		balance += alloc.pulses[i] + tell
+	}
+}
+
+type bandQuantizer struct {
+	e         *rangeEncoder
+	band      int
+	spread    int
+	remaining int // bits left in the frame
+}
+
+// partition encodes the shape with b bits, splitting it in halves while a single
+// codebook can't use the bits.
+func (q *bandQuantizer) partition(x []float64, b, lm int) {
+
+	e := q.e
+	cache := celtCacheBits[celtCacheIndex[(lm+1)*celtBands+q.band]:]
+	n := len(x)
+
+	if lm != -1 && b > int(cache[cache[0]])+12 && n > 2 {
+
+		n >>= 1
+		y := x[n:]
+		x = x[:n]
+		lm--
+
+		// The split is coded as the angle between the energies of the halves
+		pulseCap := celtLogN[q.band] + lm<<3
+		qn := thetaSteps(n, b, pulseCap>>1-4, pulseCap)
+
+		itheta := 0
+		tell := e.tellFrac()
+		if qn != 1 {
+
+			itheta = (int(math.Floor(.5+16384*0.63662*math.Atan2(norm(y), norm(x))))*qn + 8192) >> 14
+
+			// Triangular distribution
+			ft := (qn>>1 + 1) * (qn>>1 + 1)
+			fs, fl := itheta+1, itheta*(itheta+1)>>1
+			if itheta > qn>>1 {
+				fs, fl = qn+1-itheta, ft-(qn+1-itheta)*(qn+2-itheta)>>1
+			}
+			e.encode(uint32(fl), uint32(fl+fs), uint32(ft))
+
+			itheta = itheta * 16384 / qn
+		}
+		qalloc := e.tellFrac() - tell
+		b -= qalloc
+
+		var delta int
+		switch itheta {
+		case 0:
+			delta = -16384
+		case 16384:
+			delta = 16384
+		default:
+			mid := bitexactCos(itheta)
+			side := bitexactCos(16384 - itheta)
+			delta = fracMul16((n-1)<<7, bitexactLog2Tan(side, mid))
+		}
+
+		mbits := maxInt(0, minInt(b, (b-delta)/2))
+		sbits := b - mbits
+		q.remaining -= qalloc
+
+		rebalance := q.remaining
+		if mbits >= sbits {
+			q.partition(x, mbits, lm)
+			rebalance = mbits - (rebalance - q.remaining)
+			if rebalance > 3<<3 && itheta != 0 {
+				sbits += rebalance - 3<<3
+			}
+			q.partition(y, sbits, lm)
+		} else {
+			q.partition(y, sbits, lm)
+			rebalance = sbits - (rebalance - q.remaining)
+			if rebalance > 3<<3 && itheta != 16384 {
+				mbits += rebalance - 3<<3
+			}
+			q.partition(x, mbits, lm)
+		}
+		return
+	}
+
+	// The largest codebook within the bits
+	k := bitsToPulses(cache, b)
+	bits := pulsesToBits(cache, k)
+	q.remaining -= bits
+	for q.remaining < 0 && k > 0 {
+		q.remaining += bits
+		k--
+		bits = pulsesToBits(cache, k)
+		q.remaining -= bits
+	}
+
+	if k != 0 {
+		pulses := k
+		if k >= 8 {
+			pulses = (8 + k&7) << uint(k>>3-1)
+		}
+		quantizeVector(e, x, pulses, q.spread)
+	}
+}
+
+// thetaSteps returns the resolution of the angle of a split of the given bits.
+func thetaSteps(n, b, offset, pulseCap int) int {
+
+	exp2 := [8]int{16384, 17866, 19483, 21247, 23170, 25267, 27554, 30048}
+
+	n2 := 2*n - 1
+	qb := (b + n2*offset) / n2
+	qb = minInt(b-pulseCap-4<<3, qb)
+	qb = minInt(8<<3, qb)
+
+	if qb < 1<<3>>1 {
+		return 1
+	}
+
+	return (exp2[qb&7]>>uint(14-qb>>3) + 1) >> 1 << 1
+}
+
+// bitsToPulses returns the number of pulses whose bits are the closest to b, in the cache of the band.
+func bitsToPulses(cache []byte, b int) int {
+
+	lo, hi := 0, int(cache[0])
+	b--
+	for i := 0; i < 6; i++ {
+		mid := (lo + hi + 1) >> 1
+		if int(cache[mid]) >= b {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	low := -1
+	if lo != 0 {
+		low = int(cache[lo])
+	}
+	if b-low <= int(cache[hi])-b {
+		return lo
+	}
+	return hi
+}
+
+func pulsesToBits(cache []byte, pulses int) int {
+
+	if pulses == 0 {
+		return 0
+	}
+	return int(cache[pulses]) + 1
+}
+
+// quantizeVector encodes the shape as the closest vector of k pulses (RFC 6716, 4.3.4).
+func quantizeVector(e *rangeEncoder, x []float64, k, spread int) {
+
+	n := len(x)
+	x = append([]float64{}, x...)
+	rotate(x, k, spread)
+
+	sign := make([]bool, n)
+	iy := make([]int, n)
+	y := make([]float64, n)
+
+	for j := range x {
+		if x[j] <= 0 {
+			sign[j] = true
+			x[j] = -x[j]
+		}
+	}
+
+	xy, yy := 0.0, 0.0
+	left := k
+
+	// Projection on the pyramid first
+	if k > n>>1 {
+
+		sum := 0.0
+		for _, v := range x {
+			sum += v
+		}
+
+		if !(sum > 1e-15 && sum < 64) {
+			for j := range x {
+				x[j] = 0
+			}
+			x[0] = 1
+			sum = 1
+		}
+
+		rcp := float64(k-1) / sum
+		for j, v := range x {
+			iy[j] = int(math.Floor(rcp * v))
+			y[j] = float64(iy[j])
+			yy += y[j] * y[j]
+			xy += v * y[j]
+			y[j] *= 2
+			left -= iy[j]
+		}
+	}
+
+	if left > n+3 {
+		yy += float64(left*left) + float64(left)*y[0]
+		iy[0] += left
+		left = 0
+	}
+
+	// Then one pulse at a time where it brings the vector the closest
+	for ; left > 0; left-- {
+
+		best := 0
+		bestNum, bestDen := -1e15, 0.0
+		yy++
+
+		for j, v := range x {
+			rxy := (xy + v) * (xy + v)
+			ryy := yy + y[j]
+			if bestDen*rxy > ryy*bestNum {
+				best, bestNum, bestDen = j, rxy, ryy
+			}
+		}
+
+		xy += x[best]
+		yy += y[best]
+		y[best] += 2
+		iy[best]++
+	}
+
+	for j := range iy {
+		if sign[j] {
+			iy[j] = -iy[j]
+		}
+	}
+
+	e.uint(pvqIndex(iy), pvqU(n, k)+pvqU(n, k+1))
+}
+
+// rotate spreads the energy of sparse vectors (RFC 6716, 4.3.4.3).
+func rotate(x []float64, k, spread int) {
+
+	n := len(x)
+	if 2*k >= n || spread == celtSpreadNone {
+		return
+	}
+
+	factor := []int{15, 10, 5}[spread-1]
+	gain := float64(n) / float64(n+factor*k)
+	theta := .5 * gain * gain
+	c := math.Cos(.5 * math.Pi * theta)
+	s := math.Cos(.5 * math.Pi * (1 - theta))
+
+	stride2 := 0
+	if n >= 8 {
+		stride2 = 1
+		for stride2*stride2+stride2 < n {
+			stride2++
+		}
+	}
+
+	rotatePairs(x, 1, c, -s)
+	if stride2 > 0 {
+		rotatePairs(x, stride2, s, -c)
+	}
+}
+
+func rotatePairs(x []float64, stride int, c, s float64) {
+
+	for i := 0; i < len(x)-stride; i++ {
+		x1, x2 := x[i], x[i+stride]
+		x[i+stride] = c*x2 + s*x1
+		x[i] = c*x1 - s*x2
+	}
+
+	for i := len(x) - 2*stride - 1; i >= 0; i-- {
+		x1, x2 := x[i], x[i+stride]
+		x[i+stride] = c*x2 + s*x1
+		x[i] = c*x1 - s*x2
+	}
+}
+
+// pvqIndex returns the index of the vector of pulses in the codebook (RFC 6716, 4.3.4.2).
+func pvqIndex(y []int) uint32 {
+
+	n := len(y)
+	j := n - 1
+	k := absInt(y[j])
+
+	var i uint32
+	if y[j] < 0 {
+		i = 1
+	}
+
+	for j > 0 {
+		j--
+		i += pvqU(n-j, k)
+		k += absInt(y[j])
+		if y[j] < 0 {
+			i += pvqU(n-j, k+1)
+		}
+	}
+
+	return i
+}
+
+// The largest vectors of the bands and their pulses
+const pvqMaxN, pvqMaxK = 176, 130
+
+// pvqU returns U(n, k), the size of the codebook of n dimensions and k pulses, with the first one positive.
+func pvqU(n, k int) uint32 {
+
+	return pvqTable[n*(pvqMaxK+1)+k]
+}
+
+var pvqTable = func() []uint32 {
+
+	table := make([]uint32, (pvqMaxN+1)*(pvqMaxK+1))
+	table[0] = 1
+
+	for n := 1; n <= pvqMaxN; n++ {
+		for k := 1; k <= pvqMaxK; k++ {
+			u := func(n, k int) uint32 { return table[n*(pvqMaxK+1)+k] }
+			table[n*(pvqMaxK+1)+k] = u(n-1, k) + u(n, k-1) + u(n-1, k-1)
+		}
+	}
+
+	return table
+}()
+
+func norm(x []float64) float64 {
+
+	sum := 1e-15
+	for _, v := range x {
+		sum += v * v
+	}
+
+	return math.Sqrt(sum)
+}
+
+// Fixed point functions which have to give the same results as in the decoder
+
+func fracMul16(a, b int) int {
+
+	return (16384 + int(int16(a))*int(int16(b))) >> 15
+}
+
+func bitexactCos(x int) int {
+
+	x2 := (4096 + x*x) >> 13
+	x2 = int(int16((32767 - x2) + fracMul16(x2, -7651+fracMul16(x2, 8277+fracMul16(-626, x2)))))
+
+	return 1 + x2
+}
+
+func bitexactLog2Tan(sin, cos int) int {
+
+	lc := bits.Len(uint(cos))
+	ls := bits.Len(uint(sin))
+	cos <<= uint(15 - lc)
+	sin <<= uint(15 - ls)
+
+	return (ls-lc)<<11 + fracMul16(sin, fracMul16(sin, -2597)+7932) - fracMul16(cos, fracMul16(cos, -2597)+7932)
+}
+
+func absInt(a int) int {
+
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func boolToInt(b bool) int {
+
+	if b {
+		return 1
+	}
+	return 0
+}
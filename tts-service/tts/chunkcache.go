@@ -0,0 +1,113 @@
+package tts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+)
+
+type chunkCache interface {
+
+	// Load retrieves the media of a text chunk.
+	// It returns the media and true, or false if the chunk isn't cached.
+	Load(key string) ([]byte, bool)
+
+	// Store saves the media of a text chunk.
+	// It returns an error, if any.
+	Store(key string, media []byte) error
+
+	// Rotate re-encrypts the cached media with the active master key.
+	// It returns the number of re-encrypted chunks and an error, if any.
+	Rotate() (int, error)
+}
+
+// chunkKey identifies the media of a text chunk rendered with given metadata.
+func chunkKey(text string, meta Metadata) string {
+
+	options, _ := json.Marshal(meta)
+	sum := sha256.Sum256(append(append(options, '\n'), text...))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Local file system based implementation of the chunkCache interface, see filestore.
+// The media is encrypted, as it's as sensitive as the text.
+// Chunks are converted again once they're older than the TTL, so that the cache doesn't grow forever.
+type fileChunkCache struct {
+	files *filestore.Store
+	ttl   time.Duration
+}
+
+func (c fileChunkCache) Load(key string) ([]byte, bool) {
+
+	media, err := c.files.Read(key)
+
+	if err != nil {
+
+		if !os.IsNotExist(err) {
+			log.Printf("Can't read cached chunk %s: %v", key, err)
+		}
+		return nil, false
+	}
+
+	return media, true
+}
+
+func (c fileChunkCache) Store(key string, media []byte) error {
+
+	// Written aside and renamed, so that a concurrent Load never sees a partial file
+	return c.files.Write(key, media)
+}
+
+func (c fileChunkCache) Rotate() (int, error) {
+
+	return c.files.Rotate()
+}
+
+// Constructor for the fileChunkCache
+// Expired chunks are removed in the background.
+func newFileChunkCache(keys *envelope.Keyring) *fileChunkCache {
+
+	value := os.Getenv("TTS_CHUNK_CACHE_DIR")
+
+	if len(value) == 0 {
+
+		value = os.TempDir() + separator + "tts-chunks"
+		log.Printf("TTS_CHUNK_CACHE_DIR not provided. Using %s", value)
+	}
+
+	ttl := defaultChunkTtl
+
+	if ttlValue := os.Getenv("TTS_CHUNK_CACHE_TTL"); len(ttlValue) > 0 {
+
+		parsed, err := time.ParseDuration(ttlValue)
+
+		if err == nil && parsed > 0 {
+			ttl = parsed
+		} else {
+			log.Printf("Invalid TTS_CHUNK_CACHE_TTL value: '%s'. Using %v", ttlValue, defaultChunkTtl)
+		}
+	}
+
+	c := &fileChunkCache{files: filestore.New(value, keys), ttl: ttl}
+
+	interval := chunkExpiryInterval
+	if ttl < interval {
+		interval = ttl
+	}
+
+	c.files.ExpireEvery(ttl, interval)
+
+	return c
+}
+
+const defaultChunkTtl = 7 * 24 * time.Hour
+
+// How often expired chunks are removed, at most
+const chunkExpiryInterval = time.Hour
@@ -0,0 +1,80 @@
+package tts
+
+import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestChunkCache(t *testing.T) {
+
+	Convey("File based chunk cache", t, func() {
+
+		baseDir, _ := ioutil.TempDir("", "chunks")
+		defer os.RemoveAll(baseDir)
+
+		os.Setenv("TTS_CHUNK_CACHE_DIR", baseDir)
+		defer os.Unsetenv("TTS_CHUNK_CACHE_DIR")
+
+		keys, _ := envelope.ParseKeyring("k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+		cache := newFileChunkCache(keys)
+		key := chunkKey("Hello", Metadata{Lang: "EN"})
+
+		Convey("should store and load encrypted chunks", func() {
+
+			So(cache.Store(key, []byte("media")), ShouldBeNil)
+
+			media, ok := cache.Load(key)
+			So(ok, ShouldBeTrue)
+			So(string(media), ShouldEqual, "media")
+
+			stored, _ := ioutil.ReadFile(layout.Path(baseDir, key, key))
+			So(envelope.IsSealed(stored), ShouldBeTrue)
+
+			_, ok = cache.Load(chunkKey("Bye", Metadata{Lang: "EN"}))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("should re-encrypt chunks with the active master key", func() {
+
+			cache.Store(key, []byte("media"))
+
+			rotated, _ := envelope.ParseKeyring("k2:ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=\nk1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			cache = &fileChunkCache{files: filestore.New(baseDir, rotated), ttl: cache.ttl}
+
+			count, err := cache.Rotate()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			media, ok := cache.Load(key)
+			So(ok, ShouldBeTrue)
+			So(string(media), ShouldEqual, "media")
+		})
+
+		Convey("should forget expired chunks", func() {
+
+			os.Setenv("TTS_CHUNK_CACHE_TTL", "1h")
+			defer os.Unsetenv("TTS_CHUNK_CACHE_TTL")
+
+			cache = newFileChunkCache(keys)
+			So(cache.ttl, ShouldEqual, time.Hour)
+
+			cache.Store(key, []byte("media"))
+
+			old := time.Now().Add(-2 * time.Hour)
+			os.Chtimes(layout.Path(baseDir, key, key), old, old)
+
+			count, err := cache.files.Expire(cache.ttl)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			_, ok := cache.Load(key)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
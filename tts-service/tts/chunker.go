@@ -0,0 +1,265 @@
+package tts
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+)
+
+// splitText splits the text into chunks of at most maxSize characters.
+// Chunks never span paragraphs, and are split on sentence boundaries if possible,
+// so that editing one paragraph doesn't change chunks of the others.
+func splitText(text string, lang string, maxSize int) []string {
+
+	chunks := []string{}
+
+	for _, paragraph := range paragraphBreak.Split(text, -1) {
+
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+
+		if len(paragraph) == 0 {
+			continue
+		}
+
+		chunks = append(chunks, pack(splitSentences(paragraph, lang), maxSize)...)
+	}
+
+	return chunks
+}
+
+// Paragraphs are separated by empty lines
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// splitSentences splits the paragraph after sentence terminators followed by a new sentence.
+// Abbreviations and initials of the given language don't end a sentence.
+func splitSentences(paragraph string, lang string) []string {
+
+	sentences := []string{}
+	runes := []rune(paragraph)
+	start := 0
+
+	for i := 0; i < len(runes); i++ {
+
+		if !isTerminator(runes[i]) {
+			continue
+		}
+
+		// Include repeated terminators ("?!", "...") and closing quotes or brackets
+		end := i + 1
+		for end < len(runes) && (isTerminator(runes[end]) || strings.ContainsRune(closingPunctuation, runes[end])) {
+			end++
+		}
+		i = end - 1
+
+		// A new sentence starts after a space, with a capital letter, digit or opening punctuation
+		if end+1 >= len(runes) || runes[end] != ' ' || !startsSentence(runes[end+1]) {
+			continue
+		}
+
+		if runes[end-1] == '.' && isAbbreviation(lastWord(runes[start:end-1]), lang) {
+			continue
+		}
+
+		sentences = append(sentences, string(runes[start:end]))
+		start = end + 1
+	}
+
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+
+	return sentences
+}
+
+// pack joins consecutive sentences into chunks of at most maxSize characters.
+// Longer sentences are split on punctuation or between words.
+func pack(sentences []string, maxSize int) []string {
+
+	chunks := []string{}
+	current := ""
+
+	for _, sentence := range sentences {
+
+		if utf8.RuneCountInString(sentence) > maxSize {
+
+			if len(current) > 0 {
+				chunks = append(chunks, current)
+				current = ""
+			}
+
+			chunks = append(chunks, splitLong(sentence, maxSize)...)
+			continue
+		}
+
+		switch {
+		case len(current) == 0:
+			current = sentence
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(sentence) <= maxSize:
+			current += " " + sentence
+		default:
+			chunks = append(chunks, current)
+			current = sentence
+		}
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// splitLong splits the sentence preferably after a punctuation mark, otherwise between words.
+func splitLong(sentence string, maxSize int) []string {
+
+	chunks := []string{}
+	runes := []rune(sentence)
+
+	for len(runes) > maxSize {
+
+		cut := lastIndexFunc(runes[:maxSize+1], func(i int) bool {
+			return runes[i] == ' ' && i > 0 && strings.ContainsRune(",;:)", runes[i-1])
+		})
+
+		if cut <= 0 {
+			cut = lastIndexFunc(runes[:maxSize+1], func(i int) bool { return runes[i] == ' ' })
+		}
+
+		// A single, very long word
+		if cut <= 0 {
+			chunks = append(chunks, string(runes[:maxSize]))
+			runes = runes[maxSize:]
+			continue
+		}
+
+		chunks = append(chunks, string(runes[:cut]))
+		runes = runes[cut+1:]
+	}
+
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+
+	return chunks
+}
+
+func lastIndexFunc(runes []rune, f func(i int) bool) int {
+
+	for i := len(runes) - 1; i >= 0; i-- {
+
+		if f(i) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func lastWord(runes []rune) string {
+
+	i := len(runes) - 1
+	for i >= 0 && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(openingPunctuation, runes[i]) {
+		i--
+	}
+
+	return string(runes[i+1:])
+}
+
+func isTerminator(r rune) bool {
+
+	return strings.ContainsRune(".!?…", r)
+}
+
+func startsSentence(r rune) bool {
+
+	return unicode.IsUpper(r) || unicode.IsDigit(r) || strings.ContainsRune(openingPunctuation+"-–—", r)
+}
+
+func isAbbreviation(word string, lang string) bool {
+
+	// Initials, e.g. "J. R. R. Tolkien"
+	if utf8.RuneCountInString(word) == 1 {
+		return true
+	}
+
+	return abbreviations[lang][strings.ToLower(word)]
+}
+
+const openingPunctuation = "\"'„“‘«(["
+const closingPunctuation = "\"'”’»)]"
+
+// Abbreviations that are usually followed by a capitalized word, by language
+var abbreviations = map[string]map[string]bool{
+	"EN": wordSet("mr", "mrs", "ms", "dr", "prof", "st", "jr", "sr", "inc", "ltd", "co", "corp", "vs", "etc",
+		"e.g", "i.e", "no", "gen", "col", "capt", "lt", "sgt", "rev", "hon", "mt", "ft", "approx"),
+	"PL": wordSet("dr", "prof", "mgr", "inż", "hab", "doc", "ks", "płk", "gen", "św", "ul", "al", "pl", "os",
+		"np", "tzn", "tj", "tzw", "m.in", "ok", "godz", "nr", "tel", "ww", "jw", "wg", "woj", "pow", "gm", "im"),
+}
+
+func wordSet(words ...string) map[string]bool {
+
+	set := map[string]bool{}
+
+	for _, word := range words {
+		set[word] = true
+	}
+
+	return set
+}
+
+// splitSsml splits the SSML document into documents of at most maxSize characters of markup, if possible.
+// Top level elements are never split, long top level texts are split like plain texts.
+// Each chunk is wrapped in a copy of the root element, so that it keeps its language.
+func splitSsml(root *ssml.Node, lang string, maxSize int) []string {
+
+	chunks := []string{}
+	current := []*ssml.Node{}
+	size := 0
+
+	flush := func() {
+
+		if len(current) > 0 {
+			chunk := &ssml.Node{Name: root.Name, Attrs: root.Attrs, Children: current}
+			chunks = append(chunks, chunk.String())
+		}
+
+		current, size = []*ssml.Node{}, 0
+	}
+
+	for _, child := range root.Children {
+
+		pieces := []*ssml.Node{child}
+
+		if child.Name == "" {
+
+			pieces = []*ssml.Node{}
+			for _, text := range splitText(child.Text, lang, maxSize) {
+				pieces = append(pieces, &ssml.Node{Text: text})
+			}
+		}
+
+		for _, piece := range pieces {
+
+			pieceSize := utf8.RuneCountInString(piece.String())
+
+			if len(current) > 0 && size+1+pieceSize > maxSize {
+				flush()
+			}
+
+			if len(current) > 0 {
+				current = append(current, &ssml.Node{Text: " "})
+				size++
+			}
+
+			current = append(current, piece)
+			size += pieceSize
+		}
+	}
+
+	flush()
+
+	return chunks
+}
@@ -0,0 +1,101 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+)
+
+func TestChunker(t *testing.T) {
+
+	Convey("Text chunker", t, func() {
+
+		Convey("should split sentences", func() {
+
+			sentences := splitSentences("Hello there! How are you? I'm fine... Thanks.", "EN")
+
+			So(sentences, ShouldResemble, []string{"Hello there!", "How are you?", "I'm fine...", "Thanks."})
+		})
+
+		Convey("should not split after abbreviations of the language", func() {
+
+			So(splitSentences("Mr. Smith met Dr. Who. They talked.", "EN"),
+				ShouldResemble, []string{"Mr. Smith met Dr. Who.", "They talked."})
+			So(splitSentences("Spotkał m.in. Jana. Rozmawiali np. o Go. Było miło.", "PL"),
+				ShouldResemble, []string{"Spotkał m.in. Jana.", "Rozmawiali np. o Go.", "Było miło."})
+		})
+
+		Convey("should not split after initials", func() {
+
+			So(splitSentences("J. R. R. Tolkien wrote books. Many of them.", "EN"),
+				ShouldResemble, []string{"J. R. R. Tolkien wrote books.", "Many of them."})
+		})
+
+		Convey("should keep closing quotes with the sentence", func() {
+
+			So(splitSentences(`He said "Stop." Then he left.`, "EN"),
+				ShouldResemble, []string{`He said "Stop."`, "Then he left."})
+		})
+
+		Convey("should not split within a number or before a lowercase word", func() {
+
+			So(splitSentences("It costs 3.50 dollars. e.g. this one.", "EN"),
+				ShouldResemble, []string{"It costs 3.50 dollars. e.g. this one."})
+		})
+
+		Convey("should never join paragraphs", func() {
+
+			chunks := splitText("First.\n\nSecond.\n  \nThird\nline.", "EN", 1000)
+
+			So(chunks, ShouldResemble, []string{"First.", "Second.", "Third line."})
+		})
+
+		Convey("should pack sentences up to the maximal size", func() {
+
+			chunks := splitText("One. Two. Three. Four.", "EN", 10)
+
+			So(chunks, ShouldResemble, []string{"One. Two.", "Three.", "Four."})
+		})
+
+		Convey("should split long sentences on punctuation, then on spaces", func() {
+
+			chunks := splitText("Alpha beta, gamma delta epsilon zeta", "EN", 16)
+
+			So(chunks, ShouldResemble, []string{"Alpha beta,", "gamma delta", "epsilon zeta"})
+		})
+
+		Convey("should cut very long words", func() {
+
+			chunks := splitText(strings.Repeat("ą", 25), "PL", 10)
+
+			So(chunks, ShouldHaveLength, 3)
+			for _, chunk := range chunks {
+				So(utf8.RuneCountInString(chunk), ShouldBeLessThanOrEqualTo, 10)
+			}
+		})
+
+		Convey("should return no chunks for blank text", func() {
+
+			So(splitText(" \n\n \t", "EN", 10), ShouldBeEmpty)
+		})
+	})
+
+	Convey("SSML chunker", t, func() {
+
+		Convey("should wrap chunks in the root element, never splitting other elements", func() {
+
+			root, _ := ssml.Parse(`<speak xml:lang="en-US">First sentence. Second sentence.<break time="1s"/><emphasis>Third one.</emphasis></speak>`)
+
+			chunks := splitSsml(root, "EN", 36)
+
+			So(chunks, ShouldResemble, []string{
+				`<speak xml:lang="en-US">First sentence. Second sentence.</speak>`,
+				`<speak xml:lang="en-US"><break time="1s"/></speak>`,
+				`<speak xml:lang="en-US"><emphasis>Third one.</emphasis></speak>`,
+			})
+		})
+	})
+}
@@ -0,0 +1,313 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// concatenate joins media parts of the same format into a single, valid media.
+// MP3 frames are joined without re-encoding, WAV samples are joined under a new header.
+func concatenate(parts [][]byte) ([]byte, error) {
+
+	if len(parts) == 1 {
+
+		return parts[0], nil
+	}
+
+	if len(parts) == 0 {
+
+		return nil, errors.New("Nothing to concatenate")
+	}
+
+	switch info := probe(parts[0], int64(len(parts[0]))); info.MimeType {
+
+	case "audio/mpeg":
+
+		return concatenateMp3(parts)
+
+	case "audio/wav":
+
+		return concatenateWav(parts)
+
+	default:
+
+		return nil, fmt.Errorf("Can't concatenate media of type %s", info.MimeType)
+	}
+}
+
+// concatenateMp3 joins MP3 frames of all the parts, dropping their tags.
+// The result starts with a new Xing/Info frame, so that its duration is known.
+func concatenateMp3(parts [][]byte) ([]byte, error) {
+
+	var frames bytes.Buffer
+	var first mp3Frame
+	var firstHeader []byte
+	count := 0
+	constantBitrate := true
+
+	for _, part := range parts {
+
+		end := len(part)
+
+		// ID3v1 tag
+		if end >= 128 && string(part[end-128:end-125]) == "TAG" {
+			end -= 128
+		}
+
+		for pos := skipId3(part); pos+4 <= end; {
+
+			frame, ok := parseMp3Header(part[pos:end])
+			length := 0
+			if ok {
+				length = frame.length()
+			}
+
+			// Lost synchronization, look for the next frame
+			if !ok || length < 4 || pos+length > end {
+				pos++
+				continue
+			}
+
+			if count == 0 {
+				first = frame
+				firstHeader = part[pos : pos+4]
+			}
+
+			if frame.sampleRate != first.sampleRate || frame.channels != first.channels {
+
+				return nil, errors.New("Can't concatenate MP3 media with different sample rates or channels")
+			}
+
+			// The original Xing/Info frames carry no audio and their frame counts are no longer valid
+			if xingFrames(part[pos:pos+length], frame) == 0 {
+				frames.Write(part[pos : pos+length])
+				count++
+				constantBitrate = constantBitrate && frame.bitrate == first.bitrate
+			}
+
+			pos += length
+		}
+	}
+
+	if count == 0 {
+
+		return nil, errors.New("No MP3 frames found")
+	}
+
+	return append(xingFrame(firstHeader, first, count, constantBitrate), frames.Bytes()...), nil
+}
+
+// xingFrame creates an empty frame with the Xing/Info header declaring the number of frames.
+// It returns nil if the frame is too short to hold the header.
+func xingFrame(header []byte, frame mp3Frame, count int, constantBitrate bool) []byte {
+
+	// No padding and no CRC, so that the frame length and header offset are predictable
+	frame.padding = 0
+	result := make([]byte, frame.length())
+	copy(result, header)
+	result[1] |= 0x01
+	result[2] &^= 0x02
+
+	offset := xingOffset(frame)
+	if len(result) < offset+12 {
+
+		return nil
+	}
+
+	tag := "Xing"
+	if constantBitrate {
+		tag = "Info"
+	}
+
+	copy(result[offset:], tag)
+	binary.BigEndian.PutUint32(result[offset+4:], 0x01)
+	binary.BigEndian.PutUint32(result[offset+8:], uint32(count))
+
+	return result
+}
+
+// concatenateWav joins samples of WAV media of the same format.
+func concatenateWav(parts [][]byte) ([]byte, error) {
+
+	var format []byte
+	var samples bytes.Buffer
+
+	for _, part := range parts {
+
+		fmtChunk, data, err := parseWav(part)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if format == nil {
+			format = fmtChunk
+		}
+
+		if !bytes.Equal(format, fmtChunk) {
+
+			return nil, errors.New("Can't concatenate WAV media of different formats")
+		}
+
+		samples.Write(data)
+	}
+
+	return buildWav(format, samples.Bytes()), nil
+}
+
+// parseWav returns the "fmt " chunk body and samples of the WAV media.
+func parseWav(media []byte) ([]byte, []byte, error) {
+
+	if len(media) < 12 || string(media[0:4]) != "RIFF" || string(media[8:12]) != "WAVE" {
+
+		return nil, nil, errors.New("Not a WAV media")
+	}
+
+	var format []byte
+
+	for pos := 12; pos+8 <= len(media); {
+
+		chunkId := string(media[pos : pos+4])
+		chunkSize := int(binary.LittleEndian.Uint32(media[pos+4 : pos+8]))
+		body := media[pos+8:]
+
+		if chunkId == "data" {
+
+			if format == nil {
+
+				return nil, nil, errors.New("WAV media without format")
+			}
+
+			// Streamed WAVs often have an unknown (zero or maximum) data size
+			if chunkSize > 0 && chunkSize <= len(body) {
+				body = body[:chunkSize]
+			}
+
+			return format, body, nil
+		}
+
+		if chunkSize > len(body) {
+			break
+		}
+
+		if chunkId == "fmt " {
+			format = body[:chunkSize]
+		}
+
+		// Chunks are word aligned
+		pos += 8 + chunkSize + chunkSize&1
+	}
+
+	return nil, nil, errors.New("WAV media without data")
+}
+
+// buildWav creates WAV media of the given "fmt " chunk body and samples.
+func buildWav(format []byte, samples []byte) []byte {
+
+	var b bytes.Buffer
+
+	// Chunks are word aligned
+	padding := len(format) & 1
+
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(4+8+len(format)+padding+8+len(samples)))
+	b.WriteString("WAVE")
+
+	b.WriteString("fmt ")
+	binary.Write(&b, binary.LittleEndian, uint32(len(format)))
+	b.Write(format)
+	b.Write(make([]byte, padding))
+
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(samples)))
+	b.Write(samples)
+
+	return b.Bytes()
+}
+
+// silence creates silent media of the given duration, in the format of the reference media,
+// so that it can be concatenated with it.
+func silence(reference []byte, d time.Duration) ([]byte, error) {
+
+	switch info := probe(reference, int64(len(reference))); info.MimeType {
+
+	case "audio/mpeg":
+
+		return silenceMp3(reference, d)
+
+	case "audio/wav":
+
+		return silenceWav(reference, d)
+
+	default:
+
+		return nil, fmt.Errorf("Can't create silence for media of type %s", info.MimeType)
+	}
+}
+
+// silenceMp3 creates frames with no audio data, which decode to silence.
+func silenceMp3(reference []byte, d time.Duration) ([]byte, error) {
+
+	for pos := skipId3(reference); pos+4 <= len(reference); pos++ {
+
+		frame, ok := parseMp3Header(reference[pos:])
+		if !ok {
+			continue
+		}
+
+		// No padding and no CRC, so that all the frames have the same length
+		frame.padding = 0
+		header := make([]byte, 4)
+		copy(header, reference[pos:pos+4])
+		header[1] |= 0x01
+		header[2] &^= 0x02
+
+		samples := int64(d) * int64(frame.sampleRate) / int64(time.Second)
+		count := int((samples + int64(frame.samplesPerFrame) - 1) / int64(frame.samplesPerFrame))
+
+		var b bytes.Buffer
+		for i := 0; i < count; i++ {
+			b.Write(header)
+			b.Write(make([]byte, frame.length()-4))
+		}
+
+		return b.Bytes(), nil
+	}
+
+	return nil, errors.New("No MP3 frames found")
+}
+
+// silenceWav creates zero samples in the format of the reference media.
+func silenceWav(reference []byte, d time.Duration) ([]byte, error) {
+
+	format, _, err := parseWav(reference)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if len(format) < 16 {
+
+		return nil, errors.New("Invalid WAV format")
+	}
+
+	sampleRate := int64(binary.LittleEndian.Uint32(format[4:8]))
+	blockAlign := int64(binary.LittleEndian.Uint16(format[12:14]))
+	bits := binary.LittleEndian.Uint16(format[14:16])
+
+	samples := make([]byte, int64(d)*sampleRate/int64(time.Second)*blockAlign)
+
+	// 8 bit samples are unsigned
+	if bits == 8 {
+		for i := range samples {
+			samples[i] = 0x80
+		}
+	}
+
+	return buildWav(format, samples), nil
+}
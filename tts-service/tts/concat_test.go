@@ -0,0 +1,100 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConcatenate(t *testing.T) {
+
+	Convey("Media concatenation", t, func() {
+
+		Convey("should join MP3 frames under a new Xing header", func() {
+
+			part, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+			single := probe(part, int64(len(part)))
+
+			media, err := concatenate([][]byte{part, part, part})
+
+			So(err, ShouldBeNil)
+
+			info := probe(media, int64(len(media)))
+			So(info.MimeType, ShouldEqual, "audio/mpeg")
+			So(info.SampleRate, ShouldEqual, single.SampleRate)
+			So(info.Channels, ShouldEqual, single.Channels)
+			So(info.Duration, ShouldEqual, 3*single.Duration)
+		})
+
+		Convey("should join WAV samples under a new header", func() {
+
+			media, err := concatenate([][]byte{testWav(8000, 1, 4000), testWav(8000, 1, 8000)})
+
+			So(err, ShouldBeNil)
+
+			info := probe(media, int64(len(media)))
+			So(info.MimeType, ShouldEqual, "audio/wav")
+			So(info.Duration, ShouldEqual, 1500*time.Millisecond)
+			So(len(media), ShouldEqual, 44+2*12000)
+		})
+
+		Convey("should reject WAV media of different formats", func() {
+
+			_, err := concatenate([][]byte{testWav(8000, 1, 100), testWav(16000, 1, 100)})
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should return a single part as it is", func() {
+
+			media, err := concatenate([][]byte{[]byte("test")})
+
+			So(err, ShouldBeNil)
+			So(string(media), ShouldEqual, "test")
+		})
+
+		Convey("should reject unknown media", func() {
+
+			_, err := concatenate([][]byte{[]byte("test"), []byte("test")})
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Silence", t, func() {
+
+		Convey("should be created in the format of MP3 media", func() {
+
+			part, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+			single := probe(part, int64(len(part)))
+
+			pause, err := silence(part, time.Second)
+			So(err, ShouldBeNil)
+
+			media, err := concatenate([][]byte{part, pause})
+			So(err, ShouldBeNil)
+
+			info := probe(media, int64(len(media)))
+			So(info.Duration, ShouldBeBetweenOrEqual, single.Duration+time.Second, single.Duration+time.Second+100*time.Millisecond)
+		})
+
+		Convey("should be created in the format of WAV media", func() {
+
+			pause, err := silence(testWav(8000, 1, 100), 250*time.Millisecond)
+			So(err, ShouldBeNil)
+
+			info := probe(pause, int64(len(pause)))
+			So(info.MimeType, ShouldEqual, "audio/wav")
+			So(info.Duration, ShouldEqual, 250*time.Millisecond)
+		})
+
+		Convey("should reject unknown media", func() {
+
+			_, err := silence([]byte("test"), time.Second)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,13 +1,18 @@
 package tts
 
 import (
+	"bytes"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/language"
 )
 
 type converter interface {
@@ -15,29 +20,87 @@ type converter interface {
 	// Convert converts the text to a media.
 	// It returns an io.ReadCloser of an error, if any.
 	Convert(text string, metadata Metadata) (io.ReadCloser, error)
+
+	// Capabilities returns the voices, formats and prosody options the converter supports.
+	Capabilities() Capabilities
+}
+
+// ssmlConverter is implemented by converters supporting SSML input natively.
+// SSML documents are degraded to plain texts for the other ones.
+type ssmlConverter interface {
+	converter
+
+	// ConvertSsml converts the SSML document to a media.
+	// It returns an io.ReadCloser of an error, if any.
+	ConvertSsml(document string, metadata Metadata) (io.ReadCloser, error)
 }
 
 // VoiceRss based implementation of the converter interface //
 type voiceRssConverter struct {
-	apiKey string
-	apiUrl string
+	apiKey    string
+	apiUrl    string
+	languages *language.Registry // language.Default() if not set
 }
 
+// Name of VoiceRSS in the language registry
+const voiceRss = "voicerss"
+
 //  VoiceRSS mandatory parameters http://www.voicerss.org/api/documentation.aspx
 //  key - The API key (mandatory)
 //  src - The textual content for converting to speech (length limited by 100KB) (mandatory)
 //  hl  - The textual content language. Allows values: see Languages (mandatory)
 //  f   - The speech audio formats. Allows values: see Audio Formats. Default value: 8khz_8bit_mono. (optional)
+//  v   - The speech voice. Allows values: see Languages. Default value: the first voice of the language. (optional)
 //  r   - The speech rate (speed). Allows values: from -10 (slowest speed) up to 10 (fastest speed). Default value: 0 (normal speed). (optional)
+//  c   - The speech audio codec. Allows values: MP3, WAV, AAC, OGG, CAF. Default value: MP3. (optional)
+//  ssml - The SSML textual content format. Allows values: true and false. Default value: false. (optional)
 func (c voiceRssConverter) Convert(text string, meta Metadata) (io.ReadCloser, error) {
 
-	response, err := http.PostForm(c.apiUrl, url.Values{
-		"key": {c.apiKey},
-		"src": {text},
-		"hl":  {c.resolveLang(meta.Lang)},
-		"f":   {audioFormat},
-		"r":   {speechRate},
-	})
+	return c.post(text, meta, false)
+}
+
+// ConvertSsml converts the SSML document, which VoiceRSS supports natively.
+func (c voiceRssConverter) ConvertSsml(document string, meta Metadata) (io.ReadCloser, error) {
+
+	return c.post(document, meta, true)
+}
+
+func (c voiceRssConverter) post(src string, meta Metadata, ssml bool) (io.ReadCloser, error) {
+
+	provider, ok := c.resolveLang(meta.Lang)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported language: %s", meta.Lang)
+	}
+
+	// VoiceRSS changes pitch and volume only in SSML
+	if meta.Pitch != nil || meta.Volume != nil {
+		src, ssml = withProsody(src, ssml, meta.Options), true
+	}
+
+	params := url.Values{
+		"key":  {c.apiKey},
+		"src":  {src},
+		"hl":   {provider.Code},
+		"f":    {audioFormat},
+		"r":    {speechRate},
+		"ssml": {strconv.FormatBool(ssml)},
+	}
+
+	if meta.Voice != "" {
+		params.Set("v", meta.Voice)
+	} else if len(provider.Voices) > 0 {
+		params.Set("v", provider.Voices[0])
+	}
+
+	if meta.Rate != nil {
+		params.Set("r", strconv.Itoa(*meta.Rate))
+	}
+
+	if meta.Format != "" {
+		params.Set("c", strings.ToUpper(meta.Format))
+	}
+
+	response, err := http.PostForm(c.apiUrl, params)
 
 	if err != nil {
 		return nil, err
@@ -62,22 +125,100 @@ func (c voiceRssConverter) Convert(text string, meta Metadata) (io.ReadCloser, e
 	}
 }
 
+// Capabilities of VoiceRSS, limited to the formats that can be concatenated.
+// Languages and voices come from the language registry.
+// Pitch and volume are changed with SSML, see withProsody.
+func (c voiceRssConverter) Capabilities() Capabilities {
+
+	voices := map[string][]string{}
+
+	for _, l := range c.registry().All() {
+		if provider, ok := l.Providers[voiceRss]; ok {
+			voices[l.Code] = provider.Voices
+		}
+	}
+
+	return Capabilities{
+		Voices:  voices,
+		Formats: []string{"mp3", "wav"},
+		Rate:    &Range{-10, 10},
+		Pitch:   &Range{-50, 50},
+		Volume:  &Range{-10, 10},
+	}
+}
+
+// withProsody wraps the text, or the content of the SSML document, in a prosody element
+// changing the pitch by the percent and the volume by the dB of the options.
+// It returns the SSML document.
+func withProsody(src string, ssml bool, options Options) string {
+
+	prosody := "<prosody"
+
+	if options.Pitch != nil {
+		prosody += fmt.Sprintf(` pitch="%+d%%"`, *options.Pitch)
+	}
+
+	if options.Volume != nil {
+		prosody += fmt.Sprintf(` volume="%+ddB"`, *options.Volume)
+	}
+
+	prosody += ">"
+
+	if !ssml {
+
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(src))
+
+		return "<speak>" + prosody + escaped.String() + "</prosody></speak>"
+	}
+
+	// The root element keeps its attributes, e.g. xml:lang
+	start := strings.Index(src, "<speak")
+	end := strings.LastIndex(src, "</speak>")
+
+	if start < 0 || end < 0 {
+		return src
+	}
+
+	start += strings.Index(src[start:], ">") + 1
+
+	if start > end {
+		return src
+	}
+
+	return src[:start] + prosody + src[start:end] + "</prosody>" + src[end:]
+}
+
 func newVoiceRssConverter() *voiceRssConverter {
 
 	return &voiceRssConverter{
-		apiUrl: "https://api.voicerss.org/",
-		apiKey: os.Getenv("VOICE_RSS_API_KEY"),
+		apiUrl:    "https://api.voicerss.org/",
+		apiKey:    os.Getenv("VOICE_RSS_API_KEY"),
+		languages: language.Default(),
 	}
 }
 
-func (c voiceRssConverter) resolveLang(lang string) string {
+// resolveLang returns VoiceRSS settings of the language, e.g. "en-us" for "EN"
+func (c voiceRssConverter) resolveLang(lang string) (language.Provider, bool) {
+
+	l, ok := c.registry().Lookup(lang)
+	if !ok {
+		return language.Provider{}, false
+	}
 
-	if lang == "PL" {
-                return "pl-pl"
-        }
+	provider, ok := l.Providers[voiceRss]
+	return provider, ok
+}
+
+func (c voiceRssConverter) registry() *language.Registry {
+
+	if c.languages == nil {
+		return language.Default()
+	}
 
-        return "en-us"
+	return c.languages
 }
 
 const audioFormat = "16khz_16bit_stereo"
+// Default speech rate, slightly slower than the normal one
 const speechRate = "-2"
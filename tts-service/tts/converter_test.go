@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/language"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -32,7 +33,7 @@ func TestConverter(t *testing.T) {
 
 			converter := &voiceRssConverter{apiUrl: server.URL}
 
-			r, err := converter.Convert("This is just a simple test", Metadata{})
+			r, err := converter.Convert("This is just a simple test", Metadata{Lang: "EN"})
 
 			So(err, ShouldBeNil)
 
@@ -41,11 +42,124 @@ func TestConverter(t *testing.T) {
 			So(rc, ShouldResemble, fc)
 		})
 
+		Convey("should send SSML documents marked as such", func() {
+
+			f, _ := os.Open("testdata" + string(os.PathSeparator) + "test")
+			defer f.Close()
+
+			fc, _ := ioutil.ReadAll(f)
+			var params []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				r.ParseForm()
+				params = []string{r.Form.Get("src"), r.Form.Get("ssml")}
+				io.Copy(w, bytes.NewBuffer(fc))
+			}))
+			defer server.Close()
+
+			converter := &voiceRssConverter{apiUrl: server.URL}
+
+			_, err := converter.ConvertSsml("<speak>Hi</speak>", Metadata{Lang: "EN", Ssml: true})
+
+			So(err, ShouldBeNil)
+			So(params, ShouldResemble, []string{"<speak>Hi</speak>", "true"})
+		})
+
+		Convey("should pass the options", func() {
+
+			f, _ := os.Open("testdata" + string(os.PathSeparator) + "test")
+			defer f.Close()
+
+			fc, _ := ioutil.ReadAll(f)
+			var params []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				r.ParseForm()
+				params = []string{r.Form.Get("v"), r.Form.Get("r"), r.Form.Get("c")}
+				io.Copy(w, bytes.NewBuffer(fc))
+			}))
+			defer server.Close()
+
+			converter := &voiceRssConverter{apiUrl: server.URL}
+			rate := 5
+
+			_, err := converter.Convert("Hi", Metadata{Lang: "EN", Options: Options{Voice: "Mike", Rate: &rate, Format: "wav"}})
+
+			So(err, ShouldBeNil)
+			So(params, ShouldResemble, []string{"Mike", "5", "WAV"})
+		})
+
+		Convey("should change pitch and volume with SSML", func() {
+
+			f, _ := os.Open("testdata" + string(os.PathSeparator) + "test")
+			defer f.Close()
+
+			fc, _ := ioutil.ReadAll(f)
+			var params []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				r.ParseForm()
+				params = append(params, r.Form.Get("src"), r.Form.Get("ssml"))
+				io.Copy(w, bytes.NewBuffer(fc))
+			}))
+			defer server.Close()
+
+			converter := &voiceRssConverter{apiUrl: server.URL}
+			pitch, volume := -20, 6
+
+			_, err := converter.Convert("Fish & chips", Metadata{Lang: "EN", Options: Options{Pitch: &pitch}})
+			So(err, ShouldBeNil)
+
+			_, err = converter.ConvertSsml(`<speak xml:lang="en-US">Hi <break/></speak>`, Metadata{Lang: "EN", Ssml: true, Options: Options{Pitch: &pitch, Volume: &volume}})
+			So(err, ShouldBeNil)
+
+			So(params, ShouldResemble, []string{
+				`<speak><prosody pitch="-20%">Fish &amp; chips</prosody></speak>`, "true",
+				`<speak xml:lang="en-US"><prosody pitch="-20%" volume="+6dB">Hi <break/></prosody></speak>`, "true",
+			})
+			So(converter.Capabilities().Pitch, ShouldResemble, &Range{-50, 50})
+			So(converter.Capabilities().Volume, ShouldResemble, &Range{-10, 10})
+		})
+
+		Convey("should use language codes and default voices of the registry", func() {
+
+			f, _ := os.Open("testdata" + string(os.PathSeparator) + "test")
+			defer f.Close()
+
+			fc, _ := ioutil.ReadAll(f)
+			var params []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				r.ParseForm()
+				params = []string{r.Form.Get("hl"), r.Form.Get("v")}
+				io.Copy(w, bytes.NewBuffer(fc))
+			}))
+			defer server.Close()
+
+			registry, _ := language.ParseRegistry(`[{"code": "DE", "tag": "de-DE", "providers": {"voicerss": {"code": "de-de", "voices": ["Hanna", "Jonas"]}}},` +
+				`{"code": "UK", "tag": "uk-UA"}]`)
+			converter := &voiceRssConverter{apiUrl: server.URL, languages: registry}
+
+			_, err := converter.Convert("Hallo", Metadata{Lang: "DE"})
+
+			So(err, ShouldBeNil)
+			So(params, ShouldResemble, []string{"de-de", "Hanna"})
+			So(converter.Capabilities().Voices, ShouldResemble, map[string][]string{"DE": {"Hanna", "Jonas"}})
+
+			_, err = converter.Convert("Привіт", Metadata{Lang: "UK"})
+
+			So(err, ShouldNotBeNil)
+		})
+
 		Convey("should return an error in case of an internal error", func() {
 
 			converter := &voiceRssConverter{apiUrl: ""}
 
-			_, err := converter.Convert("whatever", Metadata{})
+			_, err := converter.Convert("whatever", Metadata{Lang: "EN"})
 
 			So(err, ShouldNotBeNil)
 		})
@@ -59,7 +173,7 @@ func TestConverter(t *testing.T) {
 
 			converter := &voiceRssConverter{apiUrl: server.URL}
 
-			_, err := converter.Convert("whatever", Metadata{})
+			_, err := converter.Convert("whatever", Metadata{Lang: "EN"})
 
 			So(err, ShouldNotBeNil)
 		})
@@ -74,7 +188,7 @@ func TestConverter(t *testing.T) {
 
 			converter := &voiceRssConverter{apiUrl: server.URL}
 
-			_, err := converter.Convert("whatever", Metadata{})
+			_, err := converter.Convert("whatever", Metadata{Lang: "EN"})
 
 			So(err, ShouldNotBeNil)
 		})
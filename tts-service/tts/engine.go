@@ -1,33 +1,512 @@
 package tts
 
-import "io"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/language"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/normalize"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+)
 
 // Engine aggregates converter and storage types.
 // It is supposed to be used in other packages.
 type Engine struct {
-	crt converter
-	str storage
+	crt   converter
+	str   storage
+	cache chunkCache // optional
+	post  pipeline   // optional post-processing of the concatenated media
+
+	maxChunkSize int // characters, defaultMaxChunkSize if not set
+	concurrency  int // parallel conversions, 1 if not set
+
+	detectionThreshold float64 // minimal confidence of language detection
+	fallbackLanguage   string  // used when the detection isn't confident, the first supported language if not set
 }
 
 // Process converts a given data to an audio media.
+// The text is normalized first, and long texts are converted in chunks, which are then concatenated.
+// Texts of mixed languages are converted in runs of a single language, each read in its own language.
+// Dialogues are converted segment by segment, each read by its own voice in its own language, and the text is ignored.
+// So is the text of rendered templates, converted fragment by fragment, so that their static fragments are cached.
+// Timestamps of the words and sentences are saved along with the media, see Marks.
+// If the converter returns WAV, the media is mixed with the background and jingles, if any,
+// and post-processed (e.g. its silence is trimmed) before it's saved.
 // It returns a media ID or an error, if any.
 func (e Engine) Process(text string, meta Metadata) (string, error) {
 
-	r, err := e.crt.Convert(text, meta)
+	var jobs []job
+	var err error
+
+	switch {
+	case len(meta.Segments) > 0:
+		jobs = e.dialogueJobs(meta)
+	case len(meta.Fragments) > 0:
+		jobs = e.fragmentJobs(meta)
+	case meta.Ssml:
+		jobs, err = e.ssmlJobs(text, meta)
+	default:
+		jobs = e.mixedJobs(text, meta)
+	}
+
 	if err != nil {
 		return "", err
 	}
 
-        defer r.Close()
+	parts, reported, err := e.convertAll(jobs)
+	if err != nil {
+		return "", err
+	}
 
-	id, err := e.str.Save(r)
+	media, err := concatenate(parts)
 	if err != nil {
 		return "", err
 	}
 
+	timestamps := marks(jobs, parts, reported)
+
+	if len(meta.Segments) > 0 {
+		timestamps = append(timestamps, segmentMarks(jobs, parts, meta.Segments)...)
+	}
+
+	if meta.Mix != nil {
+		var start time.Duration
+		media, start, err = mix(media, *meta.Mix)
+		if err != nil {
+			return "", err
+		}
+		timestamps = shiftMarks(timestamps, start)
+	}
+
+	processed, trimmed, err := e.post.process(media)
+	if err != nil {
+		// The media is saved as converted
+		log.Printf("Can't post-process media: %v", err)
+	}
+
+	id, err := e.str.Save(bytes.NewReader(processed))
+	if err != nil {
+		return "", err
+	}
+
+	if len(e.post) > 0 {
+		timestamps = clampMarks(shiftMarks(timestamps, -trimmed), probe(processed, int64(len(processed))).Duration)
+	}
+
+	// The media is usable without its marks
+	if err := e.str.SaveMarks(id, timestamps); err != nil {
+		log.Printf("Can't save marks of media %s: %v", id, err)
+	}
+
 	return id, nil
 }
 
+// Normalize rewrites numbers, dates, abbreviations etc. of the text as words, the way they are read aloud.
+// Words of the lexicon are read the way it tells first.
+// Only the texts of SSML documents are rewritten, the markup is preserved.
+// It returns the text that is actually converted by Process.
+func (e Engine) Normalize(text string, meta Metadata) string {
+
+	if len(meta.Fragments) > 0 {
+
+		normalized := ""
+		for _, fragment := range meta.Fragments {
+			normalized += e.Normalize(fragment, meta.whole())
+		}
+
+		return normalized
+	}
+
+	if !meta.Ssml {
+
+		normalized := ""
+		for _, run := range e.runs(meta.Lexicon.Apply(text), meta) {
+			normalized += normalize.Text(run.Text, run.Language.Code)
+		}
+
+		return normalized
+	}
+
+	root, err := ssml.Parse(text)
+	if err != nil {
+		return text
+	}
+
+	return e.applyLexicon(root, meta).Normalize(normalize.Text, meta.Lang).String()
+}
+
+// job is a piece of the input, converted with a single converter call
+type job struct {
+	text  string
+	meta  Metadata
+	pause time.Duration // If set, the job is a silence of this duration instead
+
+	segment int // Index of the dialogue segment the job belongs to, plus one. 0 if not a part of a dialogue
+}
+
+// textJobs splits the text into chunks.
+func (e Engine) textJobs(text string, meta Metadata) []job {
+
+	jobs := []job{}
+
+	for _, chunk := range splitText(text, meta.Lang, e.chunkSize()) {
+		jobs = append(jobs, job{text: chunk, meta: meta})
+	}
+
+	return jobs
+}
+
+// mixedJobs splits the text into runs of a single language first, if the options allow mixing languages.
+// Each run is normalized and read in its own language.
+func (e Engine) mixedJobs(text string, meta Metadata) []job {
+
+	jobs := []job{}
+
+	for _, run := range e.runs(meta.Lexicon.Apply(text), meta) {
+
+		runMeta := meta.in(run.Language.Code)
+		jobs = append(jobs, e.textJobs(normalize.Text(run.Text, runMeta.Lang), runMeta)...)
+	}
+
+	return jobs
+}
+
+// dialogueJobs splits each segment of the dialogue into jobs, preceded by the pause before the segment, if any.
+func (e Engine) dialogueJobs(meta Metadata) []job {
+
+	jobs := []job{}
+
+	for i, segment := range meta.Segments {
+
+		if segment.Pause > 0 {
+			jobs = append(jobs, job{pause: segment.Pause})
+		}
+
+		segmentMeta := meta.in(segment.Lang)
+		segmentMeta.Mixed = meta.Mixed
+		segmentMeta.Lexicon = segment.Lexicon
+		segmentMeta.Segments = nil
+		segmentMeta.Mix = nil
+
+		if segment.Voice != "" {
+			segmentMeta.Voice = segment.Voice
+		}
+
+		for _, j := range e.mixedJobs(segment.Text, segmentMeta) {
+			j.segment = i + 1
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs
+}
+
+// fragmentJobs splits each fragment of the text into jobs.
+// Chunks don't span fragments, so that the static fragments of templates are the same chunks in every rendering.
+func (e Engine) fragmentJobs(meta Metadata) []job {
+
+	jobs := []job{}
+
+	for _, fragment := range meta.Fragments {
+		jobs = append(jobs, e.mixedJobs(fragment, meta.whole())...)
+	}
+
+	return jobs
+}
+
+// runs splits the text into runs of the languages supported by the converter.
+// Ties are resolved in favor of the language of the text.
+// The text is a single run, unless the options allow mixing languages.
+func (e Engine) runs(text string, meta Metadata) []language.Run {
+
+	main, ok := language.Default().Lookup(meta.Lang)
+
+	if !meta.Mixed || !ok {
+		return []language.Run{{Text: text, Language: language.Language{Code: meta.Lang}}}
+	}
+
+	candidates := []language.Language{main}
+	for _, l := range e.candidates() {
+		if l.Code != main.Code {
+			candidates = append(candidates, l)
+		}
+	}
+
+	return language.Segment(text, candidates)
+}
+
+// ssmlJobs splits the SSML document into smaller documents, if the converter supports SSML natively.
+// Otherwise, the document is degraded to plain texts, and its breaks to silence.
+func (e Engine) ssmlJobs(document string, meta Metadata) ([]job, error) {
+
+	root, err := ssml.Parse(document)
+	if err != nil {
+		return nil, err
+	}
+
+	root = e.applyLexicon(root, meta).Normalize(normalize.Text, meta.Lang)
+	jobs := []job{}
+
+	if _, ok := e.crt.(ssmlConverter); ok {
+
+		for _, chunk := range splitSsml(root, meta.Lang, e.chunkSize()) {
+			jobs = append(jobs, job{text: chunk, meta: meta})
+		}
+
+		return jobs, nil
+	}
+
+	for _, segment := range root.Segments(meta.Lang, normalize.SayAs) {
+
+		if segment.Pause > 0 {
+			jobs = append(jobs, job{pause: segment.Pause})
+			continue
+		}
+
+		segmentMeta := meta.in(segment.Lang)
+		segmentMeta.Ssml = false
+
+		jobs = append(jobs, e.textJobs(segment.Text, segmentMeta)...)
+	}
+
+	return jobs, nil
+}
+
+// applyLexicon marks the words of the lexicon in the SSML document.
+// Phonemes are used only if the converter supports SSML, as they have no plain text equivalent.
+func (e Engine) applyLexicon(root *ssml.Node, meta Metadata) *ssml.Node {
+
+	_, phonemes := e.crt.(ssmlConverter)
+
+	return meta.Lexicon.ApplySsml(root, phonemes)
+}
+
+func (e Engine) chunkSize() int {
+
+	if e.maxChunkSize <= 0 {
+		return defaultMaxChunkSize
+	}
+
+	return e.maxChunkSize
+}
+
+// convertAll converts the jobs in parallel, preserving their order.
+// Silence is created in the format of the converted media.
+// It returns the media of each job, and the marks reported by the converter, if any.
+func (e Engine) convertAll(jobs []job) ([][]byte, [][]Mark, error) {
+
+	parts := make([][]byte, len(jobs))
+	marks := make([][]Mark, len(jobs))
+	errs := make([]error, len(jobs))
+	reference := -1
+
+	concurrency := e.concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, j := range jobs {
+
+		if j.pause > 0 {
+			continue
+		}
+
+		if reference < 0 {
+			reference = i
+		}
+
+		wg.Add(1)
+
+		go func(i int, j job) {
+
+			defer wg.Done()
+
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			parts[i], marks[i], errs[i] = e.convert(j.text, j.meta)
+		}(i, j)
+	}
+
+	if reference < 0 {
+		return nil, nil, errors.New("Nothing to convert")
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i, j := range jobs {
+
+		if j.pause <= 0 {
+			continue
+		}
+
+		pause, err := silence(parts[reference], j.pause)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parts[i] = pause
+	}
+
+	return parts, marks, nil
+}
+
+// convert converts a single chunk, unless its media is already cached.
+// Marks are returned only if the converter reports them, and only for chunks that aren't cached.
+func (e Engine) convert(chunk string, meta Metadata) ([]byte, []Mark, error) {
+
+	key := chunkKey(chunk, meta)
+
+	if e.cache != nil {
+
+		if media, ok := e.cache.Load(key); ok {
+			return media, nil, nil
+		}
+	}
+
+	var r io.ReadCloser
+	var marks []Mark
+	var err error
+
+	switch crt, marked := e.crt.(markConverter); {
+	case meta.Ssml:
+		r, err = e.crt.(ssmlConverter).ConvertSsml(chunk, meta)
+	case marked:
+		r, marks, err = crt.ConvertMarked(chunk, meta)
+	default:
+		r, err = e.crt.Convert(chunk, meta)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer r.Close()
+
+	media, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.cache != nil {
+
+		// The cache is an optimization only
+		if err := e.cache.Store(key, media); err != nil {
+			log.Printf("Can't cache chunk %s: %v", key, err)
+		}
+	}
+
+	return media, marks, nil
+}
+
+// marks returns the marks of the whole media: the reported ones, or estimated ones of each converted part,
+// moved by the durations of the preceding parts.
+func marks(jobs []job, parts [][]byte, reported [][]Mark) []Mark {
+
+	result := []Mark{}
+	offset := time.Duration(0)
+
+	for i, j := range jobs {
+
+		if j.pause > 0 {
+			offset += j.pause
+			continue
+		}
+
+		d := probe(parts[i], int64(len(parts[i]))).Duration
+		partMarks := reported[i]
+
+		if partMarks == nil {
+
+			text := j.text
+			if j.meta.Ssml {
+				text = ssmlText(text)
+			}
+
+			partMarks = estimateMarks(text, j.meta.Lang, d)
+		}
+
+		result = append(result, shiftMarks(partMarks, offset)...)
+		offset += d
+	}
+
+	return result
+}
+
+// segmentMarks returns a mark of each segment of the dialogue, from the start of its first part to the end of its last one.
+// Pauses before the segments aren't a part of them.
+func segmentMarks(jobs []job, parts [][]byte, segments []Segment) []Mark {
+
+	result := make([]Mark, len(segments))
+	seen := make([]bool, len(segments))
+	offset := time.Duration(0)
+
+	for i, j := range jobs {
+
+		if j.pause > 0 {
+			offset += j.pause
+			continue
+		}
+
+		d := probe(parts[i], int64(len(parts[i]))).Duration
+
+		if j.segment > 0 {
+
+			mark := &result[j.segment-1]
+
+			if !seen[j.segment-1] {
+				mark.Start = offset
+				seen[j.segment-1] = true
+			}
+
+			mark.End = offset + d
+		}
+
+		offset += d
+	}
+
+	for i, segment := range segments {
+
+		result[i].Type = MarkSegment
+		result[i].Text = segment.Speaker
+
+		// Segments with nothing to read, e.g. just punctuation, take no time
+		if !seen[i] && i > 0 {
+			result[i].Start = result[i-1].End
+			result[i].End = result[i-1].End
+		}
+	}
+
+	return result
+}
+
+// Marks returns the timestamps of the words and sentences of the media based on its ID.
+// Marks of media converted by providers not reporting them are estimated.
+// It returns the marks or an error, if any.
+func (e Engine) Marks(id string) ([]Mark, error) {
+
+	return e.str.Marks(id)
+}
+
 // Result returns the processing result based on its ID.
 // It returns an io.ReadCloser of an error, if any.
 func (e Engine) Result(id string) (io.ReadCloser, error) {
@@ -35,12 +514,297 @@ func (e Engine) Result(id string) (io.ReadCloser, error) {
 	return e.str.Get(id)
 }
 
+// Info returns the MediaInfo of the processing result based on its ID.
+// It returns the MediaInfo or an error, if any.
+func (e Engine) Info(id string) (*MediaInfo, error) {
+
+	return e.str.Info(id)
+}
+
+// Rendition returns the media based on its ID in the given format, e.g. "flac", along with its MediaInfo.
+// Media is transcoded the first time it's requested in a format and the rendition is stored next to it.
+// It returns FormatError if the media can't be transcoded, or another error, if any.
+func (e Engine) Rendition(id string, format string) (io.ReadCloser, *MediaInfo, error) {
+
+	reader, err := e.str.Get(id)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	defer reader.Close()
+
+	media, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	info := inspect(media)
+	original := FormatOf(info.MimeType)
+
+	if original == format {
+
+		return ioutil.NopCloser(bytes.NewReader(media)), info, nil
+	}
+
+	rendition, err := e.str.Rendition(id, format)
+
+	if os.IsNotExist(err) {
+
+		rendition, err = transcode(media, format)
+
+		if err != nil {
+
+			return nil, nil, FormatError{id, format, "Media with ID: '" + id + "' can't be transcoded from " + original + " to " + format + ": " + err.Error()}
+		}
+
+		// The rendition can be transcoded again
+		if err := e.str.SaveRendition(id, format, rendition); err != nil {
+			log.Printf("Can't save %s rendition of media %s: %v", format, id, err)
+		}
+	}
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(rendition)), inspect(rendition), nil
+}
+
+// Media returns IDs of all the stored media.
+// It returns the IDs or an error, if any.
+func (e Engine) Media() ([]string, error) {
+
+	return e.str.List()
+}
+
+// Verify checks the integrity of the media based on its ID.
+// It returns MediaCorruptedError if the media is damaged or missing, or another error, if any.
+func (e Engine) Verify(id string) error {
+
+	return e.str.Verify(id)
+}
+
+// Quarantine withdraws the media based on its ID, so that it is no longer served.
+// It returns an error, if any.
+func (e Engine) Quarantine(id string) error {
+
+	return e.str.Quarantine(id)
+}
+
+// Rotate re-encrypts all the stored media, and the cached chunks, with the active master key.
+// It returns the number of re-encrypted media or an error, if any.
+func (e Engine) Rotate() (int, error) {
+
+	count, err := e.str.Rotate()
+
+	if err != nil || e.cache == nil {
+
+		return count, err
+	}
+
+	// Cached chunks are as sensitive as the media, though they aren't counted as media
+	_, err = e.cache.Rotate()
+
+	return count, err
+}
+
+// Migrate moves the media stored in a flat directory into the sharded layout.
+// It returns the number of moved files or an error, if any.
+func (e Engine) Migrate() (int, error) {
+
+	return e.str.Migrate()
+}
+
+// DetectLanguage guesses the language of the text among the ones supported by the converter.
+// If the detection isn't confident enough, the fallback language is used.
+func (e Engine) DetectLanguage(text string, meta Metadata) Detection {
+
+	if meta.Ssml {
+		text = ssmlText(text)
+	}
+
+	candidates := e.candidates()
+
+	detection := Detection{Lang: e.fallbackLanguage}
+	if detection.Lang == "" && len(candidates) > 0 {
+		detection.Lang = candidates[0].Code
+	}
+
+	if l, confidence, ok := language.Detect(text, candidates); ok {
+
+		detection.Detected, detection.Confidence = l.Code, confidence
+
+		if confidence >= e.detectionThreshold {
+			detection.Lang = l.Code
+		}
+	}
+
+	return detection
+}
+
+// candidates returns the registered languages supported by the converter
+func (e Engine) candidates() []language.Language {
+
+	capabilities := e.Capabilities()
+	candidates := []language.Language{}
+
+	for _, l := range language.Default().All() {
+		if capabilities.Supports(l.Code) {
+			candidates = append(candidates, l)
+		}
+	}
+
+	return candidates
+}
+
+// ssmlText returns the text of the SSML document, without markup
+func ssmlText(document string) string {
+
+	root, err := ssml.Parse(document)
+	if err != nil {
+		return document
+	}
+
+	texts := []string{}
+	for _, segment := range root.Segments("", func(interpretAs, format, text, lang string) string { return text }) {
+		texts = append(texts, segment.Text)
+	}
+
+	return strings.Join(texts, " ")
+}
+
+// Detection is the result of language detection
+type Detection struct {
+	Lang       string  // Language to read the text in
+	Detected   string  // The most probable language, empty if it can't be detected
+	Confidence float64 // Probability of the detected language, from 0 to 1
+}
+
+// Capabilities returns the voices, formats and prosody options supported by the converter.
+func (e Engine) Capabilities() Capabilities {
+
+	return e.crt.Capabilities()
+}
+
 // https://golang.org/doc/effective_go.html#composite_literals
 func NewEngine() *Engine {
 
-	return &Engine{crt: newVoiceRssConverter(), str: newFileSystemStorage()}
+	str := newFileSystemStorage()
+
+	return &Engine{
+		crt:          newVoiceRssConverter(),
+		str:          str,
+		cache:        newFileChunkCache(str.keys),
+		post:         pipelineFromEnv("TTS_POST_PROCESSING"),
+		maxChunkSize: intFromEnv("TTS_MAX_CHUNK_SIZE", defaultMaxChunkSize),
+		concurrency:  intFromEnv("TTS_CONCURRENCY", defaultConcurrency),
+
+		detectionThreshold: floatFromEnv("TTS_LANGUAGE_DETECTION_THRESHOLD", defaultDetectionThreshold),
+		fallbackLanguage:   os.Getenv("TTS_LANGUAGE_DETECTION_FALLBACK"),
+	}
 }
 
+func intFromEnv(name string, defaultValue int) int {
+
+	value := os.Getenv(name)
+
+	if len(value) == 0 {
+
+		return defaultValue
+	}
+
+	result, err := strconv.Atoi(value)
+
+	if err != nil || result <= 0 {
+
+		log.Printf("Invalid %s value: '%s'. Using %d", name, value, defaultValue)
+		return defaultValue
+	}
+
+	return result
+}
+
+func floatFromEnv(name string, defaultValue float64) float64 {
+
+	value := os.Getenv(name)
+
+	if len(value) == 0 {
+
+		return defaultValue
+	}
+
+	result, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || result < 0 || result > 1 {
+
+		log.Printf("Invalid %s value: '%s'. Using %v", name, value, defaultValue)
+		return defaultValue
+	}
+
+	return result
+}
+
+// Long inputs reduce the speech quality, and VoiceRSS limits them to 100KB
+const defaultMaxChunkSize = 1000
+
+const defaultConcurrency = 4
+
+// Texts of a few words are rarely detected with higher confidence
+const defaultDetectionThreshold = 0.8
+
 type Metadata struct {
 	Lang string
+	Ssml bool `json:",omitempty"` // The text is an SSML document
+	Options
+
+	// Pronunciations of words. Its changes are visible in the converted texts, so it's not a part of chunk keys.
+	Lexicon lexicon.Lexicon `json:"-"`
+
+	// Audio mixed with the speech after it's converted, so it's not a part of chunk keys either. Optional.
+	Mix *Mix `json:"-"`
+
+	// Parts of a dialogue, read instead of the text. Each job is a part of a single segment. Optional.
+	Segments []Segment `json:"-"`
+
+	// Parts of the text, converted on their own, e.g. the static texts and the values of a rendered template. Optional.
+	Fragments []string `json:"-"`
+}
+
+// Segment is a part of a dialogue, read by its own speaker.
+// The options of the dialogue (rate, format...) apply to all its segments.
+type Segment struct {
+	Speaker string // Label of the speaker, e.g. "agent", reported in the segment marks
+	Text    string
+	Lang    string
+	Voice   string          // The voice of the dialogue if not set, or the default voice of Lang if it's another language
+	Pause   time.Duration   // Silence before the segment
+	Lexicon lexicon.Lexicon // Pronunciations of words of Lang
+}
+
+// whole returns the metadata of a fragment, converted as a whole text
+func (m Metadata) whole() Metadata {
+
+	m.Fragments = nil
+
+	return m
+}
+
+// in returns the metadata of a part of the text read in the given language.
+// Voices belong to a single language, so parts in other languages are read with their default voices.
+func (m Metadata) in(lang string) Metadata {
+
+	if lang != m.Lang {
+		m.Lang = lang
+		m.Voice = ""
+	}
+
+	// The part is of a single language, so that its chunks are cached like the ones of unmixed texts
+	m.Mixed = false
+
+	return m
 }
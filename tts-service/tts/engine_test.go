@@ -1,11 +1,17 @@
 package tts
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	. "github.com/smartystreets/goconvey/convey"
 	"io"
+	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
         "io/ioutil"
 )
 
@@ -17,9 +23,9 @@ func TestEngine(t *testing.T) {
 
 			Convey("should pass error from converter", func() {
 
-				engine := &Engine{mockConverter{true}, mockStorage{false}}
+				engine := &Engine{crt: mockConverter{true}, str: mockStorage{false}}
 
-				_, err := engine.Process("", Metadata{})
+				_, err := engine.Process("test", Metadata{})
 
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldEqual, converterErrorMessage)
@@ -27,9 +33,9 @@ func TestEngine(t *testing.T) {
 
 			Convey("should pass error from storage", func() {
 
-				engine := &Engine{mockConverter{false}, mockStorage{true}}
+				engine := &Engine{crt: mockConverter{false}, str: mockStorage{true}}
 
-				_, err := engine.Process("", Metadata{})
+				_, err := engine.Process("test", Metadata{})
 
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldEqual, storageErrorMessage)
@@ -37,21 +43,495 @@ func TestEngine(t *testing.T) {
 
 			Convey("should not blow if there are no errors", func() {
 
-				engine := &Engine{mockConverter{false}, mockStorage{false}}
+				engine := &Engine{crt: mockConverter{false}, str: mockStorage{false}}
 
-				_, err := engine.Process("", Metadata{})
+				_, err := engine.Process("test", Metadata{})
 
 				So(err, ShouldBeNil)
 			})
+
+			Convey("should reject empty text", func() {
+
+				engine := &Engine{crt: mockConverter{false}, str: mockStorage{false}}
+
+				_, err := engine.Process(" \n ", Metadata{})
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("should convert long text in chunks and join them in order", func() {
+
+				crt := &wavConverter{}
+				str := &capturingStorage{}
+				engine := &Engine{crt: crt, str: str, maxChunkSize: 20, concurrency: 2}
+
+				_, err := engine.Process("First sentence. Second sentence.\n\nThird one.", Metadata{Lang: "EN"})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 3)
+
+				info := probe(str.saved, int64(len(str.saved)))
+				So(info.MimeType, ShouldEqual, "audio/wav")
+				So(info.Duration, ShouldEqual, 3*chunkDuration)
+
+				_, samples, _ := parseWav(str.saved)
+				So(samples[0], ShouldEqual, byte(len("First sentence.")))
+				So(samples[len(samples)-1], ShouldEqual, byte(len("Third one.")))
+			})
+
+			Convey("should convert normalized text", func() {
+
+				crt := &wavConverter{}
+				engine := &Engine{crt: crt, str: &capturingStorage{}}
+
+				_, err := engine.Process("Dr. Smith has 2 cats.", Metadata{Lang: "EN"})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldResemble, []string{"Doctor Smith has two cats."})
+			})
+
+			Convey("should pass normalized SSML to converters supporting it", func() {
+
+				crt := &ssmlWavConverter{}
+				engine := &Engine{crt: crt, str: &capturingStorage{}}
+
+				_, err := engine.Process(`<speak>I have 2 cats.<break time="1s"/></speak>`, Metadata{Lang: "EN", Ssml: true})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldBeEmpty)
+				So(crt.documents, ShouldResemble, []string{`<speak>I have two cats. <break time="1s"/></speak>`})
+			})
+
+			Convey("should convert SSML to texts and silence for other converters", func() {
+
+				crt := &wavConverter{}
+				str := &capturingStorage{}
+				engine := &Engine{crt: crt, str: str, concurrency: 2}
+
+				_, err := engine.Process(`<speak>I have 2 cats.<break time="1s"/>`+
+					`<say-as interpret-as="characters">AB</say-as> <lang xml:lang="pl-PL">Mam 2 koty.</lang></speak>`,
+					Metadata{Lang: "EN", Ssml: true})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 3)
+				So(crt.texts, ShouldContain, "I have two cats.")
+				So(crt.texts, ShouldContain, "A B")
+				So(crt.texts, ShouldContain, "Mam dwa koty.")
+				So(crt.langs, ShouldContain, "PL")
+
+				info := probe(str.saved, int64(len(str.saved)))
+				So(info.Duration, ShouldEqual, 3*chunkDuration+time.Second)
+			})
+
+			Convey("should read runs of mixed languages in their languages", func() {
+
+				crt := &wavConverter{supported: map[string][]string{"EN": {"Amy"}, "PL": {"Zofia"}}}
+				str := &capturingStorage{}
+				engine := &Engine{crt: crt, str: str}
+
+				_, err := engine.Process("Zamówienie 2 shipped to Warsaw", Metadata{Lang: "PL", Options: Options{Voice: "Zofia", Mixed: true}})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 2)
+
+				for i, text := range crt.texts {
+					switch text {
+					case "Zamówienie dwa":
+						So(crt.langs[i], ShouldEqual, "PL")
+						So(crt.voices[i], ShouldEqual, "Zofia")
+					default:
+						So(text, ShouldEqual, "shipped to Warsaw")
+						So(crt.langs[i], ShouldEqual, "EN")
+						So(crt.voices[i], ShouldBeEmpty)
+					}
+				}
+
+				info := probe(str.saved, int64(len(str.saved)))
+				So(info.Duration, ShouldEqual, 2*chunkDuration)
+
+				_, samples, _ := parseWav(str.saved)
+				So(samples[0], ShouldEqual, byte(len("Zamówienie dwa")))
+
+				So(engine.Normalize("Zamówienie 2 shipped to Warsaw", Metadata{Lang: "PL", Options: Options{Mixed: true}}),
+					ShouldEqual, "Zamówienie dwa shipped to Warsaw")
+			})
+
+			Convey("should read mixed languages in a single language, unless the options allow mixing them", func() {
+
+				crt := &wavConverter{supported: map[string][]string{"EN": {"Amy"}, "PL": {"Zofia"}}}
+				engine := &Engine{crt: crt, str: &capturingStorage{}}
+
+				_, err := engine.Process("Zamówienie shipped to Warsaw", Metadata{Lang: "PL"})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldResemble, []string{"Zamówienie shipped to Warsaw"})
+				So(crt.langs, ShouldResemble, []string{"PL"})
+			})
+
+			Convey("should read runs of mixed languages in supported languages only", func() {
+
+				crt := &wavConverter{supported: map[string][]string{"PL": {"Zofia"}}}
+				engine := &Engine{crt: crt, str: &capturingStorage{}}
+
+				_, err := engine.Process("Zamówienie shipped to Warsaw", Metadata{Lang: "PL", Options: Options{Mixed: true}})
+
+				So(err, ShouldBeNil)
+				So(crt.langs, ShouldResemble, []string{"PL"})
+			})
+
+			Convey("should read words the way the lexicon tells", func() {
+
+				lex := lexicon.Lexicon{Entries: []lexicon.Entry{{Grapheme: "XJ9", Alias: "ex jay nine", Phoneme: "ɛks dʒeɪ naɪn"}}}
+
+				crt := &wavConverter{}
+				engine := &Engine{crt: crt, str: &capturingStorage{}}
+
+				_, err := engine.Process("Buy 2 XJ9 now.", Metadata{Lang: "EN", Lexicon: lex})
+				So(err, ShouldBeNil)
+
+				_, err = engine.Process(`<speak>Buy XJ9.</speak>`, Metadata{Lang: "EN", Ssml: true, Lexicon: lex})
+				So(err, ShouldBeNil)
+
+				So(crt.texts, ShouldResemble, []string{"Buy two ex jay nine now.", "Buy ex jay nine."})
+				So(engine.Normalize("Buy 2 XJ9 now.", Metadata{Lang: "EN", Lexicon: lex}), ShouldEqual, "Buy two ex jay nine now.")
+
+				ssmlCrt := &ssmlWavConverter{}
+				engine = &Engine{crt: ssmlCrt, str: &capturingStorage{}}
+
+				_, err = engine.Process(`<speak>Buy XJ9 now.</speak>`, Metadata{Lang: "EN", Ssml: true, Lexicon: lex})
+
+				So(err, ShouldBeNil)
+				So(ssmlCrt.documents, ShouldResemble, []string{`<speak>Buy <phoneme alphabet="ipa" ph="ɛks dʒeɪ naɪn">XJ9</phoneme> now.</speak>`})
+			})
+
+			Convey("should save estimated marks of the converted parts", func() {
+
+				str := &capturingStorage{}
+				engine := &Engine{crt: &wavConverter{}, str: str, concurrency: 2}
+
+				_, err := engine.Process(`<speak>One two.<break time="1s"/>Three.</speak>`, Metadata{Lang: "EN", Ssml: true})
+
+				So(err, ShouldBeNil)
+				So(str.marks, ShouldHaveLength, 5)
+				So(str.marks[0], ShouldResemble, Mark{Type: MarkSentence, Text: "One two.", Start: 0, End: str.marks[2].End})
+				So(str.marks[1].Text, ShouldEqual, "One")
+				So(str.marks[2].End, ShouldBeLessThan, chunkDuration)
+
+				// After the first part and the break
+				So(str.marks[3].Text, ShouldEqual, "Three.")
+				So(str.marks[3].Start, ShouldEqual, chunkDuration+time.Second)
+			})
+
+			Convey("should post-process the media and keep its marks in sync", func() {
+
+				str := &capturingStorage{}
+				trimStart := func(audio pcm) pcm {
+					audio.samples = audio.samples[audio.frame(40*time.Millisecond):]
+					audio.trimmed += 40 * time.Millisecond
+					return audio
+				}
+				engine := &Engine{crt: &wavConverter{}, str: str, post: pipeline{trimStart}}
+
+				_, err := engine.Process("One two. Three.", Metadata{Lang: "EN"})
+
+				So(err, ShouldBeNil)
+				So(probe(str.saved, int64(len(str.saved))).Duration, ShouldEqual, 60*time.Millisecond)
+				So(str.marks[0].Start, ShouldEqual, 0)
+				So(str.marks[len(str.marks)-1].End, ShouldBeLessThanOrEqualTo, 60*time.Millisecond)
+			})
+
+			Convey("should mix the media and keep its marks in sync", func() {
+
+				str := &capturingStorage{}
+				engine := &Engine{crt: &wavConverter{}, str: str}
+				intro := testWav(8000, 1, 4000)
+
+				_, err := engine.Process("One two.", Metadata{Lang: "EN", Mix: &Mix{Intro: intro, Background: testWav(8000, 1, 80)}})
+
+				So(err, ShouldBeNil)
+				So(probe(str.saved, int64(len(str.saved))).Duration, ShouldEqual, 500*time.Millisecond+chunkDuration)
+				So(str.marks[0].Start, ShouldEqual, 500*time.Millisecond)
+			})
+
+			Convey("should read dialogues segment by segment and save their timings", func() {
+
+				crt := &wavConverter{supported: map[string][]string{"EN": {"Amy", "Mike"}, "PL": {"Zofia"}}}
+				str := &capturingStorage{}
+				engine := &Engine{crt: crt, str: str}
+
+				lex := lexicon.Lexicon{Entries: []lexicon.Entry{{Grapheme: "XJ9", Alias: "ex jay nine"}}}
+
+				_, err := engine.Process("", Metadata{Lang: "EN", Options: Options{Voice: "Amy"}, Segments: []Segment{
+					{Speaker: "agent", Text: "Your XJ9 is ready.", Lang: "EN", Lexicon: lex},
+					{Speaker: "customer", Text: "Dziękuję 2 razy.", Lang: "PL", Pause: 300 * time.Millisecond},
+					{Speaker: "agent", Text: "Bye.", Lang: "EN", Voice: "Mike"},
+				}})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 3)
+
+				// Parts are converted in parallel
+				read := map[string]string{}
+				for i, text := range crt.texts {
+					read[text] = crt.langs[i] + ":" + crt.voices[i]
+				}
+				So(read, ShouldResemble, map[string]string{"Your ex jay nine is ready.": "EN:Amy", "Dziękuję dwa razy.": "PL:", "Bye.": "EN:Mike"})
+
+				info := probe(str.saved, int64(len(str.saved)))
+				So(info.Duration, ShouldEqual, 3*chunkDuration+300*time.Millisecond)
+
+				segments := []Mark{}
+				for _, m := range str.marks {
+					if m.Type == MarkSegment {
+						segments = append(segments, m)
+					}
+				}
+
+				So(segments, ShouldResemble, []Mark{
+					{Type: MarkSegment, Text: "agent", Start: 0, End: chunkDuration},
+					{Type: MarkSegment, Text: "customer", Start: chunkDuration + 300*time.Millisecond, End: 2*chunkDuration + 300*time.Millisecond},
+					{Type: MarkSegment, Text: "agent", Start: 2*chunkDuration + 300*time.Millisecond, End: 3*chunkDuration + 300*time.Millisecond},
+				})
+			})
+
+			Convey("should save marks reported by the converter", func() {
+
+				str := &capturingStorage{}
+				engine := &Engine{crt: &markedWavConverter{}, str: str, maxChunkSize: 11}
+
+				_, err := engine.Process("First one. Second one.", Metadata{Lang: "EN"})
+
+				So(err, ShouldBeNil)
+				So(str.marks, ShouldResemble, []Mark{
+					{Type: MarkWord, Text: "First one.", Start: 0, End: 50 * time.Millisecond},
+					{Type: MarkWord, Text: "Second one.", Start: chunkDuration, End: chunkDuration + 50*time.Millisecond},
+				})
+			})
+
+			Convey("should reject invalid SSML", func() {
+
+				engine := &Engine{crt: &wavConverter{}, str: &capturingStorage{}}
+
+				_, err := engine.Process(`<speak><audio/></speak>`, Metadata{Lang: "EN", Ssml: true})
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("should reject SSML with nothing to read", func() {
+
+				engine := &Engine{crt: &wavConverter{}, str: &capturingStorage{}}
+
+				_, err := engine.Process(`<speak><break/></speak>`, Metadata{Lang: "EN", Ssml: true})
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("should not convert cached chunks again", func() {
+
+				crt := &wavConverter{}
+				cache := &mockChunkCache{media: map[string][]byte{}}
+				engine := &Engine{crt: crt, str: &capturingStorage{}, cache: cache, maxChunkSize: 20}
+
+				engine.Process("First paragraph.\n\nSecond paragraph.", Metadata{Lang: "EN"})
+				So(crt.texts, ShouldHaveLength, 2)
+
+				_, err := engine.Process("First paragraph.\n\nEdited paragraph.", Metadata{Lang: "EN"})
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 3)
+				So(crt.texts[2], ShouldEqual, "Edited paragraph.")
+			})
+
+			Convey("should re-encrypt cached chunks along with the media", func() {
+
+				cache := &mockChunkCache{media: map[string][]byte{}}
+				engine := &Engine{crt: &wavConverter{}, str: &capturingStorage{}, cache: cache}
+
+				_, err := engine.Rotate()
+
+				So(err, ShouldBeNil)
+				So(cache.rotated, ShouldBeTrue)
+			})
+
+			Convey("should convert only the variable fragments of rendered templates", func() {
+
+				crt := &wavConverter{}
+				cache := &mockChunkCache{media: map[string][]byte{}}
+				engine := &Engine{crt: crt, str: &capturingStorage{}, cache: cache}
+
+				engine.Process("", Metadata{Lang: "EN", Fragments: []string{"Your order ", "one", " ships today."}})
+				So(crt.texts, ShouldHaveLength, 3)
+
+				meta := Metadata{Lang: "EN", Fragments: []string{"Your order ", "two", " ships today."}}
+				_, err := engine.Process("", meta)
+
+				So(err, ShouldBeNil)
+				So(crt.texts, ShouldHaveLength, 4)
+				So(crt.texts[3], ShouldEqual, "two")
+				So(engine.Normalize("", meta), ShouldEqual, "Your order two ships today.")
+			})
+
+			Convey("should not use chunks cached for different metadata", func() {
+
+				So(chunkKey("text", Metadata{Lang: "EN"}), ShouldNotEqual, chunkKey("text", Metadata{Lang: "PL"}))
+			})
+		})
+
+		Convey("DetectLanguage method", func() {
+
+			engine := &Engine{crt: languagesConverter{"EN", "PL"}, detectionThreshold: 0.8}
+
+			Convey("should detect the language among the supported ones", func() {
+
+				detection := engine.DetectLanguage("Dziękujemy za zamówienie, przesyłka zostanie wysłana jutro.", Metadata{})
+
+				So(detection.Lang, ShouldEqual, "PL")
+				So(detection.Detected, ShouldEqual, "PL")
+				So(detection.Confidence, ShouldBeGreaterThan, 0.8)
+			})
+
+			Convey("should detect the language of SSML texts, ignoring markup", func() {
+
+				detection := engine.DetectLanguage(`<speak><prosody rate="slow">Dziękujemy za zamówienie</prosody><break/></speak>`, Metadata{Ssml: true})
+
+				So(detection.Lang, ShouldEqual, "PL")
+			})
+
+			Convey("should fall back to the first supported language, if the detection isn't confident", func() {
+
+				detection := engine.DetectLanguage("OK", Metadata{})
+
+				So(detection.Lang, ShouldEqual, "EN")
+				So(detection.Detected, ShouldNotBeEmpty)
+				So(detection.Confidence, ShouldBeLessThan, 0.8)
+			})
+
+			Convey("should fall back to the configured language", func() {
+
+				engine.fallbackLanguage = "PL"
+
+				detection := engine.DetectLanguage("12:30", Metadata{})
+
+				So(detection.Lang, ShouldEqual, "PL")
+				So(detection.Detected, ShouldBeEmpty)
+			})
+
+			Convey("should detect only languages supported by the converter", func() {
+
+				engine.crt = languagesConverter{"EN"}
+
+				detection := engine.DetectLanguage("Dziękujemy za zamówienie, przesyłka zostanie wysłana jutro.", Metadata{})
+
+				So(detection.Detected, ShouldEqual, "EN")
+			})
+		})
+
+		Convey("Marks method", func() {
+
+			Convey("should pass error from storage", func() {
+
+				engine := &Engine{str: mockStorage{failing: true}}
+
+				_, err := engine.Marks("dummyID")
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("should return marks of the media", func() {
+
+				engine := &Engine{str: mockStorage{}}
+
+				marks, err := engine.Marks("dummyID")
+
+				So(err, ShouldBeNil)
+				So(marks, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("Rendition method", func() {
+
+			wav := testWav(8000, 1, 8000)
+
+			Convey("should return media in its own format", func() {
+
+				engine := &Engine{str: &renditionStorage{media: wav}}
+
+				reader, info, err := engine.Rendition("dummyID", "wav")
+
+				So(err, ShouldBeNil)
+				So(info.MimeType, ShouldEqual, "audio/wav")
+				media, _ := ioutil.ReadAll(reader)
+				So(media, ShouldResemble, wav)
+			})
+
+			Convey("should transcode media and store the rendition", func() {
+
+				storage := &renditionStorage{media: wav}
+				engine := &Engine{str: storage}
+
+				reader, info, err := engine.Rendition("dummyID", "flac")
+
+				So(err, ShouldBeNil)
+				So(info.MimeType, ShouldEqual, "audio/flac")
+				So(info.Duration, ShouldEqual, time.Second)
+				media, _ := ioutil.ReadAll(reader)
+				So(storage.renditions["flac"], ShouldResemble, media)
+				So(info.Size, ShouldEqual, len(media))
+			})
+
+			Convey("should return stored rendition", func() {
+
+				engine := &Engine{str: &renditionStorage{media: wav, renditions: map[string][]byte{"flac": []byte("fLaC")}}}
+
+				reader, _, err := engine.Rendition("dummyID", "flac")
+
+				So(err, ShouldBeNil)
+				media, _ := ioutil.ReadAll(reader)
+				So(string(media), ShouldEqual, "fLaC")
+			})
+
+			Convey("should report media that can't be transcoded", func() {
+
+				// A-law
+				alaw := append([]byte{}, wav...)
+				binary.LittleEndian.PutUint16(alaw[20:22], 6)
+				engine := &Engine{str: &renditionStorage{media: alaw}}
+
+				_, _, err := engine.Rendition("dummyID", "flac")
+
+				So(err, ShouldHaveSameTypeAs, FormatError{})
+				So(err.Error(), ShouldEqual, "Media with ID: 'dummyID' can't be transcoded from wav to flac: Can't decode compressed WAV media")
+			})
+
+			Convey("should transcode MP3 media", func() {
+
+				mp3, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+				engine := &Engine{str: &renditionStorage{media: mp3}}
+
+				_, info, err := engine.Rendition("dummyID", "flac")
+
+				So(err, ShouldBeNil)
+				So(info.MimeType, ShouldEqual, "audio/flac")
+				So(info.Duration, ShouldEqual, 2736*time.Millisecond)
+			})
+
+			Convey("should pass error from storage", func() {
+
+				engine := &Engine{str: mockStorage{failing: true}}
+
+				_, _, err := engine.Rendition("dummyID", "flac")
+
+				So(err, ShouldNotBeNil)
+			})
 		})
 
 		Convey("GetResult method", func() {
 
 			Convey("should pass error from storage", func() {
 
-				engine := &Engine{mockConverter{false}, mockStorage{true}}
+				engine := &Engine{crt: mockConverter{false}, str: mockStorage{true}}
 
-				_, err := engine.Process("", Metadata{})
+				_, err := engine.Process("test", Metadata{})
 
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldEqual, storageErrorMessage)
@@ -59,9 +539,9 @@ func TestEngine(t *testing.T) {
 
 			Convey("should not blow if there are no errors", func() {
 
-				engine := &Engine{mockConverter{false}, mockStorage{false}}
+				engine := &Engine{crt: mockConverter{false}, str: mockStorage{false}}
 
-				_, err := engine.Process("", Metadata{})
+				_, err := engine.Process("test", Metadata{})
 
 				So(err, ShouldBeNil)
 			})
@@ -86,6 +566,174 @@ func (mc mockConverter) Convert(text string, metadata Metadata) (io.ReadCloser,
 	return ioutil.NopCloser(strings.NewReader("test")), nil
 }
 
+func (mc mockConverter) Capabilities() Capabilities {
+
+	return Capabilities{}
+}
+
+// languagesConverter supports the given languages
+type languagesConverter []string
+
+func (lc languagesConverter) Convert(text string, metadata Metadata) (io.ReadCloser, error) {
+
+	return ioutil.NopCloser(strings.NewReader("test")), nil
+}
+
+func (lc languagesConverter) Capabilities() Capabilities {
+
+	voices := map[string][]string{}
+	for _, lang := range lc {
+		voices[lang] = []string{}
+	}
+
+	return Capabilities{Voices: voices}
+}
+
+const chunkDuration = 100 * time.Millisecond
+
+// wavConverter returns WAV media of chunkDuration, with samples set to the text length
+type wavConverter struct {
+	sync.Mutex
+	texts  []string
+	langs  []string
+	voices []string
+
+	supported map[string][]string // voices by language
+}
+
+func (wc *wavConverter) Convert(text string, metadata Metadata) (io.ReadCloser, error) {
+
+	wc.Lock()
+	wc.texts = append(wc.texts, text)
+	wc.langs = append(wc.langs, metadata.Lang)
+	wc.voices = append(wc.voices, metadata.Voice)
+	wc.Unlock()
+
+	media := testWav(8000, 1, int(8000*chunkDuration/time.Second))
+	_, samples, _ := parseWav(media)
+	for i := range samples {
+		samples[i] = byte(len(text))
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(media)), nil
+}
+
+// ssmlWavConverter is a wavConverter supporting SSML
+type ssmlWavConverter struct {
+	wavConverter
+	documents []string
+}
+
+func (sc *ssmlWavConverter) ConvertSsml(document string, metadata Metadata) (io.ReadCloser, error) {
+
+	sc.Lock()
+	sc.documents = append(sc.documents, document)
+	sc.Unlock()
+
+	return ioutil.NopCloser(bytes.NewReader(testWav(8000, 1, 800))), nil
+}
+
+// markedWavConverter is a wavConverter reporting a single mark of each text
+type markedWavConverter struct {
+	wavConverter
+}
+
+func (mc *markedWavConverter) ConvertMarked(text string, metadata Metadata) (io.ReadCloser, []Mark, error) {
+
+	r, err := mc.Convert(text, metadata)
+
+	return r, []Mark{{Type: MarkWord, Text: text, End: 50 * time.Millisecond}}, err
+}
+
+func (wc *wavConverter) Capabilities() Capabilities {
+
+	return Capabilities{Voices: wc.supported, Formats: []string{"wav"}}
+}
+
+type mockChunkCache struct {
+	sync.Mutex
+	media   map[string][]byte
+	rotated bool
+}
+
+func (mc *mockChunkCache) Load(key string) ([]byte, bool) {
+
+	mc.Lock()
+	defer mc.Unlock()
+
+	media, ok := mc.media[key]
+	return media, ok
+}
+
+func (mc *mockChunkCache) Store(key string, media []byte) error {
+
+	mc.Lock()
+	defer mc.Unlock()
+
+	mc.media[key] = media
+	return nil
+}
+
+func (mc *mockChunkCache) Rotate() (int, error) {
+
+	mc.Lock()
+	defer mc.Unlock()
+
+	mc.rotated = true
+	return len(mc.media), nil
+}
+
+type capturingStorage struct {
+	mockStorage
+	saved []byte
+	marks []Mark
+}
+
+func (cs *capturingStorage) Save(data io.Reader) (string, error) {
+
+	saved, err := ioutil.ReadAll(data)
+	cs.saved = saved
+
+	return "dummyID", err
+}
+
+func (cs *capturingStorage) SaveMarks(id string, marks []Mark) error {
+
+	cs.marks = marks
+
+	return nil
+}
+
+type renditionStorage struct {
+	mockStorage
+	media      []byte
+	renditions map[string][]byte
+}
+
+func (rs *renditionStorage) Get(id string) (io.ReadCloser, error) {
+
+	return ioutil.NopCloser(bytes.NewReader(rs.media)), nil
+}
+
+func (rs *renditionStorage) SaveRendition(id string, format string, content []byte) error {
+
+	if rs.renditions == nil {
+		rs.renditions = map[string][]byte{}
+	}
+	rs.renditions[format] = content
+
+	return nil
+}
+
+func (rs *renditionStorage) Rendition(id string, format string) ([]byte, error) {
+
+	if content, ok := rs.renditions[format]; ok {
+		return content, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
 type mockStorage struct {
 	failing bool
 }
@@ -110,7 +758,67 @@ func (ms mockStorage) Get(id string) (io.ReadCloser, error) {
 	return ioutil.NopCloser(strings.NewReader("test")), nil
 }
 
+func (ms mockStorage) Info(id string) (*MediaInfo, error) {
+
+	if ms.failing {
+
+		return nil, errors.New(storageErrorMessage)
+	}
+
+	return &MediaInfo{MimeType: "audio/mpeg"}, nil
+}
+
+func (ms mockStorage) SaveMarks(id string, marks []Mark) error {
+
+	return nil
+}
+
+func (ms mockStorage) Marks(id string) ([]Mark, error) {
+
+	if ms.failing {
+
+		return nil, errors.New(storageErrorMessage)
+	}
+
+	return []Mark{{Type: MarkWord, Text: "test", End: time.Second}}, nil
+}
+
+func (ms mockStorage) SaveRendition(id string, format string, content []byte) error {
+
+	return nil
+}
+
+func (ms mockStorage) Rendition(id string, format string) ([]byte, error) {
+
+	return nil, os.ErrNotExist
+}
+
 func (ms mockStorage) Delete(id string) error {
 
 	return nil
 }
+
+func (ms mockStorage) List() ([]string, error) {
+
+	return []string{"dummyID"}, nil
+}
+
+func (ms mockStorage) Verify(id string) error {
+
+	return nil
+}
+
+func (ms mockStorage) Quarantine(id string) error {
+
+	return nil
+}
+
+func (ms mockStorage) Rotate() (int, error) {
+
+	return 0, nil
+}
+
+func (ms mockStorage) Migrate() (int, error) {
+
+	return 0, nil
+}
@@ -0,0 +1,155 @@
+package tts
+
+import (
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Mark is a timestamp of a word or a sentence read in the media, e.g. to show captions,
+// or of a segment of a dialogue, with the speaker as its text.
+type Mark struct {
+	Type  string // MarkWord, MarkSentence or MarkSegment
+	Text  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Types of marks
+const (
+	MarkWord     = "word"
+	MarkSentence = "sentence"
+	MarkSegment  = "segment"
+)
+
+// markConverter is a converter reporting the marks of the text it reads, relative to the start of the media.
+// Marks of other converters are estimated.
+type markConverter interface {
+	converter
+
+	ConvertMarked(text string, meta Metadata) (io.ReadCloser, []Mark, error)
+}
+
+// estimateMarks spreads the duration of the media over the words of the text, proportionally to their length.
+// Punctuation takes some time, as it's read with a pause. The estimate is rough, but good enough for captions.
+func estimateMarks(text string, lang string, d time.Duration) []Mark {
+
+	type word struct {
+		text   string
+		length int // letters and digits
+		weight int // including the pause after the word
+	}
+
+	sentences := [][]word{}
+	total := 0
+
+	for _, sentence := range splitSentences(strings.Join(strings.Fields(text), " "), lang) {
+
+		words := []word{}
+
+		for _, w := range strings.Fields(sentence) {
+
+			length := utf8.RuneCountInString(strings.TrimFunc(w, func(r rune) bool { return !isLetterOrDigit(r) }))
+			weight := length + 1 + punctuationPause(w)
+
+			words = append(words, word{w, length, weight})
+			total += weight
+		}
+
+		if len(words) > 0 {
+			sentences = append(sentences, words)
+		}
+	}
+
+	marks := []Mark{}
+
+	if total == 0 {
+		return marks
+	}
+
+	unit := float64(d) / float64(total)
+	position := 0
+
+	at := func(weight int) time.Duration {
+		return time.Duration(float64(weight) * unit)
+	}
+
+	for _, words := range sentences {
+
+		wordMarks := []Mark{}
+		texts := []string{}
+
+		for _, w := range words {
+
+			wordMarks = append(wordMarks, Mark{Type: MarkWord, Text: w.text, Start: at(position), End: at(position + w.length)})
+			texts = append(texts, w.text)
+			position += w.weight
+		}
+
+		// Sentences go before their words, so that the marks are ordered by their start
+		sentence := Mark{Type: MarkSentence, Text: strings.Join(texts, " "), Start: wordMarks[0].Start, End: wordMarks[len(wordMarks)-1].End}
+		marks = append(append(marks, sentence), wordMarks...)
+	}
+
+	return marks
+}
+
+// punctuationPause returns the weight of the pause after the word, in letters
+func punctuationPause(word string) int {
+
+	last, _ := utf8.DecodeLastRuneInString(strings.TrimRight(word, closingPunctuation))
+
+	switch {
+	case isTerminator(last):
+		return 6
+	case strings.ContainsRune(",;:–—", last):
+		return 3
+	default:
+		return 0
+	}
+}
+
+func isLetterOrDigit(r rune) bool {
+
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// shiftMarks moves the marks of a part of the media by its offset
+func shiftMarks(marks []Mark, offset time.Duration) []Mark {
+
+	shifted := make([]Mark, len(marks))
+
+	for i, m := range marks {
+		m.Start += offset
+		m.End += offset
+		shifted[i] = m
+	}
+
+	return shifted
+}
+
+// clampMarks limits the marks to the duration of the media, e.g. after its silence is trimmed
+func clampMarks(marks []Mark, d time.Duration) []Mark {
+
+	clamped := make([]Mark, len(marks))
+
+	for i, m := range marks {
+		if m.Start < 0 {
+			m.Start = 0
+		}
+		if m.Start > d {
+			m.Start = d
+		}
+		if m.End > d {
+			m.End = d
+		}
+		if m.End < m.Start {
+			m.End = m.Start
+		}
+		clamped[i] = m
+	}
+
+	return clamped
+}
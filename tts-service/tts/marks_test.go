@@ -0,0 +1,39 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMarks(t *testing.T) {
+
+	Convey("Marks estimation", t, func() {
+
+		Convey("should spread the duration over the words, proportionally to their length", func() {
+
+			// "Hi," 2 letters + 1 + a pause of 3 after the comma, "all." 3 + 1 + 6 after the sentence, "Hello!" 5 + 1 + 6
+			marks := estimateMarks("Hi, all. Hello!", "EN", 2800*time.Millisecond)
+
+			So(marks, ShouldResemble, []Mark{
+				{Type: MarkSentence, Text: "Hi, all.", Start: 0, End: 900 * time.Millisecond},
+				{Type: MarkWord, Text: "Hi,", Start: 0, End: 200 * time.Millisecond},
+				{Type: MarkWord, Text: "all.", Start: 600 * time.Millisecond, End: 900 * time.Millisecond},
+				{Type: MarkSentence, Text: "Hello!", Start: 1600 * time.Millisecond, End: 2100 * time.Millisecond},
+				{Type: MarkWord, Text: "Hello!", Start: 1600 * time.Millisecond, End: 2100 * time.Millisecond},
+			})
+		})
+
+		Convey("should return no marks for texts without words", func() {
+
+			So(estimateMarks(" ", "EN", time.Second), ShouldBeEmpty)
+		})
+
+		Convey("should move marks by the offset", func() {
+
+			marks := shiftMarks([]Mark{{Type: MarkWord, Text: "Hi", Start: 0, End: time.Second}}, time.Second)
+
+			So(marks, ShouldResemble, []Mark{{Type: MarkWord, Text: "Hi", Start: time.Second, End: 2 * time.Second}})
+		})
+	})
+}
@@ -0,0 +1,424 @@
+package tts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"strconv"
+	"time"
+)
+
+// MediaInfo describes a stored media.
+// It is computed while the media is being saved and kept alongside it.
+type MediaInfo struct {
+	MimeType   string
+	Codec      string
+	SampleRate int
+	Channels   int
+	Duration   time.Duration
+	Size       int64
+	Checksum   string // hex encoded SHA-256 of the media content
+}
+
+// mediaInspector is an io.Writer collecting MediaInfo of the data written to it.
+// It keeps only the beginning of the stream, which is enough to recognize the format.
+type mediaInspector struct {
+	head []byte
+	size int64
+	hash hash.Hash
+}
+
+func newMediaInspector() *mediaInspector {
+
+	return &mediaInspector{hash: sha256.New()}
+}
+
+func (mi *mediaInspector) Write(p []byte) (int, error) {
+
+	if missing := inspectedHeadSize - len(mi.head); missing > 0 {
+
+		if missing > len(p) {
+			missing = len(p)
+		}
+		mi.head = append(mi.head, p[:missing]...)
+	}
+
+	mi.size += int64(len(p))
+	mi.hash.Write(p)
+
+	return len(p), nil
+}
+
+// Info returns the MediaInfo of all the data written so far.
+func (mi *mediaInspector) Info() *MediaInfo {
+
+	info := probe(mi.head, mi.size)
+	info.Size = mi.size
+	info.Checksum = hex.EncodeToString(mi.hash.Sum(nil))
+
+	return info
+}
+
+// inspect returns the MediaInfo of the whole media.
+func inspect(media []byte) *MediaInfo {
+
+	inspector := newMediaInspector()
+	inspector.Write(media)
+
+	return inspector.Info()
+}
+
+// How many bytes from the beginning of the media are used to recognize its format
+const inspectedHeadSize = 64 * 1024
+
+// probe recognizes the media format based on its beginning and total size.
+// Unknown formats are reported as application/octet-stream.
+func probe(head []byte, size int64) *MediaInfo {
+
+	switch {
+
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+
+		if info := probeWav(head, size); info != nil {
+			return info
+		}
+
+	case len(head) >= 4 && string(head[0:4]) == "OggS":
+
+		return probeOgg(head, size)
+
+	case len(head) >= 4 && string(head[0:4]) == "fLaC":
+
+		return probeFlac(head)
+
+	default:
+
+		if info := probeMp3(head, size); info != nil {
+			return info
+		}
+	}
+
+	return &MediaInfo{MimeType: "application/octet-stream"}
+}
+
+// http://soundfile.sapp.org/doc/WaveFormat/
+func probeWav(head []byte, size int64) *MediaInfo {
+
+	var info *MediaInfo
+	var byteRate int64
+
+	for pos := 12; pos+8 <= len(head); {
+
+		chunkId := string(head[pos : pos+4])
+		chunkSize := int64(binary.LittleEndian.Uint32(head[pos+4 : pos+8]))
+		body := head[pos+8:]
+
+		switch chunkId {
+
+		case "fmt ":
+
+			if len(body) < 16 {
+				return nil
+			}
+
+			info = &MediaInfo{
+				MimeType:   "audio/wav",
+				Codec:      "pcm_s16le",
+				Channels:   int(binary.LittleEndian.Uint16(body[2:4])),
+				SampleRate: int(binary.LittleEndian.Uint32(body[4:8])),
+			}
+			byteRate = int64(binary.LittleEndian.Uint32(body[8:12]))
+
+			if bits := binary.LittleEndian.Uint16(body[14:16]); bits != 16 {
+				info.Codec = "pcm_" + strconv.Itoa(int(bits))
+			}
+
+		case "data":
+
+			if info == nil {
+				return nil
+			}
+
+			// Streamed WAVs often have an unknown (zero or maximum) data size
+			dataSize := size - int64(pos+8)
+			if chunkSize > 0 && chunkSize < dataSize {
+				dataSize = chunkSize
+			}
+
+			if byteRate > 0 {
+				info.Duration = time.Duration(dataSize * int64(time.Second) / byteRate)
+			}
+			return info
+		}
+
+		// Chunks are word aligned
+		pos += 8 + int(chunkSize) + int(chunkSize&1)
+	}
+
+	return info
+}
+
+func probeOgg(head []byte, size int64) *MediaInfo {
+
+	info := &MediaInfo{MimeType: "audio/ogg"}
+
+	switch {
+	case bytes.Contains(head, []byte("OpusHead")):
+		info.Codec = "opus"
+		probeOpus(head, size, info)
+	case bytes.Contains(head, []byte("\x01vorbis")):
+		info.Codec = "vorbis"
+	}
+
+	return info
+}
+
+// https://tools.ietf.org/html/rfc7845
+// The duration is known from the granule position of the last page, which is in the head of short media only.
+func probeOpus(head []byte, size int64, info *MediaInfo) {
+
+	var preSkip, granule int64
+	var audioStart, end int
+
+	for pos, page := 0, 0; pos+27 <= len(head) && string(head[pos:pos+4]) == "OggS"; page++ {
+
+		segments := int(head[pos+26])
+		body := pos + 27 + segments
+		if body > len(head) {
+			break
+		}
+
+		length := 0
+		for _, lacing := range head[pos+27 : body] {
+			length += int(lacing)
+		}
+		if body+length > len(head) {
+			break
+		}
+
+		switch page {
+		case 0:
+			// The first page holds the identification header only
+			if packet := head[body : body+length]; len(packet) >= 19 && string(packet[0:8]) == "OpusHead" {
+				info.Channels = int(packet[9])
+				info.SampleRate = 48000 // whatever the rate of the input was
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+			}
+		case 1:
+			audioStart = body + length
+		default:
+			granule = int64(binary.LittleEndian.Uint64(head[pos+6 : pos+14]))
+			end = body + length
+		}
+
+		pos = body + length
+	}
+
+	if end <= audioStart || granule <= preSkip {
+		return
+	}
+
+	samples := granule - preSkip
+
+	// Longer media don't fit in the head, their bitrate is assumed constant
+	if int64(end) < size {
+		samples = samples * (size - int64(audioStart)) / int64(end-audioStart)
+	}
+
+	info.Duration = time.Duration(samples * int64(time.Second) / 48000)
+}
+
+// https://xiph.org/flac/format.html#metadata_block_streaminfo
+func probeFlac(head []byte) *MediaInfo {
+
+	info := &MediaInfo{MimeType: "audio/flac", Codec: "flac"}
+
+	if len(head) < 8+18 || head[4]&0x7f != 0 {
+		return info
+	}
+
+	streamInfo := head[8:]
+	info.SampleRate = int(streamInfo[10])<<12 | int(streamInfo[11])<<4 | int(streamInfo[12])>>4
+	info.Channels = int(streamInfo[12]>>1&0x07) + 1
+
+	samples := int64(streamInfo[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(streamInfo[14:18]))
+	if info.SampleRate > 0 {
+		info.Duration = time.Duration(samples * int64(time.Second) / int64(info.SampleRate))
+	}
+
+	return info
+}
+
+// http://www.mp3-tech.org/programmer/frame_header.html
+func probeMp3(head []byte, size int64) *MediaInfo {
+
+	start := skipId3(head)
+
+	for pos := start; pos+4 <= len(head); pos++ {
+
+		frame, ok := parseMp3Header(head[pos:])
+		if !ok {
+			continue
+		}
+
+		info := &MediaInfo{
+			MimeType:   "audio/mpeg",
+			Codec:      "mp3",
+			SampleRate: frame.sampleRate,
+			Channels:   frame.channels,
+		}
+
+		// The Xing/Info header (if present) knows the exact number of frames
+		if frames := xingFrames(head[pos:], frame); frames > 0 {
+			samples := int64(frames) * int64(frame.samplesPerFrame)
+			info.Duration = time.Duration(samples * int64(time.Second) / int64(frame.sampleRate))
+			return info
+		}
+
+		// Otherwise assume a constant bitrate
+		if frame.bitrate > 0 {
+			bits := (size - int64(pos)) * 8
+			info.Duration = time.Duration(bits * int64(time.Second) / int64(frame.bitrate))
+		}
+		return info
+	}
+
+	return nil
+}
+
+type mp3Frame struct {
+	mpeg1           bool
+	bitrate         int // bits per second
+	sampleRate      int
+	channels        int
+	padding         int
+	samplesPerFrame int
+}
+
+// Frame length in bytes, header included
+func (f mp3Frame) length() int {
+
+	if f.mpeg1 {
+		return 144*f.bitrate/f.sampleRate + f.padding
+	}
+	return 72*f.bitrate/f.sampleRate + f.padding
+}
+
+// parseMp3Header parses MPEG audio Layer III frame header.
+// Other layers are not produced by TTS providers, so they are not recognized.
+func parseMp3Header(b []byte) (mp3Frame, bool) {
+
+	var frame mp3Frame
+
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return frame, false
+	}
+
+	version := (b[1] >> 3) & 0x03 // 0 - MPEG 2.5, 2 - MPEG 2, 3 - MPEG 1
+	layer := (b[1] >> 1) & 0x03   // 1 - Layer III
+	bitrateIdx := b[2] >> 4
+	sampleRateIdx := (b[2] >> 2) & 0x03
+
+	if version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || sampleRateIdx == 3 {
+		return frame, false
+	}
+
+	frame.mpeg1 = version == 3
+	frame.padding = int(b[2]>>1) & 0x01
+	frame.channels = 2
+	if b[3]>>6 == 3 {
+		frame.channels = 1
+	}
+
+	sampleRate := []int{44100, 48000, 32000}[sampleRateIdx]
+
+	if frame.mpeg1 {
+		frame.bitrate = mpeg1Bitrates[bitrateIdx] * 1000
+		frame.sampleRate = sampleRate
+		frame.samplesPerFrame = 1152
+	} else {
+		frame.bitrate = mpeg2Bitrates[bitrateIdx] * 1000
+		frame.sampleRate = sampleRate / 2
+		if version == 0 {
+			frame.sampleRate = sampleRate / 4
+		}
+		frame.samplesPerFrame = 576
+	}
+
+	return frame, true
+}
+
+var mpeg1Bitrates = []int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+var mpeg2Bitrates = []int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}
+
+// xingFrames returns the number of frames declared by the Xing/Info header, or 0 if there is none.
+func xingFrames(b []byte, frame mp3Frame) int {
+
+	offset := xingOffset(frame)
+
+	if !isXing(b, frame) || len(b) < offset+12 {
+		return 0
+	}
+
+	flags := binary.BigEndian.Uint32(b[offset+4 : offset+8])
+
+	if flags&0x01 == 0 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint32(b[offset+8 : offset+12]))
+}
+
+// isXing tells whether the frame holds the Xing/Info header
+func isXing(b []byte, frame mp3Frame) bool {
+
+	offset := xingOffset(frame)
+
+	if len(b) < offset+4 {
+		return false
+	}
+
+	tag := string(b[offset : offset+4])
+
+	return tag == "Xing" || tag == "Info"
+}
+
+// The Xing/Info header is placed right after the side information
+func xingOffset(frame mp3Frame) int {
+
+	return 4 + sideInfoLength(frame)
+}
+
+// sideInfoLength returns the length of the side information of Layer III frames, following the header
+func sideInfoLength(frame mp3Frame) int {
+
+	switch {
+	case frame.mpeg1 && frame.channels == 1, !frame.mpeg1 && frame.channels == 2:
+		return 17
+	case frame.mpeg1:
+		return 32
+	default:
+		return 9
+	}
+}
+
+// skipId3 returns the position right after the ID3v2 tag, if any.
+func skipId3(b []byte) int {
+
+	if len(b) < 10 || string(b[0:3]) != "ID3" {
+		return 0
+	}
+
+	// Size is stored as a 28 bit "syncsafe" integer
+	size := int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f)
+	size += 10
+
+	// Footer present
+	if b[5]&0x10 != 0 {
+		size += 10
+	}
+
+	return size
+}
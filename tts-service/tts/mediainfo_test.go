@@ -0,0 +1,105 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMediaInfo(t *testing.T) {
+
+	Convey("Media inspector", t, func(c C) {
+
+		Convey("should recognize MP3 media", func() {
+
+			fc, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+
+			inspector := newMediaInspector()
+			inspector.Write(fc)
+			info := inspector.Info()
+
+			So(info.MimeType, ShouldEqual, "audio/mpeg")
+			So(info.Codec, ShouldEqual, "mp3")
+			So(info.SampleRate, ShouldEqual, 8000)
+			So(info.Channels, ShouldEqual, 1)
+			So(info.Duration, ShouldEqual, 2736*time.Millisecond)
+			So(info.Size, ShouldEqual, len(fc))
+			So(info.Checksum, ShouldHaveLength, 64)
+		})
+
+		Convey("should recognize WAV media", func() {
+
+			inspector := newMediaInspector()
+			inspector.Write(testWav(16000, 1, 8000))
+			info := inspector.Info()
+
+			So(info.MimeType, ShouldEqual, "audio/wav")
+			So(info.Codec, ShouldEqual, "pcm_s16le")
+			So(info.SampleRate, ShouldEqual, 16000)
+			So(info.Channels, ShouldEqual, 1)
+			So(info.Duration, ShouldEqual, 500*time.Millisecond)
+		})
+
+		Convey("should recognize Ogg Opus media", func() {
+
+			audio := pcm{sampleRate: 16000, channels: 2, bitsPerSample: 16, samples: make([]int32, 2*8000)}
+
+			info := inspect(encodeOpus(audio))
+
+			So(info.MimeType, ShouldEqual, "audio/ogg")
+			So(info.Codec, ShouldEqual, "opus")
+			So(info.SampleRate, ShouldEqual, 48000)
+			So(info.Channels, ShouldEqual, 2)
+			So(info.Duration, ShouldEqual, 500*time.Millisecond)
+		})
+
+		Convey("should estimate the duration of Ogg Opus media longer than the inspected head", func() {
+
+			audio := pcm{sampleRate: 48000, channels: 1, bitsPerSample: 16, samples: make([]int32, 48000*20)}
+
+			media := encodeOpus(audio)
+			So(len(media), ShouldBeGreaterThan, inspectedHeadSize)
+
+			info := inspect(media)
+
+			So(info.Duration, ShouldBeBetween, 19*time.Second, 21*time.Second)
+		})
+
+		Convey("should describe unknown media as a binary stream", func() {
+
+			inspector := newMediaInspector()
+			inspector.Write([]byte("whatever"))
+			info := inspector.Info()
+
+			So(info.MimeType, ShouldEqual, "application/octet-stream")
+			So(info.Size, ShouldEqual, 8)
+		})
+	})
+}
+
+// testWav creates a silent, 16 bit WAV media
+func testWav(sampleRate, channels, samples int) []byte {
+
+	dataSize := samples * channels * 2
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+dataSize))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * 2), uint16(channels * 2), uint16(16),
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(dataSize))
+	b.Write(make([]byte, dataSize))
+
+	return b.Bytes()
+}
@@ -0,0 +1,199 @@
+package tts
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Mix describes the audio mixed with the speech, e.g. for IVR greetings.
+// The tracks are WAV media, converted to the format of the speech.
+type Mix struct {
+	Background []byte  // Looped under the speech, optional
+	Intro      []byte  // Played before the speech, optional
+	Outro      []byte  // Played after the speech, optional
+	Volume     float64 // Gain of the background in dB, e.g. -12
+	Ducking    float64 // The background is lowered by this many dB while the speech is heard
+}
+
+// CanMix tells if the media can be mixed with the speech, i.e. it's uncompressed WAV.
+// It returns the reason why it can't, if so.
+func CanMix(media []byte) error {
+
+	_, err := decodePcm(media)
+
+	return err
+}
+
+// Speech louder than this, in dBFS, ducks the background
+const duckingThreshold = -40.0
+
+// How fast the background is lowered when the speech starts, and raised again when it stops
+const (
+	duckingAttack  = 50 * time.Millisecond
+	duckingRelease = 400 * time.Millisecond
+)
+
+// The background fades in and out, so that it doesn't start or stop abruptly
+const backgroundFade = 500 * time.Millisecond
+
+// mix puts the speech between the intro and the outro, over the background.
+// It returns the mixed media, the time the speech starts at and an error, if any.
+func mix(media []byte, m Mix) ([]byte, time.Duration, error) {
+
+	speech, err := decodePcm(media)
+
+	if err != nil {
+
+		return nil, 0, fmt.Errorf("Can't mix the speech: %v", err)
+	}
+
+	tracks := map[string]*pcm{}
+
+	for name, track := range map[string][]byte{"background": m.Background, "intro": m.Intro, "outro": m.Outro} {
+
+		if track == nil {
+			continue
+		}
+
+		audio, err := decodePcm(track)
+
+		if err != nil {
+
+			return nil, 0, fmt.Errorf("Can't mix the %s: %v", name, err)
+		}
+
+		conformed := conform(audio, speech)
+		tracks[name] = &conformed
+	}
+
+	if background := tracks["background"]; background != nil && background.frames() > 0 {
+		speech.samples = underlay(speech, *background, m.Volume, m.Ducking)
+	}
+
+	var start time.Duration
+	samples := []int32{}
+
+	if intro := tracks["intro"]; intro != nil {
+		samples = append(samples, intro.samples...)
+		start = intro.duration(intro.frames())
+	}
+
+	samples = append(samples, speech.samples...)
+
+	if outro := tracks["outro"]; outro != nil {
+		samples = append(samples, outro.samples...)
+	}
+
+	speech.samples = samples
+
+	return encodeWav(speech), start, nil
+}
+
+// underlay mixes the background, looped for the whole speech, under the speech.
+// The background is ducked while the speech is heard.
+func underlay(speech pcm, background pcm, volume float64, ducking float64) []int32 {
+
+	frames := speech.frames()
+
+	// The background looped for the whole speech
+	looped := background
+	looped.samples = make([]int32, len(speech.samples))
+	for i := range looped.samples {
+		looped.samples[i] = background.samples[i%len(background.samples)]
+	}
+	looped = fade(backgroundFade)(looped)
+
+	threshold := math.Pow(10, duckingThreshold/20) * fullScale(speech.bitsPerSample)
+	gain := math.Pow(10, volume/20)
+	ducked := math.Pow(10, -math.Abs(ducking)/20)
+
+	// Speech is detected in blocks, so that the pauses between the words don't raise the background
+	block := maxInt(speech.frame(20*time.Millisecond), 1)
+	attack := smoothing(duckingAttack, speech.sampleRate)
+	release := smoothing(duckingRelease, speech.sampleRate)
+
+	samples := make([]int32, len(speech.samples))
+	current, target := 1.0, 1.0
+
+	for frame := 0; frame < frames; frame++ {
+
+		if frame%block == 0 {
+			target = 1.0
+			if peakOf(speech, frame, minInt(frame+block, frames)) > threshold {
+				target = ducked
+			}
+		}
+
+		if target < current {
+			current += (target - current) * attack
+		} else {
+			current += (target - current) * release
+		}
+
+		for c := 0; c < speech.channels; c++ {
+			i := frame*speech.channels + c
+			samples[i] = clip(float64(speech.samples[i])+float64(looped.samples[i])*gain*current, speech.bitsPerSample)
+		}
+	}
+
+	return samples
+}
+
+// smoothing returns the coefficient of a one-pole filter reaching 63% of a change in the given time
+func smoothing(d time.Duration, sampleRate int) float64 {
+
+	return 1 - math.Exp(-1/(d.Seconds()*float64(sampleRate)))
+}
+
+// peakOf returns the magnitude of the loudest sample of the frames
+func peakOf(audio pcm, from, to int) float64 {
+
+	peak := 0.0
+
+	for _, s := range audio.samples[from*audio.channels : to*audio.channels] {
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+
+	return peak
+}
+
+// conform converts the audio to the sample rate, channels and sample size of the reference audio.
+func conform(audio pcm, reference pcm) pcm {
+
+	audio = resample(reference.sampleRate)(audio)
+
+	frames := audio.frames()
+	scale := fullScale(reference.bitsPerSample) / fullScale(audio.bitsPerSample)
+	samples := make([]int32, frames*reference.channels)
+
+	for frame := 0; frame < frames; frame++ {
+
+		in := audio.samples[frame*audio.channels : (frame+1)*audio.channels]
+
+		for c := 0; c < reference.channels; c++ {
+
+			var sample float64
+
+			switch {
+			case audio.channels == reference.channels:
+				sample = float64(in[c])
+			case reference.channels == 1:
+				// Downmixed to mono
+				for _, s := range in {
+					sample += float64(s) / float64(audio.channels)
+				}
+			default:
+				sample = float64(in[c%audio.channels])
+			}
+
+			samples[frame*reference.channels+c] = clip(sample*scale, reference.bitsPerSample)
+		}
+	}
+
+	audio.channels = reference.channels
+	audio.bitsPerSample = reference.bitsPerSample
+	audio.samples = samples
+
+	return audio
+}
@@ -0,0 +1,77 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMix(t *testing.T) {
+
+	Convey("Mixing", t, func() {
+
+		Convey("should put the speech between the jingles", func() {
+
+			speech := testWav(8000, 1, 8000)
+			intro := encodeWav(tone(16000, 2, 440, 0.5, 500*time.Millisecond))
+			outro := testWav(8000, 1, 2000)
+
+			media, start, err := mix(speech, Mix{Intro: intro, Outro: outro})
+
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 500*time.Millisecond)
+
+			info := probe(media, int64(len(media)))
+			So(info.SampleRate, ShouldEqual, 8000)
+			So(info.Channels, ShouldEqual, 1)
+			So(info.Duration, ShouldEqual, 1750*time.Millisecond)
+		})
+
+		Convey("should duck the background while the speech is heard", func() {
+
+			speech := pcm{sampleRate: 8000, channels: 1, bitsPerSample: 16, samples: make([]int32, 8000*2)}
+			speech.samples = append(speech.samples, tone(8000, 1, 440, 0.5, 2*time.Second).samples...)
+
+			background := pcm{sampleRate: 8000, channels: 1, bitsPerSample: 16}
+			for i := 0; i < 8000; i++ {
+				background.samples = append(background.samples, 1000)
+			}
+
+			samples := underlay(speech, background, -6, 12)
+
+			// In the silence, after the background faded in
+			So(samples[8000], ShouldAlmostEqual, 1000*math.Pow(10, -6.0/20), 1)
+
+			// In the speech, after the ducking settled
+			ducked := samples[3*8000] - speech.samples[3*8000]
+			So(ducked, ShouldAlmostEqual, 1000*math.Pow(10, -18.0/20), 2)
+		})
+
+		Convey("should conform tracks to the format of the speech", func() {
+
+			track := pcm{sampleRate: 8000, channels: 2, bitsPerSample: 8, samples: []int32{10, 30, -10, -30}}
+
+			conformed := conform(track, pcm{sampleRate: 8000, channels: 1, bitsPerSample: 16})
+
+			So(conformed.channels, ShouldEqual, 1)
+			So(conformed.bitsPerSample, ShouldEqual, 16)
+			So(conformed.samples, ShouldResemble, []int32{20 * 256, -20 * 256})
+		})
+
+		Convey("should reject tracks that can't be mixed", func() {
+
+			mp3, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+
+			So(CanMix(mp3), ShouldNotBeNil)
+			So(CanMix(testWav(8000, 1, 800)), ShouldBeNil)
+
+			_, _, err := mix(testWav(8000, 1, 800), Mix{Background: mp3})
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Can't mix the background: Can't decode mp3 media")
+		})
+	})
+}
@@ -0,0 +1,1040 @@
+package tts
+
+import (
+	"errors"
+	"math"
+)
+
+// decodeMp3 decodes MPEG audio Layer III media into 16 bit samples.
+// All the versions recognized by parseMp3Header are decoded, following ISO/IEC 11172-3 and 13818-3 (2.4.3.4).
+// Frames whose main data is missing, e.g. when the beginning of the media was cut, are played as silence.
+func decodeMp3(media []byte) (pcm, error) {
+
+	audio := pcm{bitsPerSample: 16}
+	d := &mp3Decoder{}
+
+	for pos := skipId3(media); pos+4 <= len(media); {
+
+		frame, ok := parseMp3Header(media[pos:])
+
+		// Frames of another stream are false syncs, e.g. in a tag at the end
+		ok = ok && pos+frame.length() <= len(media)
+		ok = ok && (audio.sampleRate == 0 || frame.sampleRate == audio.sampleRate && frame.channels == audio.channels)
+
+		if !ok {
+			pos++
+			continue
+		}
+
+		b := media[pos : pos+frame.length()]
+		pos += frame.length()
+
+		if audio.sampleRate == 0 {
+
+			audio.sampleRate, audio.channels = frame.sampleRate, frame.channels
+
+			// The Xing/Info header is a frame without audio
+			if isXing(b, frame) {
+				continue
+			}
+		}
+
+		audio.samples = append(audio.samples, d.decodeFrame(b, frame)...)
+	}
+
+	if audio.sampleRate == 0 {
+
+		return audio, errors.New("Invalid MP3 media")
+	}
+
+	return audio, nil
+}
+
+// Coefficients of a granule of a channel, decoded into as many samples
+const mp3GranuleSize = 576
+
+// Block types of a granule
+const (
+	mp3NormalBlock = iota
+	mp3StartBlock
+	mp3ShortBlock
+	mp3StopBlock
+)
+
+// mp3Decoder keeps the state carried over from a frame to the next one
+type mp3Decoder struct {
+	reservoir    []byte                     // main data of the previous frames, see mainData
+	scalefactors [2][]int                   // of the first granule, reused by the second one, see readScalefactors
+	overlap      [2][mp3GranuleSize]float64 // second halves of the IMDCT outputs, added to the next granule
+	filterbank   [2][1024]float64           // the polyphase synthesis filterbank
+	offset       [2]int                     // of the filterbank
+}
+
+// mp3Granule is the side information of a granule of a channel
+type mp3Granule struct {
+	part23Length     int // bits of the scalefactors and the Huffman coded values
+	bigValues        int // pairs of values coded with tableSelect
+	globalGain       int
+	scalefacCompress int
+	blockType        int
+	mixed            bool // the lowest 2 subbands are long blocks
+	tableSelect      [3]int
+	subblockGain     [3]int
+	region0Count     int
+	region1Count     int
+	preflag          bool
+	scalefacScale    int
+	count1Table      int
+	scfsi            [4]bool // MPEG-1 only: the groups of scalefactors reused from the first granule
+}
+
+// decodeFrame returns the interleaved samples of the frame
+func (d *mp3Decoder) decodeFrame(b []byte, frame mp3Frame) []int32 {
+
+	channels := frame.channels
+	granules := frame.samplesPerFrame / mp3GranuleSize
+	jointStereo := b[3]>>6 == 1
+	msStereo := jointStereo && b[3]&0x20 != 0
+	intensityStereo := jointStereo && b[3]&0x10 != 0
+
+	start := 4
+
+	// Protected by CRC
+	if b[1]&0x01 == 0 {
+		start += 2
+	}
+
+	begin, side := readSideInfo(&bitReader{buf: b[start:]}, frame)
+	data, ok := d.mainData(b[start+sideInfoLength(frame):], begin)
+
+	r := &bitReader{buf: data}
+	bands := mp3Bands[frame.sampleRate]
+	samples := make([]int32, frame.samplesPerFrame*channels)
+
+	for gr := 0; gr < granules; gr++ {
+
+		var xr [2][mp3GranuleSize]float64
+		var widths [2][]int
+		var long [2]int
+		var positions []int
+
+		for ch := 0; ch < channels; ch++ {
+
+			g := &side[gr][ch]
+			widths[ch], long[ch] = g.bandWidths(bands)
+
+			if !ok {
+				continue
+			}
+
+			end := r.pos + g.part23Length
+
+			var scalefactors []int
+
+			if frame.mpeg1 {
+				scalefactors = d.readScalefactors(r, g, gr, ch, len(widths[ch]))
+				positions = mpeg1Positions(scalefactors)
+			} else {
+				scalefactors, positions = readLsfScalefactors(r, g, intensityStereo && ch == 1, len(widths[ch]))
+			}
+
+			values := readHuffman(r, g, widths[ch], end)
+			requantize(&xr[ch], &values, g, scalefactors, widths[ch], long[ch])
+
+			r.pos = end
+		}
+
+		if channels == 2 && (msStereo || intensityStereo) {
+
+			s := mp3Stereo{ms: msStereo, intensity: intensityStereo, mpeg1: frame.mpeg1, intensityScale: side[gr][1].scalefacCompress & 1}
+			s.apply(&xr, widths[0], long[0], positions)
+		}
+
+		for ch := 0; ch < channels; ch++ {
+
+			out := d.synthesize(ch, &xr[ch], &side[gr][ch], widths[ch], long[ch])
+
+			for i, sample := range out {
+				samples[(gr*mp3GranuleSize+i)*channels+ch] = toInt16(sample)
+			}
+		}
+	}
+
+	return samples
+}
+
+// readSideInfo returns the position of the main data (bytes before the end of the side information,
+// see mainData) and the side information of the granules of the channels
+func readSideInfo(r *bitReader, frame mp3Frame) (int, [2][2]mp3Granule) {
+
+	var side [2][2]mp3Granule
+	var begin int
+
+	if frame.mpeg1 {
+
+		begin = int(r.read(9))
+		r.read(7 - 2*frame.channels) // private bits
+
+		for ch := 0; ch < frame.channels; ch++ {
+			for group := 0; group < 4; group++ {
+				scfsi := r.read(1) == 1
+				side[0][ch].scfsi[group], side[1][ch].scfsi[group] = scfsi, scfsi
+			}
+		}
+	} else {
+
+		begin = int(r.read(8))
+		r.read(frame.channels) // private bits
+	}
+
+	for gr := 0; gr < frame.samplesPerFrame/mp3GranuleSize; gr++ {
+
+		for ch := 0; ch < frame.channels; ch++ {
+
+			g := &side[gr][ch]
+			g.part23Length = int(r.read(12))
+			g.bigValues = int(r.read(9))
+			g.globalGain = int(r.read(8))
+
+			if frame.mpeg1 {
+				g.scalefacCompress = int(r.read(4))
+			} else {
+				g.scalefacCompress = int(r.read(9))
+			}
+
+			// Window switching
+			if r.read(1) == 1 {
+
+				g.blockType = int(r.read(2))
+				g.mixed = r.read(1) == 1
+
+				for i := 0; i < 2; i++ {
+					g.tableSelect[i] = int(r.read(5))
+				}
+				for i := 0; i < 3; i++ {
+					g.subblockGain[i] = int(r.read(3))
+				}
+
+				// The regions are implicit, the second one covering the rest of the big values
+				g.region0Count, g.region1Count = 7, mp3GranuleSize
+				if g.blockType == mp3ShortBlock && !g.mixed {
+					g.region0Count = 8
+				}
+			} else {
+
+				for i := 0; i < 3; i++ {
+					g.tableSelect[i] = int(r.read(5))
+				}
+				g.region0Count = int(r.read(4))
+				g.region1Count = int(r.read(3))
+			}
+
+			if frame.mpeg1 {
+				g.preflag = r.read(1) == 1
+			}
+			g.scalefacScale = int(r.read(1))
+			g.count1Table = int(r.read(1))
+		}
+	}
+
+	return begin, side
+}
+
+// The main data of a frame begins up to 511 bytes before the frame, in the main data of the previous frames
+const mp3MaxReservoir = 511
+
+// mainData returns the main data of the frame, which begins the given number of bytes before the frame data.
+// It returns false if the previous frames are missing.
+func (d *mp3Decoder) mainData(frameData []byte, begin int) ([]byte, bool) {
+
+	var data []byte
+	ok := begin <= len(d.reservoir)
+
+	if ok {
+		data = append(append(data, d.reservoir[len(d.reservoir)-begin:]...), frameData...)
+	}
+
+	d.reservoir = append(d.reservoir, frameData...)
+	if len(d.reservoir) > mp3MaxReservoir {
+		d.reservoir = append([]byte(nil), d.reservoir[len(d.reservoir)-mp3MaxReservoir:]...)
+	}
+
+	return data, ok
+}
+
+// bandWidths returns the widths of the scalefactor bands of the granule in the order of its coefficients,
+// each short band repeated for its 3 windows, and how many of them are long bands.
+func (g *mp3Granule) bandWidths(bands mp3BandWidths) ([]int, int) {
+
+	if g.blockType != mp3ShortBlock {
+
+		return bands.long, len(bands.long)
+	}
+
+	var widths []int
+	short := bands.short
+
+	if g.mixed {
+
+		// The long bands of the lowest 2 subbands, followed by the short bands of the rest of them
+		covered := 0
+		for i := 0; covered < 36; i++ {
+			widths = append(widths, bands.long[i])
+			covered += bands.long[i]
+		}
+
+		for covered = 0; covered+short[0] <= 36/3; short = short[1:] {
+			covered += short[0]
+		}
+		if covered < 36/3 {
+			short = append([]int{covered + short[0] - 36/3}, short[1:]...)
+		}
+	}
+
+	long := len(widths)
+
+	for _, width := range short {
+		widths = append(widths, width, width, width)
+	}
+
+	return widths, long
+}
+
+// readScalefactors reads the MPEG-1 scalefactors of the bands, reusing the ones of the first granule if scfsi is set.
+func (d *mp3Decoder) readScalefactors(r *bitReader, g *mp3Granule, gr int, ch int, count int) []int {
+
+	slen := mp3Slen[g.scalefacCompress]
+	scalefactors := make([]int, count)
+
+	if g.blockType == mp3ShortBlock {
+
+		i, first := 0, 0
+
+		if g.mixed {
+			for ; i < 8; i++ {
+				scalefactors[i] = int(r.read(slen[0]))
+			}
+			first = 3
+		}
+
+		for band := first; band < 12; band++ {
+
+			bits := slen[0]
+			if band >= 6 {
+				bits = slen[1]
+			}
+
+			for window := 0; window < 3; window++ {
+				scalefactors[i] = int(r.read(bits))
+				i++
+			}
+		}
+
+		return scalefactors
+	}
+
+	// Bands 0-5 and 6-10 have scalefactors of slen[0] bits, bands 11-15 and 16-20 of slen[1] bits
+	groups := []int{0, 6, 11, 16, 21}
+	previous := d.scalefactors[ch]
+
+	for group := 0; group < 4; group++ {
+
+		for band := groups[group]; band < groups[group+1]; band++ {
+
+			if gr == 1 && g.scfsi[group] && len(previous) == count {
+				scalefactors[band] = previous[band]
+			} else {
+				scalefactors[band] = int(r.read(slen[group/2]))
+			}
+		}
+	}
+
+	d.scalefactors[ch] = scalefactors
+
+	return scalefactors
+}
+
+// mpeg1Positions returns the intensity positions of the bands given by the scalefactors of the right channel,
+// -1 where there's none (7)
+func mpeg1Positions(scalefactors []int) []int {
+
+	positions := make([]int, len(scalefactors))
+
+	for i, sf := range scalefactors {
+		positions[i] = sf
+		if sf == 7 {
+			positions[i] = -1
+		}
+	}
+
+	return positions
+}
+
+// readLsfScalefactors reads the MPEG-2 scalefactors of the bands, split into 4 partitions of their own length.
+// It returns the intensity positions of the bands, -1 where there's none, as well.
+func readLsfScalefactors(r *bitReader, g *mp3Granule, intensityRight bool, count int) ([]int, []int) {
+
+	var slen [4]int
+	var split int
+
+	c := g.scalefacCompress
+
+	if !intensityRight {
+
+		switch {
+		case c < 400:
+			slen, split = [4]int{c >> 4 / 5, c >> 4 % 5, c & 15 >> 2, c & 3}, 0
+		case c < 500:
+			c -= 400
+			slen, split = [4]int{c >> 2 / 5, c >> 2 % 5, c & 3, 0}, 1
+		default:
+			c -= 500
+			slen, split = [4]int{c / 3, c % 3, 0, 0}, 2
+			g.preflag = true
+		}
+	} else {
+
+		c >>= 1
+
+		switch {
+		case c < 180:
+			slen, split = [4]int{c / 36, c % 36 / 6, c % 36 % 6, 0}, 3
+		case c < 244:
+			c -= 180
+			slen, split = [4]int{c % 64 >> 4, c % 16 >> 2, c % 4, 0}, 4
+		default:
+			c -= 244
+			slen, split = [4]int{c / 3, c % 3, 0, 0}, 5
+		}
+	}
+
+	blocks := 0
+	if g.blockType == mp3ShortBlock {
+		blocks = 1
+		if g.mixed {
+			blocks = 2
+		}
+	}
+
+	scalefactors := make([]int, count)
+	positions := make([]int, count)
+
+	for i, p := 0, 0; p < 4; p++ {
+
+		for n := 0; n < mp3LsfPartitions[split][blocks][p] && i < count; n++ {
+
+			if slen[p] > 0 {
+
+				scalefactors[i] = int(r.read(slen[p]))
+				positions[i] = scalefactors[i]
+
+				// The maximum value means there's no intensity position
+				if scalefactors[i] == 1<<uint(slen[p])-1 {
+					positions[i] = -1
+				}
+			}
+			i++
+		}
+	}
+
+	return scalefactors, positions
+}
+
+// readHuffman reads the Huffman coded values of the granule, which end at the given bit.
+func readHuffman(r *bitReader, g *mp3Granule, widths []int, end int) [mp3GranuleSize]int {
+
+	var values [mp3GranuleSize]int
+
+	// The big values are split into 3 regions of bands, each coded with its own table
+	region0 := sumWidths(widths, g.region0Count+1)
+	region1 := sumWidths(widths, g.region0Count+1+g.region1Count+1)
+
+	bigValues := g.bigValues * 2
+	if bigValues > mp3GranuleSize {
+		bigValues = mp3GranuleSize
+	}
+
+	i := 0
+
+	for ; i < bigValues; i += 2 {
+
+		table := g.tableSelect[2]
+
+		switch {
+		case i < region0:
+			table = g.tableSelect[0]
+		case i < region1:
+			table = g.tableSelect[1]
+		}
+
+		values[i], values[i+1] = readBigValues(r, table)
+	}
+
+	// The rest of the values are -1, 0 or 1, coded in quadruples till the end of the bits
+	for ; i+4 <= mp3GranuleSize && r.pos < end; i += 4 {
+
+		var quadruple int
+
+		if g.count1Table == 0 {
+			quadruple = mp3Trees[32].decode(r)
+		} else {
+			quadruple = int(r.read(4)) ^ 0x0f
+		}
+
+		for k := 0; k < 4; k++ {
+
+			if quadruple>>uint(3-k)&1 != 0 {
+
+				values[i+k] = 1
+				if r.read(1) == 1 {
+					values[i+k] = -1
+				}
+			}
+		}
+	}
+
+	// The last quadruple was cut by the end of the bits
+	if r.pos > end && i >= bigValues+4 {
+		for k := i - 4; k < i; k++ {
+			values[k] = 0
+		}
+	}
+
+	return values
+}
+
+// sumWidths returns the number of coefficients of the first bands
+func sumWidths(widths []int, bands int) int {
+
+	sum := 0
+
+	for i := 0; i < bands && i < len(widths); i++ {
+		sum += widths[i]
+	}
+
+	return sum
+}
+
+// readBigValues reads a pair of values coded with the table
+func readBigValues(r *bitReader, table int) (int, int) {
+
+	code := table
+
+	switch {
+	case table >= 24:
+		code = 24
+	case table >= 16:
+		code = 16
+	}
+
+	tree, ok := mp3Trees[code]
+
+	if !ok {
+
+		return 0, 0
+	}
+
+	size := mp3BigValueCodes[code].size
+	pair := tree.decode(r)
+
+	x := readBigValue(r, pair/size, mp3Linbits[table])
+	y := readBigValue(r, pair%size, mp3Linbits[table])
+
+	return x, y
+}
+
+// readBigValue reads the rest of the value of a pair: the bits added to 15, if any, and its sign
+func readBigValue(r *bitReader, value int, linbits int) int {
+
+	if linbits > 0 && value == 15 {
+		value += int(r.read(linbits))
+	}
+
+	if value != 0 && r.read(1) == 1 {
+		value = -value
+	}
+
+	return value
+}
+
+// mp3Tree decodes a Huffman code bit by bit. A node is a pair of children:
+// the indexes of their nodes or, if negative, the decoded values (-1 - value).
+type mp3Tree []int
+
+// Huffman trees by table number: the big values tables and count1 table A (32)
+var mp3Trees = newMp3Trees()
+
+func newMp3Trees() map[int]mp3Tree {
+
+	trees := map[int]mp3Tree{32: newMp3Tree(mp3Count1Code)}
+
+	for table, code := range mp3BigValueCodes {
+		trees[table] = newMp3Tree(code)
+	}
+
+	return trees
+}
+
+func newMp3Tree(code mp3HuffmanCode) mp3Tree {
+
+	tree := mp3Tree{0, 0}
+
+	for value, c := range code.codes {
+
+		node := 0
+
+		for i := int(code.lengths[value]) - 1; i > 0; i-- {
+
+			bit := int(c>>uint(i)) & 1
+
+			if tree[node+bit] == 0 {
+				tree = append(tree, 0, 0)
+				tree[node+bit] = len(tree) - 2
+			}
+			node = tree[node+bit]
+		}
+
+		tree[node+int(c&1)] = -1 - value
+	}
+
+	return tree
+}
+
+// decode reads a code, returning its value. Invalid codes are decoded as 0.
+func (t mp3Tree) decode(r *bitReader) int {
+
+	for node := 0; ; {
+
+		child := t[node+int(r.read(1))]
+
+		if child <= 0 {
+			return -1 - child
+		}
+		node = child
+	}
+}
+
+// requantize scales the values by the gains and the scalefactors of their bands
+func requantize(xr *[mp3GranuleSize]float64, values *[mp3GranuleSize]int, g *mp3Granule, scalefactors []int, widths []int, long int) {
+
+	i := 0
+
+	for band, width := range widths {
+
+		// In quarters of the power of 2
+		exponent := g.globalGain - 210
+		scalefactor := scalefactors[band]
+
+		if band < long {
+
+			if g.preflag {
+				scalefactor += mp3Pretab[band]
+			}
+		} else {
+
+			exponent -= 8 * g.subblockGain[(band-long)%3]
+		}
+
+		exponent -= 2 * (1 + g.scalefacScale) * scalefactor
+		scale := math.Pow(2, float64(exponent)/4)
+
+		for end := i + width; i < end; i++ {
+
+			if v := values[i]; v > 0 {
+				xr[i] = scale * math.Pow(float64(v), 4.0/3)
+			} else if v < 0 {
+				xr[i] = -scale * math.Pow(float64(-v), 4.0/3)
+			}
+		}
+	}
+}
+
+// mp3Stereo restores the left and right channels of joint stereo:
+// coded as their middle and side (ms) or, in the highest bands, as the left one and a direction (intensity).
+type mp3Stereo struct {
+	ms             bool
+	intensity      bool
+	mpeg1          bool
+	intensityScale int // MPEG-2 only
+}
+
+func (s mp3Stereo) apply(xr *[2][mp3GranuleSize]float64, widths []int, long int, positions []int) {
+
+	// The highest nonzero bands of the right channel, by window of short blocks.
+	// The bands above them are intensity coded.
+	top := [3]int{-1, -1, -1}
+	windows := 1
+	if long == 0 {
+		windows = 3
+	}
+
+	if s.intensity {
+
+		for band, i := 0, 0; band < len(widths); band++ {
+
+			for k := i; k < i+widths[band]; k++ {
+
+				if xr[1][k] != 0 {
+					top[band%windows] = band
+					break
+				}
+			}
+			i += widths[band]
+		}
+
+		if long > 0 {
+			top[0] = maxInt(top[0], maxInt(top[1], top[2]))
+			top[1], top[2] = top[0], top[0]
+		}
+
+		// The highest bands, which have no scalefactors, take the positions of the bands below
+		positions = append([]int(nil), positions...)
+
+		for window := 0; window < windows; window++ {
+
+			highest := len(widths) - windows + window
+			below := highest - windows
+
+			if highest >= len(positions) || below < 0 {
+				continue
+			}
+
+			switch {
+			case top[window] >= below && s.mpeg1:
+				positions[highest] = 3
+			case top[window] >= below:
+				positions[highest] = 0
+			default:
+				positions[highest] = positions[below]
+			}
+		}
+	}
+
+	for band, i := 0, 0; band < len(widths); band++ {
+
+		end := i + widths[band]
+
+		if s.intensity && band > top[band%windows] && band < len(positions) && positions[band] >= 0 {
+
+			left, right := s.intensityRatios(positions[band])
+
+			for ; i < end; i++ {
+				xr[0][i], xr[1][i] = xr[0][i]*left, xr[0][i]*right
+			}
+			continue
+		}
+
+		if s.ms {
+
+			for ; i < end; i++ {
+				xr[0][i], xr[1][i] = (xr[0][i]+xr[1][i])/math.Sqrt2, (xr[0][i]-xr[1][i])/math.Sqrt2
+			}
+		}
+		i = end
+	}
+}
+
+// intensityRatios returns the ratios of the left and right channels to the coded one for the intensity position
+func (s mp3Stereo) intensityRatios(position int) (float64, float64) {
+
+	if s.mpeg1 {
+
+		if position > 6 {
+			return 1, 1
+		}
+
+		angle := float64(position) * math.Pi / 12
+		sin, cos := math.Sin(angle), math.Cos(angle)
+
+		return sin / (sin + cos), cos / (sin + cos)
+	}
+
+	ratio := math.Pow(2, -float64((position+1)>>1)/float64(int(4)>>uint(s.intensityScale)))
+
+	if position&1 == 1 {
+		return ratio, 1
+	}
+	return 1, ratio
+}
+
+// synthesize transforms the coefficients of the granule of the channel into samples
+func (d *mp3Decoder) synthesize(ch int, xr *[mp3GranuleSize]float64, g *mp3Granule, widths []int, long int) [mp3GranuleSize]float64 {
+
+	if g.blockType == mp3ShortBlock {
+		reorder(xr, widths, long)
+	}
+
+	// The aliasing between the subbands of long blocks is reduced
+	subbands := 32
+	if g.blockType == mp3ShortBlock {
+		subbands = 0
+		if g.mixed {
+			subbands = 2
+		}
+	}
+
+	for sb := 1; sb < subbands; sb++ {
+
+		for i := 0; i < 8; i++ {
+
+			lower, upper := xr[sb*18-1-i], xr[sb*18+i]
+			xr[sb*18-1-i] = lower*mp3AliasCs[i] - upper*mp3AliasCa[i]
+			xr[sb*18+i] = upper*mp3AliasCs[i] + lower*mp3AliasCa[i]
+		}
+	}
+
+	// Samples of the subbands in time
+	var subbandSamples [18][32]float64
+
+	for sb := 0; sb < 32; sb++ {
+
+		blockType := g.blockType
+		if g.mixed && sb < 2 {
+			blockType = mp3NormalBlock
+		}
+
+		out := imdct(xr[sb*18:sb*18+18], blockType)
+		overlap := d.overlap[ch][sb*18 : sb*18+18]
+
+		for i := 0; i < 18; i++ {
+
+			sample := out[i] + overlap[i]
+			overlap[i] = out[18+i]
+
+			// Odd subbands are inverted in frequency
+			if sb%2 == 1 && i%2 == 1 {
+				sample = -sample
+			}
+			subbandSamples[i][sb] = sample
+		}
+	}
+
+	var samples [mp3GranuleSize]float64
+
+	for t := range subbandSamples {
+		d.filter(ch, &subbandSamples[t], samples[t*32:t*32+32])
+	}
+
+	return samples
+}
+
+// reorder orders the coefficients of short blocks by frequency rather than by window
+func reorder(xr *[mp3GranuleSize]float64, widths []int, long int) {
+
+	i := sumWidths(widths, long)
+
+	for band := long; band+2 < len(widths); band += 3 {
+
+		width := widths[band]
+		ordered := make([]float64, 3*width)
+
+		for window := 0; window < 3; window++ {
+			for f := 0; f < width; f++ {
+				ordered[3*f+window] = xr[i+window*width+f]
+			}
+		}
+
+		copy(xr[i:], ordered)
+		i += 3 * width
+	}
+}
+
+// Coefficients of the aliasing reduction butterflies
+var mp3AliasCs, mp3AliasCa = aliasCoefficients()
+
+func aliasCoefficients() ([8]float64, [8]float64) {
+
+	var cs, ca [8]float64
+
+	for i, c := range []float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037} {
+		cs[i] = 1 / math.Sqrt(1+c*c)
+		ca[i] = c / math.Sqrt(1+c*c)
+	}
+
+	return cs, ca
+}
+
+// imdct transforms the 18 coefficients of a subband into 36 windowed samples:
+// a long block or 3 overlapping short ones
+func imdct(in []float64, blockType int) [36]float64 {
+
+	var out [36]float64
+
+	if blockType == mp3ShortBlock {
+
+		for window := 0; window < 3; window++ {
+
+			for i := 0; i < 12; i++ {
+
+				sum := 0.0
+				for k := 0; k < 6; k++ {
+					sum += in[3*k+window] * mp3ImdctShortCos[i][k]
+				}
+
+				out[6+6*window+i] += sum * mp3Windows[mp3ShortBlock][i]
+			}
+		}
+
+		return out
+	}
+
+	for i := 0; i < 36; i++ {
+
+		sum := 0.0
+		for k := 0; k < 18; k++ {
+			sum += in[k] * mp3ImdctCos[i][k]
+		}
+
+		out[i] = sum * mp3Windows[blockType][i]
+	}
+
+	return out
+}
+
+// The IMDCT of long blocks
+var mp3ImdctCos = imdctCos()
+
+func imdctCos() [36][18]float64 {
+
+	var c [36][18]float64
+
+	for i := range c {
+		for k := range c[i] {
+			c[i][k] = math.Cos(math.Pi / 72 * float64((2*i+1+18)*(2*k+1)))
+		}
+	}
+
+	return c
+}
+
+// The IMDCT of short blocks
+var mp3ImdctShortCos = imdctShortCos()
+
+func imdctShortCos() [12][6]float64 {
+
+	var c [12][6]float64
+
+	for i := range c {
+		for k := range c[i] {
+			c[i][k] = math.Cos(math.Pi / 24 * float64((2*i+1+6)*(2*k+1)))
+		}
+	}
+
+	return c
+}
+
+// The windows of the block types, the short one for 12 samples
+var mp3Windows = imdctWindows()
+
+func imdctWindows() [4][36]float64 {
+
+	var w [4][36]float64
+
+	for i := 0; i < 36; i++ {
+		w[mp3NormalBlock][i] = math.Sin(math.Pi / 36 * (float64(i) + 0.5))
+	}
+
+	for i := 0; i < 18; i++ {
+		w[mp3StartBlock][i] = w[mp3NormalBlock][i]
+		w[mp3StopBlock][i+18] = w[mp3NormalBlock][i+18]
+	}
+
+	for i := 0; i < 6; i++ {
+		w[mp3StartBlock][18+i] = 1
+		w[mp3StartBlock][24+i] = math.Sin(math.Pi / 12 * (float64(i+6) + 0.5))
+		w[mp3StopBlock][6+i] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+		w[mp3StopBlock][12+i] = 1
+	}
+
+	for i := 0; i < 12; i++ {
+		w[mp3ShortBlock][i] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+	}
+
+	return w
+}
+
+// filter turns a sample of each subband into 32 samples, see ISO/IEC 11172-3, Annex A, figure A.2
+func (d *mp3Decoder) filter(ch int, subbands *[32]float64, samples []float64) {
+
+	v := &d.filterbank[ch]
+	d.offset[ch] = (d.offset[ch] - 64) & 1023
+	offset := d.offset[ch]
+
+	for i := 0; i < 64; i++ {
+
+		sum := 0.0
+		for k, s := range subbands {
+			sum += mp3SynthesisMatrix[i][k] * s
+		}
+		v[offset+i] = sum
+	}
+
+	for j := range samples {
+
+		sum := 0.0
+
+		for i := 0; i < 16; i++ {
+
+			u := 128*(i/2) + j
+			if i%2 == 1 {
+				u += 96
+			}
+			sum += v[(offset+u)&1023] * mp3SynthesisCoefficients[j+32*i]
+		}
+
+		samples[j] = sum
+	}
+}
+
+// The matrixing of the synthesis filterbank
+var mp3SynthesisMatrix = synthesisMatrix()
+
+func synthesisMatrix() [64][32]float64 {
+
+	var n [64][32]float64
+
+	for i := range n {
+		for k := range n[i] {
+			n[i][k] = math.Cos(float64((16+i)*(2*k+1)) * math.Pi / 64)
+		}
+	}
+
+	return n
+}
+
+// The window of the synthesis filterbank, see mp3SynthesisWindow
+var mp3SynthesisCoefficients = synthesisCoefficients()
+
+func synthesisCoefficients() [512]float64 {
+
+	var d [512]float64
+
+	for i := 0; i <= 256; i++ {
+		d[i] = float64(mp3SynthesisWindow[i]) / 65536
+	}
+
+	for i := 257; i < 512; i++ {
+
+		d[i] = -d[512-i]
+		if i%64 == 0 {
+			d[i] = d[512-i]
+		}
+	}
+
+	return d
+}
+
+// toInt16 converts a sample from -1..1 to a 16 bit one, clipping it
+func toInt16(sample float64) int32 {
+
+	s := math.Floor(sample*32768 + 0.5)
+
+	switch {
+	case s > math.MaxInt16:
+		return math.MaxInt16
+	case s < math.MinInt16:
+		return math.MinInt16
+	}
+
+	return int32(s)
+}
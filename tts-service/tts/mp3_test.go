@@ -0,0 +1,92 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMp3(t *testing.T) {
+
+	Convey("MP3 decoding", t, func() {
+
+		mp3, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+		start := skipId3(mp3)
+
+		Convey("should decode MPEG 2.5 Layer III media", func() {
+
+			audio, err := decodeMp3(mp3)
+
+			So(err, ShouldBeNil)
+			So(audio.sampleRate, ShouldEqual, 8000)
+			So(audio.channels, ShouldEqual, 1)
+			So(audio.frames(), ShouldEqual, 21888)
+
+			// Samples decoded by a reference decoder, which may round them differently
+			for i, sample := range map[int]int32{4000: -2694, 8000: 1470, 9000: 6174, 12000: 10644, 14000: -2, 18000: 0} {
+				So(audio.samples[i], ShouldAlmostEqual, sample, 1)
+			}
+		})
+
+		Convey("should skip junk between frames", func() {
+
+			// A false sync after the Xing/Info frame
+			end := start + mp3FrameLength(mp3[start:])
+			junk := append([]byte{}, mp3[:end]...)
+			junk = append(junk, 0xff, 0xf3, 0x00, 0x00)
+			junk = append(junk, mp3[end:]...)
+
+			audio, err := decodeMp3(junk)
+
+			So(err, ShouldBeNil)
+			So(audio.frames(), ShouldEqual, 21888)
+		})
+
+		Convey("should decode frames without their main data as silence", func() {
+
+			// Frames after the Xing/Info one are lost, the next one refers to their main data
+			end := start + mp3FrameLength(mp3[start:])
+			next := end
+
+			for i := 0; i < 14; i++ {
+				next += mp3FrameLength(mp3[next:])
+			}
+
+			lost := append([]byte{}, mp3[:end]...)
+			lost = append(lost, mp3[next:]...)
+
+			audio, err := decodeMp3(lost)
+
+			So(err, ShouldBeNil)
+			So(audio.frames(), ShouldEqual, 21888-14*576)
+			So(audio.samples[:mp3GranuleSize], ShouldResemble, make([]int32, mp3GranuleSize))
+			So(audio.samples[mp3GranuleSize:2*mp3GranuleSize], ShouldNotResemble, make([]int32, mp3GranuleSize))
+		})
+
+		Convey("should reject media without frames", func() {
+
+			_, err := decodeMp3([]byte("Not an MP3 at all"))
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Invalid MP3 media")
+		})
+
+		Convey("should have scale factor bands covering the granules", func() {
+
+			for _, bands := range mp3Bands {
+
+				So(sumWidths(bands.long, len(bands.long)), ShouldEqual, mp3GranuleSize)
+				So(sumWidths(bands.short, len(bands.short))*3, ShouldEqual, mp3GranuleSize)
+			}
+		})
+	})
+}
+
+// mp3FrameLength returns the length of the frame at the beginning of the media
+func mp3FrameLength(media []byte) int {
+
+	frame, _ := parseMp3Header(media)
+
+	return frame.length()
+}
@@ -0,0 +1,47 @@
+package tts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Options tell how the text is read. Zero values mean the converter defaults.
+type Options struct {
+	Voice  string `json:",omitempty"`
+	Rate   *int   `json:",omitempty"` // Speaking rate, relative to the normal one
+	Pitch  *int   `json:",omitempty"`
+	Volume *int   `json:",omitempty"`
+	Format string `json:",omitempty"` // Output format, e.g. "mp3"
+	Mixed  bool   `json:",omitempty"` // Parts of the text in other languages are read in these languages
+}
+
+// String returns the options set, in a canonical form, e.g. "voice=Amy;rate=2;mixed".
+// It returns an empty string for the default options.
+func (o Options) String() string {
+
+	options := []string{}
+
+	if o.Voice != "" {
+		options = append(options, "voice="+o.Voice)
+	}
+
+	for _, option := range []struct {
+		name  string
+		value *int
+	}{{"rate", o.Rate}, {"pitch", o.Pitch}, {"volume", o.Volume}} {
+
+		if option.value != nil {
+			options = append(options, option.name+"="+strconv.Itoa(*option.value))
+		}
+	}
+
+	if o.Format != "" {
+		options = append(options, "format="+o.Format)
+	}
+
+	if o.Mixed {
+		options = append(options, "mixed")
+	}
+
+	return strings.Join(options, ";")
+}
@@ -0,0 +1,242 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Opus renditions are Ogg Opus media (RFC 7845) of CELT frames at a constant bitrate,
+// with the bandwidth of the original media.
+
+// opusBandwidth is an audio bandwidth of Opus, the coded bands and bytes of a frame of a stream depend on it.
+type opusBandwidth struct {
+	maxSampleRate int // of the media it suits
+	bands         int
+	config        byte // of the TOC byte, CELT-only 20 ms frames
+	frameBytes    int  // TOC byte included
+}
+
+var opusBandwidths = []opusBandwidth{
+	{8000, 13, 19, 60},   // narrowband, 24 kbit/s
+	{16000, 17, 23, 80},  // wideband, 32 kbit/s
+	{24000, 19, 27, 100}, // super-wideband, 40 kbit/s
+	{48000, 21, 31, 120}, // fullband, 48 kbit/s
+}
+
+// Samples the decoder drops at the beginning, the delay of the MDCT overlap
+const opusPreSkip = celtOverlap
+
+// Vorbis channel order of the streams, by channel count (RFC 7845, 5.1.1.2)
+var opusChannelMappings = map[int][]byte{
+	2: {0, 1},
+	3: {0, 2, 1},
+	4: {0, 1, 2, 3},
+	5: {0, 2, 1, 3, 4},
+	6: {0, 2, 1, 4, 5, 3},
+	7: {0, 2, 1, 5, 6, 4, 3},
+	8: {0, 2, 1, 6, 7, 4, 5, 3},
+}
+
+// encodeOpus encodes the samples as Ogg Opus media, resampled to 48 kHz.
+// Every channel is coded as a separate mono stream.
+func encodeOpus(audio pcm) []byte {
+
+	bandwidth := opusBandwidths[len(opusBandwidths)-1]
+	for _, bw := range opusBandwidths {
+		if audio.sampleRate <= bw.maxSampleRate {
+			bandwidth = bw
+			break
+		}
+	}
+
+	original := audio
+	audio = resample(48000)(audio)
+	frames := audio.frames()
+	scale := 32768 / fullScale(audio.bitsPerSample)
+
+	w := &oggWriter{serial: 0x54545331}
+
+	w.writePacket(opusHead(original), 0, false)
+	w.writePacket(opusTags(), 0, false)
+
+	encoders := make([]*celtEncoder, audio.channels)
+	for c := range encoders {
+		encoders[c] = newCeltEncoder(bandwidth.bands, bandwidth.frameBytes-1)
+	}
+
+	// The decoder drops the pre-skip, the last frame is padded with silence
+	count := (opusPreSkip + frames + celtFrameSize - 1) / celtFrameSize
+	pcm := make([]float64, celtFrameSize)
+
+	for i := 0; i < count; i++ {
+
+		var packet bytes.Buffer
+
+		for c, encoder := range encoders {
+
+			for j := range pcm {
+				pcm[j] = 0
+				if frame := i*celtFrameSize + j; frame < frames {
+					pcm[j] = float64(audio.samples[frame*audio.channels+c]) * scale
+				}
+			}
+
+			data := encoder.encode(pcm)
+
+			packet.WriteByte(bandwidth.config << 3)
+			// Streams of a packet but the last one are self-delimited
+			if c < len(encoders)-1 {
+				packet.Write(opusFrameLength(len(data)))
+			}
+			packet.Write(data)
+		}
+
+		granule := int64(i+1) * celtFrameSize
+		last := i == count-1
+		if last {
+			granule = opusPreSkip + int64(frames)
+		}
+
+		w.writePacket(packet.Bytes(), granule, last)
+	}
+
+	return w.Bytes()
+}
+
+// opusHead returns the identification header (RFC 7845, 5.1).
+func opusHead(audio pcm) []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("OpusHead")
+	b.WriteByte(1)
+	b.WriteByte(byte(audio.channels))
+	binary.Write(&b, binary.LittleEndian, uint16(opusPreSkip))
+	binary.Write(&b, binary.LittleEndian, uint32(audio.sampleRate))
+	binary.Write(&b, binary.LittleEndian, int16(0)) // output gain
+
+	if audio.channels == 1 {
+		b.WriteByte(0)
+		return b.Bytes()
+	}
+
+	b.WriteByte(1)
+	b.WriteByte(byte(audio.channels)) // streams
+	b.WriteByte(0)                    // coupled streams
+	b.Write(opusChannelMappings[audio.channels])
+
+	return b.Bytes()
+}
+
+// opusTags returns the comment header (RFC 7845, 5.2), with no comments.
+func opusTags() []byte {
+
+	const vendor = "tts-service"
+
+	var b bytes.Buffer
+
+	b.WriteString("OpusTags")
+	binary.Write(&b, binary.LittleEndian, uint32(len(vendor)))
+	b.WriteString(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(0))
+
+	return b.Bytes()
+}
+
+// opusFrameLength returns the coded length of a frame (RFC 6716, 3.2.1).
+func opusFrameLength(length int) []byte {
+
+	if length < 252 {
+		return []byte{byte(length)}
+	}
+	return []byte{byte(252 + length&3), byte((length - 252) >> 2)}
+}
+
+// oggWriter writes the packets of a logical bitstream in Ogg pages (RFC 3533).
+// Every packet starts a new page, unless it fits in the page of the previous ones.
+type oggWriter struct {
+	bytes.Buffer
+	serial   uint32
+	sequence uint32
+	segments []byte
+	data     bytes.Buffer
+	granule  int64
+}
+
+// The Ogg pages of the audio hold about a second of it
+const oggMaxPageData = 8 * 1024
+
+// writePacket adds the packet ending at the granule position, the first two are the headers on their own pages.
+func (w *oggWriter) writePacket(packet []byte, granule int64, last bool) {
+
+	lacing := make([]byte, len(packet)/255+1)
+	for i := range lacing {
+		lacing[i] = 255
+	}
+	lacing[len(lacing)-1] = byte(len(packet) % 255)
+
+	if len(w.segments)+len(lacing) > 255 || w.data.Len()+len(packet) > oggMaxPageData {
+		w.flush(false)
+	}
+
+	w.segments = append(w.segments, lacing...)
+	w.data.Write(packet)
+	w.granule = granule
+
+	if w.sequence < 2 || last {
+		w.flush(last)
+	}
+}
+
+func (w *oggWriter) flush(last bool) {
+
+	if len(w.segments) == 0 {
+		return
+	}
+
+	var flags byte
+	if w.sequence == 0 {
+		flags |= 0x02 // beginning of stream
+	}
+	if last {
+		flags |= 0x04 // end of stream
+	}
+
+	page := make([]byte, 27, 27+len(w.segments)+w.data.Len())
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:14], uint64(w.granule))
+	binary.LittleEndian.PutUint32(page[14:18], w.serial)
+	binary.LittleEndian.PutUint32(page[18:22], w.sequence)
+	page[26] = byte(len(w.segments))
+	page = append(page, w.segments...)
+	page = append(page, w.data.Bytes()...)
+
+	binary.LittleEndian.PutUint32(page[22:26], oggCrc(page))
+
+	w.Write(page)
+	w.sequence++
+	w.segments = w.segments[:0]
+	w.data.Reset()
+}
+
+// CRC-32 of Ogg pages, polynomial 0x04c11db7 without reflection
+func oggCrc(data []byte) uint32 {
+
+	var crc uint32
+
+	for _, b := range data {
+
+		crc ^= uint32(b) << 24
+
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,200 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpus(t *testing.T) {
+
+	Convey("Opus encoder", t, func() {
+
+		tone := func(sampleRate, channels, frames int) pcm {
+
+			audio := pcm{sampleRate: sampleRate, channels: channels, bitsPerSample: 16}
+			for i := 0; i < frames*channels; i++ {
+				audio.samples = append(audio.samples, int32(8000*math.Sin(float64(i/channels)*440*2*math.Pi/float64(sampleRate))))
+			}
+			return audio
+		}
+
+		Convey("should encode media libopus decodes to the original audio", func() {
+
+			// testdata/test.opus is the rendition of testdata/test, testdata/test.opus.wav is what libopus 1.1.2
+			// decodes from it at 8 kHz (opus_multistream_decode, without the pre-skip).
+			// Both have to be regenerated when the encoder changes.
+			read := func(name string) []byte {
+				b, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + name)
+				return b
+			}
+
+			audio, err := decodeMp3(read("test"))
+			So(err, ShouldBeNil)
+
+			So(bytes.Equal(encodeOpus(audio), read("test.opus")), ShouldBeTrue)
+
+			decoded, err := decodePcm(read("test.opus.wav"))
+			So(err, ShouldBeNil)
+			So(decoded.sampleRate, ShouldEqual, audio.sampleRate)
+			So(decoded.frames(), ShouldEqual, audio.frames())
+
+			var signal, noise float64
+			for i, s := range audio.samples {
+				d := float64(s - decoded.samples[i])
+				signal += float64(s) * float64(s)
+				noise += d * d
+			}
+			So(10*math.Log10(signal/noise), ShouldBeGreaterThan, 18)
+		})
+
+		Convey("should write valid Ogg pages", func() {
+
+			pages := oggPages(encodeOpus(tone(16000, 1, 40000)))
+
+			So(len(pages), ShouldBeGreaterThan, 3)
+			for i, page := range pages {
+				So(string(page[0:4]), ShouldEqual, "OggS")
+				So(binary.LittleEndian.Uint32(page[18:22]), ShouldEqual, i)
+
+				crc := binary.LittleEndian.Uint32(page[22:26])
+				copy(page[22:26], []byte{0, 0, 0, 0})
+				So(oggCrc(page), ShouldEqual, crc)
+			}
+
+			So(pages[0][5], ShouldEqual, 0x02)
+			So(pages[1][5], ShouldEqual, 0)
+			So(pages[len(pages)-1][5], ShouldEqual, 0x04)
+		})
+
+		Convey("should write the headers on their own pages", func() {
+
+			pages := oggPages(encodeOpus(tone(22050, 1, 1000)))
+
+			head := oggPacket(pages[0])
+			So(string(head[0:8]), ShouldEqual, "OpusHead")
+			So(head[9], ShouldEqual, 1)
+			So(binary.LittleEndian.Uint16(head[10:12]), ShouldEqual, opusPreSkip)
+			So(binary.LittleEndian.Uint32(head[12:16]), ShouldEqual, 22050)
+			So(head, ShouldHaveLength, 19)
+
+			So(string(oggPacket(pages[1])[0:8]), ShouldEqual, "OpusTags")
+		})
+
+		Convey("should end at the granule position of the samples at 48 kHz", func() {
+
+			pages := oggPages(encodeOpus(tone(8000, 1, 8000)))
+
+			granule := binary.LittleEndian.Uint64(pages[len(pages)-1][6:14])
+			So(granule, ShouldEqual, opusPreSkip+48000)
+		})
+
+		Convey("should code frames of a constant size with the bandwidth of the media", func() {
+
+			for rate, expected := range map[int]opusBandwidth{
+				8000: opusBandwidths[0], 16000: opusBandwidths[1], 22050: opusBandwidths[2], 44100: opusBandwidths[3],
+			} {
+				pages := oggPages(encodeOpus(tone(rate, 1, rate/10)))
+				audio := pages[2]
+
+				// 100 ms are 6 frames with the pre-skip, in a single page
+				So(audio[26], ShouldEqual, 6)
+				for _, lacing := range audio[27 : 27+6] {
+					So(lacing, ShouldEqual, expected.frameBytes)
+				}
+				So(audio[27+6]>>3, ShouldEqual, expected.config)
+			}
+		})
+
+		Convey("should code every channel as a separate stream", func() {
+
+			pages := oggPages(encodeOpus(tone(48000, 6, 960)))
+
+			head := oggPacket(pages[0])
+			So(head[9], ShouldEqual, 6)
+			So(head[18], ShouldEqual, 1)
+			So(head[19:21], ShouldResemble, []byte{6, 0})
+			So(head[21:], ShouldResemble, []byte{0, 2, 1, 4, 5, 3})
+
+			// All the streams but the last one are self-delimited
+			packet := oggPacket(pages[2])
+			So(packet, ShouldHaveLength, 6*opusBandwidths[3].frameBytes+5)
+		})
+
+		Convey("should code silence", func() {
+
+			encoder := newCeltEncoder(celtBands, 59)
+			frame := encoder.encode(make([]float64, celtFrameSize))
+
+			So(frame, ShouldHaveLength, 59)
+			So(frame[0]>>7, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRangeEncoder(t *testing.T) {
+
+	Convey("Range encoder", t, func() {
+
+		Convey("should count the bits it uses", func() {
+
+			e := newRangeEncoder(16)
+			So(e.tell(), ShouldEqual, 1)
+
+			for i := 0; i < 8; i++ {
+				e.bitLogp(false, 1)
+			}
+			e.bits(5, 3)
+
+			So(e.tell(), ShouldEqual, 1+8+3)
+			So(e.tellFrac(), ShouldBeBetweenOrEqual, 8*(8+3), 8*(1+8+3))
+		})
+
+		Convey("should write raw bits at the end", func() {
+
+			e := newRangeEncoder(4)
+			e.bits(0xa5, 8)
+
+			So(e.done()[3], ShouldEqual, 0xa5)
+		})
+	})
+}
+
+// oggPages splits the Ogg media in pages
+func oggPages(media []byte) [][]byte {
+
+	var pages [][]byte
+
+	for len(media) >= 27 {
+
+		size := 27 + int(media[26])
+		for _, lacing := range media[27:size] {
+			size += int(lacing)
+		}
+
+		pages = append(pages, media[:size])
+		media = media[size:]
+	}
+
+	return pages
+}
+
+// oggPacket returns the first packet of the page
+func oggPacket(page []byte) []byte {
+
+	body := 27 + int(page[26])
+	size := 0
+	for _, lacing := range page[27:body] {
+		size += int(lacing)
+		if lacing < 255 {
+			break
+		}
+	}
+
+	return page[body : body+size]
+}
@@ -0,0 +1,362 @@
+package tts
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stage processes decoded audio, e.g. trims its silence.
+// Stages are composed into a pipeline, run between the conversion and the storage of the media.
+type stage func(audio pcm) pcm
+
+// pipeline runs the stages in order
+type pipeline []stage
+
+// process decodes the media, runs the stages and encodes the result as WAV.
+// It returns the media, the duration cut from its beginning and an error, if any.
+// The media is returned unchanged if it can't be decoded, e.g. MP3.
+func (p pipeline) process(media []byte) ([]byte, time.Duration, error) {
+
+	if len(p) == 0 {
+
+		return media, 0, nil
+	}
+
+	audio, err := decodePcm(media)
+
+	if err != nil {
+
+		return media, 0, err
+	}
+
+	for _, s := range p {
+		audio = s(audio)
+	}
+
+	return encodeWav(audio), audio.trimmed, nil
+}
+
+// Stages by their names, created with their optional parameter
+var stages = map[string]func(param string) (stage, error){
+	"trim": func(param string) (stage, error) {
+		threshold, err := floatParam(param, defaultSilenceThreshold)
+		return trimSilence(threshold), err
+	},
+	"loudness": func(param string) (stage, error) {
+		target, err := floatParam(param, defaultLoudnessTarget)
+		return normalizeLoudness(target), err
+	},
+	"fade": func(param string) (stage, error) {
+		ms, err := intParam(param, defaultFadeDuration)
+		return fade(time.Duration(ms) * time.Millisecond), err
+	},
+	"resample": func(param string) (stage, error) {
+		rate, err := intParam(param, defaultSampleRate)
+		return resample(rate), err
+	},
+}
+
+const (
+	defaultSilenceThreshold = -50.0 // dBFS
+	defaultLoudnessTarget   = -23.0 // LUFS, as recommended by EBU R128
+	defaultFadeDuration     = 20    // milliseconds
+	defaultSampleRate       = 22050 // Hz
+)
+
+// pipelineFromEnv creates the pipeline of stages listed by the environment variable, e.g. "trim:-50,loudness:-16,fade".
+// Unknown stages and invalid parameters are skipped.
+func pipelineFromEnv(name string) pipeline {
+
+	p := pipeline{}
+
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		stageName, param := item, ""
+		if i := strings.Index(item, ":"); i >= 0 {
+			stageName, param = item[:i], item[i+1:]
+		}
+
+		create, ok := stages[stageName]
+		if !ok {
+			log.Printf("Unknown %s stage: '%s'. Skipping it", name, stageName)
+			continue
+		}
+
+		s, err := create(param)
+		if err != nil {
+			log.Printf("Invalid %s stage: '%s'. Skipping it", name, item)
+			continue
+		}
+
+		p = append(p, s)
+	}
+
+	return p
+}
+
+func floatParam(param string, defaultValue float64) (float64, error) {
+
+	if param == "" {
+
+		return defaultValue, nil
+	}
+
+	return strconv.ParseFloat(param, 64)
+}
+
+func intParam(param string, defaultValue int) (int, error) {
+
+	if param == "" {
+
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(param)
+
+	if err == nil && value <= 0 {
+
+		return 0, fmt.Errorf("Not a positive number: %d", value)
+	}
+
+	return value, err
+}
+
+// Silence kept around the sound, so that the trimming doesn't cut quiet sounds
+const trimMargin = 50 * time.Millisecond
+
+// trimSilence removes the leading and trailing samples quieter than the threshold, in dBFS.
+// Silent audio is left as it is.
+func trimSilence(threshold float64) stage {
+
+	return func(audio pcm) pcm {
+
+		limit := math.Pow(10, threshold/20) * fullScale(audio.bitsPerSample)
+		frames := audio.frames()
+
+		loud := func(frame int) bool {
+
+			for _, s := range audio.samples[frame*audio.channels : (frame+1)*audio.channels] {
+				if math.Abs(float64(s)) > limit {
+					return true
+				}
+			}
+			return false
+		}
+
+		first := 0
+		for first < frames && !loud(first) {
+			first++
+		}
+
+		if first == frames {
+			return audio
+		}
+
+		last := frames
+		for !loud(last - 1) {
+			last--
+		}
+
+		margin := audio.frame(trimMargin)
+		first = maxInt(0, first-margin)
+		last = minInt(frames, last+margin)
+
+		audio.trimmed += audio.duration(first)
+		audio.samples = audio.samples[first*audio.channels : last*audio.channels]
+
+		return audio
+	}
+}
+
+// fade fades the audio in and out linearly, during the given time at each end.
+func fade(d time.Duration) stage {
+
+	return func(audio pcm) pcm {
+
+		frames := audio.frames()
+		length := minInt(audio.frame(d), frames/2)
+		samples := make([]int32, len(audio.samples))
+
+		for frame := 0; frame < frames; frame++ {
+
+			gain := 1.0
+			if distance := minInt(frame, frames-1-frame); distance < length {
+				gain = float64(distance) / float64(length)
+			}
+
+			for c := 0; c < audio.channels; c++ {
+				i := frame*audio.channels + c
+				samples[i] = clip(float64(audio.samples[i])*gain, audio.bitsPerSample)
+			}
+		}
+
+		audio.samples = samples
+
+		return audio
+	}
+}
+
+// Loudness is raised only as far as the peaks stay below this level, in dBFS
+const peakLimit = -1.0
+
+// normalizeLoudness changes the gain of the audio, so that its integrated loudness is the target, in LUFS.
+// Silent audio is left as it is.
+func normalizeLoudness(target float64) stage {
+
+	return func(audio pcm) pcm {
+
+		loudness := integratedLoudness(audio)
+
+		if math.IsInf(loudness, -1) {
+			return audio
+		}
+
+		peak := 0.0
+		for _, s := range audio.samples {
+			peak = math.Max(peak, math.Abs(float64(s)))
+		}
+
+		gain := math.Pow(10, (target-loudness)/20)
+		gain = math.Min(gain, math.Pow(10, peakLimit/20)*fullScale(audio.bitsPerSample)/peak)
+
+		samples := make([]int32, len(audio.samples))
+		for i, s := range audio.samples {
+			samples[i] = clip(float64(s)*gain, audio.bitsPerSample)
+		}
+
+		audio.samples = samples
+
+		return audio
+	}
+}
+
+// integratedLoudness measures the loudness of the audio in LUFS, or -Inf if it's silent.
+// Channels are weighted equally, as for mono and stereo audio.
+// https://www.itu.int/rec/R-REC-BS.1770
+func integratedLoudness(audio pcm) float64 {
+
+	frames := audio.frames()
+	scale := fullScale(audio.bitsPerSample)
+
+	// Squares of the K-weighted samples, summed over the channels
+	power := make([]float64, frames)
+
+	for c := 0; c < audio.channels; c++ {
+
+		shelf := highShelf(audio.sampleRate)
+		highPass := highPass(audio.sampleRate)
+
+		for frame := 0; frame < frames; frame++ {
+			y := highPass.filter(shelf.filter(float64(audio.samples[frame*audio.channels+c]) / scale))
+			power[frame] += y * y
+		}
+	}
+
+	// Blocks of 400ms overlapping by 75%, or the whole audio if it's shorter
+	size := minInt(audio.frame(400*time.Millisecond), frames)
+	step := maxInt(size/4, 1)
+
+	blocks := []float64{}
+	for start := 0; start+size <= frames && size > 0; start += step {
+
+		sum := 0.0
+		for _, p := range power[start : start+size] {
+			sum += p
+		}
+		blocks = append(blocks, sum/float64(size))
+	}
+
+	loudness := func(power float64) float64 {
+		return -0.691 + 10*math.Log10(power)
+	}
+
+	gated := func(threshold float64) float64 {
+
+		sum, count := 0.0, 0
+		for _, b := range blocks {
+			if loudness(b) > threshold {
+				sum += b
+				count++
+			}
+		}
+
+		if count == 0 {
+			return 0
+		}
+		return sum / float64(count)
+	}
+
+	// Absolute gate at -70 LUFS, then relative gate 10 LU below the loudness of the remaining blocks
+	absolute := gated(-70)
+	if absolute == 0 {
+		return math.Inf(-1)
+	}
+
+	relative := gated(loudness(absolute) - 10)
+	if relative == 0 {
+		return math.Inf(-1)
+	}
+
+	return loudness(relative)
+}
+
+// biquad is a second order IIR filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) filter(x float64) float64 {
+
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x1, f.x2, f.y1, f.y2 = x, f.x1, y, f.y1
+
+	return y
+}
+
+// highShelf is the first stage of the K-weighting, modelling the acoustic effects of the head,
+// with the BS.1770 coefficients for 48kHz derived for any sample rate.
+func highShelf(sampleRate int) *biquad {
+
+	const f0, gain, q = 1681.974450955533, 3.999843853973347, 0.7071752369554196
+
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+
+	return &biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
+
+// highPass is the second stage of the K-weighting (the RLB filter).
+func highPass(sampleRate int) *biquad {
+
+	const f0, q = 38.13547087602444, 0.5003270373238773
+
+	k := math.Tan(math.Pi * f0 / float64(sampleRate))
+	a0 := 1 + k/q + k*k
+
+	return &biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+}
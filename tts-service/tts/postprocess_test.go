@@ -0,0 +1,146 @@
+package tts
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPostProcess(t *testing.T) {
+
+	Convey("Post-processing", t, func() {
+
+		Convey("should create stages listed by the environment", func() {
+
+			os.Setenv("TEST_POST_PROCESSING", "trim:-40, fade ,unknown,resample:abc,loudness")
+			defer os.Unsetenv("TEST_POST_PROCESSING")
+
+			So(pipelineFromEnv("TEST_POST_PROCESSING"), ShouldHaveLength, 3)
+		})
+
+		Convey("should leave media unchanged without stages", func() {
+
+			media := testWav(8000, 1, 800)
+
+			processed, trimmed, err := pipeline{}.process(media)
+
+			So(err, ShouldBeNil)
+			So(processed, ShouldResemble, media)
+			So(trimmed, ShouldEqual, 0)
+		})
+
+		Convey("should leave media that can't be decoded unchanged", func() {
+
+			media := []byte("ID3")
+
+			processed, _, err := pipeline{fade(time.Second)}.process(media)
+
+			So(err, ShouldNotBeNil)
+			So(processed, ShouldResemble, media)
+		})
+
+		Convey("should trim leading and trailing silence", func() {
+
+			audio := pcm{sampleRate: 8000, channels: 2, bitsPerSample: 16}
+			audio.samples = append(audio.samples, make([]int32, 2*8000)...)
+			audio.samples = append(audio.samples, tone(8000, 2, 440, 0.5, time.Second).samples...)
+			audio.samples = append(audio.samples, make([]int32, 2*4000)...)
+
+			trimmed := trimSilence(-50)(audio)
+
+			// The sine starts and ends with quiet samples
+			So(trimmed.trimmed, ShouldAlmostEqual, time.Second-trimMargin, time.Millisecond)
+			So(trimmed.duration(trimmed.frames()), ShouldAlmostEqual, time.Second+2*trimMargin, time.Millisecond)
+		})
+
+		Convey("should leave silent audio untrimmed", func() {
+
+			audio := pcm{sampleRate: 8000, channels: 1, bitsPerSample: 16, samples: make([]int32, 800)}
+
+			So(trimSilence(-50)(audio), ShouldResemble, audio)
+		})
+
+		Convey("should fade audio in and out", func() {
+
+			audio := pcm{sampleRate: 1000, channels: 1, bitsPerSample: 16}
+			for i := 0; i < 1000; i++ {
+				audio.samples = append(audio.samples, 1000)
+			}
+
+			faded := fade(100 * time.Millisecond)(audio)
+
+			So(faded.samples[0], ShouldEqual, 0)
+			So(faded.samples[50], ShouldEqual, 500)
+			So(faded.samples[500], ShouldEqual, 1000)
+			So(faded.samples[999], ShouldEqual, 0)
+		})
+
+		Convey("should measure loudness of a sine wave", func() {
+
+			// A 1kHz sine at -20 dBFS is -23 LUFS
+			So(integratedLoudness(tone(48000, 1, 997, 0.1, 3*time.Second)), ShouldAlmostEqual, -23.0, 0.05)
+			So(integratedLoudness(tone(16000, 2, 997, 0.1, 3*time.Second)), ShouldAlmostEqual, -20.0, 0.1)
+			So(math.IsInf(integratedLoudness(pcm{sampleRate: 8000, channels: 1, bitsPerSample: 16, samples: make([]int32, 8000)}), -1), ShouldBeTrue)
+		})
+
+		Convey("should normalize loudness to the target", func() {
+
+			normalized := normalizeLoudness(-16)(tone(22050, 1, 997, 0.1, 2*time.Second))
+
+			So(integratedLoudness(normalized), ShouldAlmostEqual, -16.0, 0.1)
+		})
+
+		Convey("should keep peaks below the limit", func() {
+
+			normalized := normalizeLoudness(0)(tone(22050, 1, 997, 0.1, 2*time.Second))
+
+			So(peak(normalized), ShouldBeLessThanOrEqualTo, math.Pow(10, peakLimit/20)*32768+1)
+		})
+
+		Convey("should resample audio", func() {
+
+			audio := tone(16000, 2, 440, 0.5, time.Second)
+
+			resampled := resample(8000)(audio)
+
+			So(resampled.sampleRate, ShouldEqual, 8000)
+			So(resampled.channels, ShouldEqual, 2)
+			So(resampled.frames(), ShouldEqual, 8000)
+			So(peak(resampled), ShouldAlmostEqual, 0.5*32768, 0.02*32768)
+
+			// Frequencies above the new Nyquist frequency are removed
+			So(peak(resample(8000)(tone(16000, 1, 6000, 0.5, time.Second))), ShouldBeLessThan, 0.05*32768)
+		})
+	})
+}
+
+// tone returns a sine wave of the given frequency and amplitude (of the full scale) in all the channels
+func tone(sampleRate, channels int, frequency, amplitude float64, d time.Duration) pcm {
+
+	audio := pcm{sampleRate: sampleRate, channels: channels, bitsPerSample: 16}
+
+	for i := 0; i < audio.frame(d); i++ {
+
+		s := int32(amplitude * 32767 * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate)))
+
+		for c := 0; c < channels; c++ {
+			audio.samples = append(audio.samples, s)
+		}
+	}
+
+	return audio
+}
+
+// peak returns the magnitude of the loudest sample, away from the edges
+func peak(audio pcm) float64 {
+
+	result := 0.0
+
+	for _, s := range audio.samples[len(audio.samples)/10 : len(audio.samples)*9/10] {
+		result = math.Max(result, math.Abs(float64(s)))
+	}
+
+	return result
+}
@@ -0,0 +1,262 @@
+package tts
+
+import "math/bits"
+
+// rangeEncoder is the entropy coder of Opus (RFC 6716, 4.1 and 5.1).
+// Symbols are range coded from the beginning of the packet, raw bits are written from its end.
+type rangeEncoder struct {
+	buf       []byte
+	offs      int    // range coded bytes written
+	endOffs   int    // raw bytes written
+	endWindow uint32 // raw bits not written yet
+	endBits   int
+	nbits     int // bits used so far, plus the ones needed to flush the range
+	rng       uint32
+	val       uint32
+	rem       int // the last byte, waiting for a carry
+	ext       int // 0xff bytes waiting for a carry
+}
+
+const (
+	rangeCodeTop   = 1 << 31
+	rangeCodeBot   = rangeCodeTop >> 8
+	rangeCodeShift = 23
+)
+
+// newRangeEncoder creates an encoder of a packet of the given size in bytes.
+func newRangeEncoder(size int) *rangeEncoder {
+
+	return &rangeEncoder{buf: make([]byte, size), nbits: 33, rng: rangeCodeTop, rem: -1}
+}
+
+// encode encodes a symbol of the frequencies [fl, fh) out of ft.
+func (e *rangeEncoder) encode(fl, fh, ft uint32) {
+
+	r := e.rng / ft
+	if fl > 0 {
+		e.val += e.rng - r*(ft-fl)
+		e.rng = r * (fh - fl)
+	} else {
+		e.rng -= r * (ft - fh)
+	}
+	e.normalize()
+}
+
+// encodeBin is encode with ft = 1 << ftb.
+func (e *rangeEncoder) encodeBin(fl, fh uint32, ftb uint) {
+
+	r := e.rng >> ftb
+	if fl > 0 {
+		e.val += e.rng - r*(1<<ftb-fl)
+		e.rng = r * (fh - fl)
+	} else {
+		e.rng -= r * (1<<ftb - fh)
+	}
+	e.normalize()
+}
+
+// bitLogp encodes a bit which is set with the probability 1/(1 << logp).
+func (e *rangeEncoder) bitLogp(bit bool, logp uint) {
+
+	s := e.rng >> logp
+	r := e.rng - s
+	if bit {
+		e.val += r
+		e.rng = s
+	} else {
+		e.rng = r
+	}
+	e.normalize()
+}
+
+// icdf encodes the symbol s of the inverse cumulative distribution, in 1/(1 << ftb).
+func (e *rangeEncoder) icdf(s int, icdf []byte, ftb uint) {
+
+	r := e.rng >> ftb
+	if s > 0 {
+		e.val += e.rng - r*uint32(icdf[s-1])
+		e.rng = r * uint32(icdf[s-1]-icdf[s])
+	} else {
+		e.rng -= r * uint32(icdf[s])
+	}
+	e.normalize()
+}
+
+// uint encodes a value in [0, ft), the bits below the top 8 are written raw.
+func (e *rangeEncoder) uint(value, ft uint32) {
+
+	ft--
+	ftb := bits.Len32(ft)
+	if ftb <= 8 {
+		e.encode(value, value+1, ft+1)
+		return
+	}
+
+	ftb -= 8
+	fl := value >> uint(ftb)
+	e.encode(fl, fl+1, ft>>uint(ftb)+1)
+	e.bits(value&(1<<uint(ftb)-1), ftb)
+}
+
+// bits writes raw bits.
+func (e *rangeEncoder) bits(value uint32, count int) {
+
+	if e.endBits+count > 32 {
+		for e.endBits >= 8 {
+			e.writeAtEnd(byte(e.endWindow))
+			e.endWindow >>= 8
+			e.endBits -= 8
+		}
+	}
+
+	e.endWindow |= value << uint(e.endBits)
+	e.endBits += count
+	e.nbits += count
+}
+
+// tell returns the number of bits used so far, rounded up.
+func (e *rangeEncoder) tell() int {
+
+	return e.nbits - bits.Len32(e.rng)
+}
+
+// tellFrac returns the number of bits used so far in 1/8 bits, rounded up.
+func (e *rangeEncoder) tellFrac() int {
+
+	l := bits.Len32(e.rng)
+	r := e.rng >> uint(l-16)
+
+	for i := 0; i < 3; i++ {
+		r = r * r >> 15
+		b := int(r >> 16)
+		l = l<<1 | b
+		r >>= uint(b)
+	}
+
+	return e.nbits<<3 - l
+}
+
+// done flushes the range and the raw bits, the unused bytes between them stay zero.
+func (e *rangeEncoder) done() []byte {
+
+	// The fewest bits which decode to the symbols whatever follows
+	l := 31 - bits.Len32(e.rng)
+	mask := uint32(rangeCodeTop-1) >> uint(l)
+	end := (e.val + mask) &^ mask
+	if end|mask >= e.val+e.rng {
+		l++
+		mask >>= 1
+		end = (e.val + mask) &^ mask
+	}
+
+	for ; l > 0; l -= 8 {
+		e.carryOut(int(end >> rangeCodeShift))
+		end = end << 8 & (rangeCodeTop - 1)
+	}
+
+	if e.rem >= 0 || e.ext > 0 {
+		e.carryOut(0)
+	}
+
+	for ; e.endBits >= 8; e.endBits -= 8 {
+		e.writeAtEnd(byte(e.endWindow))
+		e.endWindow >>= 8
+	}
+
+	if e.endBits > 0 && e.endOffs < len(e.buf) {
+		e.buf[len(e.buf)-e.endOffs-1] |= byte(e.endWindow)
+	}
+
+	return e.buf
+}
+
+func (e *rangeEncoder) normalize() {
+
+	for e.rng <= rangeCodeBot {
+		e.carryOut(int(e.val >> rangeCodeShift))
+		e.val = e.val << 8 & (rangeCodeTop - 1)
+		e.rng <<= 8
+		e.nbits += 8
+	}
+}
+
+// carryOut outputs a byte of the range, 0xff bytes are held until it's known whether a carry reaches them.
+func (e *rangeEncoder) carryOut(c int) {
+
+	if c == 0xff {
+		e.ext++
+		return
+	}
+
+	carry := c >> 8
+	if e.rem >= 0 {
+		e.write(byte(e.rem + carry))
+	}
+	for ; e.ext > 0; e.ext-- {
+		e.write(byte(0xff + carry))
+	}
+	e.rem = c & 0xff
+}
+
+// Bytes past the end of the packet are dropped, the frame encoder keeps within its size
+func (e *rangeEncoder) write(b byte) {
+
+	if e.offs+e.endOffs < len(e.buf) {
+		e.buf[e.offs] = b
+		e.offs++
+	}
+}
+
+func (e *rangeEncoder) writeAtEnd(b byte) {
+
+	if e.offs+e.endOffs < len(e.buf) {
+		e.endOffs++
+		e.buf[len(e.buf)-e.endOffs] = b
+	}
+}
+
+// laplace encodes a coarse energy delta with the Laplace-like distribution of the probability of 0
+// and the decay rate, both in 1/32768 (RFC 6716, 4.3.2.1).
+// Deltas too large for the distribution are clamped, the delta encoded is returned.
+func (e *rangeEncoder) laplace(value int, fs uint32, decay int) int {
+
+	var fl uint32
+
+	if value != 0 {
+
+		s := 0
+		if value < 0 {
+			s = -1
+		}
+		magnitude := (value + s) ^ s
+
+		fl = fs
+		fs = (32768 - 32 - fs) * uint32(16384-decay) >> 15
+
+		i := 1
+		for ; fs > 0 && i < magnitude; i++ {
+			fs *= 2
+			fl += fs + 2
+			fs = fs * uint32(decay) >> 15
+		}
+
+		if fs == 0 {
+			// Everything beyond has the minimum probability
+			max := (int(32768-fl) - s) >> 1
+			di := minInt(magnitude-i, max-1)
+			fl += uint32(2*di + 1 + s)
+			fs = 1
+			if fl >= 32768 {
+				fs = 0
+			}
+			value = (i + di + s) ^ s
+		} else {
+			fs++
+			fl += fs &^ uint32(s)
+		}
+	}
+
+	e.encodeBin(fl, fl+fs, 15)
+
+	return value
+}
@@ -0,0 +1,101 @@
+package tts
+
+import "math"
+
+// Zero crossings of the resampling filter on each side
+const resampleTaps = 16
+
+// resample returns a conversion of audio to the sample rate, in Hz, with a windowed sinc filter.
+func resample(rate int) func(audio pcm) pcm {
+
+	return func(audio pcm) pcm {
+
+		if rate == audio.sampleRate {
+			return audio
+		}
+
+		ratio := float64(rate) / float64(audio.sampleRate)
+		// Frequencies above the new Nyquist frequency are filtered out when downsampling
+		cutoff := math.Min(1, ratio)
+		width := resampleTaps / cutoff
+
+		inFrames := audio.frames()
+		frames := int(int64(inFrames) * int64(rate) / int64(audio.sampleRate))
+		samples := make([]int32, frames*audio.channels)
+		sums := make([]float64, audio.channels)
+
+		for frame := 0; frame < frames; frame++ {
+
+			center := float64(frame) / ratio
+			from := maxInt(0, int(math.Ceil(center-width)))
+			to := minInt(inFrames-1, int(math.Floor(center+width)))
+
+			for c := range sums {
+				sums[c] = 0
+			}
+
+			for i := from; i <= to; i++ {
+
+				x := (float64(i) - center) * cutoff
+				weight := cutoff * sinc(x) * blackman(x/resampleTaps)
+
+				for c := range sums {
+					sums[c] += weight * float64(audio.samples[i*audio.channels+c])
+				}
+			}
+
+			for c, sum := range sums {
+				samples[frame*audio.channels+c] = clip(sum, audio.bitsPerSample)
+			}
+		}
+
+		audio.sampleRate = rate
+		audio.samples = samples
+
+		return audio
+	}
+}
+
+func sinc(x float64) float64 {
+
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is the Blackman window over [-1, 1]
+func blackman(x float64) float64 {
+
+	return 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+}
+
+// fullScale returns the magnitude of the loudest sample of the given size
+func fullScale(bitsPerSample int) float64 {
+
+	return float64(int64(1) << uint(bitsPerSample-1))
+}
+
+// clip rounds the sample and limits it to the range of the given sample size
+func clip(sample float64, bitsPerSample int) int32 {
+
+	limit := fullScale(bitsPerSample)
+
+	return int32(math.Max(-limit, math.Min(limit-1, math.Floor(sample+0.5))))
+}
+
+func minInt(a, b int) int {
+
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -1,38 +1,114 @@
 package tts
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/filestore"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
 )
 
 type storage interface {
 
-	// Save saves the media.
+	// Save saves the media together with its MediaInfo.
 	// It returns the new media ID and an error, if any.
 	Save(data io.Reader) (string, error)
 
-	// Get retrieves the media by its ID.
-	// It returns an io.ReadCloser and an error, if any.
+	// Get retrieves the media by its ID, verifying it against its checksum.
+	// It returns an io.ReadCloser and an error (MediaCorruptedError on checksum mismatch), if any.
 	Get(id string) (io.ReadCloser, error)
 
+	// Info retrieves the MediaInfo by the media ID.
+	// It returns the MediaInfo and an error, if any.
+	Info(id string) (*MediaInfo, error)
+
+	// SaveMarks saves the timestamps of the words and sentences of the media.
+	// It returns an error, if any.
+	SaveMarks(id string, marks []Mark) error
+
+	// Marks retrieves the timestamps of the words and sentences by the media ID.
+	// It returns the marks and an error, if any.
+	Marks(id string) ([]Mark, error)
+
+	// SaveRendition saves the media transcoded to another format, e.g. "flac".
+	// It returns an error, if any.
+	SaveRendition(id string, format string, content []byte) error
+
+	// Rendition retrieves the media transcoded to the format by its ID.
+	// It returns the content and an error, if any.
+	Rendition(id string, format string) ([]byte, error)
+
 	// Delete removes the media by its ID.
 	// It returns an error, if any.
 	Delete(id string) error
+
+	// List returns IDs of all the media with a recorded MediaInfo.
+	// It returns the IDs and an error, if any.
+	List() ([]string, error)
+
+	// Verify checks the media against its recorded size and checksum.
+	// It returns MediaCorruptedError if the media is damaged or missing, or another error, if any.
+	Verify(id string) error
+
+	// Quarantine moves the media out of the way, so that it is no longer served.
+	// It returns an error, if any.
+	Quarantine(id string) error
+
+	// Rotate re-encrypts all the media with the active master key.
+	// It returns the number of re-encrypted media and an error, if any.
+	Rotate() (int, error)
+
+	// Migrate moves media stored in a single, flat directory into the sharded layout.
+	// It returns the number of moved files and an error, if any.
+	Migrate() (int, error)
+}
+
+// MediaCorruptedError is returned when the media doesn't match its recorded MediaInfo.
+type MediaCorruptedError struct {
+	Id      string
+	Message string
 }
 
-// Local file system based implementation of the storage interface
+// MediaCorruptedError implements built-in "error" interface
+func (err MediaCorruptedError) Error() string {
+
+	return err.Message
+}
+
+func corrupted(id string, reason string) MediaCorruptedError {
+
+	return MediaCorruptedError{id, "Media with ID: '" + id + "' is corrupted: " + reason}
+}
+
+// Local file system based implementation of the storage interface.
+// The media and its marks (but not its MediaInfo) are encrypted if a master key is provided.
+// Writers of the sidecars hold the media's lock, so that their changes aren't lost to a concurrent re-encryption.
 type fileSystemStorage struct {
 	baseDir string
+	keys    *envelope.Keyring
+	locks   *layout.Locks
 }
 
 // https://golang.org/doc/faq#methods_on_values_or_pointers
 func (s fileSystemStorage) Save(data io.Reader) (string, error) {
 
 	id := strconv.FormatInt(time.Now().UnixNano(), 10)
-	path := s.createPathFor(id)
+	path, err := layout.Create(s.baseDir, id, id)
+
+	if err != nil {
+
+		return "", err
+	}
 
 	file, err := os.Create(path)
 
@@ -41,9 +117,28 @@ func (s fileSystemStorage) Save(data io.Reader) (string, error) {
 		return "", err
 	}
 
-	defer file.Close()
+	// The media is sealed in segments as it's copied, so that it's never held in memory
+	sealer, err := s.keys.NewWriter(file)
+	inspector := newMediaInspector()
+
+	if err == nil {
+		_, err = io.Copy(sealer, io.TeeReader(data, inspector))
+	}
+
+	if err == nil {
+		err = sealer.Close()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+
+		return "", err
+	}
 
-	_, err = io.Copy(file, data)
+	err = s.saveInfo(id, inspector.Info())
 
 	if err != nil {
 
@@ -55,42 +150,414 @@ func (s fileSystemStorage) Save(data io.Reader) (string, error) {
 
 func (s fileSystemStorage) Get(id string) (io.ReadCloser, error) {
 
-	path := s.createPathFor(id)
+	// Verified before it's served, so that no corrupted media is sent.
+	// It's read twice rather than held in memory.
+	err := s.verify(id)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return s.open(id)
+}
+
+func (s fileSystemStorage) Info(id string) (*MediaInfo, error) {
+
+	content, err := s.readFile(id, id+infoSuffix)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	info := &MediaInfo{}
+	err = json.Unmarshal(content, info)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (s fileSystemStorage) SaveMarks(id string, marks []Mark) error {
+
+	content, err := json.Marshal(marks)
+
+	if err != nil {
+
+		return err
+	}
+
+	// Marks reveal the text, just like the media
+	sealed, err := s.keys.Seal(content)
+
+	if err != nil {
+
+		return err
+	}
+
+	defer s.locks.Lock(id)()
+
+	return ioutil.WriteFile(layout.Path(s.baseDir, id, id+marksSuffix), sealed, 0666)
+}
+
+func (s fileSystemStorage) Marks(id string) ([]Mark, error) {
+
+	content, err := s.readFile(id, id+marksSuffix)
+
+	if err != nil {
+
+		return nil, err
+	}
 
-	file, err := os.Open(path)
+	marks := []Mark{}
+	err = json.Unmarshal(content, &marks)
 
 	if err != nil {
 
 		return nil, err
 	}
 
-	return file, nil
+	return marks, nil
+}
+
+func (s fileSystemStorage) SaveRendition(id string, format string, content []byte) error {
+
+	sealed, err := s.keys.Seal(content)
+
+	if err != nil {
+
+		return err
+	}
+
+	defer s.locks.Lock(id)()
+
+	return ioutil.WriteFile(layout.Path(s.baseDir, id, id+"."+format), sealed, 0666)
+}
+
+func (s fileSystemStorage) Rendition(id string, format string) ([]byte, error) {
+
+	return s.readFile(id, id+"."+format)
 }
 
 func (s fileSystemStorage) Delete(id string) error {
 
-	path := s.createPathFor(id)
-	return os.Remove(path)
+	defer s.locks.Lock(id)()
+
+	err := layout.Remove(s.baseDir, id, id)
+
+	if err != nil {
+
+		return err
+	}
+
+	// Media saved before the metadata or marks were introduced has no sidecars
+	for _, name := range sidecars(id) {
+
+		err = layout.Remove(s.baseDir, id, name)
+
+		if err != nil && !os.IsNotExist(err) {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s fileSystemStorage) List() ([]string, error) {
+
+	names, err := layout.List(s.baseDir, func(name string) bool {
+
+		return strings.HasSuffix(name, infoSuffix)
+	})
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	ids := []string{}
+
+	for _, name := range names {
+		ids = append(ids, strings.TrimSuffix(name, infoSuffix))
+	}
+
+	return ids, nil
+}
+
+func (s fileSystemStorage) Verify(id string) error {
+
+	err := s.verify(id)
+
+	if os.IsNotExist(err) {
+
+		return corrupted(id, "media is missing")
+	}
+
+	return err
+}
+
+func (s fileSystemStorage) Rotate() (int, error) {
+
+	ids, err := s.List()
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	count := 0
+
+	for _, id := range ids {
+
+		rotated, err := s.rotate(id)
+
+		if err != nil {
+
+			return count, err
+		}
+
+		if rotated {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// rotate re-encrypts the media and its sidecars
+func (s fileSystemStorage) rotate(id string) (bool, error) {
+
+	defer s.locks.Lock(id)()
+
+	rotated, err := s.keys.RotateFile(s.createPathFor(id))
+
+	if err != nil && !os.IsNotExist(err) {
+
+		return false, err
+	}
+
+	for _, name := range sidecars(id) {
+
+		_, err = s.keys.RotateFile(layout.Locate(s.baseDir, id, name))
+
+		if err != nil && !os.IsNotExist(err) {
+
+			return rotated, err
+		}
+	}
+
+	return rotated, nil
+}
+
+func (s fileSystemStorage) Migrate() (int, error) {
+
+	return layout.Migrate(s.baseDir, s.locks, mediaIdOf)
+}
+
+func (s fileSystemStorage) Quarantine(id string) error {
+
+	defer s.locks.Lock(id)()
+
+	dir := s.baseDir + separator + quarantineDir
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, name := range append([]string{id}, sidecars(id)...) {
+
+		err = os.Rename(layout.Locate(s.baseDir, id, name), dir+separator+name)
+
+		if err != nil && !os.IsNotExist(err) {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// open opens the media, its content is decrypted as it's read
+func (s fileSystemStorage) open(id string) (io.ReadCloser, error) {
+
+	var media io.ReadCloser
+
+	err := layout.Read(s.baseDir, id, id, func(path string) (err error) {
+
+		media, err = s.keys.OpenFile(path)
+		return err
+	})
+
+	if err == envelope.ErrCorrupted {
+
+		return nil, corrupted(id, err.Error())
+	}
+
+	return media, err
+}
+
+// verify reads the media through, comparing it with the recorded MediaInfo.
+func (s fileSystemStorage) verify(id string) error {
+
+	media, err := s.open(id)
+
+	if err != nil {
+
+		return err
+	}
+
+	defer media.Close()
+
+	info, err := s.Info(id)
+
+	// Media saved before the metadata was introduced can't be verified
+	if os.IsNotExist(err) {
+
+		return nil
+	}
+
+	if err != nil {
+
+		return err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, media)
+
+	if err == envelope.ErrCorrupted {
+
+		return corrupted(id, err.Error())
+	}
+
+	if err != nil {
+
+		return err
+	}
+
+	if size != info.Size {
+
+		return corrupted(id, fmt.Sprintf("expected %d bytes, found %d", info.Size, size))
+	}
+
+	if checksum := hash.Sum(nil); hex.EncodeToString(checksum) != info.Checksum {
+
+		return corrupted(id, "checksum mismatch")
+	}
+
+	return nil
+}
+
+func (s fileSystemStorage) saveInfo(id string, info *MediaInfo) error {
+
+	content, err := json.Marshal(info)
+
+	if err != nil {
+
+		return err
+	}
+
+	// The checksum would tell which media are the same
+	sealed, err := s.keys.Seal(content)
+
+	if err != nil {
+
+		return err
+	}
+
+	return ioutil.WriteFile(layout.Path(s.baseDir, id, id+infoSuffix), sealed, 0666)
 }
 
 // Constructor for the fileSystemStorage
 func newFileSystemStorage() *fileSystemStorage {
 
-        value := os.Getenv("TTS_BASE_DIR")
+	value := filestore.BaseDir("TTS_BASE_DIR", "media")
+
+	// Media is listed, e.g. by the scrub, before any is stored
+	if err := os.MkdirAll(value, 0700); err != nil {
+
+		log.Fatalf("Can't create %s: %v", value, err)
+	}
+
+	keys, err := envelope.NewKeyring()
 
-        if len(value) == 0 {
+	if err != nil {
 
-                value = os.TempDir()
-                log.Printf("TTS_BASE_DIR not provided. Using %s", value)
-        }
+		log.Fatalf("Can't load encryption keys: %v", err)
+	}
 
-        return &fileSystemStorage{baseDir: value}
+	return &fileSystemStorage{baseDir: value, keys: keys, locks: &layout.Locks{}}
 }
 
+// Corrupted media is moved to this subdirectory of the base directory
+const quarantineDir = "quarantine"
+
 // We need to distinguish between different path separator (Windows, Linux)
 const separator = string(os.PathSeparator)
 
 func (s fileSystemStorage) createPathFor(id string) string {
 
-	return s.baseDir + separator + id
+	return layout.Locate(s.baseDir, id, id)
+}
+
+// readFile returns the decrypted content of the media's file, e.g. its MediaInfo
+func (s fileSystemStorage) readFile(id, name string) ([]byte, error) {
+
+	var content []byte
+
+	err := layout.Read(s.baseDir, id, name, func(path string) (err error) {
+
+		content, err = s.keys.ReadFile(path)
+		return err
+	})
+
+	return content, err
+}
+
+// MediaInfo is stored in a sidecar file next to the media, encrypted like the media.
+// The suffix distinguishes it from other JSON files kept in the same directory (e.g. persistence records).
+const infoSuffix = ".info.json"
+
+func (s fileSystemStorage) createInfoPathFor(id string) string {
+
+	return layout.Locate(s.baseDir, id, id+infoSuffix)
+}
+
+// Marks are stored in a sidecar file next to the media, encrypted like the media
+const marksSuffix = ".marks.json"
+
+func (s fileSystemStorage) createMarksPathFor(id string) string {
+
+	return layout.Locate(s.baseDir, id, id+marksSuffix)
+}
+
+// Renditions are stored next to the media, named after their format, e.g. "123.flac"
+func sidecars(id string) []string {
+
+	names := []string{id + infoSuffix, id + marksSuffix}
+
+	for _, format := range TranscodeFormats {
+		names = append(names, id+"."+format)
+	}
+
+	return names
+}
+
+// Media files are named after their IDs, which are numeric
+func mediaIdOf(name string) (string, bool) {
+
+	id := strings.TrimSuffix(name, infoSuffix)
+
+	if len(id) == 0 || strings.TrimLeft(id, "0123456789") != "" {
+
+		return "", false
+	}
+
+	return id, true
 }
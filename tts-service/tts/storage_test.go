@@ -1,11 +1,14 @@
 package tts
 
 import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/envelope"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/layout"
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestStorage(t *testing.T) {
@@ -13,7 +16,7 @@ func TestStorage(t *testing.T) {
 	Convey("File system based storage", t, func(c C) {
 
 		baseDir, _ := ioutil.TempDir("", "test")
-		defer os.Remove(baseDir)
+		defer os.RemoveAll(baseDir)
 
 		os.Setenv("TTS_BASE_DIR", baseDir)
 		defer os.Unsetenv("TTS_BASE_DIR")
@@ -48,12 +51,223 @@ func TestStorage(t *testing.T) {
 			So(err, ShouldNotBeNil)
 		})
 
+		Convey("should save media info alongside media", func() {
+
+			data := "This is just a simple test"
+
+			id, _ := storage.Save(strings.NewReader(data))
+			info, err := storage.Info(id)
+
+			So(err, ShouldBeNil)
+			So(info.Size, ShouldEqual, len(data))
+			So(info.Checksum, ShouldEqual, "3a394f8a00eae2ce335921b7d45035525146085e718c08498f9d5bb9a75bc15e")
+		})
+
+		Convey("should detect truncated media", func() {
+
+			id, _ := storage.Save(strings.NewReader("This is just a simple test"))
+			os.Truncate(storage.createPathFor(id), 4)
+
+			_, err := storage.Get(id)
+
+			So(err, ShouldHaveSameTypeAs, MediaCorruptedError{})
+			So(storage.Verify(id), ShouldHaveSameTypeAs, MediaCorruptedError{})
+		})
+
+		Convey("should detect modified media", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+			ioutil.WriteFile(storage.createPathFor(id), []byte("TEST"), 0666)
+
+			_, err := storage.Get(id)
+
+			So(err, ShouldHaveSameTypeAs, MediaCorruptedError{})
+			So(err.Error(), ShouldEqual, "Media with ID: '"+id+"' is corrupted: checksum mismatch")
+		})
+
+		Convey("should detect missing media", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+			os.Remove(storage.createPathFor(id))
+
+			So(storage.Verify(id), ShouldHaveSameTypeAs, MediaCorruptedError{})
+		})
+
+		Convey("should list and quarantine media", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+
+			ids, err := storage.List()
+			So(err, ShouldBeNil)
+			So(ids, ShouldContain, id)
+
+			err = storage.Quarantine(id)
+			So(err, ShouldBeNil)
+
+			ids, _ = storage.List()
+			So(ids, ShouldNotContain, id)
+
+			_, err = storage.Get(id)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should encrypt media if a master key is provided", func() {
+
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			storage := newFileSystemStorage()
+			data := "This is just a simple test"
+
+			id, _ := storage.Save(strings.NewReader(data))
+
+			stored, _ := ioutil.ReadFile(storage.createPathFor(id))
+			So(string(stored), ShouldNotContainSubstring, data)
+
+			info, _ := storage.Info(id)
+			stored, _ = ioutil.ReadFile(storage.createInfoPathFor(id))
+			So(string(stored), ShouldNotContainSubstring, info.Checksum)
+
+			reader, err := storage.Get(id)
+			So(err, ShouldBeNil)
+
+			content, _ := ioutil.ReadAll(reader)
+			So(string(content), ShouldEqual, data)
+		})
+
+		Convey("should stream encrypted media larger than a segment", func() {
+
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			storage := newFileSystemStorage()
+			data := strings.Repeat("This is just a simple test. ", 10000)
+
+			id, err := storage.Save(strings.NewReader(data))
+			So(err, ShouldBeNil)
+
+			reader, err := storage.Get(id)
+			So(err, ShouldBeNil)
+
+			content, _ := ioutil.ReadAll(reader)
+			reader.Close()
+			So(string(content), ShouldEqual, data)
+
+			stored, _ := ioutil.ReadFile(storage.createPathFor(id))
+			stored[len(stored)/2] ^= 0xff
+			ioutil.WriteFile(storage.createPathFor(id), stored, 0666)
+
+			_, err = storage.Get(id)
+			So(err, ShouldHaveSameTypeAs, MediaCorruptedError{})
+		})
+
+		Convey("should re-encrypt media stored before the encryption was enabled", func() {
+
+			id, _ := storage.Save(strings.NewReader("This is just a simple test"))
+
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			encrypting := newFileSystemStorage()
+			count, err := encrypting.Rotate()
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+			So(encrypting.Verify(id), ShouldBeNil)
+
+			stored, _ := ioutil.ReadFile(storage.createPathFor(id))
+			So(string(stored), ShouldNotContainSubstring, "simple test")
+
+			stored, _ = ioutil.ReadFile(storage.createInfoPathFor(id))
+			So(envelope.IsSealed(stored), ShouldBeTrue)
+		})
+
+		Convey("should shard media into subdirectories", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+
+			So(storage.createPathFor(id), ShouldStartWith, layout.Dir(baseDir, id))
+			So(storage.createInfoPathFor(id), ShouldStartWith, layout.Dir(baseDir, id))
+		})
+
+		Convey("should find and migrate media stored in a flat directory", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+
+			// Simulate media stored before the sharding was introduced
+			for _, name := range []string{id, id + infoSuffix} {
+				os.Rename(layout.Path(baseDir, id, name), layout.FlatPath(baseDir, name))
+			}
+
+			So(storage.Verify(id), ShouldBeNil)
+
+			ids, _ := storage.List()
+			So(ids, ShouldContain, id)
+
+			count, err := storage.Migrate()
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(storage.createPathFor(id), ShouldStartWith, layout.Dir(baseDir, id))
+			So(storage.Verify(id), ShouldBeNil)
+		})
+
+		Convey("should save encrypted marks alongside media", func() {
+
+			os.Setenv("ENCRYPTION_MASTER_KEY", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+			defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
+
+			storage := newFileSystemStorage()
+			marks := []Mark{{Type: MarkWord, Text: "secret", Start: time.Second, End: 2 * time.Second}}
+
+			id, _ := storage.Save(strings.NewReader("test"))
+			err := storage.SaveMarks(id, marks)
+			So(err, ShouldBeNil)
+
+			stored, _ := ioutil.ReadFile(storage.createMarksPathFor(id))
+			So(string(stored), ShouldNotContainSubstring, "secret")
+
+			saved, err := storage.Marks(id)
+			So(err, ShouldBeNil)
+			So(saved, ShouldResemble, marks)
+		})
+
+		Convey("should return an error if marks do not exist", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+			_, err := storage.Marks(id)
+
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("should save renditions alongside media", func() {
+
+			id, _ := storage.Save(strings.NewReader("test"))
+			err := storage.SaveRendition(id, "flac", []byte("fLaC"))
+			So(err, ShouldBeNil)
+
+			saved, err := storage.Rendition(id, "flac")
+			So(err, ShouldBeNil)
+			So(string(saved), ShouldEqual, "fLaC")
+
+			_, err = storage.Rendition(id, "wav")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
 		Convey("should remove media", func() {
 
 			id, _ := storage.Save(strings.NewReader("test"))
+			storage.SaveMarks(id, []Mark{})
+			storage.SaveRendition(id, "wav", []byte("RIFF"))
 			err := storage.Delete(id)
 
 			So(err, ShouldBeNil)
+
+			_, err = storage.Marks(id)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			_, err = storage.Rendition(id, "wav")
+			So(os.IsNotExist(err), ShouldBeTrue)
 		})
 	})
 }
@@ -0,0 +1,479 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TranscodeFormats are the formats the media can be transcoded to, regardless of the format of the converter.
+var TranscodeFormats = []string{"wav", "flac", "opus"}
+
+// MIME types of the formats
+var formatTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"wav":  "audio/wav",
+	"flac": "audio/flac",
+	"opus": "audio/ogg",
+}
+
+// FormatOf returns the format of the given MIME type, e.g. "flac" for "audio/flac", or "" if it's unknown.
+func FormatOf(mimeType string) string {
+
+	for format, t := range formatTypes {
+		if t == mimeType {
+			return format
+		}
+	}
+
+	return ""
+}
+
+// FormatError is returned when the media can't be provided in the requested format.
+type FormatError struct {
+	Id      string
+	Format  string
+	Message string
+}
+
+// FormatError implements built-in "error" interface
+func (err FormatError) Error() string {
+
+	return err.Message
+}
+
+// pcm is decoded audio. Samples of all the channels are interleaved.
+type pcm struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+	samples       []int32
+
+	trimmed time.Duration // cut from the beginning, see trimSilence
+}
+
+// frames returns the number of samples of each channel
+func (p pcm) frames() int {
+
+	return len(p.samples) / p.channels
+}
+
+// frame returns the number of samples of each channel played in the given time
+func (p pcm) frame(d time.Duration) int {
+
+	return int(int64(d) * int64(p.sampleRate) / int64(time.Second))
+}
+
+// duration returns the time the given number of samples of each channel is played
+func (p pcm) duration(frames int) time.Duration {
+
+	return time.Duration(int64(frames) * int64(time.Second) / int64(p.sampleRate))
+}
+
+// transcode decodes the media and encodes it in the given format.
+func transcode(media []byte, format string) ([]byte, error) {
+
+	var encode func(pcm) []byte
+
+	switch format {
+	case "wav":
+		encode = encodeWav
+	case "flac":
+		encode = encodeFlac
+	case "opus":
+		encode = encodeOpus
+	default:
+		return nil, fmt.Errorf("Unknown format: %s", format)
+	}
+
+	decode := decodePcm
+	if probe(media, int64(len(media))).MimeType == "audio/mpeg" {
+		decode = decodeMp3
+	}
+
+	audio, err := decode(media)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return encode(audio), nil
+}
+
+// decodePcm decodes uncompressed WAV media.
+// MP3 media is decoded only to be transcoded, see decodeMp3, since the other stages produce WAV.
+func decodePcm(media []byte) (pcm, error) {
+
+	var audio pcm
+
+	if info := probe(media, int64(len(media))); info.MimeType != "audio/wav" {
+
+		return audio, fmt.Errorf("Can't decode %s media", info.Codec)
+	}
+
+	format, data, err := parseWav(media)
+
+	if err != nil {
+
+		return audio, err
+	}
+
+	// Extensible format (0xfffe) is used for PCM with more than 2 channels
+	if len(format) < 16 || (binary.LittleEndian.Uint16(format[0:2]) != 1 && binary.LittleEndian.Uint16(format[0:2]) != 0xfffe) {
+
+		return audio, errors.New("Can't decode compressed WAV media")
+	}
+
+	audio.channels = int(binary.LittleEndian.Uint16(format[2:4]))
+	audio.sampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+	audio.bitsPerSample = int(binary.LittleEndian.Uint16(format[14:16]))
+
+	if audio.channels < 1 || audio.channels > 8 || audio.sampleRate <= 0 {
+
+		return audio, errors.New("Invalid WAV format")
+	}
+
+	width := audio.bitsPerSample / 8
+	if audio.bitsPerSample%8 != 0 || width < 1 || width > 3 {
+
+		return audio, fmt.Errorf("Can't decode %d bit samples", audio.bitsPerSample)
+	}
+
+	// Incomplete frames at the end are dropped
+	count := len(data) / (width * audio.channels) * audio.channels
+	audio.samples = make([]int32, count)
+
+	for i := range audio.samples {
+
+		b := data[i*width:]
+
+		switch width {
+		case 1:
+			// 8 bit samples are unsigned
+			audio.samples[i] = int32(b[0]) - 0x80
+		case 2:
+			audio.samples[i] = int32(int16(binary.LittleEndian.Uint16(b)))
+		case 3:
+			audio.samples[i] = int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		}
+	}
+
+	return audio, nil
+}
+
+// encodeWav encodes the samples as uncompressed WAV media.
+func encodeWav(audio pcm) []byte {
+
+	width := audio.bitsPerSample / 8
+	blockAlign := width * audio.channels
+
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:2], 1)
+	binary.LittleEndian.PutUint16(format[2:4], uint16(audio.channels))
+	binary.LittleEndian.PutUint32(format[4:8], uint32(audio.sampleRate))
+	binary.LittleEndian.PutUint32(format[8:12], uint32(audio.sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(format[12:14], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(format[14:16], uint16(audio.bitsPerSample))
+
+	samples := make([]byte, len(audio.samples)*width)
+
+	for i, s := range audio.samples {
+
+		b := samples[i*width:]
+
+		switch width {
+		case 1:
+			b[0] = byte(s + 0x80)
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(s))
+		case 3:
+			b[0], b[1], b[2] = byte(s), byte(s>>8), byte(s>>16)
+		}
+	}
+
+	return buildWav(format, samples)
+}
+
+// Samples of each channel in a FLAC frame
+const flacBlockSize = 4096
+
+// encodeFlac encodes the samples losslessly, with the best fixed predictor of each subframe
+// and Rice coded residuals.
+// https://xiph.org/flac/format.html
+func encodeFlac(audio pcm) []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("fLaC")
+
+	// The only metadata block, STREAMINFO
+	b.Write([]byte{0x80, 0, 0, 34})
+
+	w := &bitWriter{}
+	w.write(flacBlockSize, 16)
+	w.write(flacBlockSize, 16)
+	w.write(0, 24) // unknown frame sizes
+	w.write(0, 24)
+	w.write(uint64(audio.sampleRate), 20)
+	w.write(uint64(audio.channels-1), 3)
+	w.write(uint64(audio.bitsPerSample-1), 5)
+	w.write(uint64(audio.frames()), 36)
+	w.write(0, 64) // unknown MD5
+	w.write(0, 64)
+	b.Write(w.bytes())
+
+	for n, start := 0, 0; start < audio.frames(); n, start = n+1, start+flacBlockSize {
+
+		size := audio.frames() - start
+		if size > flacBlockSize {
+			size = flacBlockSize
+		}
+
+		b.Write(flacFrame(audio, n, start, size))
+	}
+
+	return b.Bytes()
+}
+
+// flacFrame encodes the n-th block of samples
+func flacFrame(audio pcm, n int, start int, size int) []byte {
+
+	w := &bitWriter{}
+
+	w.write(0xfff8, 16)                  // sync code, fixed block size
+	w.write(0x7, 4)                      // block size in 16 bits at the end of the header
+	w.write(0x0, 4)                      // sample rate from STREAMINFO
+	w.write(uint64(audio.channels-1), 4) // independent channels
+	w.write(0x0, 3)                      // sample size from STREAMINFO
+	w.write(0, 1)                        // reserved
+	w.writeBytes(utf8Number(uint64(n)))  // frame number
+	w.write(uint64(size-1), 16)          // block size
+	w.writeBytes([]byte{crc8(w.bytes())})
+
+	channel := make([]int32, size)
+
+	for c := 0; c < audio.channels; c++ {
+
+		for i := range channel {
+			channel[i] = audio.samples[(start+i)*audio.channels+c]
+		}
+
+		flacSubframe(w, channel, audio.bitsPerSample)
+	}
+
+	frame := w.bytes()
+	crc := crc16(frame)
+
+	return append(frame, byte(crc>>8), byte(crc))
+}
+
+// flacSubframe encodes the samples of a channel with the fixed predictor of the smallest residuals
+func flacSubframe(w *bitWriter, samples []int32, bitsPerSample int) {
+
+	bestOrder, bestResiduals, bestParameter, bestSize := 0, []int64(nil), 0, -1
+
+	for order := 0; order <= 4 && order < len(samples); order++ {
+
+		residuals := fixedResiduals(samples, order)
+		parameter, size := riceParameter(residuals)
+
+		if bestSize < 0 || size < bestSize {
+			bestOrder, bestResiduals, bestParameter, bestSize = order, residuals, parameter, size
+		}
+	}
+
+	w.write(0, 1)                      // padding
+	w.write(uint64(0x08|bestOrder), 6) // FIXED subframe
+	w.write(0, 1)                      // no wasted bits
+
+	for _, s := range samples[:bestOrder] {
+		w.write(uint64(s), bitsPerSample)
+	}
+
+	w.write(0, 2) // Rice coding with 4 bit parameters
+	w.write(0, 4) // a single partition
+	w.write(uint64(bestParameter), 4)
+
+	for _, r := range bestResiduals {
+
+		u := uint64(r<<1 ^ r>>63)
+
+		for q := u >> uint(bestParameter); q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(u, bestParameter)
+	}
+}
+
+// fixedResiduals returns the differences between the samples and their predictions of the given order
+func fixedResiduals(samples []int32, order int) []int64 {
+
+	residuals := make([]int64, 0, len(samples)-order)
+
+	for i := order; i < len(samples); i++ {
+
+		s := func(k int) int64 { return int64(samples[i-k]) }
+
+		var prediction int64
+
+		switch order {
+		case 1:
+			prediction = s(1)
+		case 2:
+			prediction = 2*s(1) - s(2)
+		case 3:
+			prediction = 3*s(1) - 3*s(2) + s(3)
+		case 4:
+			prediction = 4*s(1) - 6*s(2) + 4*s(3) - s(4)
+		}
+
+		residuals = append(residuals, s(0)-prediction)
+	}
+
+	return residuals
+}
+
+// riceParameter returns the Rice parameter encoding the residuals in the fewest bits, and the number of bits
+func riceParameter(residuals []int64) (int, int) {
+
+	bestParameter, bestSize := 0, -1
+
+	// 15 is reserved for unencoded residuals
+	for parameter := 0; parameter < 15; parameter++ {
+
+		size := 0
+
+		for _, r := range residuals {
+			size += int(uint64(r<<1^r>>63)>>uint(parameter)) + 1 + parameter
+		}
+
+		if bestSize < 0 || size < bestSize {
+			bestParameter, bestSize = parameter, size
+		}
+	}
+
+	return bestParameter, bestSize
+}
+
+// utf8Number encodes the number like UTF-8 encodes runes, extended to 36 bits
+func utf8Number(n uint64) []byte {
+
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var continuation []byte
+	bits := 6 // bits left in the first byte
+
+	for ; n >= 1<<uint(bits); bits-- {
+		continuation = append([]byte{0x80 | byte(n&0x3f)}, continuation...)
+		n >>= 6
+	}
+
+	first := byte(0xff<<uint(bits+1)) | byte(n)
+
+	return append([]byte{first}, continuation...)
+}
+
+// bitWriter writes values of any number of bits, most significant bit first
+type bitWriter struct {
+	buf  []byte
+	bits uint // bits used in the last byte, 0 if it's full
+}
+
+func (w *bitWriter) write(value uint64, bits int) {
+
+	for i := bits - 1; i >= 0; i-- {
+
+		if w.bits == 0 {
+			w.buf = append(w.buf, 0)
+		}
+
+		w.buf[len(w.buf)-1] |= byte(value>>uint(i)&1) << (7 - w.bits)
+		w.bits = (w.bits + 1) % 8
+	}
+}
+
+func (w *bitWriter) writeBytes(b []byte) {
+
+	for _, c := range b {
+		w.write(uint64(c), 8)
+	}
+}
+
+// bytes returns the written bits, padded with zeros to a full byte
+func (w *bitWriter) bytes() []byte {
+
+	return w.buf
+}
+
+// bitReader reads values of any number of bits, most significant bit first.
+// Bits past the end are read as zeros.
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+}
+
+func (r *bitReader) read(bits int) uint64 {
+
+	var value uint64
+
+	for i := 0; i < bits; i++ {
+
+		var bit byte
+		if r.pos/8 < len(r.buf) {
+			bit = r.buf[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		}
+
+		value = value<<1 | uint64(bit)
+		r.pos++
+	}
+
+	return value
+}
+
+// CRC-8 of FLAC frame headers, polynomial x^8 + x^2 + x^1 + x^0
+func crc8(data []byte) byte {
+
+	var crc byte
+
+	for _, b := range data {
+
+		crc ^= b
+
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// CRC-16 of FLAC frames, polynomial x^16 + x^15 + x^2 + x^0
+func crc16(data []byte) uint16 {
+
+	var crc uint16
+
+	for _, b := range data {
+
+		crc ^= uint16(b) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
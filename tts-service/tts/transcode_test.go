@@ -0,0 +1,195 @@
+package tts
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+
+	Convey("Media transcoding", t, func() {
+
+		// A tone with some noise, longer than a FLAC block
+		audio := pcm{sampleRate: 16000, channels: 2, bitsPerSample: 16}
+		for i := 0; i < 2*(flacBlockSize+1000); i++ {
+			audio.samples = append(audio.samples, int32(12000*math.Sin(float64(i/2)/7))+int32(i*7919%61)-30)
+		}
+		wav := encodeWav(audio)
+
+		Convey("should encode lossless FLAC", func() {
+
+			media, err := transcode(wav, "flac")
+
+			So(err, ShouldBeNil)
+
+			info := probe(media, int64(len(media)))
+			So(info.MimeType, ShouldEqual, "audio/flac")
+			So(info.SampleRate, ShouldEqual, 16000)
+			So(info.Channels, ShouldEqual, 2)
+			So(info.Duration, ShouldEqual, probe(wav, int64(len(wav))).Duration)
+
+			decoded, err := decodeFlac(media)
+
+			So(err, ShouldBeNil)
+			So(decoded.samples, ShouldResemble, audio.samples)
+			So(len(media), ShouldBeLessThan, len(wav)*3/4)
+		})
+
+		Convey("should encode Ogg Opus", func() {
+
+			media, err := transcode(wav, "opus")
+
+			So(err, ShouldBeNil)
+
+			info := probe(media, int64(len(media)))
+			So(info.MimeType, ShouldEqual, "audio/ogg")
+			So(info.Codec, ShouldEqual, "opus")
+			So(info.SampleRate, ShouldEqual, 48000)
+			So(info.Channels, ShouldEqual, 2)
+			So(info.Duration, ShouldEqual, probe(wav, int64(len(wav))).Duration)
+		})
+
+		Convey("should encode WAV of any sample size", func() {
+
+			for _, bits := range []int{8, 16, 24} {
+
+				audio := pcm{sampleRate: 8000, channels: 1, bitsPerSample: bits, samples: []int32{0, 1, -1, 100, -100}}
+
+				decoded, err := decodePcm(encodeWav(audio))
+
+				So(err, ShouldBeNil)
+				So(decoded, ShouldResemble, audio)
+			}
+		})
+
+		Convey("should encode FLAC frame numbers like UTF-8", func() {
+
+			So(utf8Number(0x41), ShouldResemble, []byte("A"))
+			So(utf8Number(0x105), ShouldResemble, []byte("ą"))
+			So(utf8Number(0x20ac), ShouldResemble, []byte("€"))
+		})
+
+		Convey("should transcode MP3 media", func() {
+
+			mp3, _ := ioutil.ReadFile("testdata" + string(os.PathSeparator) + "test")
+
+			media, err := transcode(mp3, "wav")
+			So(err, ShouldBeNil)
+
+			decoded, err := decodePcm(media)
+			So(err, ShouldBeNil)
+			So(decoded.sampleRate, ShouldEqual, 8000)
+			So(decoded.channels, ShouldEqual, 1)
+			So(decoded.frames(), ShouldEqual, 21888)
+		})
+
+		Convey("should reject media it can't decode", func() {
+
+			_, err := transcode([]byte("OggS not really"), "wav")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "Can't decode")
+		})
+
+		Convey("should reject unknown formats", func() {
+
+			_, err := transcode(wav, "aac")
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "Unknown format: aac")
+		})
+	})
+}
+
+// decodeFlac decodes FLAC media with fixed subframes, checking the CRCs
+func decodeFlac(media []byte) (pcm, error) {
+
+	var audio pcm
+
+	r := &bitReader{buf: media[8:]}
+	r.read(16 + 16 + 24 + 24)
+	audio.sampleRate = int(r.read(20))
+	audio.channels = int(r.read(3)) + 1
+	audio.bitsPerSample = int(r.read(5)) + 1
+	total := int(r.read(36))
+
+	frames := media[8+34:]
+	channels := make([][]int32, audio.channels)
+
+	for len(frames) > 0 {
+
+		r := &bitReader{buf: frames}
+
+		if r.read(16) != 0xfff8 || r.read(4) != 0x7 || r.read(4) != 0 || int(r.read(4)) != audio.channels-1 || r.read(4) != 0 {
+			return audio, errors.New("Unexpected frame header")
+		}
+
+		// Frame number
+		for first := r.read(8); first&0x80 != 0 && first&0x40 != 0; first <<= 1 {
+			r.read(8)
+		}
+
+		size := int(r.read(16)) + 1
+		if byte(r.read(8)) != crc8(frames[:r.pos/8-1]) {
+			return audio, errors.New("Header CRC mismatch")
+		}
+
+		for c := range channels {
+
+			padding, kind, wasted := r.read(1), r.read(6), r.read(1)
+			if padding != 0 || kind&0x38 != 0x08 || wasted != 0 {
+				return audio, errors.New("Unexpected subframe")
+			}
+			order := int(kind & 0x07)
+
+			samples := make([]int32, 0, size)
+			for i := 0; i < order; i++ {
+				samples = append(samples, r.signed(audio.bitsPerSample))
+			}
+
+			r.read(6)
+			parameter := uint(r.read(4))
+
+			for i := order; i < size; i++ {
+
+				q := uint64(0)
+				for r.read(1) == 0 {
+					q++
+				}
+				u := q<<parameter | r.read(int(parameter))
+				residual := int64(u>>1) ^ -int64(u&1)
+
+				// The residual of a zero sample is the negated prediction
+				prediction := -fixedResiduals(append(samples, 0)[i-order:], order)[0]
+				samples = append(samples, int32(residual+prediction))
+			}
+
+			channels[c] = append(channels[c], samples...)
+		}
+
+		length := (r.pos+7)/8 + 2
+		if crc16(frames[:length]) != 0 {
+			return audio, errors.New("Frame CRC mismatch")
+		}
+		frames = frames[length:]
+	}
+
+	for i := 0; i < total; i++ {
+		for c := range channels {
+			audio.samples = append(audio.samples, channels[c][i])
+		}
+	}
+
+	return audio, nil
+}
+
+func (r *bitReader) signed(bits int) int32 {
+
+	shift := 64 - uint(bits)
+
+	return int32(int64(r.read(bits)<<shift) >> shift)
+}
@@ -0,0 +1,221 @@
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+)
+
+//Handles POST /media:archive with the IDs of the voice messages
+func onCreateArchiveRequest(h archiveHandling, w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto ArchiveRequestDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	if len(dto.IDs) == 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errEmptyArchive, nil}, w, r)
+		return
+	}
+
+	if len(dto.IDs) > maxBatchSize {
+		handleError(ErrorDTO{http.StatusRequestEntityTooLarge, fmt.Sprintf(errArchiveTooLarge, maxBatchSize), nil}, w, r)
+		return
+	}
+
+	sendArchive(h, "media", ArchiveManifestDTO{}, dto.IDs, w, r)
+}
+
+//Handles GET /batches/{id}/archive
+func onGetBatchArchiveRequest(h batchHandling, id string, w http.ResponseWriter, r *http.Request) {
+	batch, err := h.batches.Get(id)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	//Rejected items, and the ones not created yet, have no voice messages
+	ids := []string{}
+	for _, item := range batch.Items {
+		if item.Id != "" {
+			ids = append(ids, item.Id)
+		}
+	}
+
+	sendArchive(h.archive, "batch-"+id, ArchiveManifestDTO{Batch: id}, ids, w, r)
+}
+
+//Streams the media of the ready voice messages, a file at a time, followed by the manifest listing them
+//Media that can't be read is skipped. Once the archive is started, errors can't be responded with, so if a media fails
+//while it's written, the archive is cut short instead
+func sendArchive(h archiveHandling, name string, manifest ArchiveManifestDTO, ids []string, w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get(formatParam)
+	if format == "" {
+		format = archiveZip
+	}
+
+	newArchive, ok := archiveFormats[format]
+	if !ok {
+		handleError(ErrorDTO{http.StatusBadRequest, errArchiveFormat + format, nil}, w, r)
+		return
+	}
+
+	manifest.Created = time.Now().UTC().Truncate(time.Second)
+	manifest.Files = []ArchiveFileDTO{}
+	manifest.Skipped = []ArchiveSkippedDTO{}
+
+	w.Header().Set("Content-Type", archiveTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	archive := newArchive(w)
+	added := map[string]bool{}
+
+	for _, id := range ids {
+		if added[id] {
+			continue
+		}
+		added[id] = true
+
+		result, err := h.service.Get(id)
+		if err != nil {
+			manifest.Skipped = append(manifest.Skipped, ArchiveSkippedDTO{ID: id, Error: err.Error()})
+			continue
+		}
+
+		if result.Status != service.StatusReady {
+			manifest.Skipped = append(manifest.Skipped, ArchiveSkippedDTO{ID: id, Status: result.Status.String()})
+			continue
+		}
+
+		//E.g. missing or corrupted, nothing of it is written yet
+		media, err := h.engine.Result(result.MediaId)
+		if err != nil {
+			log.Printf("Problem with archive %v - can't read media of TTS(id: %v): %v", name, id, err)
+			manifest.Skipped = append(manifest.Skipped, ArchiveSkippedDTO{ID: id, Status: result.Status.String(), Error: err.Error()})
+			continue
+		}
+
+		file := ArchiveFileDTO{Name: archiveFileName(result), ID: id, Text: result.Text, Language: result.Language.String(), Media: toMediaDTO(result.Media)}
+
+		err = addMedia(archive, file.Name, result, manifest.Created, media)
+		media.Close()
+		if err != nil {
+			log.Printf("Problem with archive %v - can't add TTS(id: %v): %v", name, id, err)
+			return
+		}
+
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	content, _ := json.MarshalIndent(manifest, "", "  ")
+
+	if err := archive.add(archiveManifest, int64(len(content)), manifest.Created, bytes.NewReader(content)); err != nil {
+		log.Printf("Problem with archive %v - can't add manifest: %v", name, err)
+		return
+	}
+
+	if err := archive.Close(); err != nil {
+		log.Printf("Problem with archive %v: %v", name, err)
+	}
+}
+
+func addMedia(archive mediaArchive, name string, result *service.TtsResult, modified time.Time, media io.Reader) error {
+	size := int64(-1)
+	if result.Media != nil {
+		size = result.Media.Size
+	}
+
+	return archive.add(name, size, modified, media)
+}
+
+//Names the file after the voice message, with the extension of its format, if known
+func archiveFileName(result *service.TtsResult) string {
+	if result.Media != nil {
+		if format := tts.FormatOf(result.Media.MimeType); format != "" {
+			return result.Id + "." + format
+		}
+	}
+	return result.Id
+}
+
+//Writes files to an archive as they're read
+type mediaArchive interface {
+	//Size is -1 if it's unknown
+	add(name string, size int64, modified time.Time, content io.Reader) error
+	Close() error
+}
+
+//Audio is compressed already, so it's stored as it is
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a zipArchive) add(name string, size int64, modified time.Time, content io.Reader) error {
+	file, err := a.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, content)
+	return err
+}
+
+//Headers of TAR files tell their sizes, so files of unknown sizes are read in memory first
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (a tarArchive) add(name string, size int64, modified time.Time, content io.Reader) error {
+	if size < 0 {
+		media, err := ioutil.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		size, content = int64(len(media)), bytes.NewReader(media)
+	}
+
+	err := a.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modified, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a, content)
+	return err
+}
+
+var archiveFormats = map[string]func(w io.Writer) mediaArchive{
+	archiveZip: func(w io.Writer) mediaArchive { return zipArchive{zip.NewWriter(w)} },
+	archiveTar: func(w io.Writer) mediaArchive { return tarArchive{tar.NewWriter(w)} },
+}
+
+var archiveTypes = map[string]string{
+	archiveZip: "application/zip",
+	archiveTar: "application/x-tar",
+}
+
+const archiveZip = "zip"
+const archiveTar = "tar"
+const archiveAction = "archive"
+const archiveManifest = "manifest.json"
+
+const errEmptyArchive = "IDs of the voice messages must be given"
+const errArchiveTooLarge = "Archives can't have more than %d voice messages"
+const errArchiveFormat = "Unsupported archive format. Formats: zip, tar. Given: "
@@ -0,0 +1,123 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+)
+
+//Handles /assets/ and /assets/{name}
+func onAssetRequest(h assetHandling, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, h.pathPrefix)
+
+	switch {
+	case name == "" && r.Method == "GET":
+		onListAssetsRequest(h, tenant, w, r)
+	case name == "":
+		onMethodNotSupported([]string{"GET"}, w, r)
+	case !assets.ValidName(name):
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidAssetName + name, nil}, w, r)
+	case r.Method == "GET":
+		onGetAssetRequest(h, tenant, name, w, r)
+	case r.Method == "PUT":
+		onPutAssetRequest(h, tenant, name, w, r)
+	case r.Method == "DELETE":
+		onDeleteAssetRequest(h, tenant, name, w, r)
+	default:
+		onMethodNotSupported([]string{"GET", "PUT", "DELETE"}, w, r)
+	}
+}
+
+func onListAssetsRequest(h assetHandling, tenant string, w http.ResponseWriter, r *http.Request) {
+	list, err := h.assets.List(tenant)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	dtos := []AssetDTO{}
+	for _, a := range list {
+		dtos = append(dtos, toAssetDTO(a))
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dtos)
+}
+
+func onGetAssetRequest(h assetHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	asset, content, err := h.assets.Get(tenant, name)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	headers := w.Header()
+	headers.Set("Content-Type", "audio/wav")
+	headers.Set("Content-Length", strconv.FormatInt(asset.Size, 10))
+	headers.Set("ETag", `"`+asset.Checksum+`"`)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+func onPutAssetRequest(h assetHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	if !isWavContentType(r.Header.Get("Content-Type")) {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errAssetContentType, nil}, w, r)
+		return
+	}
+
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAssetSize))
+	if err != nil {
+		handleError(ErrorDTO{http.StatusRequestEntityTooLarge, errAssetTooLarge, nil}, w, r)
+		return
+	}
+
+	//Assets are checked when uploaded, so that mixing them doesn't fail later
+	if err := tts.CanMix(content); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidAsset + err.Error(), nil}, w, r)
+		return
+	}
+
+	asset, err := h.assets.Put(tenant, name, content)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toAssetDTO(asset))
+}
+
+func onDeleteAssetRequest(h assetHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	if err := h.assets.Delete(tenant, name); err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func isWavContentType(contentType string) bool {
+	mime := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return mime == "audio/wav" || mime == "audio/x-wav" || mime == "audio/wave"
+}
+
+//Large enough for a few minutes of background music
+const maxAssetSize = 20 << 20
+
+const errAssetContentType = "Content-Type must be audio/wav"
+const errAssetTooLarge = "Asset must not be larger than 20MB"
+const errInvalidAsset = "Asset can't be mixed: "
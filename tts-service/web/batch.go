@@ -0,0 +1,224 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+)
+
+//Handles POST /voiceMessages:batch with a JSON array or an NDJSON stream of creation requests
+//Invalid items are rejected on their own, the others are created
+func onCreateBatchRequest(h batchHandling, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	items, err := readBatchItems(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	creates := []service.BatchCreate{}
+	for _, item := range items {
+		creates = append(creates, toBatchCreate(item, tenant, h.create.service))
+	}
+
+	result, serviceErr := h.batches.Create(creates)
+	if serviceErr != nil {
+		handleError(ErrorDTO{http.StatusInternalServerError, serviceErr.Error(), nil}, w, r)
+		return
+	}
+
+	addJsonHeader(w)
+	w.Header().Set("Location", h.pathPrefix+result.Id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(toBatchDTO(result, true))
+}
+
+//Reads the raw items of the batch, each of them is decoded on its own
+func readBatchItems(r *http.Request) ([]json.RawMessage, error) {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/json") && !strings.HasPrefix(contentType, ndjsonContentType) {
+		return nil, ErrorDTO{http.StatusUnsupportedMediaType, errBatchContentType, nil}
+	}
+
+	if r.Body == nil {
+		return nil, ErrorDTO{http.StatusBadRequest, errEmptyBody, nil}
+	}
+
+	items := []json.RawMessage{}
+
+	if strings.HasPrefix(contentType, ndjsonContentType) {
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 64*1024), maxBatchLineSize)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				items = append(items, json.RawMessage(append([]byte{}, line...)))
+			}
+			if len(items) > maxBatchSize {
+				break
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}
+		}
+	} else {
+		var err error
+		if items, err = readJsonItems(r.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, ErrorDTO{http.StatusBadRequest, errEmptyBatch, nil}
+	}
+
+	if len(items) > maxBatchSize {
+		return nil, ErrorDTO{http.StatusRequestEntityTooLarge, fmt.Sprintf(errBatchTooLarge, maxBatchSize), nil}
+	}
+
+	return items, nil
+}
+
+//Reads the items of a JSON array one by one, so that too large batches are rejected before they're read whole
+func readJsonItems(body io.Reader) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(body)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}
+	}
+	if token != json.Delim('[') {
+		return nil, ErrorDTO{http.StatusBadRequest, errJsonParse + errBatchNotArray, nil}
+	}
+
+	items := []json.RawMessage{}
+	for decoder.More() {
+		if len(items) == maxBatchSize {
+			return nil, ErrorDTO{http.StatusRequestEntityTooLarge, fmt.Sprintf(errBatchTooLarge, maxBatchSize), nil}
+		}
+
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return nil, ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}
+		}
+		items = append(items, item)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}
+	}
+
+	return items, nil
+}
+
+//Validates the item the way POST /voiceMessages does, it's rejected with the problem found, if any
+func toBatchCreate(item json.RawMessage, tenant string, ttsService service.TtsService) service.BatchCreate {
+	var dto CreateDTO
+	if err := json.Unmarshal(item, &dto); err != nil {
+		return service.BatchCreate{Problem: errJsonParse + err.Error()}
+	}
+
+	ttsCreate, err := validateCreateDTO(&dto, ttsService.Capabilities())
+	if invalid, ok := err.(ErrorDTO); ok {
+		return service.BatchCreate{Problem: invalid.Message, Details: invalid.Details}
+	} else if err != nil {
+		return service.BatchCreate{Problem: err.Error()}
+	}
+
+	ttsCreate.Tenant = tenant
+	return service.BatchCreate{Create: ttsCreate}
+}
+
+//Handles GET /batches/{id} and GET /batches/{id}/archive
+//With "Accept: application/x-ndjson" the batch is followed: its progress is streamed, a line every poll interval, until it's done
+func onGetBatchRequest(h batchHandling, w http.ResponseWriter, r *http.Request) {
+	id, err := getId(h.pathPrefix, r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	if i := strings.Index(id, "/"); i >= 0 {
+		if action := id[i+1:]; action != archiveAction {
+			handleError(ErrorDTO{http.StatusNotFound, errUnknownBatchAction + action, nil}, w, r)
+		} else {
+			onGetBatchArchiveRequest(h, id[:i], w, r)
+		}
+		return
+	}
+
+	result, serviceErr := h.batches.Get(id)
+	if serviceErr != nil {
+		handleError(convertError(serviceErr), w, r)
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		addJsonHeader(w)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(toBatchDTO(result, true))
+		return
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	followBatch(h, result, w, r)
+}
+
+//Streams the progress of the batch, the last line lists its items
+func followBatch(h batchHandling, result *service.BatchResult, w http.ResponseWriter, r *http.Request) {
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for {
+		done := result.Status == service.BatchDone
+		if err := encoder.Encode(toBatchDTO(result, done)); err != nil || done {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(batchPollInterval):
+		}
+
+		var err error
+		if result, err = h.batches.Get(result.Id); err != nil {
+			//Headers are already sent, the stream just ends
+			return
+		}
+	}
+}
+
+func toBatchDTO(s *service.BatchResult, withItems bool) *BatchDTO {
+	b := BatchDTO{}
+	b.createWith(s, withItems)
+	return &b
+}
+
+//How often followed batches are polled
+var batchPollInterval = time.Second
+
+const ndjsonContentType = "application/x-ndjson"
+const maxBatchSize = 1000
+const maxBatchLineSize = 1 << 20
+
+const errBatchContentType = "Invalid Content-Type. Only application/json and application/x-ndjson are supported"
+const errEmptyBatch = "Batch must have at least one item"
+const errBatchTooLarge = "Batch can't have more than %d items"
+const errBatchNotArray = "batch must be an array"
+const errUnknownBatchAction = "Unknown batch action: "
@@ -0,0 +1,15 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func onGetCapabilitiesRequest(h capabilitiesHandling, w http.ResponseWriter, r *http.Request) {
+	dto := CapabilitiesDTO{}
+	dto.createWith(h.service.Capabilities())
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto)
+}
@@ -0,0 +1,139 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+)
+
+//Captions of the media, served at /media/{id}.vtt and /media/{id}.srt
+//The media URL signature is valid for its captions too
+func onGetCaptionsRequest(h mediaHandling, id string, format captionFormat, w http.ResponseWriter, r *http.Request) {
+	err := h.signer.verify(id, r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	marks, err := h.engine.Marks(id)
+	if os.IsNotExist(err) {
+		//Media saved before the marks were introduced has no captions
+		err = ErrorDTO{http.StatusNotFound, "Captions of media with ID: '" + id + "' don't exist", nil}
+	}
+	if err != nil {
+		handleError(convertMediaError(id, err), w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(format.render(cues(marks)))
+}
+
+type captionFormat struct {
+	contentType string
+	render      func(cues []cue) []byte
+}
+
+//Caption formats by file extension
+var captionFormats = map[string]captionFormat{
+	".vtt": {"text/vtt; charset=utf-8", webVtt},
+	".srt": {"application/x-subrip; charset=utf-8", subRip},
+}
+
+//Splits the media id and the caption format of the path, e.g. "123.vtt"
+func captionsOf(path string) (string, captionFormat, bool) {
+	for extension, format := range captionFormats {
+		if strings.HasSuffix(path, extension) {
+			return strings.TrimSuffix(path, extension), format, true
+		}
+	}
+	return path, captionFormat{}, false
+}
+
+//A caption shown at once
+type cue struct {
+	start, end time.Duration
+	text       string
+}
+
+//Two lines of 42 characters, as recommended for readability
+const maxCueSize = 84
+
+//Groups the words into cues of at most maxCueSize characters, starting a new cue with every sentence
+func cues(marks []tts.Mark) []cue {
+	result := []cue{}
+	var current *cue
+
+	for _, m := range marks {
+		text := strings.TrimSpace(m.Text)
+
+		//Providers may mark words with no text, e.g. of pauses
+		if m.Type != tts.MarkWord || text == "" {
+			continue
+		}
+
+		if current != nil && utf8.RuneCountInString(current.text)+1+utf8.RuneCountInString(text) > maxCueSize {
+			result = append(result, *current)
+			current = nil
+		}
+
+		if current == nil {
+			current = &cue{start: m.Start, end: m.End, text: text}
+		} else {
+			current.end = m.End
+			current.text += " " + text
+		}
+
+		if strings.ContainsAny(text[len(text)-1:], ".!?") {
+			result = append(result, *current)
+			current = nil
+		}
+	}
+
+	if current != nil {
+		result = append(result, *current)
+	}
+
+	return result
+}
+
+//https://www.w3.org/TR/webvtt1/
+func webVtt(cues []cue) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n", timestamp(c.start, "."), timestamp(c.end, "."), c.text)
+	}
+
+	return b.Bytes()
+}
+
+//https://en.wikipedia.org/wiki/SubRip
+func subRip(cues []cue) []byte {
+	var b bytes.Buffer
+
+	for i, c := range cues {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n%s --> %s\n%s\n", strconv.Itoa(i+1), timestamp(c.start, ","), timestamp(c.end, ","), c.text)
+	}
+
+	return b.Bytes()
+}
+
+//Formats the time as "00:01:02.345", with the given milliseconds separator
+func timestamp(d time.Duration, separator string) string {
+	ms := int64(d / time.Millisecond)
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
@@ -0,0 +1,374 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/collections"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+)
+
+//Handles /collections/{id}, /collections/{id}/items, /collections/{id}/feed.xml, /collections/{id}.m3u8 and /collections/{id}/media/{messageId}
+//Collections are public to read, but they're changed by the tenants owning them only, like templates
+func onCollectionRequest(h collectionHandling, w http.ResponseWriter, r *http.Request) {
+	id, action := strings.TrimPrefix(r.URL.Path, h.pathPrefix), ""
+	if i := strings.Index(id, "/"); i >= 0 {
+		id, action = id[:i], id[i+1:]
+	} else if strings.HasSuffix(id, playlistSuffix) {
+		id, action = strings.TrimSuffix(id, playlistSuffix), playlistSuffix
+	}
+
+	switch {
+	case !collections.ValidId(id):
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidCollectionId + id, nil}, w, r)
+	case action == itemsAction && r.Method == "POST":
+		onAddCollectionItemRequest(h, id, w, r)
+	case action == feedAction && r.Method == "GET":
+		onGetFeedRequest(h, id, w, r)
+	case action == playlistSuffix && r.Method == "GET":
+		onGetPlaylistRequest(h, id, w, r)
+	case strings.HasPrefix(action, mediaAction) && r.Method == "GET":
+		onGetEpisodeMediaRequest(h, id, strings.TrimPrefix(action, mediaAction), w, r)
+	case action == itemsAction:
+		onMethodNotSupported([]string{"POST"}, w, r)
+	case action == feedAction || action == playlistSuffix || strings.HasPrefix(action, mediaAction):
+		onMethodNotSupported([]string{"GET"}, w, r)
+	case action != "":
+		handleError(ErrorDTO{http.StatusNotFound, errUnknownCollectionAction + action, nil}, w, r)
+	case r.Method == "GET":
+		collection, err := h.collections.Get(id)
+		sendCollection(h, collection, err, w, r)
+	case r.Method == "PUT":
+		onPutCollectionRequest(h, id, w, r)
+	case r.Method == "DELETE":
+		onDeleteCollectionRequest(h, id, w, r)
+	default:
+		onMethodNotSupported([]string{"GET", "PUT", "DELETE"}, w, r)
+	}
+}
+
+func onPutCollectionRequest(h collectionHandling, id string, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto CollectionDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	//The collection is identified by the path, and the times its items were added at are kept by the store
+	collection := collections.Collection{Id: id, Tenant: tenant, Title: dto.Title, Description: dto.Description, Language: dto.Language, Author: dto.Author, Items: []collections.Item{}}
+	for _, item := range dto.Items {
+		collection.Items = append(collection.Items, collections.Item{Id: item.ID, Title: item.Title})
+	}
+
+	details := collection.Validate()
+	if collection.Language != "" && !h.service.Capabilities().Supports(collection.Language) {
+		details = append(details, errUnsupportedLang+collection.Language)
+	}
+	if len(details) == 0 {
+		details = missingMessages(h.service, tenant, collection.Items)
+	}
+
+	if len(details) > 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}, w, r)
+		return
+	}
+
+	stored, err := h.collections.Put(collection)
+	sendCollection(h, stored, err, w, r)
+}
+
+//Publishes the voice message in the collection, e.g. the bulletin of the day
+func onAddCollectionItemRequest(h collectionHandling, id string, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto CollectionItemDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	item := collections.Item{Id: dto.ID, Title: dto.Title}
+
+	details := missingMessages(h.service, tenant, []collections.Item{item})
+	if len(details) > 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}, w, r)
+		return
+	}
+
+	stored, err := h.collections.Add(id, tenant, item)
+	if full, ok := err.(collections.FullError); ok {
+		handleError(ErrorDTO{http.StatusConflict, full.Message, nil}, w, r)
+		return
+	}
+
+	sendCollection(h, stored, err, w, r)
+}
+
+func onDeleteCollectionRequest(h collectionHandling, id string, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	if err := h.collections.Delete(id, tenant); err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Returns the problems of items that aren't voice messages of the tenant
+//Voice messages of other tenants are reported missing, so that they can't be told apart from the ones that don't exist
+func missingMessages(ttsService service.TtsService, tenant string, items []collections.Item) []string {
+	details := []string{}
+	for _, item := range items {
+		result, err := ttsService.Get(item.Id)
+		if err == nil && ownerOf(result) != tenant {
+			err = service.NotFound(item.Id)
+		}
+		if err != nil {
+			details = append(details, err.Error())
+		}
+	}
+	return details
+}
+
+//Voice messages created before tenants were introduced are owned by the default one
+func ownerOf(result *service.TtsResult) string {
+	if result.Tenant == "" {
+		return lexicon.DefaultTenant
+	}
+	return result.Tenant
+}
+
+func sendCollection(h collectionHandling, collection collections.Collection, err error, w http.ResponseWriter, r *http.Request) {
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toCollectionDTO(collection, h.selfUrl+h.pathPrefix))
+}
+
+//An episode: a ready voice message of the collection
+type episode struct {
+	item   collections.Item
+	result *service.TtsResult
+	url    string
+}
+
+//Reads the voice messages of the collection, only the ready ones are published
+//Their media is linked through the collection, so that the links don't change between reads of the feeds, unlike signed media URLs
+func readEpisodes(h collectionHandling, id string) (collections.Collection, []episode, error) {
+	collection, err := h.collections.Get(id)
+	if err != nil {
+		return collection, nil, convertError(err)
+	}
+
+	episodes := []episode{}
+	for _, item := range collection.Items {
+		result, err := h.service.Get(item.Id)
+		//Media saved before the metadata was introduced can't be enclosed without its type and length
+		if err != nil || result.Status != service.StatusReady || result.Media == nil {
+			continue
+		}
+		episodes = append(episodes, episode{item, result, h.selfUrl + h.pathPrefix + id + "/" + mediaAction + item.Id})
+	}
+
+	return collection, episodes, nil
+}
+
+//Returns the title of the item, or the beginning of the text of its voice message
+func (e episode) title() string {
+	title := e.item.Title
+	if title == "" {
+		title = e.result.Text
+	}
+
+	//Playlists have a line per title
+	title = strings.Join(strings.Fields(title), " ")
+	if utf8.RuneCountInString(title) > maxEpisodeTitle {
+		title = string([]rune(title)[:maxEpisodeTitle-1]) + "…"
+	}
+	return title
+}
+
+//Handles GET /collections/{id}/feed.xml, a podcast RSS feed of the collection, the newest episodes first
+//https://www.rssboard.org/rss-specification
+func onGetFeedRequest(h collectionHandling, id string, w http.ResponseWriter, r *http.Request) {
+	collection, episodes, err := readEpisodes(h, id)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	feedUrl := h.selfUrl + h.pathPrefix + id + "/" + feedAction
+
+	channel := rssChannel{
+		Title:         collection.Title,
+		Link:          feedUrl,
+		Description:   collection.Description,
+		Language:      strings.ToLower(collection.Language),
+		LastBuildDate: collection.Updated.Format(time.RFC1123Z),
+		Author:        collection.Author,
+		Items:         []rssItem{},
+	}
+	if channel.Description == "" {
+		channel.Description = collection.Title
+	}
+
+	for i := len(episodes) - 1; i >= 0; i-- {
+		e := episodes[i]
+		channel.Items = append(channel.Items, rssItem{
+			Title:       e.title(),
+			Description: e.result.Text,
+			Guid:        rssGuid{e.item.Id, false},
+			PubDate:     e.item.Added.Format(time.RFC1123Z),
+			Enclosure:   rssEnclosure{e.url, e.result.Media.Size, e.result.Media.MimeType},
+			Duration:    strconv.Itoa(int((e.result.Media.Duration + time.Second/2) / time.Second)),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	encoder.Encode(rssDTO{Version: "2.0", Itunes: itunesNamespace, Channel: channel})
+}
+
+//Handles GET /collections/{id}.m3u8, an extended M3U playlist of the collection, in the order of publishing
+//https://tools.ietf.org/html/rfc8216#section-4.3.2.1
+func onGetPlaylistRequest(h collectionHandling, id string, w http.ResponseWriter, r *http.Request) {
+	_, episodes, err := readEpisodes(h, id)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	for _, e := range episodes {
+		duration := strconv.FormatFloat(e.result.Media.Duration.Seconds(), 'f', 3, 64)
+		playlist.WriteString("#EXTINF:" + duration + "," + e.title() + "\n" + e.url + "\n")
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(playlist.String()))
+}
+
+//Handles GET /collections/{id}/media/{messageId}, the media of a voice message published in the collection
+//Collections are public, so is the media their tenants published in them, unlike the one under /media/
+func onGetEpisodeMediaRequest(h collectionHandling, id string, messageId string, w http.ResponseWriter, r *http.Request) {
+	collection, err := h.collections.Get(id)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	published := false
+	for _, item := range collection.Items {
+		published = published || item.Id == messageId
+	}
+
+	result, err := h.service.Get(messageId)
+	if !published || err != nil || result.Status != service.StatusReady {
+		handleError(ErrorDTO{http.StatusNotFound, fmt.Sprintf(errEpisodeNotFound, messageId, id), nil}, w, r)
+		return
+	}
+
+	reader, err := h.engine.Result(result.MediaId)
+	if err != nil {
+		handleError(convertMediaError(result.MediaId, err), w, r)
+		return
+	}
+	defer reader.Close()
+
+	if info, err := h.engine.Info(result.MediaId); err == nil {
+		addMediaHeaders(w, info)
+	}
+
+	io.Copy(w, reader)
+}
+
+type rssDTO struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Itunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Author        string    `xml:"itunes:author,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	Guid        rssGuid      `xml:"guid"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+	Duration    string       `xml:"itunes:duration"` //In seconds
+}
+
+type rssGuid struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+const itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+const itemsAction = "items"
+const feedAction = "feed.xml"
+const mediaAction = "media/"
+const playlistSuffix = ".m3u8"
+const maxEpisodeTitle = 80
+
+const errInvalidCollectionId = "Collection IDs must be 1-64 letters, digits, '-' or '_': "
+const errUnknownCollectionAction = "Unknown collection action: "
+const errEpisodeNotFound = "Voice message with ID: '%s' isn't ready in collection: '%s'"
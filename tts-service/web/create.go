@@ -2,35 +2,67 @@ package web
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/ssml"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 	"strings"
 )
 
 func onCreateRequest(h createHandling, w http.ResponseWriter, r *http.Request) {
 
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		onIdempotentCreateRequest(h, key, w, r)
+		return
+	}
+
+	createFromRequest(h, w, r)
+}
+
+func createFromRequest(h createHandling, w http.ResponseWriter, r *http.Request) {
+
 	createDTO, inputErr := readCreateDTO(r)
 	if inputErr != nil {
 		handleError(inputErr, w, r)
 		return
 	}
 
-	ttsCreate, validationErr := validateCreateDTO(createDTO)
+	ttsCreate, validationErr := validateCreateDTO(createDTO, h.service.Capabilities())
+	if validationErr != nil {
+		handleError(validationErr, w, r)
+		return
+	}
+
+	//Words are read the way the tenant's lexicon tells
+	ttsCreate.Tenant, validationErr = readTenant(r)
 	if validationErr != nil {
 		handleError(validationErr, w, r)
 		return
 	}
 
-	//Invoke service
+	createVoiceMessage(h, ttsCreate, w, r)
+}
+
+//Invokes the service and responds with the created voice message
+func createVoiceMessage(h createHandling, ttsCreate *service.TtsCreate, w http.ResponseWriter, r *http.Request) {
 	result, serviceErr := h.service.Create(ttsCreate)
-	if serviceErr != nil {
+	if notFound, ok := serviceErr.(assets.NotFoundError); ok {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, []string{notFound.Message}}, w, r)
+	} else if invalid, ok := serviceErr.(service.IdError); ok {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, []string{invalid.Message}}, w, r)
+	} else if conflict, ok := serviceErr.(service.IdConflictError); ok {
+		handleError(ErrorDTO{http.StatusConflict, conflict.Message, nil}, w, r)
+	} else if serviceErr != nil {
 		message := ErrorDTO{http.StatusInternalServerError, serviceErr.Error(), nil}
 		handleError(message, w, r)
 	} else {
 		addJsonHeader(w)
 		w.WriteHeader(http.StatusAccepted)
-		json.NewEncoder(w).Encode(toResultDTO(result, h.mediaUrl))
+		json.NewEncoder(w).Encode(toResultDTO(result, h.mediaUrl, 0))
 	}
 
 }
@@ -57,34 +89,231 @@ func readCreateDTO(r *http.Request) (*CreateDTO, error) {
 	}
 }
 
-func validateCreateDTO(dto *CreateDTO) (*service.TtsCreate, error) {
+func validateCreateDTO(dto *CreateDTO, capabilities tts.Capabilities) (*service.TtsCreate, error) {
 	var details []string
 
-	if dto.Text == "" {
+	dialogue := len(dto.Segments) > 0
+
+	switch {
+	case dto.Text == "" && !dialogue:
 		details = append(details, errEmptyText)
+	case dto.Text != "" && dialogue:
+		details = append(details, errTextWithSegments)
+	}
+
+	//Dialogues are in the language of their first segment, unless told otherwise
+	code := dto.Language
+	if dialogue && code == "" {
+		code = dto.Segments[0].Language
 	}
 
 	var langEnum service.LangEnum = nil
 
-	switch dto.Language {
-	case "EN":
-		langEnum = service.EN
-	case "PL":
-		langEnum = service.PL
+	switch {
+	case code == service.AUTO.String() && dialogue:
+		details = append(details, errAutoDialogue)
+	case code == service.AUTO.String():
+		langEnum = service.AUTO
+	case capabilities.Supports(code):
+		langEnum = service.NewLanguage(code)
 	default:
-		details = append(details, errUnsupportedLang+dto.Language)
+		details = append(details, errUnsupportedLang+code)
+	}
+
+	isSsml := false
+
+	switch dto.TextType {
+	case "", textTypeText:
+	case textTypeSsml:
+		isSsml = true
+		details = append(details, validateSsml(dto.Text)...)
+	default:
+		details = append(details, errUnsupportedTextType+dto.TextType)
+	}
+
+	options := tts.Options{
+		Voice:  dto.Voice,
+		Rate:   dto.Rate,
+		Pitch:  dto.Pitch,
+		Volume: dto.Volume,
+		Format: strings.ToLower(dto.Format),
+		Mixed:  dto.MixedLanguages,
+	}
+
+	//SSML marks parts in other languages with <lang> instead
+	if isSsml && options.Mixed {
+		details = append(details, errMixedSsml)
+	}
+
+	//Segments are plain texts
+	if isSsml && dialogue {
+		details = append(details, errSsmlDialogue)
+	}
+
+	//Voices depend on the language, so they can't be chosen before it's detected
+	if langEnum == service.AUTO && options.Voice != "" {
+		details = append(details, errVoiceWithAutoLang)
+		options.Voice = ""
+	}
+
+	if langEnum != nil {
+		details = append(details, capabilities.Validate(langEnum.String(), options)...)
+	}
+
+	mix, mixDetails := validateMix(dto.Mix, options, capabilities)
+	details = append(details, mixDetails...)
+
+	segments, segmentDetails := validateSegments(dto.Segments, code, capabilities)
+	details = append(details, segmentDetails...)
+
+	//Whether IDs can be chosen at all is up to the ID strategy of the service
+	if dto.Id != "" && !service.ValidId(dto.Id) {
+		details = append(details, errInvalidId+dto.Id)
 	}
 
 	if len(details) == 0 {
-		return &service.TtsCreate{dto.Text, langEnum}, nil
+		return &service.TtsCreate{Id: dto.Id, Text: dto.Text, Language: langEnum, Ssml: isSsml, Options: options, Mix: mix, Segments: segments}, nil
 	} else {
 		return nil, ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}
 	}
 }
 
+//Returns the mix with the defaults applied, or its problems
+func validateMix(dto *MixDTO, options tts.Options, capabilities tts.Capabilities) (*service.Mix, []string) {
+	var details []string
+
+	if dto == nil {
+		return nil, details
+	}
+
+	if dto.Background == "" && dto.Intro == "" && dto.Outro == "" {
+		details = append(details, errEmptyMix)
+	}
+
+	for _, name := range []string{dto.Background, dto.Intro, dto.Outro} {
+		if name != "" && !assets.ValidName(name) {
+			details = append(details, errInvalidAssetName+name)
+		}
+	}
+
+	mix := &service.Mix{Background: dto.Background, Intro: dto.Intro, Outro: dto.Outro, Volume: defaultMixVolume, Ducking: defaultDucking}
+
+	if dto.Volume != nil {
+		mix.Volume = *dto.Volume
+	}
+	if dto.Ducking != nil {
+		mix.Ducking = *dto.Ducking
+	}
+	if mix.Volume < -60 || mix.Volume > 0 {
+		details = append(details, errMixVolume)
+	}
+	if mix.Ducking < 0 || mix.Ducking > 60 {
+		details = append(details, errMixDucking)
+	}
+
+	//Only uncompressed speech can be mixed
+	format := options.Format
+	if format == "" && len(capabilities.Formats) > 0 {
+		format = capabilities.Formats[0]
+	}
+	if format != "wav" {
+		details = append(details, errMixFormat)
+	}
+
+	return mix, details
+}
+
+//Returns the segments of the dialogue, or their problems, prefixed with their positions
+func validateSegments(dtos []SegmentDTO, dialogueLanguage string, capabilities tts.Capabilities) ([]service.Segment, []string) {
+	var segments []service.Segment
+	var details []string
+
+	if len(dtos) > maxSegments {
+		details = append(details, fmt.Sprintf(errTooManySegments, maxSegments))
+	}
+
+	for i, dto := range dtos {
+		prefix := fmt.Sprintf("Segment %d: ", i+1)
+
+		if strings.TrimSpace(dto.Text) == "" {
+			details = append(details, prefix+errEmptyText)
+		}
+
+		if dto.Pause < 0 || dto.Pause > maxPause {
+			details = append(details, prefix+fmt.Sprintf(errSegmentPause, maxPause))
+		}
+
+		code := dto.Language
+		if code == "" {
+			code = dialogueLanguage
+		}
+
+		if !capabilities.Supports(code) {
+			details = append(details, prefix+errUnsupportedLang+code)
+			continue
+		}
+
+		for _, problem := range capabilities.Validate(code, tts.Options{Voice: dto.Voice}) {
+			details = append(details, prefix+problem)
+		}
+
+		segments = append(segments, service.Segment{
+			Speaker:  strings.TrimSpace(dto.Speaker),
+			Text:     dto.Text,
+			Language: service.NewLanguage(code),
+			Voice:    dto.Voice,
+			Pause:    time.Duration(dto.Pause) * time.Millisecond,
+		})
+	}
+
+	return segments, details
+}
+
+const maxSegments = 100
+const maxPause = 10000 //Milliseconds
+
+const defaultMixVolume = -12.0
+const defaultDucking = 12.0
+
+//Returns all the problems of the SSML document, with their positions
+func validateSsml(text string) []string {
+	var details []string
+
+	if text == "" {
+		return details
+	}
+
+	_, err := ssml.Parse(text)
+	if invalid, ok := err.(ssml.InvalidError); ok {
+		for _, problem := range invalid.Problems {
+			details = append(details, errInvalidSsml+problem.String())
+		}
+	}
+
+	return details
+}
+
+const textTypeText = "text"
+const textTypeSsml = "ssml"
+
 const errInvalidContentType = "Invalid Content-Type. Only application/json is supported"
 const errEmptyBody = "Request body must not be empty"
 const errJsonParse = "Can't read json data: "
 const errEmptyText = "Text is empty"
 const errUnsupportedLang = "Unsupported Language: "
 const errInvalidPayload = "Invalid payload"
+const errVoiceWithAutoLang = "Voice can't be chosen for AUTO Language"
+const errUnsupportedTextType = "Unsupported TextType: "
+const errInvalidSsml = "SSML "
+const errMixedSsml = "MixedLanguages isn't supported for SSML. Use <lang> elements instead"
+const errEmptyMix = "Mix must name a background, an intro or an outro"
+const errInvalidAssetName = "Mix asset names must be 1-64 letters, digits, '-' or '_': "
+const errMixVolume = "Mix volume must be between -60 and 0"
+const errMixDucking = "Mix ducking must be between 0 and 60"
+const errMixFormat = "Mix needs \"Format\": \"wav\""
+const errTextWithSegments = "Text can't be set along with Segments"
+const errAutoDialogue = "Language of dialogues can't be AUTO"
+const errSsmlDialogue = "Segments can't be SSML"
+const errTooManySegments = "Dialogues can't have more than %d Segments"
+const errSegmentPause = "Pause must be between 0 and %d milliseconds"
+const errInvalidId = "Id must be 1-64 letters, digits, '-' or '_': "
@@ -3,6 +3,8 @@ package web
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func onGetByIdRequest(h getHandling, w http.ResponseWriter, r *http.Request) {
@@ -14,6 +16,13 @@ func onGetByIdRequest(h getHandling, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//Every request gets a freshly signed media URL, optionally with a custom lifetime
+	urlTtl, err := readUrlTtl(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
 	result, serviceErr := h.service.Get(id)
 
 	if serviceErr != nil {
@@ -21,6 +30,23 @@ func onGetByIdRequest(h getHandling, w http.ResponseWriter, r *http.Request) {
 	} else {
 		addJsonHeader(w)
 		w.WriteHeader(200)
-		json.NewEncoder(w).Encode(toResultDTO(result, h.mediaUrl))
+		json.NewEncoder(w).Encode(toResultDTO(result, h.mediaUrl, urlTtl))
+	}
+}
+
+//Reads the "urlTtl" query parameter: media URL lifetime in seconds
+func readUrlTtl(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("urlTtl")
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, ErrorDTO{http.StatusBadRequest, errInvalidUrlTtl + value, nil}
 	}
+
+	return time.Duration(seconds) * time.Second, nil
 }
+
+const errInvalidUrlTtl = "urlTtl must be a positive number of seconds: "
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/idempotency"
+)
+
+//Creates the voice message once per key: a repeated request is responded to the way the first one was,
+//so that clients can safely retry requests they haven't got the response to
+//https://tools.ietf.org/html/draft-ietf-httpapi-idempotency-key-header
+func onIdempotentCreateRequest(h createHandling, key string, w http.ResponseWriter, r *http.Request) {
+	if !validIdempotencyKey(key) {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidIdempotencyKey, nil}, w, r)
+		return
+	}
+
+	//Keys of tenants are kept apart
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	if r.Body == nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errEmptyBody, nil}, w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	fingerprint := idempotency.Fingerprint(body)
+	key = tenant + ":" + key
+
+	unlock := h.idempotency.Lock(key)
+	defer unlock()
+
+	record, err := h.idempotency.Get(key)
+	switch err.(type) {
+	case nil:
+		if record.Fingerprint != fingerprint {
+			handleError(ErrorDTO{http.StatusUnprocessableEntity, errIdempotencyKeyReused, nil}, w, r)
+			return
+		}
+		addJsonHeader(w)
+		w.Header().Set(idempotentReplayedHeader, "true")
+		w.WriteHeader(record.Status)
+		w.Write(record.Body)
+		return
+	case idempotency.NotFoundError:
+	default:
+		handleError(err, w, r)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	createFromRequest(h, recorder, r)
+
+	//Rejected requests aren't recorded, so they can be corrected and retried with the same key
+	if recorder.status != http.StatusAccepted {
+		return
+	}
+
+	if err := h.idempotency.Put(key, idempotency.Record{Fingerprint: fingerprint, Status: recorder.status, Body: recorder.body.Bytes()}); err != nil {
+		log.Printf("Problem with idempotency key %v - can't record the response: %v", key, err)
+	}
+}
+
+//Keeps the response, as it's written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+//Keys are 1-255 visible ASCII characters, e.g. UUIDs
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeySize {
+		return false
+	}
+	for _, c := range []byte(key) {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+const idempotencyKeyHeader = "Idempotency-Key"
+const idempotentReplayedHeader = "Idempotent-Replayed"
+const maxIdempotencyKeySize = 255
+
+const errInvalidIdempotencyKey = "Idempotency-Key must be 1-255 visible ASCII characters"
+const errIdempotencyKeyReused = "Idempotency-Key was already used with another request"
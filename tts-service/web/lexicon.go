@@ -0,0 +1,133 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
+)
+
+//Handles /lexicons/{language} and /lexicons/{language}/{grapheme}
+func onLexiconRequest(h lexiconHandling, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	path, err := getId(h.pathPrefix, r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	language, grapheme := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		language, grapheme = path[:i], path[i+1:]
+	}
+
+	if !h.service.Capabilities().Supports(language) {
+		handleError(ErrorDTO{http.StatusNotFound, errUnsupportedLang + language, nil}, w, r)
+		return
+	}
+
+	switch {
+	case grapheme == "" && r.Method == "GET":
+		onGetLexiconRequest(h, tenant, language, w, r)
+	case grapheme == "":
+		onMethodNotSupported([]string{"GET"}, w, r)
+	case r.Method == "GET":
+		onGetLexiconEntryRequest(h, tenant, language, grapheme, w, r)
+	case r.Method == "PUT":
+		onPutLexiconEntryRequest(h, tenant, language, grapheme, w, r)
+	case r.Method == "DELETE":
+		onDeleteLexiconEntryRequest(h, tenant, language, grapheme, w, r)
+	default:
+		onMethodNotSupported([]string{"GET", "PUT", "DELETE"}, w, r)
+	}
+}
+
+func onGetLexiconRequest(h lexiconHandling, tenant, language string, w http.ResponseWriter, r *http.Request) {
+	lex, err := h.lexicons.Get(tenant, language)
+	sendLexicon(lex, err, w, r)
+}
+
+func onGetLexiconEntryRequest(h lexiconHandling, tenant, language, grapheme string, w http.ResponseWriter, r *http.Request) {
+	lex, err := h.lexicons.Get(tenant, language)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	entry, ok := lex.Lookup(grapheme)
+	if !ok {
+		handleError(convertError(lexicon.NotFound(grapheme)), w, r)
+		return
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toEntryDTO(entry))
+}
+
+func onPutLexiconEntryRequest(h lexiconHandling, tenant, language, grapheme string, w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto EntryDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	//The grapheme is identified by the path
+	entry := lexicon.Entry{Grapheme: grapheme, Alias: strings.TrimSpace(dto.Alias), Phoneme: strings.TrimSpace(dto.Phoneme)}
+
+	if details := entry.Validate(); len(details) > 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}, w, r)
+		return
+	}
+
+	lex, err := h.lexicons.Put(tenant, language, entry)
+	sendLexicon(lex, err, w, r)
+}
+
+func onDeleteLexiconEntryRequest(h lexiconHandling, tenant, language, grapheme string, w http.ResponseWriter, r *http.Request) {
+	lex, err := h.lexicons.Delete(tenant, language, grapheme)
+	sendLexicon(lex, err, w, r)
+}
+
+func sendLexicon(lex lexicon.Lexicon, err error, w http.ResponseWriter, r *http.Request) {
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	dto := LexiconDTO{}
+	dto.createWith(lex)
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dto)
+}
+
+//Reads the tenant owning the lexicons from the X-Tenant-Id header, lexicon.DefaultTenant if not set
+func readTenant(r *http.Request) (string, error) {
+	tenant := r.Header.Get(tenantHeader)
+	if tenant == "" {
+		return lexicon.DefaultTenant, nil
+	}
+
+	if !lexicon.ValidTenant(tenant) {
+		return "", ErrorDTO{http.StatusBadRequest, errInvalidTenant + tenant, nil}
+	}
+
+	return tenant, nil
+}
+
+const tenantHeader = "X-Tenant-Id"
+
+const errInvalidTenant = "X-Tenant-Id must be 1-64 letters, digits, '-' or '_', but not 2 lowercase hex digits: "
@@ -1,8 +1,15 @@
 package web
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 )
 
 func onGetMediaRequest(h mediaHandling, w http.ResponseWriter, r *http.Request) {
@@ -14,12 +21,163 @@ func onGetMediaRequest(h mediaHandling, w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	reader, err := h.engine.Result(id)
+	if mediaId, format, ok := captionsOf(id); ok {
+		onGetCaptionsRequest(h, mediaId, format, w, r)
+		return
+	}
 
+	err = h.signer.verify(id, r)
 	if err != nil {
 		handleError(err, w, r)
 		return
 	}
 
+	reader, info, err := openMedia(h.engine, id, r)
+
+	if err != nil {
+		handleError(convertMediaError(id, err), w, r)
+		return
+	}
+	defer reader.Close()
+
+	//Media saved before the metadata was introduced is served without the headers
+	if info != nil {
+		addMediaHeaders(w, info)
+	}
+	w.Header().Set("Vary", "Accept")
+
 	io.Copy(w, reader)
 }
+
+//Opens the media in the format requested by the format parameter or the Accept header, in the stored one otherwise
+func openMedia(engine MediaEngine, id string, r *http.Request) (io.ReadCloser, *tts.MediaInfo, error) {
+	if format := r.URL.Query().Get(formatParam); format != "" {
+		return engine.Rendition(id, format)
+	}
+
+	info, err := engine.Info(id)
+	if err != nil {
+		info = nil
+	}
+
+	if format := acceptedFormat(r.Header.Get("Accept"), info); format != "" {
+		reader, rendition, err := engine.Rendition(id, format)
+
+		//Accept is only a preference, so the stored format is served if the media can't be transcoded
+		if _, ok := err.(tts.FormatError); !ok {
+			return reader, rendition, err
+		}
+	}
+
+	reader, err := engine.Result(id)
+	return reader, info, err
+}
+
+//Returns the format preferred by the Accept header, or "" if it's the stored one or none of them
+//https://tools.ietf.org/html/rfc7231#section-5.3.2
+func acceptedFormat(accept string, info *tts.MediaInfo) string {
+	if accept == "" || info == nil {
+		return ""
+	}
+
+	stored := tts.FormatOf(info.MimeType)
+	best, bestQuality := "", 0.0
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(params[0]))
+		quality := 1.0
+
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				quality, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+
+		format := tts.FormatOf(mimeType)
+		if mimeType == "*/*" || mimeType == "audio/*" {
+			format = stored
+		}
+
+		if format != stored && !contains(tts.TranscodeFormats, format) {
+			continue
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	if best == stored {
+		return ""
+	}
+	return best
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+const formatParam = "format"
+
+//Tries to convert tts.Engine error to ErrorDTO.
+//If succesfull, returns ErrorDTO instance.
+//Otherwise returns err argument unchanged
+func convertMediaError(id string, err error) error {
+
+	if os.IsNotExist(err) {
+		return ErrorDTO{
+			Status:  http.StatusNotFound,
+			Message: "Media with ID: '" + id + "' doesn't exist",
+		}
+	}
+
+	//The media exists, but can't be served until it's regenerated
+	if corrupted, ok := err.(tts.MediaCorruptedError); ok {
+		return ErrorDTO{
+			Status:  http.StatusServiceUnavailable,
+			Message: corrupted.Message + ". Create the voice message again to regenerate it",
+		}
+	}
+
+	//The media exists, but not in the requested format
+	if format, ok := err.(tts.FormatError); ok {
+		return ErrorDTO{
+			Status:  http.StatusNotAcceptable,
+			Message: format.Message,
+		}
+	}
+
+	//Unknown error
+	return err
+}
+
+//Describes the media using HTTP headers
+func addMediaHeaders(w http.ResponseWriter, info *tts.MediaInfo) {
+	headers := w.Header()
+
+	headers.Set("Content-Type", info.MimeType)
+	headers.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	headers.Set("ETag", `"`+info.Checksum+`"`)
+	headers.Set("X-Media-Duration", strconv.FormatFloat(info.Duration.Seconds(), 'f', 3, 64))
+
+	//https://tools.ietf.org/html/rfc3230#section-4.3.2
+	if checksum, err := hex.DecodeString(info.Checksum); err == nil {
+		headers.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(checksum))
+	}
+
+	if info.Codec != "" {
+		headers.Set("X-Media-Codec", info.Codec)
+	}
+	if info.SampleRate > 0 {
+		headers.Set("X-Media-Sample-Rate", strconv.Itoa(info.SampleRate))
+	}
+	if info.Channels > 0 {
+		headers.Set("X-Media-Channels", strconv.Itoa(info.Channels))
+	}
+}
@@ -1,33 +1,201 @@
 package web
 
 import (
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/collections"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/language"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/templates"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
+	"time"
 )
 
 type CreateDTO struct {
+	Id       string //Chosen by the client, optional, if the ID strategy of the service allows it
 	Text     string
 	Language string
+	TextType string //"text" (default) or "ssml"
+
+	//Optional, the defaults of the engine are used if not set
+	Voice  string
+	Rate   *int
+	Pitch  *int
+	Volume *int
+	Format string
+
+	MixedLanguages bool //Parts of the text in other languages are read in these languages
+
+	Mix *MixDTO //Assets mixed with the speech, optional
+
+	Segments []SegmentDTO //Make a dialogue, read instead of the Text, optional
+}
+
+//A part of a dialogue, read by its own speaker
+type SegmentDTO struct {
+	Speaker  string //Label, e.g. "agent"
+	Text     string
+	Language string //The Language of the dialogue if not set
+	Voice    string //The Voice of the dialogue if it's in the same Language, the default voice otherwise
+	Pause    int    //Milliseconds of silence before the segment
+}
+
+//Names the assets of the tenant mixed with the speech, see /assets/
+type MixDTO struct {
+	Background string   `json:"background,omitempty"` //Looped under the speech
+	Intro      string   `json:"intro,omitempty"`      //Played before the speech
+	Outro      string   `json:"outro,omitempty"`      //Played after the speech
+	Volume     *float64 `json:"volume,omitempty"`     //Of the background in dB, defaultMixVolume if not set
+	Ducking    *float64 `json:"ducking,omitempty"`    //The background is lowered by this many dB while the speech is heard, defaultDucking if not set
 }
 
 type ResultDTO struct {
-	ID       string `json:"id"`
+	ID                  string             `json:"id"`
+	Text                string             `json:"text"`
+	NormalizedText      string             `json:"normalizedText,omitempty"` //What's actually read aloud, for debugging
+	TextType            string             `json:"textType,omitempty"`       //"ssml" for SSML documents
+	Language            string             `json:"language"`
+	DetectedLanguage    string             `json:"detectedLanguage,omitempty"` //Set if the language was detected (AUTO)
+	DetectionConfidence float64            `json:"detectionConfidence,omitempty"`
+	Voice               string             `json:"voice,omitempty"`
+	Rate                *int               `json:"rate,omitempty"`
+	Pitch               *int               `json:"pitch,omitempty"`
+	Volume              *int               `json:"volume,omitempty"`
+	Format              string             `json:"format,omitempty"`
+	MixedLanguages      bool               `json:"mixedLanguages,omitempty"`
+	LexiconVersion      int                `json:"lexiconVersion,omitempty"` //Version of the tenant's lexicon the text is read with
+	Mix                 *MixDTO            `json:"mix,omitempty"`
+	Segments            []SegmentResultDTO `json:"segments,omitempty"`
+	Template            string             `json:"template,omitempty"` //Name of the template the text is rendered from
+	Status              string             `json:"status"`
+	MediaUrl            string             `json:"mediaUrl,omitempty"`
+	Media               *MediaDTO          `json:"media,omitempty"`
+}
+
+//A segment of a dialogue, with its timing once the media is ready
+type SegmentResultDTO struct {
+	Speaker  string `json:"speaker,omitempty"`
 	Text     string `json:"text"`
 	Language string `json:"language"`
-	Status   string `json:"status"`
-	MediaUrl string `json:"mediaUrl,omitempty"`
+	Voice    string `json:"voice,omitempty"`
+	Pause    int64  `json:"pause,omitempty"` //Milliseconds of silence before the segment
+	Start    *int64 `json:"start,omitempty"` //Milliseconds from the start of the media
+	End      *int64 `json:"end,omitempty"`
+}
+
+//Describes the media available under MediaUrl
+type MediaDTO struct {
+	MimeType   string `json:"mimeType"`
+	Codec      string `json:"codec,omitempty"`
+	SampleRate int    `json:"sampleRate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	Duration   int64  `json:"duration"` //In milliseconds
+	Size       int64  `json:"size"`
+	Sha256     string `json:"sha256"`
 }
 
 //Converts service result to REST response object
-func (r *ResultDTO) createWith(s *service.TtsResult, mediaUrl mediaUrlFunc) {
+func (r *ResultDTO) createWith(s *service.TtsResult, mediaUrl mediaUrlFunc, urlTtl time.Duration) {
 	r.ID = s.Id
 	r.Text = s.Text
+	r.NormalizedText = s.NormalizedText
+	if s.Ssml {
+		r.TextType = textTypeSsml
+	}
 	r.Language = s.Language.String()
+	if s.DetectedLanguage != nil {
+		r.DetectedLanguage = s.DetectedLanguage.String()
+		r.DetectionConfidence = s.DetectionConfidence
+	}
+	r.Voice = s.Options.Voice
+	r.Rate = s.Options.Rate
+	r.Pitch = s.Options.Pitch
+	r.Volume = s.Options.Volume
+	r.Format = s.Options.Format
+	r.MixedLanguages = s.Options.Mixed
+	r.LexiconVersion = s.LexiconVersion
+	if s.Mix != nil {
+		r.Mix = &MixDTO{s.Mix.Background, s.Mix.Intro, s.Mix.Outro, &s.Mix.Volume, &s.Mix.Ducking}
+	}
+	r.Template = s.Template
+	for _, segment := range s.Segments {
+		dto := SegmentResultDTO{segment.Speaker, segment.Text, segment.Language.String(), segment.Voice, int64(segment.Pause / time.Millisecond), nil, nil}
+		//Timings are known once the media is ready
+		if s.MediaId != "" {
+			start, end := int64(segment.Start/time.Millisecond), int64(segment.End/time.Millisecond)
+			dto.Start, dto.End = &start, &end
+		}
+		r.Segments = append(r.Segments, dto)
+	}
 	r.Status = s.Status.String()
 
 	if s.MediaId != "" {
-		r.MediaUrl = mediaUrl(s.MediaId)
+		r.MediaUrl = mediaUrl(s.MediaId, urlTtl)
 	} //QUESTION: Why no else here?
 
+	r.Media = toMediaDTO(s.Media)
+
+}
+
+//Returns nil for media saved before the metadata was introduced
+func toMediaDTO(m *tts.MediaInfo) *MediaDTO {
+	if m == nil {
+		return nil
+	}
+	return &MediaDTO{
+		MimeType:   m.MimeType,
+		Codec:      m.Codec,
+		SampleRate: m.SampleRate,
+		Channels:   m.Channels,
+		Duration:   int64(m.Duration / time.Millisecond),
+		Size:       m.Size,
+		Sha256:     m.Checksum,
+	}
+}
+
+//Describes what can be requested: languages, voices, formats...
+//Options that can't be changed are omitted
+type CapabilitiesDTO struct {
+	Languages        []LanguageDTO `json:"languages"`
+	Formats          []string      `json:"formats"`
+	TranscodeFormats []string      `json:"transcodeFormats"` //See GET /media/{id}?format=
+	Rate             *RangeDTO     `json:"rate,omitempty"`
+	Pitch            *RangeDTO     `json:"pitch,omitempty"`
+	Volume           *RangeDTO     `json:"volume,omitempty"`
+}
+
+type LanguageDTO struct {
+	Code   string   `json:"code"`
+	Tag    string   `json:"tag,omitempty"` //BCP-47, e.g. "en-US"
+	Name   string   `json:"name,omitempty"`
+	Voices []string `json:"voices"` //The first one is the default
+}
+
+type RangeDTO struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+//Converts engine capabilities to REST response object
+func (c *CapabilitiesDTO) createWith(s tts.Capabilities) {
+	c.Languages = []LanguageDTO{}
+	for _, code := range s.Languages() {
+		l, _ := language.Default().Lookup(code)
+		c.Languages = append(c.Languages, LanguageDTO{code, l.Tag, l.Name, s.Voices[code]})
+	}
+
+	c.Formats = s.Formats
+	c.TranscodeFormats = tts.TranscodeFormats
+	c.Rate = toRangeDTO(s.Rate)
+	c.Pitch = toRangeDTO(s.Pitch)
+	c.Volume = toRangeDTO(s.Volume)
+}
+
+func toRangeDTO(r *tts.Range) *RangeDTO {
+	if r == nil {
+		return nil
+	}
+	return &RangeDTO{r.Min, r.Max}
 }
 
 // REST error object
@@ -41,3 +209,182 @@ type ErrorDTO struct {
 func (err ErrorDTO) Error() string {
 	return err.Message
 }
+
+//Pronunciations of words, by tenant and language
+type LexiconDTO struct {
+	Tenant   string     `json:"tenant"`
+	Language string     `json:"language"`
+	Version  int        `json:"version"` //Increased on every change
+	Entries  []EntryDTO `json:"entries"`
+}
+
+//Tells how to read the grapheme: with the alias instead, or with the IPA phoneme, if the provider supports it
+type EntryDTO struct {
+	Grapheme string `json:"grapheme"`
+	Alias    string `json:"alias,omitempty"`
+	Phoneme  string `json:"phoneme,omitempty"`
+}
+
+//Converts the lexicon into REST representation
+func (l *LexiconDTO) createWith(s lexicon.Lexicon) {
+	l.Tenant = s.Tenant
+	l.Language = s.Language
+	l.Version = s.Version
+	l.Entries = []EntryDTO{}
+	for _, entry := range s.Entries {
+		l.Entries = append(l.Entries, toEntryDTO(entry))
+	}
+}
+
+func toEntryDTO(e lexicon.Entry) EntryDTO {
+	return EntryDTO{Grapheme: e.Grapheme, Alias: e.Alias, Phoneme: e.Phoneme}
+}
+
+//Describes an asset available under /assets/{name}
+type AssetDTO struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+func toAssetDTO(a assets.Asset) AssetDTO {
+	return AssetDTO{a.Name, a.Size, a.Checksum}
+}
+
+//A text with placeholders, e.g. "Your order {number} ships {date}", see /templates/{name}/render
+type TemplateDTO struct {
+	Name         string            `json:"name"`
+	Language     string            `json:"language"`
+	Text         string            `json:"text"`
+	Placeholders map[string]string `json:"placeholders"` //Types by name, e.g. "number": "digits"
+	Version      int               `json:"version"`      //Increased on every change
+}
+
+func toTemplateDTO(t templates.Template) TemplateDTO {
+	return TemplateDTO{t.Name, t.Language, t.Text, t.Placeholders, t.Version}
+}
+
+//Renders the template into a voice message. Options are the same as the ones of CreateDTO
+type RenderDTO struct {
+	Variables map[string]string //Values by placeholder name
+
+	Voice  string
+	Rate   *int
+	Pitch  *int
+	Volume *int
+	Format string
+
+	Mix *MixDTO
+}
+
+//A batch of voice messages, created together by POST /voiceMessages:batch, see /batches/{id}
+//Status is PENDING while any of its voice messages is, DONE when none is
+type BatchDTO struct {
+	ID       string         `json:"id"`
+	Created  time.Time      `json:"created"`
+	Status   string         `json:"status"`
+	Pending  int            `json:"pending"`
+	Ready    int            `json:"ready"`
+	Failed   int            `json:"failed"`
+	Rejected int            `json:"rejected"` //Items that weren't created, e.g. invalid ones
+	Items    []BatchItemDTO `json:"items,omitempty"`
+}
+
+//The voice message of a batch item, in the order of the request, see /voiceMessages/{id}
+//Rejected items have no ID, only the error they were rejected for
+type BatchItemDTO struct {
+	ID     string         `json:"id,omitempty"`
+	Status string         `json:"status,omitempty"`
+	Error  *BatchErrorDTO `json:"error,omitempty"`
+}
+
+type BatchErrorDTO struct {
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+}
+
+//Converts the batch into REST representation, its items are left out of progress reports
+func (b *BatchDTO) createWith(s *service.BatchResult, withItems bool) {
+	b.ID = s.Id
+	b.Created = s.Created
+	b.Status = s.Status
+	b.Pending = s.Pending
+	b.Ready = s.Ready
+	b.Failed = s.Failed
+	b.Rejected = s.Rejected
+
+	if !withItems {
+		return
+	}
+
+	b.Items = []BatchItemDTO{}
+	for _, item := range s.Items {
+		dto := BatchItemDTO{ID: item.Id}
+		if item.Status != nil {
+			dto.Status = item.Status.String()
+		}
+		if item.Problem != "" {
+			dto.Error = &BatchErrorDTO{item.Problem, item.Details}
+		}
+		b.Items = append(b.Items, dto)
+	}
+}
+
+//Lists the files of an archive of media, see /batches/{id}/archive and /media:archive
+//Voice messages that aren't ready are skipped
+type ArchiveManifestDTO struct {
+	Batch   string              `json:"batch,omitempty"`
+	Created time.Time           `json:"created"`
+	Files   []ArchiveFileDTO    `json:"files"`
+	Skipped []ArchiveSkippedDTO `json:"skipped"`
+}
+
+type ArchiveFileDTO struct {
+	Name     string    `json:"name"` //In the archive
+	ID       string    `json:"id"`   //Of the voice message
+	Text     string    `json:"text"`
+	Language string    `json:"language"`
+	Media    *MediaDTO `json:"media,omitempty"`
+}
+
+type ArchiveSkippedDTO struct {
+	ID     string `json:"id"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+//Requests an archive of the media of the voice messages
+type ArchiveRequestDTO struct {
+	IDs []string `json:"ids"`
+}
+
+//A playlist of voice messages, published as a podcast feed under FeedUrl and a playlist under PlaylistUrl
+type CollectionDTO struct {
+	ID          string              `json:"id"`
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Language    string              `json:"language,omitempty"`
+	Author      string              `json:"author,omitempty"`
+	Items       []CollectionItemDTO `json:"items"`
+	Created     *time.Time          `json:"created,omitempty"`
+	Updated     *time.Time          `json:"updated,omitempty"`
+	FeedUrl     string              `json:"feedUrl,omitempty"`
+	PlaylistUrl string              `json:"playlistUrl,omitempty"`
+}
+
+//A voice message of a collection, see /voiceMessages/{id}
+//Title of the episode is the beginning of the text of the voice message if empty
+type CollectionItemDTO struct {
+	ID    string     `json:"id"`
+	Title string     `json:"title,omitempty"`
+	Added *time.Time `json:"added,omitempty"`
+}
+
+func toCollectionDTO(c collections.Collection, collectionsUrl string) CollectionDTO {
+	dto := CollectionDTO{c.Id, c.Title, c.Description, c.Language, c.Author, []CollectionItemDTO{}, &c.Created, &c.Updated,
+		collectionsUrl + c.Id + "/" + feedAction, collectionsUrl + c.Id + playlistSuffix}
+	for i := range c.Items {
+		dto.Items = append(dto.Items, CollectionItemDTO{c.Items[i].Id, c.Items[i].Title, &c.Items[i].Added})
+	}
+	return dto
+}
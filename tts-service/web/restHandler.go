@@ -2,45 +2,101 @@ package web
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/collections"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/idempotency"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/templates"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 	"strings"
+	"time"
 )
 
+//What the handlers are built of
+//Unit tests set only what the tested handlers use
+type Config struct {
+	Service     service.TtsService
+	Batches     service.BatchService
+	Engine      MediaEngine
+	Lexicons    LexiconStore
+	Assets      AssetStore
+	Templates   TemplateStore
+	Collections CollectionStore
+	Idempotency IdempotencyStore
+	SelfUrl     string //Base of the media URLs
+	Signer      *UrlSigner
+}
+
 //We pass ServeMux explicitly to be able to unit-test in isolation.
-func New(mux *http.ServeMux, ttsService service.TtsService, engine *tts.Engine, selfUrl string) {
+func New(mux *http.ServeMux, config Config) {
+	ttsService, engine, selfUrl, signer := config.Service, config.Engine, config.SelfUrl, config.Signer
 
 	const createPathPrefix = "/voiceMessages"
 	const getPathPrefix = "/voiceMessages/"
 	const mediaPathPrefix = "/media/"
+	const capabilitiesPath = "/capabilities"
+	const lexiconPathPrefix = "/lexicons/"
+	const assetPathPrefix = "/assets/"
+	const templatePathPrefix = "/templates/"
+	const batchCreatePath = "/voiceMessages:batch"
+	const batchPathPrefix = "/batches/"
+	const mediaArchivePath = "/media:archive"
+	const collectionPathPrefix = "/collections/"
 
-	//Allows to construct URL to media given it's ID
-	mediaUrl := func(mediaId string) string {
-		return selfUrl + mediaPathPrefix + mediaId
+	//Allows to construct signed URL to media given it's ID
+	mediaUrl := func(mediaId string, ttl time.Duration) string {
+		return selfUrl + mediaPathPrefix + mediaId + "?" + signer.sign(mediaId, ttl)
 	}
 
-	create := createHandling{createPathPrefix, ttsService, mediaUrl}
+	create := createHandling{createPathPrefix, ttsService, mediaUrl, config.Idempotency}
 	get := getHandling{getPathPrefix, ttsService, mediaUrl}
-	media := mediaHandling{mediaPathPrefix, engine}
+	media := mediaHandling{mediaPathPrefix, engine, signer}
+	capabilities := capabilitiesHandling{capabilitiesPath, ttsService}
+	lexicon := lexiconHandling{lexiconPathPrefix, config.Lexicons, ttsService}
+	asset := assetHandling{assetPathPrefix, config.Assets}
+	template := templateHandling{templatePathPrefix, config.Templates, create}
+	archive := archiveHandling{mediaArchivePath, ttsService, engine}
+	batch := batchHandling{batchPathPrefix, config.Batches, create, archive}
+	collection := collectionHandling{collectionPathPrefix, config.Collections, ttsService, engine, selfUrl}
 
 	//Second argument must be a http.HandlerFunc Function!
 	mux.HandleFunc(create.pathPrefix, create.handle)
 	mux.HandleFunc(get.pathPrefix, get.handle)
 	mux.HandleFunc(media.pathPrefix, media.handle)
+	mux.HandleFunc(capabilities.pathPrefix, capabilities.handle)
+	mux.HandleFunc(lexicon.pathPrefix, lexicon.handle)
+	mux.HandleFunc(asset.pathPrefix, asset.handle)
+	mux.HandleFunc(template.pathPrefix, template.handle)
+	mux.HandleFunc(batchCreatePath, batch.handleCreate)
+	mux.HandleFunc(batch.pathPrefix, batch.handleGet)
+	mux.HandleFunc(archive.pathPrefix, archive.handle)
+	mux.HandleFunc(collection.pathPrefix, collection.handle)
 
 	//Handle simple UI
 	mux.HandleFunc("/public/", uiHandler)
 }
 
-type mediaUrlFunc func(string) string
+//Zero ttl means the default URL lifetime
+type mediaUrlFunc func(mediaId string, ttl time.Duration) string
+
+//Interface abstracting over tts.Engine
+type MediaEngine interface {
+	Result(mediaId string) (io.ReadCloser, error)
+	Info(mediaId string) (*tts.MediaInfo, error)
+	Marks(mediaId string) ([]tts.Mark, error)
+	Rendition(mediaId string, format string) (io.ReadCloser, *tts.MediaInfo, error)
+}
 
 // CREATE HANDLING
 type createHandling struct {
-	pathPrefix string
-	service    service.TtsService
-	mediaUrl   mediaUrlFunc
+	pathPrefix  string
+	service     service.TtsService
+	mediaUrl    mediaUrlFunc
+	idempotency IdempotencyStore
 }
 
 func (h createHandling) handle(w http.ResponseWriter, r *http.Request) {
@@ -53,6 +109,13 @@ func (h createHandling) handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//Interface abstracting over idempotency.Store
+type IdempotencyStore interface {
+	Lock(key string) func()
+	Get(key string) (idempotency.Record, error)
+	Put(key string, r idempotency.Record) error
+}
+
 // GET HANDLING
 type getHandling struct {
 	pathPrefix string
@@ -73,7 +136,8 @@ func (h getHandling) handle(w http.ResponseWriter, r *http.Request) {
 // MEDIA HANDLING
 type mediaHandling struct {
 	pathPrefix string
-	engine     *tts.Engine
+	engine     MediaEngine
+	signer     *UrlSigner
 }
 
 func (h mediaHandling) handle(w http.ResponseWriter, r *http.Request) {
@@ -85,6 +149,142 @@ func (h mediaHandling) handle(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// CAPABILITIES HANDLING
+type capabilitiesHandling struct {
+	pathPrefix string
+	service    service.TtsService
+}
+
+func (h capabilitiesHandling) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		onGetCapabilitiesRequest(h, w, r)
+	default:
+		onMethodNotSupported([]string{"GET"}, w, r)
+	}
+}
+
+// LEXICON HANDLING
+type lexiconHandling struct {
+	pathPrefix string
+	lexicons   LexiconStore
+	service    service.TtsService
+}
+
+func (h lexiconHandling) handle(w http.ResponseWriter, r *http.Request) {
+	onLexiconRequest(h, w, r)
+}
+
+//Interface abstracting over lexicon.Store
+type LexiconStore interface {
+	Get(tenant, language string) (lexicon.Lexicon, error)
+	Put(tenant, language string, entry lexicon.Entry) (lexicon.Lexicon, error)
+	Delete(tenant, language, grapheme string) (lexicon.Lexicon, error)
+}
+
+// ASSET HANDLING
+type assetHandling struct {
+	pathPrefix string
+	assets     AssetStore
+}
+
+func (h assetHandling) handle(w http.ResponseWriter, r *http.Request) {
+	onAssetRequest(h, w, r)
+}
+
+//Interface abstracting over assets.Store
+type AssetStore interface {
+	List(tenant string) ([]assets.Asset, error)
+	Get(tenant, name string) (assets.Asset, []byte, error)
+	Put(tenant, name string, content []byte) (assets.Asset, error)
+	Delete(tenant, name string) error
+}
+
+// TEMPLATE HANDLING
+type templateHandling struct {
+	pathPrefix string
+	templates  TemplateStore
+	create     createHandling //Rendered templates are created as voice messages
+}
+
+func (h templateHandling) handle(w http.ResponseWriter, r *http.Request) {
+	onTemplateRequest(h, w, r)
+}
+
+//Interface abstracting over templates.Store
+type TemplateStore interface {
+	List(tenant string) ([]templates.Template, error)
+	Get(tenant, name string) (templates.Template, error)
+	Put(t templates.Template) (templates.Template, error)
+	Delete(tenant, name string) error
+}
+
+// BATCH HANDLING
+type batchHandling struct {
+	pathPrefix string
+	batches    service.BatchService
+	create     createHandling //Items are validated the way single voice messages are
+	archive    archiveHandling
+}
+
+func (h batchHandling) handleCreate(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		onCreateBatchRequest(h, w, r)
+	default:
+		onMethodNotSupported([]string{"POST"}, w, r)
+	}
+}
+
+func (h batchHandling) handleGet(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		onGetBatchRequest(h, w, r)
+	default:
+		onMethodNotSupported([]string{"GET"}, w, r)
+	}
+}
+
+// ARCHIVE HANDLING
+type archiveHandling struct {
+	pathPrefix string
+	service    service.TtsService
+	engine     MediaEngine
+}
+
+func (h archiveHandling) handle(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		onCreateArchiveRequest(h, w, r)
+	default:
+		onMethodNotSupported([]string{"POST"}, w, r)
+	}
+}
+
+// COLLECTION HANDLING
+type collectionHandling struct {
+	pathPrefix  string
+	collections CollectionStore
+	service     service.TtsService
+	engine      MediaEngine
+	selfUrl     string //Feeds are read by podcast apps, so they link to absolute URLs
+}
+
+func (h collectionHandling) handle(w http.ResponseWriter, r *http.Request) {
+	onCollectionRequest(h, w, r)
+}
+
+//Interface abstracting over collections.Store
+type CollectionStore interface {
+	Get(id string) (collections.Collection, error)
+	Put(c collections.Collection) (collections.Collection, error)
+	Add(id, tenant string, item collections.Item) (collections.Collection, error)
+	Delete(id, tenant string) error
+}
+
 // HELPER FUNCTIONS
 func onMethodNotSupported(allowed []string, w http.ResponseWriter, r *http.Request) {
 
@@ -120,10 +320,10 @@ func addJsonHeader(w http.ResponseWriter) {
 }
 
 //Converts result object from the service into REST representation
-func toResultDTO(s *service.TtsResult, mediaUrl mediaUrlFunc) *ResultDTO {
+func toResultDTO(s *service.TtsResult, mediaUrl mediaUrlFunc, urlTtl time.Duration) *ResultDTO {
 	//Convert result to REST format
 	r := ResultDTO{}
-	r.createWith(s, mediaUrl)
+	r.createWith(s, mediaUrl, urlTtl)
 	return &r
 }
 
@@ -140,6 +340,54 @@ func convertError(err error) error {
 		}
 	}
 
+	lnf, ok := err.(lexicon.NotFoundError)
+	if ok {
+		return ErrorDTO{
+			Status:  404,
+			Message: lnf.Message,
+		}
+	}
+
+	anf, ok := err.(assets.NotFoundError)
+	if ok {
+		return ErrorDTO{
+			Status:  404,
+			Message: anf.Message,
+		}
+	}
+
+	tnf, ok := err.(templates.NotFoundError)
+	if ok {
+		return ErrorDTO{
+			Status:  404,
+			Message: tnf.Message,
+		}
+	}
+
+	cnf, ok := err.(collections.NotFoundError)
+	if ok {
+		return ErrorDTO{
+			Status:  404,
+			Message: cnf.Message,
+		}
+	}
+
+	coe, ok := err.(collections.OwnerError)
+	if ok {
+		return ErrorDTO{
+			Status:  403,
+			Message: coe.Message,
+		}
+	}
+
+	bnf, ok := err.(service.BatchNotFoundError)
+	if ok {
+		return ErrorDTO{
+			Status:  404,
+			Message: bnf.Message,
+		}
+	}
+
 	//Unknown error
 	return err
 }
@@ -1,15 +1,29 @@
 package web
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/assets"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/collections"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/idempotency"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/lexicon"
 	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/service"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/templates"
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/tts"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func TestRestController(t *testing.T) {
@@ -28,7 +42,7 @@ func TestRestController(t *testing.T) {
 				}
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -49,7 +63,7 @@ func TestRestController(t *testing.T) {
 				}
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -67,7 +81,7 @@ func TestRestController(t *testing.T) {
 				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -85,7 +99,7 @@ func TestRestController(t *testing.T) {
 				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -110,7 +124,7 @@ func TestRestController(t *testing.T) {
 				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -137,7 +151,7 @@ func TestRestController(t *testing.T) {
 				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -164,7 +178,7 @@ func TestRestController(t *testing.T) {
 				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -178,93 +192,1514 @@ func TestRestController(t *testing.T) {
 				So(string(rr.Body.String()), ShouldEqual, expected)
 			})
 
-			Convey("should correctly handle proper json body", func() {
+			Convey("should validate SSML with positions of the problems", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "<speak>\n  Wait <break time=\"forever\"/>\n  <audio/>\n</speak>", Language: "EN", TextType: "ssml"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":[` +
+					`"SSML line 2, column 8: \u003cbreak\u003e attribute 'time' must be a time like 500ms or 1.5s, got 'forever'",` +
+					`"SSML line 3, column 3: unsupported element \u003caudio\u003e"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should validate TextType", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "abcdef", Language: "EN", TextType: "html"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Unsupported TextType: html"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should accept valid SSML", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "<speak>Hello <break/> world</speak>", Language: "EN", TextType: "ssml"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				const expected = `{"id":"abc123","text":"Received: \u003cspeak\u003eHello \u003cbreak/\u003e world\u003c/speak\u003e","textType":"ssml","language":"EN","status":"PENDING"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should reject mixed languages for SSML", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "<speak>Hello</speak>", Language: "EN", TextType: "ssml", MixedLanguages: true}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":[` +
+					`"MixedLanguages isn't supported for SSML. Use \u003clang\u003e elements instead"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should validate options against the capabilities", func() {
+
+				//Encode JSON
+				rate, pitch := 20, 5
+				u := CreateDTO{Text: "abcdef", Language: "PL", Voice: "Amy", Rate: &rate, Pitch: &pitch, Format: "aiff"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Unsupported Voice: Amy. Voices of PL: Zofia",` +
+					`"Rate must be between -10 and 10","Pitch can't be changed","Unsupported Format: aiff. Formats: mp3, wav"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should accept options", func() {
+
+				//Encode JSON
+				rate := -3
+				u := CreateDTO{Text: "abcdef", Language: "EN", Voice: "Mike", Rate: &rate, Format: "WAV", MixedLanguages: true}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				const expected = `{"id":"abc123","text":"Received: abcdef","language":"EN","voice":"Mike","rate":-3,"format":"wav","mixedLanguages":true,"status":"PENDING"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should mix assets with the defaults applied", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "abcdef", Language: "EN", Format: "wav", Mix: &MixDTO{Background: "music", Outro: "jingle"}}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(rr.Body.String(), ShouldContainSubstring, `"mix":{"background":"music","outro":"jingle","volume":-12,"ducking":12}`)
+			})
+
+			Convey("should validate the mix", func() {
+
+				//Encode JSON
+				volume := 6.0
+				u := CreateDTO{Text: "abcdef", Language: "EN", Mix: &MixDTO{Intro: "../jingle", Volume: &volume}}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Mix asset names must be 1-64 letters, digits, '-' or '_': ../jingle",` +
+					`"Mix volume must be between -60 and 0","Mix needs \"Format\": \"wav\""]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should accept dialogues", func() {
+
+				//Encode JSON
+				u := CreateDTO{Voice: "Mike", Segments: []SegmentDTO{
+					{Speaker: "agent", Text: "How can I help?", Language: "EN"},
+					{Speaker: "customer", Text: "Dzień dobry", Language: "PL", Voice: "Zofia", Pause: 250},
+				}}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				const expected = `"language":"EN","voice":"Mike","segments":[{"speaker":"agent","text":"How can I help?","language":"EN"},` +
+					`{"speaker":"customer","text":"Dzień dobry","language":"PL","voice":"Zofia","pause":250}]`
+				So(rr.Body.String(), ShouldContainSubstring, expected)
+			})
+
+			Convey("should validate the segments of dialogues", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "Hello", Language: "EN", Segments: []SegmentDTO{
+					{Text: " "},
+					{Text: "Dzień dobry", Language: "DE", Pause: -1},
+					{Text: "Hi", Voice: "Zofia"},
+				}}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Text can't be set along with Segments",` +
+					`"Segment 1: Text is empty","Segment 2: Pause must be between 0 and 10000 milliseconds","Segment 2: Unsupported Language: DE",` +
+					`"Segment 3: Unsupported Voice: Zofia. Voices of EN: Amy, Mike"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should reject invalid tenants", func() {
 
 				//Encode JSON
 				u := CreateDTO{Text: "abcdef", Language: "EN"}
 				b := new(bytes.Buffer)
 				json.NewEncoder(b).Encode(u)
 
-				//Prepare request
-				req, err := http.NewRequest("POST", rootUrl, b)
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Tenant-Id", "acme/../other")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, "X-Tenant-Id must be")
+			})
+
+			Convey("should validate IDs chosen by clients", func() {
+				serve := func(body string) *httptest.ResponseRecorder {
+					req, err := http.NewRequest("POST", rootUrl, strings.NewReader(body))
+					if err != nil {
+						t.Fatal(err)
+					}
+					req.Header.Set("Content-Type", "application/json")
+
+					mux := http.NewServeMux()
+					New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+					rr := httptest.NewRecorder()
+					mux.ServeHTTP(rr, req)
+					return rr
+				}
+
+				rr := serve(`{"id":"a/b","text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, `"details":["Id must be 1-64 letters, digits, '-' or '_': a/b"]`)
+
+				rr = serve(`{"id":"denied","text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, "ID can't be chosen")
+
+				rr = serve(`{"id":"taken","text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusConflict)
+				So(rr.Body.String(), ShouldContainSubstring, "TTS with ID: 'taken' already exists with another request")
+			})
+
+			Convey("should accept AUTO language, but no voice for it", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "abcdef", Language: "AUTO", Voice: "Amy"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Voice can't be chosen for AUTO Language"]}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should correctly handle proper json body", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "abcdef", Language: "EN"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				const expected = `{"id":"abc123","text":"Received: abcdef","language":"EN","status":"PENDING"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should correctly return json with MediaUrl and correct Content-Type", func() {
+
+				//Encode JSON
+				u := CreateDTO{Text: "abcdef", Language: "EN"}
+				b := new(bytes.Buffer)
+				json.NewEncoder(b).Encode(u)
+
+				//Prepare request
+				req, err := http.NewRequest("POST", rootUrl, b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: getMockService("123", service.StatusReady), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+				expected := `{"id":"abc123","text":"Received: abcdef","language":"EN","status":"READY","mediaUrl":"` + selfUrl + `/media/123?` + testSignature("123", time.Hour) + `"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+		})
+
+		Convey("when handling request on /capabilities", func() {
+
+			Convey("should return languages, voices and options", func() {
+				req, err := http.NewRequest("GET", "http://localhost/capabilities", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/json")
+
+				const expected = `{"languages":[{"code":"EN","tag":"en-US","name":"English","voices":["Amy","Mike"]},` +
+					`{"code":"PL","tag":"pl-PL","name":"Polish","voices":["Zofia"]}],` +
+					`"formats":["mp3","wav"],"transcodeFormats":["wav","flac","opus"],"rate":{"min":-10,"max":10}}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should respond with 405 (Method Not Allowed) status code for POST", func() {
+				req, err := http.NewRequest("POST", "http://localhost/capabilities", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("when handling request on /lexicons/", func() {
+
+			lexicons := &mockLexicons{entries: []lexicon.Entry{{Grapheme: "XJ9", Alias: "ex jay nine"}}, version: 1}
+
+			serve := func(method, path, tenant, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost/lexicons/"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				if tenant != "" {
+					req.Header.Set("X-Tenant-Id", tenant)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Lexicons: lexicons, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should return the lexicon of the tenant", func() {
+				rr := serve("GET", "EN", "acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(lexicons.tenant, ShouldEqual, "acme")
+				const expected = `{"tenant":"acme","language":"EN","version":1,"entries":[{"grapheme":"XJ9","alias":"ex jay nine"}]}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should use the default tenant if none is given", func() {
+				serve("GET", "EN", "", "")
+
+				So(lexicons.tenant, ShouldEqual, lexicon.DefaultTenant)
+			})
+
+			Convey("should reject invalid tenants", func() {
+				rr := serve("GET", "EN", "../acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+			})
+
+			Convey("should respond with 404 (Not Found) status code for unsupported languages", func() {
+				rr := serve("GET", "DE", "acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should return a single entry", func() {
+				rr := serve("GET", "EN/xj9", "acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, `{"grapheme":"XJ9","alias":"ex jay nine"}`+"\n")
+
+				rr = serve("GET", "EN/Acme", "acme", "")
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should put entries of graphemes from the path", func() {
+				rr := serve("PUT", "EN/Nike Air", "acme", `{"phoneme": "ˈnaɪki ɛər"}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(lexicons.entries, ShouldContain, lexicon.Entry{Grapheme: "Nike Air", Phoneme: "ˈnaɪki ɛər"})
+				So(rr.Body.String(), ShouldContainSubstring, `"version":2`)
+			})
+
+			Convey("should reject entries without pronunciation", func() {
+				rr := serve("PUT", "EN/Nike", "acme", `{"alias": " "}`)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, "Alias or Phoneme must be set")
+			})
+
+			Convey("should delete entries", func() {
+				rr := serve("DELETE", "EN/XJ9", "acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(lexicons.entries, ShouldBeEmpty)
+
+				rr = serve("DELETE", "EN/XJ9", "acme", "")
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should respond with 405 (Method Not Allowed) status code for changing whole lexicons", func() {
+				rr := serve("DELETE", "EN", "acme", "")
+
+				So(rr.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("when handling request on /assets/", func() {
+
+			store := mockAssets{"acme/music": testAsset("acme", "music")}
+
+			serve := func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost/assets/"+path, bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", contentType)
+				req.Header.Set("X-Tenant-Id", "acme")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Assets: store, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should list the assets of the tenant", func() {
+				store["other/jingle"] = testAsset("other", "jingle")
+
+				rr := serve("GET", "", "", nil)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, `[{"name":"music","size":46,"sha256":"cafe"}]`+"\n")
+			})
+
+			Convey("should return the asset", func() {
+				rr := serve("GET", "music", "", nil)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "audio/wav")
+				So(rr.Header().Get("ETag"), ShouldEqual, `"cafe"`)
+				So(rr.Body.Bytes(), ShouldResemble, testWav())
+			})
+
+			Convey("should put WAV assets", func() {
+				rr := serve("PUT", "jingle", "audio/x-wav", testWav())
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, `{"name":"jingle","size":46,"sha256":"cafe"}`+"\n")
+				So(store, ShouldContainKey, "acme/jingle")
+			})
+
+			Convey("should reject assets that can't be mixed", func() {
+				rr := serve("PUT", "jingle", "audio/mpeg", []byte("ID3"))
+				So(rr.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+
+				rr = serve("PUT", "jingle", "audio/wav", []byte("ID3"))
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+
+				rr = serve("PUT", "jingle", "audio/wav", make([]byte, maxAssetSize+1))
+				So(rr.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+			})
+
+			Convey("should reject invalid names", func() {
+				rr := serve("GET", "jingle.mp3", "", nil)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+			})
+
+			Convey("should delete assets", func() {
+				rr := serve("DELETE", "music", "", nil)
+				So(rr.Code, ShouldEqual, http.StatusNoContent)
+
+				rr = serve("DELETE", "music", "", nil)
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should respond with 405 (Method Not Allowed) status code for changing all assets", func() {
+				rr := serve("DELETE", "", "", nil)
+
+				So(rr.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("when handling request on /templates/", func() {
+
+			store := mockTemplates{"acme/shipped": {Tenant: "acme", Name: "shipped", Language: "EN",
+				Text: "Order {number} ships {date}", Placeholders: map[string]string{"number": "digits", "date": "date"}, Version: 1}}
+
+			serve := func(method, path, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost/templates/"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Tenant-Id", "acme")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Templates: store, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should list the templates of the tenant", func() {
+				rr := serve("GET", "", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				const expected = `[{"name":"shipped","language":"EN","text":"Order {number} ships {date}",` +
+					`"placeholders":{"date":"date","number":"digits"},"version":1}]` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should put valid templates", func() {
+				rr := serve("PUT", "shipped", `{"language":"EN","text":"Order {number} ships","placeholders":{"number":"digits"}}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldContainSubstring, `"version":2`)
+				So(store["acme/shipped"].Text, ShouldEqual, "Order {number} ships")
+			})
+
+			Convey("should reject invalid templates", func() {
+				rr := serve("PUT", "paid", `{"language":"DE","text":"Paid {amount}"}`)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Invalid payload","details":["Unsupported Language: DE","Placeholder {amount} must be declared"]}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should delete templates", func() {
+				So(serve("DELETE", "shipped", "").Code, ShouldEqual, http.StatusNoContent)
+				So(serve("GET", "shipped", "").Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should render templates into voice messages", func() {
+				rr := serve("POST", "shipped/render", `{"Variables":{"number":"12","date":"2017-05-12"},"Voice":"Mike"}`)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				const expected = `{"id":"abc123","text":"Received: Order 12 ships 2017-05-12","language":"EN","voice":"Mike","template":"shipped","status":"PENDING"}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should validate the variables of rendered templates", func() {
+				rr := serve("POST", "shipped/render", `{"Variables":{"number":"12"}}`)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, "Variable date is missing")
+
+				rr = serve("POST", "unknown/render", `{}`)
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+
+				rr = serve("GET", "shipped/render", "")
+				So(rr.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("when handling POST request on /voiceMessages with Idempotency-Key", func() {
+
+			keys := mockIdempotency{}
+
+			serve := func(key, tenant, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest("POST", rootUrl, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Idempotency-Key", key)
+				req.Header.Set("X-Tenant-Id", tenant)
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Idempotency: keys, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should replay the response to repeated requests", func() {
+				first := serve("key-1", "acme", `{"text":"Hello","language":"EN"}`)
+				So(first.Code, ShouldEqual, http.StatusAccepted)
+				So(first.Header().Get("Idempotent-Replayed"), ShouldEqual, "")
+				So(keys, ShouldContainKey, "acme:key-1")
+
+				keys["acme:key-1"] = idempotency.Record{Fingerprint: keys["acme:key-1"].Fingerprint, Status: http.StatusAccepted, Body: []byte(`{"id":"first"}`)}
+
+				rr := serve("key-1", "acme", `{"text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(rr.Header().Get("Idempotent-Replayed"), ShouldEqual, "true")
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				So(rr.Body.String(), ShouldEqual, `{"id":"first"}`)
+			})
+
+			Convey("should reject keys reused for other requests", func() {
+				serve("key-1", "acme", `{"text":"Hello","language":"EN"}`)
+
+				rr := serve("key-1", "acme", `{"text":"Hello","language":"EN","voice":"Amy"}`)
+				So(rr.Code, ShouldEqual, http.StatusUnprocessableEntity)
+				So(rr.Body.String(), ShouldContainSubstring, "Idempotency-Key was already used with another request")
+
+				//Keys of tenants are kept apart
+				rr = serve("key-1", "other", `{"text":"Hello","language":"EN","voice":"Amy"}`)
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+			})
+
+			Convey("should not record rejected requests", func() {
+				rr := serve("key-1", "acme", `{"text":"","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(keys, ShouldBeEmpty)
+
+				rr = serve("key-1", "acme", `{"text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+			})
+
+			Convey("should validate keys", func() {
+				rr := serve("key 1", "acme", `{"text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+
+				rr = serve(strings.Repeat("k", 256), "acme", `{"text":"Hello","language":"EN"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(keys, ShouldBeEmpty)
+			})
+		})
+
+		Convey("when handling request on /voiceMessages:batch and /batches/", func() {
+
+			batches := &mockBatches{}
+
+			serve := func(method, path, contentType, accept, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", contentType)
+				req.Header.Set("Accept", accept)
+				req.Header.Set("X-Tenant-Id", "acme")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Batches: batches, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should create the valid items of JSON arrays and reject the others", func() {
+				rr := serve("POST", "/voiceMessages:batch", "application/json", "",
+					`[{"text":"Hello","language":"EN"},{"text":"","language":"EN"},"hello"]`)
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(rr.Header().Get("Location"), ShouldEqual, "/batches/b1")
+				const expected = `{"id":"b1","created":"2020-01-02T03:04:05Z","status":"PENDING","pending":1,"ready":0,"failed":0,"rejected":2,"items":[` +
+					`{"id":"abc123","status":"PENDING"},` +
+					`{"error":{"message":"Invalid payload","details":["Text is empty"]}},` +
+					`{"error":{"message":"Can't read json data: json: cannot unmarshal string into Go value of type web.CreateDTO"}}]}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+
+				So(len(batches.created), ShouldEqual, 3)
+				So(batches.created[0].Create.Text, ShouldEqual, "Hello")
+				So(batches.created[0].Create.Tenant, ShouldEqual, "acme")
+			})
+
+			Convey("should create the items of NDJSON streams", func() {
+				rr := serve("POST", "/voiceMessages:batch", "application/x-ndjson", "",
+					"{\"text\":\"Hello\",\"language\":\"EN\"}\n\n{\"text\":\"Hi\",\"language\":\"XX\"}\n")
+
+				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(len(batches.created), ShouldEqual, 2)
+				So(batches.created[0].Create, ShouldNotBeNil)
+				So(batches.created[1].Create, ShouldBeNil)
+				So(batches.created[1].Details, ShouldResemble, []string{"Unsupported Language: XX"})
+			})
+
+			Convey("should reject empty, too large and unreadable batches", func() {
+				rr := serve("POST", "/voiceMessages:batch", "application/json", "", `[]`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+
+				rr = serve("POST", "/voiceMessages:batch", "application/json", "", `{"text":"Hello"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, errBatchNotArray)
+
+				rr = serve("POST", "/voiceMessages:batch", "text/plain", "", `[]`)
+				So(rr.Code, ShouldEqual, http.StatusUnsupportedMediaType)
+
+				rr = serve("POST", "/voiceMessages:batch", "application/x-ndjson", "", strings.Repeat("{}\n", maxBatchSize+1))
+				So(rr.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+				//The rest of the array isn't read
+				rr = serve("POST", "/voiceMessages:batch", "application/json", "", "["+strings.Repeat("{},", maxBatchSize)+"{}, unreadable")
+				So(rr.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+				rr = serve("POST", "/voiceMessages:batch", "application/json", "", `[{"text":"Hello"}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+
+				rr = serve("GET", "/voiceMessages:batch", "", "", "")
+				So(rr.Code, ShouldEqual, http.StatusMethodNotAllowed)
+
+				So(batches.created, ShouldBeEmpty)
+			})
+
+			Convey("should return the batch by ID", func() {
+				batches.pendingGets = 1
+
+				rr := serve("GET", "/batches/b1", "", "", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldContainSubstring, `"status":"PENDING","pending":1,`)
+				So(rr.Body.String(), ShouldContainSubstring, `"items":[{"id":"abc123","status":"PENDING"}]`)
+
+				rr = serve("GET", "/batches/unknown", "", "", "")
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should stream the progress of followed batches until they're done", func() {
+				defer func(interval time.Duration) { batchPollInterval = interval }(batchPollInterval)
+				batchPollInterval = time.Millisecond
+				batches.pendingGets = 2
+
+				rr := serve("GET", "/batches/b1", "", "application/x-ndjson", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/x-ndjson")
+				lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+				So(len(lines), ShouldEqual, 3)
+				So(lines[0], ShouldNotContainSubstring, `"items"`)
+				So(lines[1], ShouldContainSubstring, `"status":"PENDING"`)
+				So(lines[2], ShouldContainSubstring, `"status":"DONE","pending":0,"ready":1,`)
+				So(lines[2], ShouldContainSubstring, `"items":[{"id":"abc123","status":"READY"}]`)
+			})
+		})
+
+		Convey("when handling request on /media:archive and /batches/{id}/archive", func() {
+
+			engine := mockEngine{}
+
+			serve := func(method, path, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Batches: &mockBatches{}, Engine: engine, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			readManifest := func(content []byte) ArchiveManifestDTO {
+				manifest := ArchiveManifestDTO{}
+				So(json.Unmarshal(content, &manifest), ShouldBeNil)
+				return manifest
+			}
+
+			Convey("should stream ZIP archives of ready media with their manifest", func() {
+				rr := serve("POST", "/media:archive", `{"ids":["latte","cafe","latte","unknown"]}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/zip")
+				So(rr.Header().Get("Content-Disposition"), ShouldEqual, `attachment; filename="media.zip"`)
+
+				archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+				So(err, ShouldBeNil)
+				So(len(archive.File), ShouldEqual, 2)
+				So(archive.File[0].Name, ShouldEqual, "latte.mp3")
+				So(archive.File[1].Name, ShouldEqual, "manifest.json")
+
+				file, _ := archive.File[0].Open()
+				content, _ := ioutil.ReadAll(file)
+				So(string(content), ShouldEqual, "audio")
+
+				file, _ = archive.File[1].Open()
+				content, _ = ioutil.ReadAll(file)
+				manifest := readManifest(content)
+				So(manifest.Files, ShouldResemble, []ArchiveFileDTO{{Name: "latte.mp3", ID: "latte", Text: "coffee'h good", Language: "EN", Media: toMediaDTO(testMediaInfo())}})
+				So(manifest.Skipped, ShouldResemble, []ArchiveSkippedDTO{
+					{ID: "cafe", Status: "PENDING"},
+					{ID: "unknown", Error: "TTS with ID: 'unknown' doesn't exist"}})
+			})
+
+			Convey("should stream TAR archives of the media of batches", func() {
+				rr := serve("GET", "/batches/b1/archive?format=tar", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/x-tar")
+
+				archive := tar.NewReader(bytes.NewReader(rr.Body.Bytes()))
+				header, err := archive.Next()
+				So(err, ShouldBeNil)
+				So(header.Name, ShouldEqual, "manifest.json")
+
+				content, _ := ioutil.ReadAll(archive)
+				manifest := readManifest(content)
+				So(manifest.Batch, ShouldEqual, "b1")
+				So(manifest.Files, ShouldBeEmpty)
+				So(manifest.Skipped, ShouldResemble, []ArchiveSkippedDTO{{ID: "abc123", Error: "TTS with ID: 'abc123' doesn't exist"}})
+			})
+
+			Convey("should skip media that can't be read and complete the archive", func() {
+				engine.err = tts.MediaCorruptedError{Id: "456", Message: "Media with ID: '456' is corrupted: checksum mismatch"}
+
+				rr := serve("POST", "/media:archive", `{"ids":["latte"]}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+
+				archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+				So(err, ShouldBeNil)
+				So(len(archive.File), ShouldEqual, 1)
+				So(archive.File[0].Name, ShouldEqual, "manifest.json")
+
+				file, _ := archive.File[0].Open()
+				content, _ := ioutil.ReadAll(file)
+				manifest := readManifest(content)
+				So(manifest.Files, ShouldBeEmpty)
+				So(manifest.Skipped, ShouldResemble, []ArchiveSkippedDTO{
+					{ID: "latte", Status: "READY", Error: "Media with ID: '456' is corrupted: checksum mismatch"}})
+			})
+
+			Convey("should read media of unknown size before adding it to TAR archives", func() {
+				rr := serve("POST", "/media:archive?format=tar", `{"ids":["chat"]}`)
+
+				archive := tar.NewReader(bytes.NewReader(rr.Body.Bytes()))
+				header, err := archive.Next()
+				So(err, ShouldBeNil)
+				So(header.Name, ShouldEqual, "chat")
+				So(header.Size, ShouldEqual, 5)
+
+				header, err = archive.Next()
+				So(err, ShouldBeNil)
+				So(header.Name, ShouldEqual, "manifest.json")
+			})
+
+			Convey("should reject invalid requests", func() {
+				So(serve("POST", "/media:archive", `{"ids":[]}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(serve("POST", "/media:archive?format=rar", `{"ids":["latte"]}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(serve("GET", "/media:archive", "").Code, ShouldEqual, http.StatusMethodNotAllowed)
+				So(serve("GET", "/batches/unknown/archive", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("GET", "/batches/b1/unknown", "").Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("when handling request on /collections/", func() {
+
+			added := time.Date(2017, 5, 12, 6, 0, 0, 0, time.UTC)
+			store := mockCollections{"bulletins": {Id: "bulletins", Tenant: lexicon.DefaultTenant, Title: "Daily bulletins", Language: "EN", Author: "ACME",
+				Items: []collections.Item{{Id: "latte", Added: added}, {Id: "cafe", Added: added}, {Id: "chat", Added: added}}, Updated: added}}
+
+			tenant := ""
+
+			serve := func(method, path, body string) *httptest.ResponseRecorder {
+				req, err := http.NewRequest(method, "http://localhost/collections/"+path, strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Content-Type", "application/json")
+				if tenant != "" {
+					req.Header.Set(tenantHeader, tenant)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, Collections: store, SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+				return rr
+			}
+
+			Convey("should put collections of existing voice messages", func() {
+				rr := serve("PUT", "news", `{"title":"News","language":"PL","items":[{"id":"latte","title":"Monday"}]}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldContainSubstring, `"items":[{"id":"latte","title":"Monday","added":`)
+				So(rr.Body.String(), ShouldContainSubstring, `"feedUrl":"http://localhost:3000/collections/news/feed.xml","playlistUrl":"http://localhost:3000/collections/news.m3u8"`)
+				So(store["news"].Items, ShouldHaveLength, 1)
+
+				rr = serve("PUT", "news", `{"title":"News","items":[{"id":"unknown"}]}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, `"details":["TTS with ID: 'unknown' doesn't exist"]`)
+
+				rr = serve("PUT", "news", `{"title":"","language":"XX","items":[]}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, `"details":["Title must not be empty","Unsupported Language: XX"]`)
+			})
+
+			Convey("should add items to collections", func() {
+				rr := serve("POST", "bulletins/items", `{"id":"mocha"}`)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(store["bulletins"].Items, ShouldHaveLength, 4)
+
+				So(serve("POST", "unknown/items", `{"id":"mocha"}`).Code, ShouldEqual, http.StatusNotFound)
+				So(serve("POST", "bulletins/items", `{"id":"unknown"}`).Code, ShouldEqual, http.StatusBadRequest)
+				So(serve("GET", "bulletins/items", "").Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+
+			Convey("should publish the ready voice messages in podcast feeds", func() {
+				rr := serve("GET", "bulletins/feed.xml", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/rss+xml; charset=utf-8")
+				body := rr.Body.String()
+				So(body, ShouldStartWith, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">`)
+				So(body, ShouldContainSubstring, "<title>Daily bulletins</title>")
+				So(body, ShouldContainSubstring, "<language>en</language>")
+				So(body, ShouldContainSubstring, "<itunes:author>ACME</itunes:author>")
+				So(strings.Count(body, "<item>"), ShouldEqual, 1)
+				So(body, ShouldContainSubstring, `<guid isPermaLink="false">latte</guid>`)
+				So(body, ShouldContainSubstring, "<pubDate>Fri, 12 May 2017 06:00:00 +0000</pubDate>")
+				So(body, ShouldContainSubstring, `<enclosure url="http://localhost:3000/collections/bulletins/media/latte" length="2987" type="audio/mpeg"></enclosure>`)
+				So(body, ShouldContainSubstring, "<itunes:duration>3</itunes:duration>")
+
+				//Podcast apps tell the episodes apart by their GUIDs and enclosures
+				So(serve("GET", "bulletins/feed.xml", "").Body.String(), ShouldEqual, body)
+			})
+
+			Convey("should publish the ready voice messages in playlists", func() {
+				rr := serve("GET", "bulletins.m3u8", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/vnd.apple.mpegurl")
+				So(rr.Body.String(), ShouldEqual, "#EXTM3U\n#EXTINF:2.736,coffee'h good\nhttp://localhost:3000/collections/bulletins/media/latte\n")
+			})
+
+			Convey("should serve the media of the ready voice messages of collections", func() {
+				rr := serve("GET", "bulletins/media/latte", "")
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, "audio")
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "audio/mpeg")
+
+				So(serve("GET", "bulletins/media/cafe", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("GET", "bulletins/media/mocha", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("GET", "unknown/media/latte", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("DELETE", "bulletins/media/latte", "").Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+
+			Convey("should let tenants change their own collections with their own voice messages only", func() {
+				tenant = "acme"
+
+				rr := serve("PUT", "news", `{"title":"News","items":[{"id":"latte"}]}`)
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				So(rr.Body.String(), ShouldContainSubstring, `"details":["TTS with ID: 'latte' doesn't exist"]`)
+
+				So(serve("PUT", "bulletins", `{"title":"Bulletins","items":[]}`).Code, ShouldEqual, http.StatusForbidden)
+				So(serve("DELETE", "bulletins", "").Code, ShouldEqual, http.StatusForbidden)
+
+				tenant = lexicon.DefaultTenant
+				So(serve("POST", "bulletins/items", `{"id":"mocha"}`).Code, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("should delete collections", func() {
+				So(serve("DELETE", "bulletins", "").Code, ShouldEqual, http.StatusNoContent)
+				So(serve("GET", "bulletins", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("GET", "bulletins/feed.xml", "").Code, ShouldEqual, http.StatusNotFound)
+			})
+
+			Convey("should reject invalid IDs and actions", func() {
+				So(serve("GET", "a%20b", "").Code, ShouldEqual, http.StatusBadRequest)
+				So(serve("GET", "bulletins/unknown", "").Code, ShouldEqual, http.StatusNotFound)
+				So(serve("POST", "bulletins.m3u8", "").Code, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+		})
+
+		Convey("when handling GET request on /voiceMessages/{ID}", func() {
+
+			Convey("should require ID value", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"Missing ID in request path"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should return result by ID", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/cafe", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				const expected = `{"id":"cafe","text":"coffee'h good","language":"EN","status":"PENDING"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should return detected language", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/auto", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				rr := httptest.NewRecorder()
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				const expected = `{"id":"auto","text":"Dzień dobry","language":"PL","detectedLanguage":"PL","detectionConfidence":0.97,"status":"PENDING"}` + "\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should return normalized text", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/mocha", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				const expected = `{"id":"mocha","text":"2 mochas","normalizedText":"two mochas","language":"EN","status":"PENDING"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should return the timing of the segments of dialogues", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/chat", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				const expected = `"segments":[{"speaker":"agent","text":"Hi","language":"EN","start":0,"end":800},` +
+					`{"speaker":"customer","text":"Cześć","language":"PL","pause":300,"start":1100,"end":2000}]`
+				So(rr.Body.String(), ShouldContainSubstring, expected)
+			})
+
+			Convey("should return 404 for non-existing TTS", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/tea", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+				const expected = `{"status":404,"message":"TTS with ID: 'tea' doesn't exist"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should return media info of ready TTS", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/latte", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				expected := `{"id":"latte","text":"coffee'h good","language":"EN","status":"READY","mediaUrl":"` + selfUrl + `/media/456?` + testSignature("456", time.Hour) + `",` +
+					`"media":{"mimeType":"audio/mpeg","codec":"mp3","sampleRate":8000,"channels":1,"duration":2736,"size":2987,"sha256":"cafe"}}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+		})
+
+		Convey("when handling GET request on /voiceMessages/{ID} with urlTtl", func() {
+
+			Convey("should sign media URL for the requested time", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/latte?urlTtl=60", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldContainSubstring, `/media/456?`+testSignature("456", time.Minute)+`"`)
+			})
+
+			Convey("should not sign media URL for longer than allowed", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/latte?urlTtl=31536000", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldContainSubstring, `/media/456?`+testSignature("456", 24*time.Hour)+`"`)
+			})
+
+			Convey("should validate urlTtl", func() {
+				req, err := http.NewRequest("GET", rootUrl+"/latte?urlTtl=forever", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusBadRequest)
+				const expected = `{"status":400,"message":"urlTtl must be a positive number of seconds: forever"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+		})
+
+		Convey("when handling GET request on /media/{ID}", func() {
+
+			Convey("should reject unsigned URL", func() {
+				req, err := http.NewRequest("GET", "/media/456", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusForbidden)
+				const expected = `{"status":403,"message":"Media URL must be signed"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should reject URL signed for another media", func() {
+				req, err := http.NewRequest("GET", "/media/457?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusForbidden)
+				const expected = `{"status":403,"message":"Invalid media URL signature"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should reject expired URL", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				signer := testSigner()
+				signer.now = func() time.Time { return testNow.Add(2 * time.Hour) }
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: signer})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusForbidden)
+				const expected = `{"status":403,"message":"Media URL has expired"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should return media with headers describing it", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
 				if err != nil {
 					t.Fatal(err)
 				}
-				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
 
 				mux.ServeHTTP(rr, req)
 
-				So(rr.Code, ShouldEqual, http.StatusAccepted)
-				const expected = `{"id":"abc123","text":"Received: abcdef","language":"EN","status":"PENDING"}` + "\n"
-				So(string(rr.Body.String()), ShouldEqual, expected)
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, "audio")
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "audio/mpeg")
+				So(rr.Header().Get("Content-Length"), ShouldEqual, "2987")
+				So(rr.Header().Get("ETag"), ShouldEqual, `"cafe"`)
+				So(rr.Header().Get("Digest"), ShouldEqual, "SHA-256=yv4=")
+				So(rr.Header().Get("X-Media-Duration"), ShouldEqual, "2.736")
+				So(rr.Header().Get("X-Media-Codec"), ShouldEqual, "mp3")
+				So(rr.Header().Get("X-Media-Sample-Rate"), ShouldEqual, "8000")
+				So(rr.Header().Get("X-Media-Channels"), ShouldEqual, "1")
 			})
 
-			Convey("should correctly return json with MediaUrl and correct Content-Type", func() {
+			Convey("should return 404 for non-existing media", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
 
-				//Encode JSON
-				u := CreateDTO{Text: "abcdef", Language: "EN"}
-				b := new(bytes.Buffer)
-				json.NewEncoder(b).Encode(u)
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{err: os.ErrNotExist}, SelfUrl: selfUrl, Signer: testSigner()})
 
-				//Prepare request
-				req, err := http.NewRequest("POST", rootUrl, b)
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusNotFound)
+				const expected = `{"status":404,"message":"Media with ID: '456' doesn't exist"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should report corrupted media", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
 				if err != nil {
 					t.Fatal(err)
 				}
-				req.Header.Set("Content-Type", "application/json")
 
 				mux := http.NewServeMux()
-				New(mux, getMockService("123", service.StatusReady), nil, selfUrl)
+				corrupted := tts.MediaCorruptedError{Id: "456", Message: "Media with ID: '456' is corrupted: checksum mismatch"}
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{err: corrupted}, SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
 
 				mux.ServeHTTP(rr, req)
 
-				So(rr.Code, ShouldEqual, http.StatusAccepted)
+				So(rr.Code, ShouldEqual, http.StatusServiceUnavailable)
 				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/json")
+				const expected = `{"status":503,"message":"Media with ID: '456' is corrupted: checksum mismatch. Create the voice message again to regenerate it"}` + "\n"
+				So(string(rr.Body.String()), ShouldEqual, expected)
+			})
+
+			Convey("should report corrupted media requested in another format", func() {
+				req, err := http.NewRequest("GET", "/media/456?format=flac&"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				corrupted := tts.MediaCorruptedError{Id: "456", Message: "Media with ID: '456' is corrupted: media is missing"}
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{err: corrupted}, SelfUrl: selfUrl, Signer: testSigner()})
 
-				const expected = `{"id":"abc123","text":"Received: abcdef","language":"EN","status":"READY","mediaUrl":"` + selfUrl + `/media/123"}` + "\n"
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusServiceUnavailable)
+				const expected = `{"status":503,"message":"Media with ID: '456' is corrupted: media is missing. Create the voice message again to regenerate it"}` + "\n"
 				So(string(rr.Body.String()), ShouldEqual, expected)
 			})
 
-		})
+			Convey("should transcode media to the format parameter", func() {
+				req, err := http.NewRequest("GET", "/media/456?format=flac&"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
 
-		Convey("when handling GET request on /voiceMessages/{ID}", func() {
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
 
-			Convey("should require ID value", func() {
-				req, err := http.NewRequest("GET", rootUrl+"/", nil)
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, "flac")
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "audio/flac")
+				So(rr.Header().Get("Vary"), ShouldEqual, "Accept")
+			})
+
+			Convey("should reject format the media can't be transcoded to", func() {
+				req, err := http.NewRequest("GET", "/media/456?format=aac&"+testSigner().sign("456", 0), nil)
 				if err != nil {
 					t.Fatal(err)
 				}
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
 
 				mux.ServeHTTP(rr, req)
 
-				So(rr.Code, ShouldEqual, http.StatusBadRequest)
-				const expected = `{"status":400,"message":"Missing ID in request path"}` + "\n"
+				So(rr.Code, ShouldEqual, http.StatusNotAcceptable)
+				const expected = `{"status":406,"message":"Media with ID: '456' can't be transcoded to aac"}` + "\n"
 				So(string(rr.Body.String()), ShouldEqual, expected)
 			})
 
-			Convey("should return result by ID", func() {
-				req, err := http.NewRequest("GET", rootUrl+"/cafe", nil)
+			Convey("should transcode media to the preferred accepted format", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
 				if err != nil {
 					t.Fatal(err)
 				}
+				req.Header.Set("Accept", "audio/mpeg;q=0.8, audio/flac, */*;q=0.1")
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -272,18 +1707,94 @@ func TestRestController(t *testing.T) {
 				mux.ServeHTTP(rr, req)
 
 				So(rr.Code, ShouldEqual, http.StatusOK)
-				const expected = `{"id":"cafe","text":"coffee'h good","language":"EN","status":"PENDING"}` + "\n"
-				So(string(rr.Body.String()), ShouldEqual, expected)
+				So(rr.Body.String(), ShouldEqual, "flac")
 			})
 
-			Convey("should return 404 for non-existing TTS", func() {
-				req, err := http.NewRequest("GET", rootUrl+"/tea", nil)
+			Convey("should serve stored format if the accepted one can't be produced", func() {
+				req, err := http.NewRequest("GET", "/media/456?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Accept", "audio/wav, audio/ogg;q=0.9, audio/*;q=0.5")
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Body.String(), ShouldEqual, "audio")
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "audio/mpeg")
+			})
+
+			Convey("should return WebVTT captions", func() {
+				req, err := http.NewRequest("GET", "/media/456.vtt?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "text/vtt; charset=utf-8")
+				const expected = "WEBVTT\n\n00:00:00.000 --> 00:00:00.800\nHi, all.\n\n00:00:01.400 --> 00:01:01.900\nHello!\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should return SRT captions", func() {
+				req, err := http.NewRequest("GET", "/media/456.srt?"+testSigner().sign("456", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusOK)
+				So(rr.Header().Get("Content-Type"), ShouldEqual, "application/x-subrip; charset=utf-8")
+				const expected = "1\n00:00:00,000 --> 00:00:00,800\nHi, all.\n\n2\n00:00:01,400 --> 00:01:01,900\nHello!\n"
+				So(rr.Body.String(), ShouldEqual, expected)
+			})
+
+			Convey("should reject captions URL signed for another media", func() {
+				req, err := http.NewRequest("GET", "/media/456.vtt?"+testSigner().sign("456.vtt", 0), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				mux := http.NewServeMux()
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{}, SelfUrl: selfUrl, Signer: testSigner()})
+
+				//Test the request
+				rr := httptest.NewRecorder()
+
+				mux.ServeHTTP(rr, req)
+
+				So(rr.Code, ShouldEqual, http.StatusForbidden)
+			})
+
+			Convey("should return 404 for media without captions", func() {
+				req, err := http.NewRequest("GET", "/media/456.srt?"+testSigner().sign("456", 0), nil)
 				if err != nil {
 					t.Fatal(err)
 				}
 
 				mux := http.NewServeMux()
-				New(mux, defaultMockService(), nil, selfUrl)
+				New(mux, Config{Service: defaultMockService(), Engine: mockEngine{err: os.ErrNotExist}, SelfUrl: selfUrl, Signer: testSigner()})
 
 				//Test the request
 				rr := httptest.NewRecorder()
@@ -291,14 +1802,31 @@ func TestRestController(t *testing.T) {
 				mux.ServeHTTP(rr, req)
 
 				So(rr.Code, ShouldEqual, http.StatusNotFound)
-				const expected = `{"status":404,"message":"TTS with ID: 'tea' doesn't exist"}` + "\n"
+				const expected = `{"status":404,"message":"Captions of media with ID: '456' don't exist"}` + "\n"
 				So(string(rr.Body.String()), ShouldEqual, expected)
 			})
-
 		})
 	})
 }
 
+// Signer with a fixed secret and clock
+var testNow = time.Unix(1500000000, 0)
+
+func testSigner() *UrlSigner {
+	return &UrlSigner{
+		secret: []byte("secret"),
+		ttl:    time.Hour,
+		maxTtl: 24 * time.Hour,
+		now:    func() time.Time { return testNow },
+	}
+}
+
+// Query string of the media URL signed by testSigner, as encoded in JSON
+func testSignature(mediaId string, ttl time.Duration) string {
+	expires := strconv.FormatInt(testNow.Add(ttl).Unix(), 10)
+	return "expires=" + expires + `\u0026signature=` + testSigner().signature(mediaId, expires)
+}
+
 // Mocks for service.TtsService
 func defaultMockService() service.TtsService {
 	return getMockService("", service.StatusPending)
@@ -314,16 +1842,40 @@ type mockService struct {
 }
 
 func (s mockService) Create(create *service.TtsCreate) (*service.TtsResult, error) {
+	switch create.Id {
+	case "denied":
+		return nil, service.IdError{Message: "ID can't be chosen"}
+	case "taken":
+		return nil, service.IdConflict(create.Id)
+	}
+
 	res := service.TtsResult{
 		Id:       "abc123",
 		Text:     "Received: " + create.Text,
+		Ssml:     create.Ssml,
+		Options:  create.Options,
 		Language: create.Language,
+		Mix:      create.Mix,
+		Segments: create.Segments,
+		Template: create.Template,
 		Status:   s.status,
 		MediaId:  s.mediaId,
 	}
 	return &res, nil
 }
 
+func (s mockService) Id(create *service.TtsCreate) (string, error) {
+	return "abc123", nil
+}
+
+func (s mockService) Capabilities() tts.Capabilities {
+	return tts.Capabilities{
+		Voices:  map[string][]string{"EN": {"Amy", "Mike"}, "PL": {"Zofia"}},
+		Formats: []string{"mp3", "wav"},
+		Rate:    &tts.Range{Min: -10, Max: 10},
+	}
+}
+
 func (s mockService) Get(id string) (*service.TtsResult, error) {
 
 	if id == "cafe" {
@@ -334,7 +1886,349 @@ func (s mockService) Get(id string) (*service.TtsResult, error) {
 			Status:   service.StatusPending,
 		}
 		return &res, nil
+	} else if id == "auto" {
+		res := service.TtsResult{
+			Id:                  id,
+			Text:                "Dzień dobry",
+			Language:            service.PL,
+			DetectedLanguage:    service.PL,
+			DetectionConfidence: 0.97,
+			Status:              service.StatusPending,
+		}
+		return &res, nil
+	} else if id == "mocha" {
+		res := service.TtsResult{
+			Id:             id,
+			Text:           "2 mochas",
+			NormalizedText: "two mochas",
+			Language:       service.EN,
+			Status:         service.StatusPending,
+		}
+		return &res, nil
+	} else if id == "chat" {
+		res := service.TtsResult{
+			Id:       id,
+			Text:     "Hi\nCześć",
+			Language: service.EN,
+			Segments: []service.Segment{
+				{Speaker: "agent", Text: "Hi", Language: service.EN, End: 800 * time.Millisecond},
+				{Speaker: "customer", Text: "Cześć", Language: service.PL, Pause: 300 * time.Millisecond, Start: 1100 * time.Millisecond, End: 2 * time.Second},
+			},
+			Status:  service.StatusReady,
+			MediaId: "789",
+		}
+		return &res, nil
+	} else if id == "latte" {
+		res := service.TtsResult{
+			Id:       id,
+			Text:     "coffee'h good",
+			Language: service.EN,
+			Status:   service.StatusReady,
+			MediaId:  "456",
+			Media:    testMediaInfo(),
+		}
+		return &res, nil
 	} else {
 		return nil, service.NotFound(id)
 	}
 }
+
+// Mock for web.LexiconStore, holding a single lexicon
+type mockLexicons struct {
+	entries []lexicon.Entry
+	version int
+	tenant  string //of the last call
+}
+
+func (l *mockLexicons) Get(tenant, language string) (lexicon.Lexicon, error) {
+	l.tenant = tenant
+	return lexicon.Lexicon{Tenant: tenant, Language: language, Version: l.version, Entries: l.entries}, nil
+}
+
+func (l *mockLexicons) Put(tenant, language string, entry lexicon.Entry) (lexicon.Lexicon, error) {
+	l.entries = append(l.entries, entry)
+	l.version++
+	return l.Get(tenant, language)
+}
+
+func (l *mockLexicons) Delete(tenant, language, grapheme string) (lexicon.Lexicon, error) {
+	lex, _ := l.Get(tenant, language)
+	if _, ok := lex.Lookup(grapheme); !ok {
+		return lex, lexicon.NotFound(grapheme)
+	}
+	l.entries = []lexicon.Entry{}
+	l.version++
+	return l.Get(tenant, language)
+}
+
+// Mock for web.AssetStore, keyed by tenant/name
+type mockAssets map[string]assets.Asset
+
+func (m mockAssets) List(tenant string) ([]assets.Asset, error) {
+	list := []assets.Asset{}
+	for _, a := range m {
+		if a.Tenant == tenant {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+func (m mockAssets) Get(tenant, name string) (assets.Asset, []byte, error) {
+	a, ok := m[tenant+"/"+name]
+	if !ok {
+		return a, nil, assets.NotFound(name)
+	}
+	return a, testWav(), nil
+}
+
+func (m mockAssets) Put(tenant, name string, content []byte) (assets.Asset, error) {
+	m[tenant+"/"+name] = testAsset(tenant, name)
+	return m[tenant+"/"+name], nil
+}
+
+func (m mockAssets) Delete(tenant, name string) error {
+	if _, ok := m[tenant+"/"+name]; !ok {
+		return assets.NotFound(name)
+	}
+	delete(m, tenant+"/"+name)
+	return nil
+}
+
+func testAsset(tenant, name string) assets.Asset {
+	return assets.Asset{Tenant: tenant, Name: name, Size: int64(len(testWav())), Checksum: "cafe"}
+}
+
+//Returns a WAV file with a single 16-bit mono sample
+func testWav() []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("RIFF")
+	binary.Write(b, binary.LittleEndian, uint32(38))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{uint32(16), uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)} {
+		binary.Write(b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(b, binary.LittleEndian, uint32(2))
+	binary.Write(b, binary.LittleEndian, int16(100))
+	return b.Bytes()
+}
+
+// Mock for web.TemplateStore, keyed by tenant/name
+type mockTemplates map[string]templates.Template
+
+func (m mockTemplates) List(tenant string) ([]templates.Template, error) {
+	list := []templates.Template{}
+	for _, t := range m {
+		if t.Tenant == tenant {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+func (m mockTemplates) Get(tenant, name string) (templates.Template, error) {
+	t, ok := m[tenant+"/"+name]
+	if !ok {
+		return t, templates.NotFound(name)
+	}
+	return t, nil
+}
+
+func (m mockTemplates) Put(t templates.Template) (templates.Template, error) {
+	t.Version = m[t.Tenant+"/"+t.Name].Version + 1
+	m[t.Tenant+"/"+t.Name] = t
+	return t, nil
+}
+
+func (m mockTemplates) Delete(tenant, name string) error {
+	if _, ok := m[tenant+"/"+name]; !ok {
+		return templates.NotFound(name)
+	}
+	delete(m, tenant+"/"+name)
+	return nil
+}
+
+// Mock for service.BatchService, its only batch "b1" has one voice message, pending for the first pendingGets
+type mockBatches struct {
+	created     []service.BatchCreate
+	pendingGets int
+}
+
+func (m *mockBatches) Create(items []service.BatchCreate) (*service.BatchResult, error) {
+	m.created = items
+	res := &service.BatchResult{Id: "b1", Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Status: service.BatchPending, Pending: 1}
+	for _, item := range items {
+		if item.Create == nil {
+			res.Rejected++
+			res.Items = append(res.Items, service.BatchItem{Problem: item.Problem, Details: item.Details})
+		} else {
+			res.Items = append(res.Items, service.BatchItem{Id: "abc123", Status: service.StatusPending})
+		}
+	}
+	return res, nil
+}
+
+func (m *mockBatches) Get(id string) (*service.BatchResult, error) {
+	if id != "b1" {
+		return nil, service.BatchNotFound(id)
+	}
+	if m.pendingGets > 0 {
+		m.pendingGets--
+		return &service.BatchResult{Id: id, Status: service.BatchPending, Pending: 1,
+			Items: []service.BatchItem{{Id: "abc123", Status: service.StatusPending}}}, nil
+	}
+	return &service.BatchResult{Id: id, Status: service.BatchDone, Ready: 1,
+		Items: []service.BatchItem{{Id: "abc123", Status: service.StatusReady}}}, nil
+}
+
+// Mock for web.CollectionStore, keyed by ID
+type mockCollections map[string]collections.Collection
+
+func (m mockCollections) Get(id string) (collections.Collection, error) {
+	c, ok := m[id]
+	if !ok {
+		return c, collections.NotFound(id)
+	}
+	return c, nil
+}
+
+func (m mockCollections) Put(c collections.Collection) (collections.Collection, error) {
+	if previous, ok := m[c.Id]; ok && previous.Tenant != c.Tenant {
+		return c, collections.OwnedBy(c.Id)
+	}
+	m[c.Id] = c
+	return c, nil
+}
+
+func (m mockCollections) Add(id, tenant string, item collections.Item) (collections.Collection, error) {
+	c, ok := m[id]
+	if !ok {
+		return c, collections.NotFound(id)
+	}
+	if c.Tenant != tenant {
+		return c, collections.OwnedBy(id)
+	}
+	c.Items = append(c.Items, item)
+	m[id] = c
+	return c, nil
+}
+
+func (m mockCollections) Delete(id, tenant string) error {
+	c, ok := m[id]
+	if !ok {
+		return collections.NotFound(id)
+	}
+	if c.Tenant != tenant {
+		return collections.OwnedBy(id)
+	}
+	delete(m, id)
+	return nil
+}
+
+// Mock for web.IdempotencyStore, keeping records by key
+type mockIdempotency map[string]idempotency.Record
+
+func (m mockIdempotency) Lock(key string) func() {
+	return func() {}
+}
+
+func (m mockIdempotency) Get(key string) (idempotency.Record, error) {
+	r, ok := m[key]
+	if !ok {
+		return r, idempotency.NotFoundError{Message: "Idempotency key not found"}
+	}
+	return r, nil
+}
+
+func (m mockIdempotency) Put(key string, r idempotency.Record) error {
+	m[key] = r
+	return nil
+}
+
+// Mock for web.MediaEngine
+type mockEngine struct {
+	err error //if not nil, returned from Result
+}
+
+func (e mockEngine) Result(mediaId string) (io.ReadCloser, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return ioutil.NopCloser(strings.NewReader("audio")), nil
+}
+
+func (e mockEngine) Info(mediaId string) (*tts.MediaInfo, error) {
+	return testMediaInfo(), nil
+}
+
+func (e mockEngine) Marks(mediaId string) ([]tts.Mark, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []tts.Mark{
+		{Type: tts.MarkSentence, Text: "Hi, all.", Start: 0, End: 700 * time.Millisecond},
+		{Type: tts.MarkWord, Text: "Hi,", Start: 0, End: 200 * time.Millisecond},
+		{Type: tts.MarkWord, Text: "all.", Start: 500 * time.Millisecond, End: 800 * time.Millisecond},
+		{Type: tts.MarkSentence, Text: "Hello!", Start: 1400 * time.Millisecond, End: 1900 * time.Millisecond},
+		{Type: tts.MarkWord, Text: "Hello!", Start: 1400 * time.Millisecond, End: 61900 * time.Millisecond},
+	}, nil
+}
+
+func (e mockEngine) Rendition(mediaId string, format string) (io.ReadCloser, *tts.MediaInfo, error) {
+	if e.err != nil {
+		return nil, nil, e.err
+	}
+	if format != "flac" {
+		return nil, nil, tts.FormatError{Id: mediaId, Format: format, Message: "Media with ID: '" + mediaId + "' can't be transcoded to " + format}
+	}
+	return ioutil.NopCloser(strings.NewReader("flac")), &tts.MediaInfo{MimeType: "audio/flac", Size: 4, Checksum: "cafe"}, nil
+}
+
+func testMediaInfo() *tts.MediaInfo {
+	return &tts.MediaInfo{
+		MimeType:   "audio/mpeg",
+		Codec:      "mp3",
+		SampleRate: 8000,
+		Channels:   1,
+		Duration:   2736 * time.Millisecond,
+		Size:       2987,
+		Checksum:   "cafe",
+	}
+}
+
+func TestCues(t *testing.T) {
+	Convey("Cues", t, func() {
+		Convey("should split long sentences to fit two lines", func() {
+			marks := []tts.Mark{}
+			for i := 0; i < 30; i++ {
+				start := time.Duration(i) * time.Second
+				marks = append(marks, tts.Mark{Type: tts.MarkWord, Text: "word", Start: start, End: start + 500*time.Millisecond})
+			}
+
+			result := cues(marks)
+
+			So(len(result), ShouldEqual, 2)
+			So(len(result[0].text), ShouldEqual, 84)
+			So(result[0].end, ShouldEqual, 16500*time.Millisecond)
+			So(result[1].start, ShouldEqual, 17*time.Second)
+		})
+
+		Convey("should skip words without text", func() {
+			marks := []tts.Mark{
+				{Type: tts.MarkWord, Text: "Hi", Start: 0, End: 200 * time.Millisecond},
+				{Type: tts.MarkWord, Text: "", Start: 200 * time.Millisecond, End: 300 * time.Millisecond},
+				{Type: tts.MarkWord, Text: " ", Start: 300 * time.Millisecond, End: 400 * time.Millisecond},
+				{Type: tts.MarkWord, Text: "all.", Start: 500 * time.Millisecond, End: 800 * time.Millisecond},
+			}
+
+			result := cues(marks)
+
+			So(result, ShouldResemble, []cue{{start: 0, end: 800 * time.Millisecond, text: "Hi all."}})
+		})
+
+		Convey("should format hours", func() {
+			So(timestamp(3723004*time.Millisecond, ","), ShouldEqual, "01:02:03,004")
+		})
+	})
+}
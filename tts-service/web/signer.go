@@ -0,0 +1,108 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+//Signs media URLs with an expiry time, so that media can't be downloaded by guessing its ID
+type UrlSigner struct {
+	secret []byte
+	ttl    time.Duration //Default URL lifetime
+	maxTtl time.Duration //Longest URL lifetime a client can ask for
+	now    func() time.Time
+}
+
+//Initializes the signer based on environment variables:
+//MEDIA_URL_SECRET - HMAC key. If not provided, a random one is used (URLs don't survive restarts then)
+//MEDIA_URL_TTL, MEDIA_URL_MAX_TTL - default and maximal URL lifetime, e.g. "15m"
+func NewUrlSigner() *UrlSigner {
+	secret := []byte(os.Getenv("MEDIA_URL_SECRET"))
+
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		log.Printf("MEDIA_URL_SECRET not provided. Using a random one, media URLs won't be valid after restart")
+	}
+
+	return &UrlSigner{
+		secret: secret,
+		ttl:    durationFromEnv("MEDIA_URL_TTL", defaultUrlTtl),
+		maxTtl: durationFromEnv("MEDIA_URL_MAX_TTL", defaultMaxUrlTtl),
+		now:    time.Now,
+	}
+}
+
+//Returns the query string authorizing access to the media for the given time.
+//Zero ttl means the default lifetime, longer ones are shortened to the maximal one.
+func (s *UrlSigner) sign(mediaId string, ttl time.Duration) string {
+	if ttl <= 0 {
+		ttl = s.ttl
+	}
+	if ttl > s.maxTtl {
+		ttl = s.maxTtl
+	}
+
+	expires := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+	return expiresParam + "=" + expires + "&" + signatureParam + "=" + s.signature(mediaId, expires)
+}
+
+//Checks the signature and expiry time of the media URL
+func (s *UrlSigner) verify(mediaId string, r *http.Request) error {
+	query := r.URL.Query()
+	expires := query.Get(expiresParam)
+	signature := query.Get(signatureParam)
+
+	if expires == "" || signature == "" {
+		return ErrorDTO{http.StatusForbidden, errUnsignedUrl, nil}
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.signature(mediaId, expires))) {
+		return ErrorDTO{http.StatusForbidden, errInvalidSignature, nil}
+	}
+
+	//The signature is valid, so expires is a number we've produced
+	expiresAt, _ := strconv.ParseInt(expires, 10, 64)
+	if s.now().Unix() > expiresAt {
+		return ErrorDTO{http.StatusForbidden, errExpiredUrl, nil}
+	}
+
+	return nil
+}
+
+func (s *UrlSigner) signature(mediaId string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(mediaId + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func durationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Invalid %s value: '%s'. Using %v", name, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
+
+const defaultUrlTtl = time.Hour
+const defaultMaxUrlTtl = 7 * 24 * time.Hour
+
+const expiresParam = "expires"
+const signatureParam = "signature"
+
+const errUnsignedUrl = "Media URL must be signed"
+const errInvalidSignature = "Invalid media URL signature"
+const errExpiredUrl = "Media URL has expired"
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/SAPHybrisGliwice/golang-part-2/tts-service/templates"
+)
+
+//Handles /templates/, /templates/{name} and /templates/{name}/render
+func onTemplateRequest(h templateHandling, w http.ResponseWriter, r *http.Request) {
+	tenant, err := readTenant(r)
+	if err != nil {
+		handleError(err, w, r)
+		return
+	}
+
+	name, action := strings.TrimPrefix(r.URL.Path, h.pathPrefix), ""
+	if i := strings.Index(name, "/"); i >= 0 {
+		name, action = name[:i], name[i+1:]
+	}
+
+	switch {
+	case name == "" && r.Method == "GET":
+		onListTemplatesRequest(h, tenant, w, r)
+	case name == "":
+		onMethodNotSupported([]string{"GET"}, w, r)
+	case !templates.ValidName(name):
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidTemplateName + name, nil}, w, r)
+	case action == renderAction && r.Method == "POST":
+		onRenderTemplateRequest(h, tenant, name, w, r)
+	case action == renderAction:
+		onMethodNotSupported([]string{"POST"}, w, r)
+	case action != "":
+		handleError(ErrorDTO{http.StatusNotFound, errUnknownTemplateAction + action, nil}, w, r)
+	case r.Method == "GET":
+		template, err := h.templates.Get(tenant, name)
+		sendTemplate(template, err, w, r)
+	case r.Method == "PUT":
+		onPutTemplateRequest(h, tenant, name, w, r)
+	case r.Method == "DELETE":
+		onDeleteTemplateRequest(h, tenant, name, w, r)
+	default:
+		onMethodNotSupported([]string{"GET", "PUT", "DELETE"}, w, r)
+	}
+}
+
+func onListTemplatesRequest(h templateHandling, tenant string, w http.ResponseWriter, r *http.Request) {
+	list, err := h.templates.List(tenant)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	dtos := []TemplateDTO{}
+	for _, t := range list {
+		dtos = append(dtos, toTemplateDTO(t))
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(dtos)
+}
+
+func onPutTemplateRequest(h templateHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto TemplateDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	//The template is identified by the path, and its version is increased by the store
+	template := templates.Template{Tenant: tenant, Name: name, Language: dto.Language, Text: dto.Text, Placeholders: dto.Placeholders}
+
+	details := template.Validate()
+	if !h.create.service.Capabilities().Supports(template.Language) {
+		details = append([]string{errUnsupportedLang + template.Language}, details...)
+	}
+
+	if len(details) > 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}, w, r)
+		return
+	}
+
+	stored, err := h.templates.Put(template)
+	sendTemplate(stored, err, w, r)
+}
+
+func onDeleteTemplateRequest(h templateHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	if err := h.templates.Delete(tenant, name); err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Renders the template with the variables and creates a voice message of it, the way POST /voiceMessages does
+func onRenderTemplateRequest(h templateHandling, tenant, name string, w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		handleError(ErrorDTO{http.StatusUnsupportedMediaType, errInvalidContentType, nil}, w, r)
+		return
+	}
+
+	var dto RenderDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		handleError(ErrorDTO{http.StatusBadRequest, errJsonParse + err.Error(), nil}, w, r)
+		return
+	}
+
+	template, err := h.templates.Get(tenant, name)
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	text, fragments, details := template.Render(dto.Variables)
+	if len(details) > 0 {
+		handleError(ErrorDTO{http.StatusBadRequest, errInvalidPayload, details}, w, r)
+		return
+	}
+
+	createDTO := CreateDTO{Text: text, Language: template.Language, Voice: dto.Voice, Rate: dto.Rate, Pitch: dto.Pitch, Volume: dto.Volume, Format: dto.Format, Mix: dto.Mix}
+
+	ttsCreate, validationErr := validateCreateDTO(&createDTO, h.create.service.Capabilities())
+	if validationErr != nil {
+		handleError(validationErr, w, r)
+		return
+	}
+
+	ttsCreate.Tenant = tenant
+	ttsCreate.Fragments = fragments
+	ttsCreate.Template = template.Name
+
+	createVoiceMessage(h.create, ttsCreate, w, r)
+}
+
+func sendTemplate(template templates.Template, err error, w http.ResponseWriter, r *http.Request) {
+	if err != nil {
+		handleError(convertError(err), w, r)
+		return
+	}
+
+	addJsonHeader(w)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(toTemplateDTO(template))
+}
+
+const renderAction = "render"
+
+const errInvalidTemplateName = "Template names must be 1-64 letters, digits, '-' or '_': "
+const errUnknownTemplateAction = "Unknown template action: "